@@ -0,0 +1,473 @@
+// Package audit is an append-only, hash-chained log of operations.
+//
+// Every record stores the hash of the record before it, and its own hash is
+// an HMAC of its contents including that link, with a key kept outside the
+// log. The sequence number and hash of the last record are kept, signed with
+// the same key, in a head file also outside the log. Editing, reordering or
+// removing a record, even the first or the last ones, breaks the chain or no
+// longer matches the head, and rewriting the chain takes the key: Verify
+// detects all of them. The log is split across files: records are appended
+// to audit.log, which is renamed to audit-<first seq>.log once it grows past
+// MaxSize. The chain continues across files.
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	currentFile = "audit.log"
+	// DefaultMaxSize is the size after which the current file is rotated.
+	DefaultMaxSize = 64 << 20
+	// keySize is the size of the keys made by LoadKey.
+	keySize = 32
+)
+
+// Record is a single audited operation.
+type Record struct {
+	Seq       uint64 `json:"seq"`
+	Time      int64  `json:"time"` // unix nanoseconds
+	User      string `json:"user"`
+	APIKey    string `json:"api_key,omitempty"` // ID of the API key used, if any
+	Namespace string `json:"namespace,omitempty"`
+	RPC       string `json:"rpc"`
+	Key       string `json:"key,omitempty"`
+	Outcome   string `json:"outcome"` // "OK" or the error returned
+	RequestID string `json:"request_id,omitempty"`
+	Prev      string `json:"prev"`
+	Hash      string `json:"hash"`
+}
+
+// sign returns the HMAC of b with key.
+func sign(key, b []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// computeHash signs the record with its Hash field cleared.
+func (r Record) computeHash(key []byte) string {
+	r.Hash = ""
+	b, _ := json.Marshal(r)
+	return sign(key, b)
+}
+
+// LoadKey reads the hex encoded key in the file at path. If there is none
+// and create is true, a random key is written to it.
+func LoadKey(path string, create bool) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString(hex.EncodeToString(key) + "\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return key, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) < 16 {
+		return nil, fmt.Errorf("%s: expected a hex encoded key of at least 16 bytes", path)
+	}
+	return key, nil
+}
+
+// head is the sequence number and hash of the last record.
+type head struct {
+	seq  uint64
+	hash string
+}
+
+// encode returns the head signed with key, always as many bytes long so
+// it can be overwritten in place.
+func (h head) encode(key []byte) []byte {
+	s := fmt.Sprintf("%020d %s", h.seq, h.hash)
+	return []byte(s + " " + sign(key, []byte(s)) + "\n")
+}
+
+// readHead reads the head in the file at path, nil if there is none yet.
+func readHead(path string, key []byte) (*head, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 3 || sign(key, []byte(fields[0]+" "+fields[1])) != fields[2] {
+		return nil, &TamperError{File: path, Line: 1, Reason: "head signature does not match"}
+	}
+	seq, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, &TamperError{File: path, Line: 1, Reason: "malformed head"}
+	}
+	return &head{seq: seq, hash: fields[1]}, nil
+}
+
+// file is the current file of a Log.
+type file interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// Log appends records to the audit files in a directory. It is safe for
+// concurrent use.
+type Log struct {
+	// MaxSize is the size in bytes after which the current file is rotated.
+	MaxSize int64
+
+	mu   sync.Mutex
+	dir  string
+	key  []byte
+	file file
+	head *os.File
+	size int64
+	seq  uint64
+	prev string
+}
+
+// Open opens the audit log in dir, creating it if needed, and resumes the
+// chain from the last record written. Records are signed with key, and the
+// head is kept in the file at headPath; both must be kept outside dir.
+func Open(dir string, key []byte, headPath string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	l := &Log{MaxSize: DefaultMaxSize, dir: dir, key: key}
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	// find the last record, the current file may be empty after a rotation
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastRecord(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.prev = last.Seq, last.Hash
+			break
+		}
+	}
+	h, err := readHead(headPath, key)
+	if err != nil {
+		return nil, err
+	}
+	if h != nil && h.seq > l.seq {
+		// records were removed from the end: the chain goes on after them,
+		// so Verify still reports the gap
+		l.seq, l.prev = h.seq, h.hash
+	}
+	if l.head, err = os.OpenFile(headPath, os.O_WRONLY|os.O_CREATE, 0600); err != nil {
+		return nil, err
+	}
+	if err := l.openCurrent(); err != nil {
+		l.head.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) openCurrent() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, currentFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Append assigns the next sequence number to r, links it to the previous
+// record and writes it.
+func (l *Log) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if r.Time == 0 {
+		r.Time = time.Now().UnixNano()
+	}
+	r.Seq = l.seq + 1
+	r.Prev = l.prev
+	r.Hash = r.computeHash(l.key)
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(b, '\n'))
+	if err != nil {
+		// a partial record would break the chain for every later one
+		if n > 0 && l.file.Truncate(l.size) != nil {
+			l.size += int64(n)
+		}
+		return err
+	}
+	l.size += int64(n)
+	l.seq, l.prev = r.Seq, r.Hash
+	if _, err := l.head.WriteAt(head{r.Seq, r.Hash}.encode(l.key), 0); err != nil {
+		return fmt.Errorf("record written, failed to update the head: %s", err)
+	}
+	if l.MaxSize > 0 && l.size >= l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("record written, failed to rotate: %s", err)
+		}
+	}
+	return nil
+}
+
+// rotate renames the current file after the first sequence number it holds
+// and starts a new one. If that fails, records are still appended to the
+// current file, which is rotated again on the next append.
+func (l *Log) rotate() error {
+	path := filepath.Join(l.dir, currentFile)
+	first, err := firstRecord(path)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	rotated := filepath.Join(l.dir, fmt.Sprintf("audit-%020d.log", first.Seq))
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	prev := l.file
+	if err := l.openCurrent(); err != nil {
+		// keep appending to the file, under its name
+		os.Rename(rotated, path)
+		return err
+	}
+	return prev.Close()
+}
+
+// Close flushes and closes the current file and the head.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := l.head.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// Filter selects records in Query. Zero fields match everything.
+type Filter struct {
+	User  string
+	Key   string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (f *Filter) match(r *Record) bool {
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.Key != "" && r.Key != f.Key {
+		return false
+	}
+	t := time.Unix(0, r.Time)
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !t.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Query returns the records matching f, oldest first. If f.Limit is set,
+// only the most recent f.Limit matches are returned.
+func (l *Log) Query(f Filter) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files, err := logFiles(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, path := range files {
+		err := readRecords(path, func(r *Record, _ int) error {
+			if f.match(r) {
+				records = append(records, *r)
+				if f.Limit > 0 && len(records) > f.Limit {
+					records = records[1:]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// TamperError describes where the chain is broken.
+type TamperError struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (e *TamperError) Error() string {
+	return fmt.Sprintf("audit log tampered: %s:%d: %s", e.File, e.Line, e.Reason)
+}
+
+// Verify checks the whole chain in dir against key and the head in the
+// file at headPath, and returns the number of records checked. A broken
+// chain is reported as a *TamperError.
+func Verify(dir string, key []byte, headPath string) (int, error) {
+	files, err := logFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	h, err := readHead(headPath, key)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	var seq uint64
+	var prev string
+	for _, path := range files {
+		err := readRecords(path, func(r *Record, line int) error {
+			fail := func(reason string) error {
+				return &TamperError{File: path, Line: line, Reason: reason}
+			}
+			// the chain starts at seq 1 with no previous hash, so records
+			// removed from its start are detected too
+			if r.Seq != seq+1 {
+				return fail(fmt.Sprintf("expected seq %d, found %d", seq+1, r.Seq))
+			}
+			if r.Prev != prev {
+				return fail("previous hash does not match")
+			}
+			if r.computeHash(key) != r.Hash {
+				return fail("record hash does not match its contents")
+			}
+			if h != nil && r.Seq == h.seq && r.Hash != h.hash {
+				return fail("record hash does not match the head")
+			}
+			count++
+			seq, prev = r.Seq, r.Hash
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+	// records after the head were written before a crash kept it from
+	// being updated, they are signed all the same
+	switch {
+	case h == nil && count > 0:
+		return count, &TamperError{File: headPath, Reason: "head is missing"}
+	case h != nil && seq < h.seq:
+		return count, &TamperError{File: headPath, Line: 1, Reason: fmt.Sprintf("expected records up to seq %d, found %d", h.seq, seq)}
+	}
+	return count, nil
+}
+
+// logFiles returns the rotated files in order, followed by the current file.
+func logFiles(dir string) ([]string, error) {
+	rotated, err := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	current := filepath.Join(dir, currentFile)
+	if _, err := os.Stat(current); err == nil {
+		rotated = append(rotated, current)
+	}
+	return rotated, nil
+}
+
+// readRecords calls fn for every record in the file at path.
+func readRecords(path string, fn func(r *Record, line int) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err == io.EOF && len(b) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(strings.TrimSpace(string(b))), &rec); err != nil {
+			return &TamperError{File: path, Line: line, Reason: "malformed record"}
+		}
+		if err := fn(&rec, line); err != nil {
+			return err
+		}
+	}
+}
+
+func firstRecord(path string) (*Record, error) {
+	var first *Record
+	err := readRecords(path, func(r *Record, _ int) error {
+		first = r
+		return io.EOF
+	})
+	if err == io.EOF {
+		err = nil
+	}
+	if err == nil && first == nil {
+		err = fmt.Errorf("%s is empty", path)
+	}
+	return first, err
+}
+
+func lastRecord(path string) (*Record, error) {
+	var last *Record
+	err := readRecords(path, func(r *Record, _ int) error {
+		last = r
+		return nil
+	})
+	return last, err
+}
@@ -0,0 +1,300 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// headOf returns the path of the head of the log in dir, outside it.
+func headOf(dir string) string {
+	return dir + ".head"
+}
+
+func removeLog(dir string) {
+	os.RemoveAll(dir)
+	os.Remove(headOf(dir))
+}
+
+func appendN(t *testing.T, l *Log, n int, user string) {
+	for i := 0; i < n; i++ {
+		err := l.Append(Record{User: user, Namespace: "ns", RPC: "/protobuf.KVS/Set", Key: "k", Outcome: "OK"})
+		if err != nil {
+			t.Fatalf("failed to append record: %s", err.Error())
+		}
+	}
+}
+
+func Test_AuditAppendVerify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, err := Open(dir, testKey, headOf(dir))
+	if err != nil {
+		t.Fatalf("failed to open audit log: %s", err.Error())
+	}
+	appendN(t, l, 10, "user")
+	l.Close()
+
+	// reopening continues the chain
+	l, err = Open(dir, testKey, headOf(dir))
+	if err != nil {
+		t.Fatalf("failed to reopen audit log: %s", err.Error())
+	}
+	appendN(t, l, 5, "admin")
+	l.Close()
+
+	n, err := Verify(dir, testKey, headOf(dir))
+	if err != nil {
+		t.Fatalf("valid audit log failed verification: %s", err.Error())
+	}
+	if n != 15 {
+		t.Fatalf("expected 15 records, verified %d", n)
+	}
+}
+
+func Test_AuditRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	l.MaxSize = 1024
+	appendN(t, l, 50, "user")
+	l.Close()
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if len(rotated) < 2 {
+		t.Fatalf("audit log not rotated, found %d rotated files", len(rotated))
+	}
+	if n, err := Verify(dir, testKey, headOf(dir)); err != nil || n != 50 {
+		t.Fatalf("rotated audit log failed verification: %d records, %v", n, err)
+	}
+
+	l, _ = Open(dir, testKey, headOf(dir))
+	defer l.Close()
+	records, err := l.Query(Filter{})
+	if err != nil || len(records) != 50 {
+		t.Fatalf("query across rotated files returned %d records, %v", len(records), err)
+	}
+	for i, r := range records {
+		if r.Seq != uint64(i+1) {
+			t.Fatalf("records out of order at %d: seq %d", i, r.Seq)
+		}
+	}
+}
+
+func Test_AuditQuery(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	defer l.Close()
+	start := time.Now()
+	l.Append(Record{User: "user", RPC: "/protobuf.KVS/Set", Key: "a", Outcome: "OK"})
+	l.Append(Record{User: "admin", RPC: "/protobuf.KVS/Set", Key: "b", Outcome: "OK"})
+	l.Append(Record{User: "user", RPC: "/protobuf.KVS/Get", Key: "b", Outcome: "OK"})
+	l.Append(Record{User: "user", RPC: "/protobuf.KVS/Unset", Key: "b", Outcome: "OK", Time: start.Add(time.Hour).UnixNano()})
+
+	if records, _ := l.Query(Filter{User: "user"}); len(records) != 3 {
+		t.Fatalf("user filter returned %d records", len(records))
+	}
+	if records, _ := l.Query(Filter{Key: "b"}); len(records) != 3 {
+		t.Fatalf("key filter returned %d records", len(records))
+	}
+	if records, _ := l.Query(Filter{User: "user", Key: "b", Until: start.Add(time.Minute)}); len(records) != 1 {
+		t.Fatalf("combined filter returned %d records", len(records))
+	}
+	if records, _ := l.Query(Filter{Since: start.Add(time.Minute)}); len(records) != 1 || records[0].RPC != "/protobuf.KVS/Unset" {
+		t.Fatalf("time filter returned %v", records)
+	}
+	if records, _ := l.Query(Filter{Limit: 2}); len(records) != 2 || records[1].Seq != 4 {
+		t.Fatalf("limit did not return the latest records: %v", records)
+	}
+}
+
+func Test_AuditDetectsTampering(t *testing.T) {
+	tamper := func(name string, edit func([][]byte) [][]byte) {
+		dir, _ := ioutil.TempDir("", "keev-audit")
+		defer removeLog(dir)
+		l, _ := Open(dir, testKey, headOf(dir))
+		appendN(t, l, 5, "user")
+		l.Close()
+
+		path := filepath.Join(dir, currentFile)
+		b, _ := ioutil.ReadFile(path)
+		lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+		lines = edit(lines)
+		ioutil.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600)
+
+		_, err := Verify(dir, testKey, headOf(dir))
+		if _, ok := err.(*TamperError); !ok {
+			t.Fatalf("%s: tampering not detected: %v", name, err)
+		}
+	}
+
+	tamper("edit", func(lines [][]byte) [][]byte {
+		lines[2] = bytes.Replace(lines[2], []byte(`"user":"user"`), []byte(`"user":"someone"`), 1)
+		return lines
+	})
+	tamper("remove", func(lines [][]byte) [][]byte {
+		return append(lines[:2], lines[3:]...)
+	})
+	tamper("remove first", func(lines [][]byte) [][]byte {
+		return lines[2:]
+	})
+	tamper("remove last", func(lines [][]byte) [][]byte {
+		return lines[:4]
+	})
+	tamper("rewrite", func(lines [][]byte) [][]byte {
+		// a whole new chain, without the key
+		var prev string
+		for i := range lines {
+			var r Record
+			json.Unmarshal(lines[i], &r)
+			r.User, r.Prev = "someone", prev
+			r.Hash = r.computeHash([]byte("not the key"))
+			lines[i], _ = json.Marshal(r)
+			prev = r.Hash
+		}
+		return lines
+	})
+	tamper("reorder", func(lines [][]byte) [][]byte {
+		lines[1], lines[2] = lines[2], lines[1]
+		return lines
+	})
+	tamper("garbage", func(lines [][]byte) [][]byte {
+		lines[3] = []byte("not json")
+		return lines
+	})
+}
+
+func Test_AuditDetectsRemovedFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	l.MaxSize = 1024
+	appendN(t, l, 50, "user")
+	l.Close()
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	sort.Strings(rotated)
+	os.Remove(rotated[0])
+	if _, err := Verify(dir, testKey, headOf(dir)); err == nil {
+		t.Fatalf("removing the oldest file not detected")
+	} else if _, ok := err.(*TamperError); !ok {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
+
+func Test_AuditRotationFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	defer l.Close()
+	l.MaxSize = 1024
+	// a directory in the way fails the rename
+	blocker := filepath.Join(dir, "audit-00000000000000000001.log")
+	os.MkdirAll(filepath.Join(blocker, "x"), 0700)
+	for i := 0; i < 20; i++ {
+		l.Append(Record{User: "user", RPC: "/protobuf.KVS/Set", Key: "k", Outcome: "OK"})
+	}
+	if err := l.Append(Record{User: "user", RPC: "/protobuf.KVS/Set", Outcome: "OK"}); err == nil {
+		t.Fatalf("expected the rotation to fail")
+	}
+
+	os.RemoveAll(blocker)
+	appendN(t, l, 1, "user")
+	if rotated, _ := filepath.Glob(filepath.Join(dir, "audit-*.log")); len(rotated) != 1 {
+		t.Fatalf("expected the rotation to be retried, found %d rotated files", len(rotated))
+	}
+	if n, err := Verify(dir, testKey, headOf(dir)); err != nil || n != 22 {
+		t.Fatalf("audit log failed verification: %d records, %v", n, err)
+	}
+}
+
+func Test_AuditHead(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	appendN(t, l, 5, "user")
+	l.Close()
+	// the last records are removed, then the log is written to again
+	path := filepath.Join(dir, currentFile)
+	b, _ := ioutil.ReadFile(path)
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	ioutil.WriteFile(path, bytes.Join(lines[:3], nil), 0600)
+	l, _ = Open(dir, testKey, headOf(dir))
+	appendN(t, l, 2, "user")
+	l.Close()
+	if n, err := Verify(dir, testKey, headOf(dir)); n != 3 || err == nil {
+		t.Fatalf("expected the gap to be detected after 3 records, got %d, %v", n, err)
+	}
+
+	// a head that is not signed with the key
+	b, _ = ioutil.ReadFile(headOf(dir))
+	ioutil.WriteFile(headOf(dir), bytes.Replace(b, []byte("00000000000000000007"), []byte("00000000000000000003"), 1), 0600)
+	if _, err := Verify(dir, testKey, headOf(dir)); err == nil {
+		t.Fatalf("forged head accepted")
+	}
+	os.Remove(headOf(dir))
+	if _, err := Verify(dir, testKey, headOf(dir)); err == nil {
+		t.Fatalf("missing head not detected")
+	}
+}
+
+// shortFile writes half of what it is given, then fails.
+type shortFile struct {
+	*os.File
+}
+
+func (f shortFile) Write(b []byte) (int, error) {
+	n, _ := f.File.Write(b[:len(b)/2])
+	return n, errors.New("disk full")
+}
+
+func Test_AuditPartialWrite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer removeLog(dir)
+
+	l, _ := Open(dir, testKey, headOf(dir))
+	defer l.Close()
+	appendN(t, l, 2, "user")
+	f := l.file
+	l.file = shortFile{f.(*os.File)}
+	if err := l.Append(Record{User: "user", RPC: "/protobuf.KVS/Set", Outcome: "OK"}); err == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	l.file = f
+	appendN(t, l, 2, "user")
+	if n, err := Verify(dir, testKey, headOf(dir)); err != nil || n != 4 {
+		t.Fatalf("expected the partial record to be removed, got %d records, %v", n, err)
+	}
+}
+
+func Test_AuditLoadKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-audit")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.key")
+
+	if _, err := LoadKey(path, false); err == nil {
+		t.Fatalf("expected a missing key to fail")
+	}
+	key, err := LoadKey(path, true)
+	if err != nil || len(key) != keySize {
+		t.Fatalf("failed to create a key: %v", err)
+	}
+	if again, err := LoadKey(path, true); err != nil || !bytes.Equal(again, key) {
+		t.Fatalf("expected the key to be read back, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations an API key can be restricted to.
+const (
+	OpRead  = "read"
+	OpWrite = "write"
+)
+
+// apiKeyPrefix marks keev API keys, which look like "keev_<id>_<secret>".
+const apiKeyPrefix = "keev_"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrExpiredAPIKey = errors.New("API key has expired")
+	ErrUnknownOp     = errors.New("unknown operation, expected read or write")
+)
+
+// APIKey is a credential for service accounts. It acts on behalf of Username,
+// optionally restricted to some namespaces and operations. Only a hash of the
+// secret is kept.
+type APIKey struct {
+	ID         string   `json:"id"`
+	Username   string   `json:"username"`
+	Hash       string   `json:"hash"`
+	Namespaces []string `json:"namespaces,omitempty"` // empty means all namespaces
+	Ops        []string `json:"ops,omitempty"`        // empty means all operations
+	ExpiresAt  int64    `json:"expires_at,omitempty"` // unix seconds, 0 means never
+	CreatedAt  int64    `json:"created_at"`
+	LastUsed   int64    `json:"last_used,omitempty"`
+}
+
+// Expired returns true if the key has an expiry that is before now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != 0 && now.Unix() >= k.ExpiresAt
+}
+
+// AllowsNamespace returns true if the key may be used within namespace.
+func (k *APIKey) AllowsNamespace(namespace string) bool {
+	return len(k.Namespaces) == 0 || contains(k.Namespaces, namespace)
+}
+
+// AllowsOp returns true if the key may perform op.
+func (k *APIKey) AllowsOp(op string) bool {
+	return len(k.Ops) == 0 || contains(k.Ops, op)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore stores API keys by ID. It is safe for concurrent use.
+type APIKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]*APIKey
+}
+
+// NewAPIKeyStore returns a new, empty APIKeyStore.
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{keys: make(map[string]*APIKey)}
+}
+
+// Load loads API keys from a reader, as written by Save.
+func (s *APIKeyStore) Load(r io.Reader) error {
+	var keys []*APIKey
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return nil
+}
+
+// Save writes all API keys to w.
+func (s *APIKeyStore) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.List())
+}
+
+// Create generates a new key for username. The returned secret is the only
+// copy of the full key and must be handed to the caller.
+func (s *APIKeyStore) Create(username string, namespaces, ops []string, expiresAt int64) (*APIKey, string, error) {
+	for _, op := range ops {
+		if op != OpRead && op != OpWrite {
+			return nil, "", ErrUnknownOp
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		ID:         id,
+		Username:   username,
+		Hash:       hashSecret(secret),
+		Namespaces: namespaces,
+		Ops:        ops,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now().Unix(),
+	}
+	s.mu.Lock()
+	s.keys[id] = key
+	s.mu.Unlock()
+	created := *key
+	return &created, apiKeyPrefix + id + "_" + secret, nil
+}
+
+// Revoke deletes a key, returning false if it does not exist.
+func (s *APIKeyStore) Revoke(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[id]
+	delete(s.keys, id)
+	return ok
+}
+
+// List returns a copy of every key, ordered by ID.
+func (s *APIKeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		c := *k
+		keys = append(keys, &c)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Check validates a full API key and records its use. It returns a copy of
+// the key so callers can check its scope.
+func (s *APIKeyStore) Check(apiKey string) (*APIKey, error) {
+	parts := strings.SplitN(strings.TrimPrefix(apiKey, apiKeyPrefix), "_", 2)
+	if !strings.HasPrefix(apiKey, apiKeyPrefix) || len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[parts[0]]
+	if !ok || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashSecret(parts[1]))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, ErrExpiredAPIKey
+	}
+	key.LastUsed = now.Unix()
+	used := *key
+	return &used, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_APIKeyCreateCheck(t *testing.T) {
+	store := NewAPIKeyStore()
+	key, secret, err := store.Create("batch", []string{"metrics"}, []string{OpRead}, 0)
+	if err != nil {
+		t.Fatalf("failed to create API key: %s", err.Error())
+	}
+	if strings.Contains(key.Hash, secret) || !strings.HasPrefix(secret, "keev_"+key.ID+"_") {
+		t.Fatalf("API key not generated correctly")
+	}
+
+	checked, err := store.Check(secret)
+	if err != nil {
+		t.Fatalf("valid API key rejected: %s", err.Error())
+	}
+	if checked.Username != "batch" || checked.LastUsed == 0 {
+		t.Fatalf("API key not checked correctly")
+	}
+	if !checked.AllowsNamespace("metrics") || checked.AllowsNamespace("other") {
+		t.Fatalf("API key namespaces not restricted correctly")
+	}
+	if !checked.AllowsOp(OpRead) || checked.AllowsOp(OpWrite) {
+		t.Fatalf("API key ops not restricted correctly")
+	}
+
+	if _, err := store.Check(secret + "x"); err != ErrInvalidAPIKey {
+		t.Fatalf("wrong API key accepted")
+	}
+	if _, err := store.Check("keev_" + key.ID); err != ErrInvalidAPIKey {
+		t.Fatalf("API key without secret accepted")
+	}
+
+	if !store.Revoke(key.ID) {
+		t.Fatalf("failed to revoke API key")
+	}
+	if _, err := store.Check(secret); err != ErrInvalidAPIKey {
+		t.Fatalf("revoked API key accepted")
+	}
+}
+
+func Test_APIKeyUnrestricted(t *testing.T) {
+	store := NewAPIKeyStore()
+	_, secret, err := store.Create("batch", nil, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to create API key: %s", err.Error())
+	}
+	key, err := store.Check(secret)
+	if err != nil {
+		t.Fatalf("valid API key rejected: %s", err.Error())
+	}
+	if !key.AllowsNamespace("anything") || !key.AllowsOp(OpWrite) {
+		t.Fatalf("unrestricted API key is restricted")
+	}
+
+	if _, _, err := store.Create("batch", nil, []string{"delete"}, 0); err != ErrUnknownOp {
+		t.Fatalf("unknown operation accepted")
+	}
+}
+
+func Test_APIKeyExpiry(t *testing.T) {
+	store := NewAPIKeyStore()
+	_, secret, _ := store.Create("batch", nil, nil, time.Now().Add(-time.Minute).Unix())
+	if _, err := store.Check(secret); err != ErrExpiredAPIKey {
+		t.Fatalf("expired API key accepted")
+	}
+}
+
+func Test_APIKeySaveLoad(t *testing.T) {
+	store := NewAPIKeyStore()
+	key, secret, _ := store.Create("batch", []string{"metrics"}, nil, 0)
+
+	var buf bytes.Buffer
+	if err := store.Save(&buf); err != nil {
+		t.Fatalf("failed to save API keys: %s", err.Error())
+	}
+	if strings.Contains(buf.String(), strings.TrimPrefix(secret, "keev_"+key.ID+"_")) {
+		t.Fatalf("API key secret saved in plaintext")
+	}
+
+	loaded := NewAPIKeyStore()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("failed to load API keys: %s", err.Error())
+	}
+	if _, err := loaded.Check(secret); err != nil {
+		t.Fatalf("loaded API key rejected: %s", err.Error())
+	}
+}
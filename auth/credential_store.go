@@ -4,7 +4,9 @@
 package auth
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -13,19 +15,54 @@ type Credential struct {
 	Username string   `json:"username,omitempty"`
 	Password string   `json:"password,omitempty"`
 	Perms    []string `json:"perms,omitempty"`
+	// Certificates lists client certificate identities (subject common name,
+	// DNS, email or URI SAN) that authenticate as this user.
+	Certificates []string `json:"certificates,omitempty"`
+	// RateLimit applies to all requests of this user, APIKeyRateLimit to
+	// each of the user's API keys on top of that.
+	RateLimit       RateLimit `json:"rate_limit,omitempty"`
+	APIKeyRateLimit RateLimit `json:"api_key_rate_limit,omitempty"`
+	// Quota limits all data of this user, NamespaceQuotas each namespace by
+	// name, with "*" applying to namespaces that are not listed.
+	Quota           Quota            `json:"quota,omitempty"`
+	NamespaceQuotas map[string]Quota `json:"namespace_quotas,omitempty"`
+}
+
+// RateLimit is a limit per second on the number of requests and the number of
+// request and response bytes. Zero means unlimited.
+type RateLimit struct {
+	Requests float64 `json:"requests,omitempty"`
+	Bytes    float64 `json:"bytes,omitempty"`
+}
+
+// Quota is a limit on the number of keys and the number of bytes of keys and
+// values stored. Zero means unlimited.
+type Quota struct {
+	Keys  int64 `json:"keys,omitempty"`
+	Bytes int64 `json:"bytes,omitempty"`
 }
 
 // CredentialsStore stores authentication and authorization information for all users.
 type CredentialsStore struct {
-	store map[string]string
-	perms map[string]map[string]bool
+	store     map[string]string
+	perms     map[string]map[string]bool
+	certs     map[string]string
+	limits    map[string]RateLimit
+	keyLimits map[string]RateLimit
+	quotas    map[string]Quota
+	nsQuotas  map[string]map[string]Quota
 }
 
 // NewCredentialsStore returns a new instance of a CredentialStore.
 func NewCredentialsStore() *CredentialsStore {
 	return &CredentialsStore{
-		store: make(map[string]string),
-		perms: make(map[string]map[string]bool),
+		store:     make(map[string]string),
+		perms:     make(map[string]map[string]bool),
+		certs:     make(map[string]string),
+		limits:    make(map[string]RateLimit),
+		keyLimits: make(map[string]RateLimit),
+		quotas:    make(map[string]Quota),
+		nsQuotas:  make(map[string]map[string]Quota),
 	}
 }
 
@@ -38,8 +75,8 @@ func (c *CredentialsStore) Load(r io.Reader) error {
 		return err
 	}
 
-	var cred Credential
 	for dec.More() {
+		var cred Credential
 		err := dec.Decode(&cred)
 		if err != nil {
 			return err
@@ -49,6 +86,13 @@ func (c *CredentialsStore) Load(r io.Reader) error {
 		for _, p := range cred.Perms {
 			c.perms[cred.Username][p] = true
 		}
+		for _, id := range cred.Certificates {
+			c.certs[id] = cred.Username
+		}
+		c.limits[cred.Username] = cred.RateLimit
+		c.keyLimits[cred.Username] = cred.APIKeyRateLimit
+		c.quotas[cred.Username] = cred.Quota
+		c.nsQuotas[cred.Username] = cred.NamespaceQuotas
 	}
 
 	// Read closing bracket.
@@ -60,10 +104,47 @@ func (c *CredentialsStore) Load(r io.Reader) error {
 	return nil
 }
 
+// Count returns the number of users.
+func (c *CredentialsStore) Count() int {
+	return len(c.store)
+}
+
+// String describes the store without revealing any credentials.
+func (c *CredentialsStore) String() string {
+	return fmt.Sprintf("CredentialsStore(%d users)", len(c.store))
+}
+
 // Check returns true if the password is correct for the given username.
 func (c *CredentialsStore) Check(username, password string) bool {
 	pw, ok := c.store[username]
-	return ok && password == pw
+	return ok && password != "" && password == pw
+}
+
+// Exists returns true if username is a known user.
+func (c *CredentialsStore) Exists(username string) bool {
+	_, ok := c.store[username]
+	return ok
+}
+
+// CheckCertificate returns the user a verified client certificate maps to.
+// The subject common name is tried first, then the DNS, email and URI SANs.
+// It does not verify the certificate chain, that is left to TLS.
+func (c *CredentialsStore) CheckCertificate(cert *x509.Certificate) (string, bool) {
+	ids := []string{cert.Subject.CommonName}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if username, ok := c.certs[id]; ok {
+			return username, true
+		}
+	}
+	return "", false
 }
 
 // HasPerm returns true if username has the given perm. It does not
@@ -78,3 +159,27 @@ func (c *CredentialsStore) HasPerm(username string, perm string) bool {
 	}
 	return true
 }
+
+// RateLimit returns the rate limit of username.
+func (c *CredentialsStore) RateLimit(username string) RateLimit {
+	return c.limits[username]
+}
+
+// APIKeyRateLimit returns the rate limit of each API key of username.
+func (c *CredentialsStore) APIKeyRateLimit(username string) RateLimit {
+	return c.keyLimits[username]
+}
+
+// Quota returns the quota on all data of username.
+func (c *CredentialsStore) Quota(username string) Quota {
+	return c.quotas[username]
+}
+
+// NamespaceQuota returns the quota on a namespace of username.
+func (c *CredentialsStore) NamespaceQuota(username, namespace string) Quota {
+	quotas := c.nsQuotas[username]
+	if q, ok := quotas[namespace]; ok {
+		return q
+	}
+	return quotas["*"]
+}
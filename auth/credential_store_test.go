@@ -2,6 +2,9 @@
 package auth
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -172,3 +175,105 @@ func Test_AuthPermsNilLoadSingle(t *testing.T) {
 		t.Fatalf("wrong has foo perm")
 	}
 }
+
+func Test_AuthCertificates(t *testing.T) {
+	const jsonStream = `
+        [
+            {
+                "username": "username1",
+                "password": "password1",
+                "certificates": ["client1", "spiffe://keev/batch"]
+            },
+            {
+                "username": "service1",
+                "certificates": ["service1.keev.internal"]
+            }
+        ]
+    `
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load certificate credentials: %s", err.Error())
+	}
+
+	cn := &x509.Certificate{Subject: pkix.Name{CommonName: "client1"}}
+	if username, ok := store.CheckCertificate(cn); !ok || username != "username1" {
+		t.Fatalf("common name not mapped correctly")
+	}
+
+	uri, _ := url.Parse("spiffe://keev/batch")
+	san := &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}, URIs: []*url.URL{uri}}
+	if username, ok := store.CheckCertificate(san); !ok || username != "username1" {
+		t.Fatalf("URI SAN not mapped correctly")
+	}
+
+	dns := &x509.Certificate{DNSNames: []string{"service1.keev.internal"}}
+	if username, ok := store.CheckCertificate(dns); !ok || username != "service1" {
+		t.Fatalf("DNS SAN not mapped correctly")
+	}
+
+	unknown := &x509.Certificate{Subject: pkix.Name{CommonName: "username1"}}
+	if _, ok := store.CheckCertificate(unknown); ok {
+		t.Fatalf("unmapped certificate accepted")
+	}
+
+	// certificate-only users cannot log in with an empty password
+	if check := store.Check("service1", ""); check {
+		t.Fatalf("certificate-only user accepted an empty password")
+	}
+}
+
+func Test_AuthRateLimitLoad(t *testing.T) {
+	const jsonStream = `
+        [
+            {"username": "username1", "password": "password1",
+             "rate_limit": {"requests": 100, "bytes": 1024},
+             "api_key_rate_limit": {"requests": 10}},
+            {"username": "username2", "password": "password2"}
+        ]
+    `
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load rate limits: %s", err.Error())
+	}
+
+	if l := store.RateLimit("username1"); l != (RateLimit{Requests: 100, Bytes: 1024}) {
+		t.Fatalf("rate limit not loaded correctly: %v", l)
+	}
+	if l := store.APIKeyRateLimit("username1"); l != (RateLimit{Requests: 10}) {
+		t.Fatalf("API key rate limit not loaded correctly: %v", l)
+	}
+	if l := store.RateLimit("username2"); l != (RateLimit{}) {
+		t.Fatalf("rate limit leaked into another user: %v", l)
+	}
+}
+
+func Test_AuthQuotaLoad(t *testing.T) {
+	const jsonStream = `
+        [
+            {"username": "username1", "password": "password1",
+             "quota": {"keys": 100, "bytes": 1024},
+             "namespace_quotas": {"*": {"keys": 10}, "big": {"keys": 50}}},
+            {"username": "username2", "password": "password2"}
+        ]
+    `
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load quotas: %s", err.Error())
+	}
+
+	if q := store.Quota("username1"); q != (Quota{Keys: 100, Bytes: 1024}) {
+		t.Fatalf("quota not loaded correctly: %v", q)
+	}
+	if q := store.NamespaceQuota("username1", "big"); q != (Quota{Keys: 50}) {
+		t.Fatalf("namespace quota not loaded correctly: %v", q)
+	}
+	if q := store.NamespaceQuota("username1", "other"); q != (Quota{Keys: 10}) {
+		t.Fatalf("default namespace quota not applied: %v", q)
+	}
+	if q := store.NamespaceQuota("username2", "other"); q != (Quota{}) {
+		t.Fatalf("namespace quota leaked into another user: %v", q)
+	}
+}
@@ -2,121 +2,451 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/imjching/keev/keevclient"
 	pb "github.com/imjching/keev/protobuf"
 	"golang.org/x/net/context"
-	"google.golang.org/grpc/metadata"
 )
 
-var token string = ""
-
-func currentCtx() context.Context {
-	if token == "" {
-		return context.Background()
-	}
-	md := metadata.Pairs("token", token)
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
-	return ctx
-}
-
 // Inserts a key-value pair into a namespace, if not present
-func Set(client pb.KVSClient, key, value string) {
-	resp, err := client.Set(currentCtx(), &pb.KeyValuePair{Key: key, Value: value})
-	if err != nil {
+func Set(client *keevclient.Client, key, value string, ttl time.Duration) {
+	if err := client.Set(context.Background(), key, value, ttl); err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Println(resp.Value)
+	fmt.Println("(1 pair(s) affected)")
 }
 
 // Updates a key-value pair in a namespace, if present
-func Update(client pb.KVSClient, key, value string) {
-	resp, err := client.Update(currentCtx(), &pb.KeyValuePair{Key: key, Value: value})
-	if err != nil {
+func Update(client *keevclient.Client, key, value string, ttl time.Duration) {
+	if err := client.Update(context.Background(), key, value, ttl); err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Println(resp.Value)
+	fmt.Println("(1 pair(s) affected)")
 }
 
 // Checks if a key is in a namespace
-func Has(client pb.KVSClient, key string) {
-	resp, err := client.Has(currentCtx(), &pb.Key{Key: key})
+func Has(client *keevclient.Client, key string) {
+	found, err := client.Has(context.Background(), key)
 	if err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Println(resp.Value)
+	if !found {
+		fmt.Println("(0 pair(s) found)")
+		return
+	}
+	fmt.Println("(1 pair(s) found)")
 }
 
 // Removes a key in a namespace, if present
-func Unset(client pb.KVSClient, key string) {
-	resp, err := client.Unset(currentCtx(), &pb.Key{Key: key})
+func Unset(client *keevclient.Client, key string) {
+	value, err := client.Unset(context.Background(), key)
 	if err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Println("Removed entry: Key:", resp.Key, "Value:", resp.Value)
+	fmt.Println("Removed entry: Key:", key, "Value:", value)
 }
 
 // Retrieves an element from a namespace under given key
-func Get(client pb.KVSClient, key string) {
-	resp, err := client.Get(currentCtx(), &pb.Key{Key: key})
+func Get(client *keevclient.Client, key string) {
+	resp, err := client.Get(context.Background(), key)
 	if err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Println("Key:", resp.Key, ", Value:", resp.Value)
+	if resp.TTL > 0 {
+		fmt.Println("Key:", resp.Key, ", Value:", resp.Value, ", TTL:", resp.TTL)
+	} else {
+		fmt.Println("Key:", resp.Key, ", Value:", resp.Value)
+	}
+	// values written concurrently at other sites
+	for _, s := range resp.Siblings {
+		fmt.Printf("  Sibling from site %s: %s\r\n", s.Site, s.Value)
+	}
 }
 
 // Returns the total number of key-value pairs in a namespace
-func Count(client pb.KVSClient) {
-	resp, err := client.Count(currentCtx(), &google_protobuf.Empty{})
+func Count(client *keevclient.Client) {
+	count, err := client.Count(context.Background())
 	if err != nil {
 		fmt.Println("ERROR: ", err)
 		return
 	}
-	fmt.Printf("Found %d key-value pair(s)\r\n", resp.Count)
+	fmt.Printf("Found %d key-value pair(s)\r\n", count)
 }
 
-func Show(client pb.KVSClient, key string) {
+func Show(client *keevclient.Client, key string) {
 	switch key {
 	case "keys": // Retrieve all keys in a namespace
-		resp, err := client.ShowKeys(currentCtx(), &google_protobuf.Empty{})
+		keys, err := client.Keys(context.Background())
 		if err != nil {
 			fmt.Println("ERROR: ", err)
 			return
 		}
-		fmt.Println("Keys:", resp.Keys)
+		fmt.Println("Keys:", keys)
 	case "data": // Retrieve all key-value pairs in a namespace
-		resp, err := client.ShowData(currentCtx(), &google_protobuf.Empty{})
+		entries, err := client.Data(context.Background())
 		if err != nil {
 			fmt.Println("ERROR: ", err)
 			return
 		}
-		fmt.Println("Data:", resp.Data)
+		pairs := make([]string, len(entries))
+		for i, e := range entries {
+			pairs[i] = e.Key + "=" + e.Value
+		}
+		fmt.Println("Data:", pairs)
 	case "namespaces": // Retrieve all namespaces in the key-value store that belongs to the user
-		resp, err := client.ShowNamespaces(currentCtx(), &google_protobuf.Empty{})
+		namespaces, err := client.Namespaces(context.Background())
 		if err != nil {
 			fmt.Println("ERROR: ", err)
 			return
 		}
-		fmt.Println("Namespaces:", resp.Namespaces)
+		fmt.Println("Namespaces:", namespaces)
 	default:
 		fmt.Println("ERROR:  syntax error. use \"show [keys|data|namespaces]\"")
 	}
 }
 
-// Changes the current namespace, returns a token that must be used for subsequent requests
+// Changes the current namespace, returns it if it could be used
 // NOTE: No token needed
-func UseNamespace(client pb.KVSClient, namespace string) string {
-	resp, err := client.UseNamespace(currentCtx(), &pb.Namespace{Namespace: namespace})
-	if err != nil {
+func UseNamespace(client *keevclient.Client, namespace string) string {
+	if err := client.Use(context.Background(), namespace); err != nil {
 		fmt.Println("ERROR: ", err)
 		return ""
 	}
-
-	token = resp.Token
 	return namespace
 }
+
+// Creates an API key for a user and prints the full key
+// NOTE: Admin only
+func CreateAPIKey(client *keevclient.Client, username string, namespaces, ops []string, expiresAt int64) {
+	resp, err := client.CreateAPIKey(context.Background(), &pb.APIKeyRequest{
+		Username:   username,
+		Namespaces: namespaces,
+		Ops:        ops,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Println("Created API key", resp.Id, "for", resp.Username)
+	fmt.Println("Key:", resp.Key, "(it will not be shown again)")
+}
+
+// Revokes an API key
+// NOTE: Admin only
+func RevokeAPIKey(client *keevclient.Client, id string) {
+	msg, err := client.RevokeAPIKey(context.Background(), id)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Println(msg)
+}
+
+// Lists all API keys
+// NOTE: Admin only
+func ListAPIKeys(client *keevclient.Client) {
+	keys, err := client.ListAPIKeys(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	for _, k := range keys {
+		fmt.Printf("%s user=%s namespaces=%s ops=%s expires=%s last_used=%s\r\n", k.Id, k.Username,
+			listOrAll(k.Namespaces), listOrAll(k.Ops), formatUnix(k.ExpiresAt, "never"), formatUnix(k.LastUsed, "never"))
+	}
+	fmt.Printf("(%d key(s))\r\n", len(keys))
+}
+
+func listOrAll(list []string) string {
+	if len(list) == 0 {
+		return "*"
+	}
+	return strings.Join(list, ",")
+}
+
+func formatUnix(sec int64, zero string) string {
+	if sec == 0 {
+		return zero
+	}
+	return time.Unix(sec, 0).Format(time.RFC3339)
+}
+
+// Prints audit records matching a query
+// NOTE: Admin only
+func QueryAudit(client *keevclient.Client, query *pb.AuditQuery) {
+	records, err := client.QueryAudit(context.Background(), query)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	for _, r := range records {
+		user := r.User
+		if r.ApiKey != "" {
+			user += " (key " + r.ApiKey + ")"
+		}
+		fmt.Printf("#%d %s user=%s namespace=%s rpc=%s key=%s outcome=%s\r\n", r.Seq,
+			time.Unix(0, r.Time).Format(time.RFC3339), user, r.Namespace, r.Rpc, r.Key, r.Outcome)
+	}
+	fmt.Printf("(%d record(s))\r\n", len(records))
+}
+
+// Prints server statistics
+// NOTE: Admin only
+func Stats(client *keevclient.Client) {
+	resp, err := client.Stats(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	m := resp.Memory
+	fmt.Printf("Memory: used=%d max=%s policy=%s evicted=%d expired=%d\r\n", m.UsedBytes,
+		formatQuota(m.MaxBytes), m.EvictionPolicy, m.Evicted, m.Expired)
+	fmt.Println("Rate limits:\r")
+	for _, r := range resp.RateLimits {
+		fmt.Printf("  %s requests/s=%s bytes/s=%s allowed=%d throttled=%d bytes=%d\r\n", r.Id,
+			formatLimit(r.RequestsLimit), formatLimit(r.BytesLimit), r.Allowed, r.Throttled, r.Bytes)
+	}
+}
+
+// Rewrites the data on disk with the active encryption key
+// NOTE: Admin only
+func Reencrypt(client *keevclient.Client) {
+	msg, err := client.Reencrypt(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Println(msg)
+}
+
+// Prints the state of the cluster as the node sees it, with the lag of every
+// node when asked to the leader
+// NOTE: Admin only
+func ClusterStatus(client *keevclient.Client) {
+	resp, err := client.ClusterStatus(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Printf("Node: %s (%s) term=%d leader=%s %s\r\n", resp.Id, resp.State, resp.Term, resp.Leader, resp.LeaderAddr)
+	fmt.Printf("Log: last=%d commit=%d applied=%d snapshot=%d\r\n", resp.LastIndex, resp.CommitIndex, resp.AppliedIndex, resp.SnapshotIndex)
+	fmt.Println("Members:\r")
+	for _, m := range resp.Members {
+		role := "voter"
+		if m.Learner {
+			role = "learner"
+		}
+		if resp.State != "leader" {
+			fmt.Printf("  %s %s %s\r\n", m.Id, m.Addr, role)
+			continue
+		}
+		fmt.Printf("  %s %s %s match=%d lag=%d acked=%s\r\n", m.Id, m.Addr, role, m.MatchIndex, m.Lag, formatAgo(m.LastAckMs))
+	}
+}
+
+// Changes the members of the cluster: "add", "promote", "remove" or
+// "transfer" leadership
+// NOTE: Admin only
+func ChangeMember(client *keevclient.Client, change string, in *pb.MemberRequest) {
+	var msg string
+	var err error
+	switch change {
+	case "add":
+		msg, err = client.AddMember(context.Background(), in.Id, in.Addr, in.Learner)
+	case "promote":
+		msg, err = client.PromoteMember(context.Background(), in.Id)
+	case "remove":
+		msg, err = client.RemoveMember(context.Background(), in.Id)
+	case "transfer":
+		msg, err = client.TransferLeadership(context.Background(), in.Id)
+	}
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Println(msg)
+}
+
+// Prints the role of the server in primary-replica replication, with the
+// lag of a replica or of every replica following a primary
+// NOTE: Admin only
+func ReplicationStatus(client *keevclient.Client) {
+	resp, err := client.ReplicationStatus(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	if resp.Role == "primary" {
+		fmt.Printf("Primary: revision=%d history=%s\r\n", resp.Revision, resp.History)
+		fmt.Println("Replicas:\r")
+		for _, r := range resp.Replicas {
+			fmt.Printf("  %s revision=%d lag=%d acked=%s\r\n", r.Addr, r.Revision, r.Lag, formatAgo(r.LastAckMs))
+		}
+		return
+	}
+	state := "disconnected"
+	if resp.Connected {
+		state = "connected"
+	}
+	fmt.Printf("Replica of %s (%s): revision=%d primary=%d lag=%d synced=%s\r\n", resp.Primary, state,
+		resp.Revision, resp.PrimaryRevision, resp.Lag, formatAgo(resp.StalenessMs))
+}
+
+// Prints the sites the server exchanges writes with and how far behind each of them it is
+// NOTE: Admin only
+func SiteStatus(client *keevclient.Client) {
+	resp, err := client.SiteStatus(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Printf("Site: %s conflicts=%s revision=%d hlc=%d\r\n", resp.Id, resp.Conflicts, resp.Revision, resp.Hlc)
+	fmt.Println("Sites:\r")
+	for _, p := range resp.Peers {
+		state := "disconnected"
+		if p.Connected {
+			state = "connected"
+		}
+		fmt.Printf("  %s %s (%s): revision=%d site=%d lag=%d synced=%s conflicts=%d\r\n", p.Id, p.Addr, state,
+			p.Revision, p.SiteRevision, p.Lag, formatAgo(p.StalenessMs), p.Conflicts)
+	}
+}
+
+// Prints the shard map of the server and the keys it is moving
+// NOTE: Admin only
+func ShardStatus(client *keevclient.Client) {
+	resp, err := client.ShardStatus(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	state := "idle"
+	if resp.Rebalancing {
+		state = "rebalancing"
+	}
+	fmt.Printf("Shard: %s (%s) version=%d moved=%d\r\n", resp.Id, state, resp.Map.Version, resp.Moved)
+	if len(resp.Pending) > 0 {
+		fmt.Printf("Receiving keys from: %s\r\n", strings.Join(resp.Pending, ", "))
+	}
+	fmt.Println("Shards:\r")
+	for _, n := range resp.Map.Nodes {
+		fmt.Printf("  %s %s\r\n", n.Id, n.Addr)
+	}
+}
+
+// Adds a server to the shard map, or removes one
+// NOTE: Admin only
+func ChangeShard(client *keevclient.Client, change string, in *pb.ShardNode) {
+	var msg string
+	var err error
+	switch change {
+	case "add":
+		msg, err = client.AddShard(context.Background(), in.Id, in.Addr)
+	case "remove":
+		msg, err = client.RemoveShard(context.Background(), in.Id)
+	}
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Println(msg)
+}
+
+// formatAgo formats milliseconds elapsed, -1 for never.
+func formatAgo(ms int64) string {
+	if ms < 0 {
+		return "never"
+	}
+	return (time.Duration(ms) * time.Millisecond).String() + " ago"
+}
+
+// Saves a snapshot of the store, a user or a namespace to a local file
+// NOTE: Admin only
+func Backup(client *keevclient.Client, path, username, namespace string) {
+	// write to a temporary file, so a failed backup never looks complete
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	size, err := client.Backup(context.Background(), file, username, namespace)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	fmt.Printf("(backup of %d bytes written to %s)\r\n", size, path)
+}
+
+// Replaces the store, a user or a namespace with a backup read from a local file
+// NOTE: Admin only
+func Restore(client *keevclient.Client, path, username, namespace string, dryRun bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	defer file.Close()
+	resp, err := client.Restore(context.Background(), file, username, namespace, dryRun)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	if resp.DryRun {
+		fmt.Printf("(backup is valid: %d key(s) would be restored, %d removed)\r\n", resp.Keys, resp.Removed)
+		return
+	}
+	fmt.Printf("(%d key(s) restored, %d removed)\r\n", resp.Keys, resp.Removed)
+}
+
+func formatLimit(limit float64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(limit, 'g', -1, 64)
+}
+
+// Prints the storage used by a user and their namespaces
+// NOTE: Only admins may query other users
+func Usage(client *keevclient.Client, username string) {
+	resp, err := client.Usage(context.Background(), username)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return
+	}
+	printUsage("total", resp.Total)
+	for _, u := range resp.Namespaces {
+		printUsage(u.Namespace, u)
+	}
+}
+
+func printUsage(name string, u *pb.QuotaUsage) {
+	fmt.Printf("%s: keys=%d/%s bytes=%d/%s\r\n", name, u.Keys, formatQuota(u.MaxKeys), u.Bytes, formatQuota(u.MaxBytes))
+}
+
+func formatQuota(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
@@ -1,17 +1,20 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/carmark/pseudo-terminal-go/terminal"
+	"github.com/imjching/keev/keevclient"
 	pb "github.com/imjching/keev/protobuf"
-	"golang.org/x/net/context"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -20,27 +23,19 @@ const (
 
 var username = flag.String("username", "", "Username")
 var password = flag.String("password", "", "Password")
-
-type loginCreds struct {
-	Username, Password string
-}
-
-func (c *loginCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
-	return map[string]string{
-		"username": c.Username,
-		"password": c.Password,
-	}, nil
-}
-
-func (c *loginCreds) RequireTransportSecurity() bool {
-	return true
-}
+var certFile = flag.String("cert", "", "Client certificate, authenticates instead of username and password")
+var keyFile = flag.String("key", "", "Private key for --cert")
+var apiKey = flag.String("api-key", "", "API key, authenticates instead of username and password")
+var failover = flag.String("failover", "", "Other servers to send requests to when the server cannot serve them, as host:port,...")
+var timeout = flag.Duration("timeout", 10*time.Second, "How long a request waits for the server before it is retried or fails")
 
 func printHelpMessage() {
 	fmt.Println(`Usage: COMMAND [command-specific-options]
 
-    set [key] [value]    # sets a key-value pair if not present
-    update [key] [value] # updates a key-value pair if present
+    set [key] [value] [ttl]
+                         # sets a key-value pair if not present, expiring after ttl (e.g. "30s")
+    update [key] [value] [ttl]
+                         # updates a key-value pair if present, expiring after ttl
     has [key]            # determines if key is present
     unset [key]          # remove key from store
     get [key]            # retrieve key from store
@@ -49,10 +44,41 @@ func printHelpMessage() {
     show data            # show all key-value pairs in store
     show namespaces      # show all namespaces in store
     use [namespace]      # select a namespace
+    usage                # show keys and bytes stored, with their quotas
+    consistency [linearizable|lease|bounded|local] [max-staleness]
+                         # choose how fresh reads from a cluster must be, e.g. "consistency bounded 2s"
+
+  Admin commands:
+    apikey create [username] [namespaces|*] [read,write|*] [expiry|never]
+                         # create an API key, e.g. "apikey create batch metrics read 720h"
+    apikey revoke [id]   # revoke an API key
+    apikey list          # list API keys
+    audit [user=..] [key=..] [since=..] [limit=..]
+                         # show audit records, e.g. "audit user=batch since=24h limit=50"
+    stats                # show server statistics
+    reencrypt            # reload the encryption keys and rewrite the data with the active key
+    backup [file] [username] [namespace]
+                         # save a snapshot of the store, a user or a namespace to a local file
+    restore [file] [username] [namespace] [--dry-run]
+                         # replace the store, a user or a namespace with a backup
+    usage [username]     # show keys and bytes stored by a user
+    cluster status       # show the term, leader, log indexes and, on the leader, the lag of every node
+    cluster add [id] [host:port] [--learner]
+                         # add a node started with --cluster-join, as a voter once it caught up
+    cluster promote [id] # make a learner a voter once it caught up
+    cluster remove [id]  # remove a node from the cluster
+    cluster transfer [id]
+                         # hand leadership over to a voter
+    replication status   # show the lag of a replica, or of every replica of a primary
+    shard status         # show the shard map and the keys moving to or from the server
+    shard add [id] [host:port]
+                         # add a shard started with --shard-id, the keys it now holds move to it
+    shard remove [id]    # remove a shard, its keys move to the others
+    site status          # show the other sites and how far behind each of them the server is
 	`)
 }
 
-func handleCommand(client pb.KVSClient, term *terminal.Terminal, command []string) bool {
+func handleCommand(client *keevclient.Client, term *terminal.Terminal, command []string) bool {
 	if len(command) == 0 {
 		printHelpMessage()
 		// fmt.Println("ERROR:  available options: set, update, has, unset, get, count, show, use")
@@ -64,17 +90,25 @@ func handleCommand(client pb.KVSClient, term *terminal.Terminal, command []strin
 	case "help":
 		printHelpMessage()
 	case "set":
-		if len(command) != 3 {
-			fmt.Println("ERROR:  syntax error. use \"put [key] [value]\"")
+		if len(command) != 3 && len(command) != 4 {
+			fmt.Println("ERROR:  syntax error. use \"set [key] [value] [ttl]\"")
+			break
+		}
+		ttl, ok := parseTTL(command[3:])
+		if !ok {
 			break
 		}
-		Set(client, command[1], command[2])
+		Set(client, command[1], command[2], ttl)
 	case "update":
-		if len(command) != 3 {
-			fmt.Println("ERROR:  syntax error. use \"update [key] [value]\"")
+		if len(command) != 3 && len(command) != 4 {
+			fmt.Println("ERROR:  syntax error. use \"update [key] [value] [ttl]\"")
 			break
 		}
-		Update(client, command[1], command[2])
+		ttl, ok := parseTTL(command[3:])
+		if !ok {
+			break
+		}
+		Update(client, command[1], command[2], ttl)
 	case "has":
 		if len(command) != 2 {
 			// TODO: implement smart guessing?
@@ -113,33 +147,284 @@ func handleCommand(client pb.KVSClient, term *terminal.Terminal, command []strin
 		if str != "" {
 			term.SetPrompt(*username + "@" + str + " > ")
 		}
+	case "consistency":
+		handleConsistencyCommand(client, command[1:])
+	case "apikey":
+		handleAPIKeyCommand(client, command[1:])
+	case "audit":
+		handleAuditCommand(client, command[1:])
+	case "cluster":
+		handleClusterCommand(client, command[1:])
+	case "replication":
+		if len(command) != 2 || strings.ToLower(command[1]) != "status" {
+			fmt.Println("ERROR:  syntax error. use \"replication status\"")
+			break
+		}
+		ReplicationStatus(client)
+	case "shard":
+		handleShardCommand(client, command[1:])
+	case "site":
+		if len(command) != 2 || strings.ToLower(command[1]) != "status" {
+			fmt.Println("ERROR:  syntax error. use \"site status\"")
+			break
+		}
+		SiteStatus(client)
+	case "stats":
+		Stats(client)
+	case "reencrypt":
+		Reencrypt(client)
+	case "backup":
+		if len(command) < 2 || len(command) > 4 {
+			fmt.Println("ERROR:  syntax error. use \"backup [file] [username] [namespace]\"")
+			break
+		}
+		username, namespace := scopeArgs(command[2:])
+		Backup(client, command[1], username, namespace)
+	case "restore":
+		args, dryRun := command[1:], false
+		if len(args) > 0 && args[len(args)-1] == "--dry-run" {
+			args, dryRun = args[:len(args)-1], true
+		}
+		if len(args) < 1 || len(args) > 3 {
+			fmt.Println("ERROR:  syntax error. use \"restore [file] [username] [namespace] [--dry-run]\"")
+			break
+		}
+		username, namespace := scopeArgs(args[1:])
+		Restore(client, args[0], username, namespace, dryRun)
+	case "usage":
+		if len(command) > 2 {
+			fmt.Println("ERROR:  syntax error. use \"usage [username]\"")
+			break
+		}
+		username := ""
+		if len(command) == 2 {
+			username = command[1]
+		}
+		Usage(client, username)
 	default:
 		fmt.Println("ERROR:  syntax error at or near \"" + command[0] + "\"")
 	}
 	return true
 }
 
+// handleConsistencyCommand sets the consistency of the next reads, or shows
+// it without arguments.
+func handleConsistencyCommand(client *keevclient.Client, args []string) {
+	switch {
+	case len(args) == 0:
+		consistency, maxStaleness := client.ReadConsistency()
+		switch {
+		case consistency == "":
+			fmt.Println("server default")
+		case maxStaleness > 0:
+			fmt.Println(consistency, maxStaleness)
+		default:
+			fmt.Println(consistency)
+		}
+	case len(args) > 2:
+		fmt.Println("ERROR:  syntax error. use \"consistency [linearizable|lease|bounded|local] [max-staleness]\"")
+	default:
+		switch args[0] {
+		case keevclient.Linearizable, keevclient.Lease, keevclient.Bounded, keevclient.Local:
+		default:
+			fmt.Println("ERROR:  unknown consistency \"" + args[0] + "\"")
+			return
+		}
+		var staleness time.Duration
+		if len(args) == 2 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				fmt.Println("ERROR:  invalid max staleness \"" + args[1] + "\"")
+				return
+			}
+			staleness = d
+		}
+		client.SetReadConsistency(args[0], staleness)
+	}
+}
+
+// scopeArgs returns the optional username and namespace of a backup or
+// restore.
+func scopeArgs(args []string) (string, string) {
+	var username, namespace string
+	if len(args) > 0 {
+		username = args[0]
+	}
+	if len(args) > 1 {
+		namespace = args[1]
+	}
+	return username, namespace
+}
+
+// parseTTL parses an optional duration of at least a second.
+func parseTTL(args []string) (time.Duration, bool) {
+	if len(args) == 0 {
+		return 0, true
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil || d < time.Second {
+		fmt.Println("ERROR:  invalid ttl \"" + args[0] + "\", use a duration of at least 1s such as \"90s\" or \"1h\"")
+		return 0, false
+	}
+	return d, true
+}
+
+func handleAPIKeyCommand(client *keevclient.Client, args []string) {
+	switch {
+	case len(args) == 1 && strings.ToLower(args[0]) == "list":
+		ListAPIKeys(client)
+	case len(args) == 2 && strings.ToLower(args[0]) == "revoke":
+		RevokeAPIKey(client, args[1])
+	case len(args) == 5 && strings.ToLower(args[0]) == "create":
+		var expiresAt int64
+		if args[4] != "never" {
+			d, err := time.ParseDuration(args[4])
+			if err != nil || d <= 0 {
+				fmt.Println("ERROR:  invalid expiry, use a duration such as \"720h\" or \"never\"")
+				return
+			}
+			expiresAt = time.Now().Add(d).Unix()
+		}
+		CreateAPIKey(client, args[1], splitList(args[2]), splitList(args[3]), expiresAt)
+	default:
+		fmt.Println("ERROR:  syntax error. use \"apikey [create|revoke|list]\"")
+	}
+}
+
+func handleClusterCommand(client *keevclient.Client, args []string) {
+	learner := len(args) > 0 && args[len(args)-1] == "--learner"
+	if learner {
+		args = args[:len(args)-1]
+	}
+	switch {
+	case len(args) == 1 && strings.ToLower(args[0]) == "status" && !learner:
+		ClusterStatus(client)
+	case len(args) == 3 && strings.ToLower(args[0]) == "add":
+		ChangeMember(client, "add", &pb.MemberRequest{Id: args[1], Addr: args[2], Learner: learner})
+	case len(args) == 2 && !learner:
+		switch change := strings.ToLower(args[0]); change {
+		case "promote", "remove", "transfer":
+			ChangeMember(client, change, &pb.MemberRequest{Id: args[1]})
+			return
+		}
+		fallthrough
+	default:
+		fmt.Println("ERROR:  syntax error. use \"cluster [status|add|promote|remove|transfer]\"")
+	}
+}
+
+func handleShardCommand(client *keevclient.Client, args []string) {
+	switch {
+	case len(args) == 1 && strings.ToLower(args[0]) == "status":
+		ShardStatus(client)
+	case len(args) == 3 && strings.ToLower(args[0]) == "add":
+		ChangeShard(client, "add", &pb.ShardNode{Id: args[1], Addr: args[2]})
+	case len(args) == 2 && strings.ToLower(args[0]) == "remove":
+		ChangeShard(client, "remove", &pb.ShardNode{Id: args[1]})
+	default:
+		fmt.Println("ERROR:  syntax error. use \"shard [status|add|remove]\"")
+	}
+}
+
+func handleAuditCommand(client *keevclient.Client, args []string) {
+	query := &pb.AuditQuery{Limit: 100}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			fmt.Println("ERROR:  syntax error. use \"audit [user=..] [key=..] [since=..] [limit=..]\"")
+			return
+		}
+		switch kv[0] {
+		case "user":
+			query.User = kv[1]
+		case "key":
+			query.Key = kv[1]
+		case "since":
+			d, err := time.ParseDuration(kv[1])
+			if err != nil {
+				fmt.Println("ERROR:  invalid duration \"" + kv[1] + "\"")
+				return
+			}
+			query.Since = time.Now().Add(-d).Unix()
+		case "limit":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil {
+				fmt.Println("ERROR:  invalid limit \"" + kv[1] + "\"")
+				return
+			}
+			query.Limit = int32(n)
+		default:
+			fmt.Println("ERROR:  unknown audit filter \"" + kv[0] + "\"")
+			return
+		}
+	}
+	QueryAudit(client, query)
+}
+
+// splitList splits a comma-separated list, where "*" means no restriction.
+func splitList(s string) []string {
+	if s == "*" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// loadTLSConfig trusts the server certificate and, if --cert is set, presents
+// a client certificate for mutual TLS.
+func loadTLSConfig() (*tls.Config, error) {
+	pem, err := ioutil.ReadFile("keys/cert.pem")
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: "localhost", RootCAs: x509.NewCertPool()}
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in keys/cert.pem")
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		if *username == "" {
+			// only used for the prompt, the server maps the certificate to a user
+			if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+				*username = leaf.Subject.CommonName
+			}
+		}
+	}
+	return config, nil
+}
+
 func main() {
 	flag.Parse()
-	if *username == "" {
-		log.Fatalf("Please supply a username using the --username flag")
+	if *username == "" && *certFile == "" && *apiKey == "" {
+		log.Fatalf("Please supply a username using the --username flag, a certificate using --cert or an API key using --api-key")
 	}
 
-	creds, err := credentials.NewClientTLSFromFile("keys/cert.pem", "localhost")
+	tlsConfig, err := loadTLSConfig()
 	if err != nil {
 		log.Fatalf("Failed to create TLS credentials %v", err)
 	}
 
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(&loginCreds{
-		Username: *username,
-		Password: *password,
-	}))
+	opts := []keevclient.Option{keevclient.WithTLS(tlsConfig), keevclient.WithTimeout(*timeout)}
+	if *failover != "" {
+		opts = append(opts, keevclient.WithFailover(strings.Split(*failover, ",")...))
+	}
+	if *apiKey != "" {
+		opts = append(opts, keevclient.WithAPIKey(*apiKey))
+		if *username == "" {
+			*username = "apikey"
+		}
+	} else if *certFile == "" || *password != "" {
+		opts = append(opts, keevclient.WithLogin(*username, *password))
+	}
+	// requests for a key go to the shard holding it
+	client, err := keevclient.Dial(address, opts...)
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
-	defer conn.Close()
-
-	client := pb.NewKVSClient(conn)
+	defer client.Close()
 
 	term, err := terminal.NewWithStdInOut()
 	if err != nil {
@@ -170,5 +455,4 @@ func main() {
 		}
 		line, err = term.ReadLine()
 	}
-	term.Write([]byte(line))
 }
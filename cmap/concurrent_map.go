@@ -14,16 +14,65 @@ var SHARD_COUNT = 32
 type ConcurrentMap []*ConcurrentMapShared
 
 // A "thread" safe string to anything map.
+// It also keeps track of the memory used by its items, see Size, the
+// previous values of items changed since a pending snapshot, see Snapshot,
+// and the hook changes are reported to, see NewWithHook.
 type ConcurrentMapShared struct {
 	items        map[string]interface{}
+	bytes        int64
+	snapshots    []*shardSnapshot
+	hook         Hook
 	sync.RWMutex // Read Write mutex, guards access to internal map.
 }
 
+// Hook is called after an element is stored or deleted, with the shard lock
+// held. Changes to an element are reported in the order they were made.
+type Hook func(key string, value interface{}, deleted bool)
+
+// Returns the number of bytes accounted for an element, its key plus its
+// value if the value is a string.
+func Size(key string, value interface{}) int64 {
+	if s, ok := value.(string); ok {
+		return int64(len(key) + len(s))
+	}
+	return int64(len(key))
+}
+
+// Stores an element, the shard lock must be held.
+func (shard *ConcurrentMapShared) set(key string, value interface{}) {
+	shard.preserve(key)
+	if old, ok := shard.items[key]; ok {
+		shard.bytes -= Size(key, old)
+	}
+	shard.items[key] = value
+	shard.bytes += Size(key, value)
+	if shard.hook != nil {
+		shard.hook(key, value, false)
+	}
+}
+
+// Deletes an element, the shard lock must be held.
+func (shard *ConcurrentMapShared) remove(key string) {
+	if old, ok := shard.items[key]; ok {
+		shard.preserve(key)
+		shard.bytes -= Size(key, old)
+		delete(shard.items, key)
+		if shard.hook != nil {
+			shard.hook(key, nil, true)
+		}
+	}
+}
+
 // Creates a new concurrent map.
 func New() ConcurrentMap {
+	return NewWithHook(nil)
+}
+
+// Creates a new concurrent map reporting every change to hook.
+func NewWithHook(hook Hook) ConcurrentMap {
 	m := make(ConcurrentMap, SHARD_COUNT)
 	for i := 0; i < SHARD_COUNT; i++ {
-		m[i] = &ConcurrentMapShared{items: make(map[string]interface{})}
+		m[i] = &ConcurrentMapShared{items: make(map[string]interface{}), hook: hook}
 	}
 	return m
 }
@@ -37,7 +86,7 @@ func (m ConcurrentMap) MSet(data map[string]interface{}) {
 	for key, value := range data {
 		shard := m.GetShard(key)
 		shard.Lock()
-		shard.items[key] = value
+		shard.set(key, value)
 		shard.Unlock()
 	}
 }
@@ -47,7 +96,7 @@ func (m ConcurrentMap) Set(key string, value interface{}) {
 	// Get map shard.
 	shard := m.GetShard(key)
 	shard.Lock()
-	shard.items[key] = value
+	shard.set(key, value)
 	shard.Unlock()
 }
 
@@ -63,7 +112,7 @@ func (m ConcurrentMap) Upsert(key string, value interface{}, cb UpsertCb) (res i
 	shard.Lock()
 	v, ok := shard.items[key]
 	res = cb(ok, v, value)
-	shard.items[key] = res
+	shard.set(key, res)
 	shard.Unlock()
 	return res
 }
@@ -75,12 +124,26 @@ func (m ConcurrentMap) SetIfAbsent(key string, value interface{}) bool {
 	shard.Lock()
 	_, ok := shard.items[key]
 	if !ok {
-		shard.items[key] = value
+		shard.set(key, value)
 	}
 	shard.Unlock()
 	return !ok
 }
 
+// Replaces the value under the specified key if a value was associated with it
+// and returns the previous value.
+func (m ConcurrentMap) Replace(key string, value interface{}) (old interface{}, exists bool) {
+	// Get map shard.
+	shard := m.GetShard(key)
+	shard.Lock()
+	old, exists = shard.items[key]
+	if exists {
+		shard.set(key, value)
+	}
+	shard.Unlock()
+	return old, exists
+}
+
 // Retrieves an element from map under given key.
 func (m ConcurrentMap) Get(key string) (interface{}, bool) {
 	// Get shard
@@ -104,6 +167,18 @@ func (m ConcurrentMap) Count() int {
 	return count
 }
 
+// Returns the number of bytes used by all elements, as accounted by Size.
+func (m ConcurrentMap) Bytes() int64 {
+	var bytes int64
+	for i := 0; i < SHARD_COUNT; i++ {
+		shard := m[i]
+		shard.RLock()
+		bytes += shard.bytes
+		shard.RUnlock()
+	}
+	return bytes
+}
+
 // Looks up an item under specified key
 func (m ConcurrentMap) Has(key string) bool {
 	// Get shard
@@ -120,7 +195,7 @@ func (m ConcurrentMap) Remove(key string) {
 	// Try to get shard.
 	shard := m.GetShard(key)
 	shard.Lock()
-	delete(shard.items, key)
+	shard.remove(key)
 	shard.Unlock()
 }
 
@@ -130,7 +205,7 @@ func (m ConcurrentMap) Pop(key string) (v interface{}, exists bool) {
 	shard := m.GetShard(key)
 	shard.Lock()
 	v, exists = shard.items[key]
-	delete(shard.items, key)
+	shard.remove(key)
 	shard.Unlock()
 	return v, exists
 }
@@ -273,14 +348,15 @@ func (m ConcurrentMap) Keys() []string {
 }
 
 //Reviles ConcurrentMap "private" variables to json marshal.
+// The items are taken from a snapshot, so they are consistent across shards.
 func (m ConcurrentMap) MarshalJSON() ([]byte, error) {
 	// Create a temporary map, which will hold all item spread across shards.
 	tmp := make(map[string]interface{})
 
 	// Insert items to temporary map.
-	for item := range m.IterBuffered() {
-		tmp[item.Key] = item.Val
-	}
+	m.Snapshot().IterCb(func(key string, v interface{}) {
+		tmp[key] = v
+	})
 	return json.Marshal(tmp)
 }
 
@@ -0,0 +1,132 @@
+package cmap
+
+// A Snapshot is a point-in-time view of a map, taken without copying it.
+//
+// Taking a snapshot briefly locks every shard to mark the point in time.
+// From then on, the first write to an item in a shard the snapshot has not
+// read yet saves the item's previous value (copy-on-write). Reading the
+// snapshot walks the shards one at a time, combining the current items with
+// the saved values, and stops tracking writes to a shard once it has been
+// read. Writers are only held up while a single shard is copied, never for
+// the whole snapshot or while its items are being serialized.
+type Snapshot struct {
+	m      ConcurrentMap
+	shards []*shardSnapshot
+}
+
+// preimage is the value of an item when the snapshot was taken.
+type preimage struct {
+	value  interface{}
+	exists bool
+}
+
+type shardSnapshot struct {
+	preimages map[string]preimage
+}
+
+// Takes a snapshot of the map. It must be read with IterCb or Items, or
+// released with Close, otherwise writes keep saving previous values for it.
+func (m ConcurrentMap) Snapshot() *Snapshot {
+	return m.SnapshotFunc(nil)
+}
+
+// Takes a snapshot of the map like Snapshot, calling at while no change can
+// be made. Together with a Hook this tells which changes the snapshot holds.
+func (m ConcurrentMap) SnapshotFunc(at func()) *Snapshot {
+	s := &Snapshot{m: m, shards: make([]*shardSnapshot, len(m))}
+	// Writers hold a single shard lock, so locking the shards in order
+	// cannot deadlock.
+	for i, shard := range m {
+		shard.Lock()
+		s.shards[i] = &shardSnapshot{preimages: make(map[string]preimage)}
+		shard.snapshots = append(shard.snapshots, s.shards[i])
+	}
+	if at != nil {
+		at()
+	}
+	for _, shard := range m {
+		shard.Unlock()
+	}
+	return s
+}
+
+// Saves the value of key for the snapshots that have not read this shard
+// yet, unless it was already saved. The shard lock must be held.
+func (shard *ConcurrentMapShared) preserve(key string) {
+	for _, snap := range shard.snapshots {
+		if _, ok := snap.preimages[key]; !ok {
+			v, exists := shard.items[key]
+			snap.preimages[key] = preimage{v, exists}
+		}
+	}
+}
+
+// Stops saving values for snap, the shard lock must be held.
+func (shard *ConcurrentMapShared) detach(snap *shardSnapshot) {
+	for i, s := range shard.snapshots {
+		if s == snap {
+			shard.snapshots = append(shard.snapshots[:i], shard.snapshots[i+1:]...)
+			return
+		}
+	}
+}
+
+// Copies the items of shard i as they were when the snapshot was taken and
+// stops tracking writes to it.
+func (s *Snapshot) readShard(i int) []Tuple {
+	shard, snap := s.m[i], s.shards[i]
+	shard.Lock()
+	defer shard.Unlock()
+	if snap == nil {
+		return nil
+	}
+	items := make([]Tuple, 0, len(shard.items))
+	for key, val := range shard.items {
+		// items written since the snapshot are added from their preimages
+		if _, ok := snap.preimages[key]; !ok {
+			items = append(items, Tuple{key, val})
+		}
+	}
+	for key, pre := range snap.preimages {
+		if pre.exists {
+			items = append(items, Tuple{key, pre.value})
+		}
+	}
+	shard.detach(snap)
+	s.shards[i] = nil
+	return items
+}
+
+// Calls fn for every item in the snapshot, shard by shard. No lock is held
+// while fn runs. A snapshot can only be read once.
+func (s *Snapshot) IterCb(fn IterCb) {
+	for i := range s.m {
+		for _, t := range s.readShard(i) {
+			fn(t.Key, t.Val)
+		}
+	}
+}
+
+// Returns all items in the snapshot. A snapshot can only be read once.
+func (s *Snapshot) Items() map[string]interface{} {
+	tmp := make(map[string]interface{})
+	s.IterCb(func(key string, v interface{}) {
+		tmp[key] = v
+	})
+	return tmp
+}
+
+// Releases a snapshot that will not be read, or the rest of a snapshot that
+// was partially read.
+func (s *Snapshot) Close() {
+	for i, snap := range s.shards {
+		if snap == nil {
+			continue
+		}
+		shard := s.m[i]
+		shard.Lock()
+		shard.detach(snap)
+		shard.Unlock()
+		s.shards[i] = nil
+	}
+}
@@ -0,0 +1,130 @@
+package cmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func Test_SnapshotPointInTime(t *testing.T) {
+	m := New()
+	m.Set("a", "1")
+	m.Set("b", "2")
+	m.Set("c", "3")
+
+	snap := m.Snapshot()
+	m.Set("a", "changed")
+	m.Remove("b")
+	m.Set("d", "added")
+	m.Replace("c", "replaced")
+	m.Set("a", "changed again")
+
+	items := snap.Items()
+	expected := map[string]interface{}{"a": "1", "b": "2", "c": "3"}
+	if fmt.Sprint(items) != fmt.Sprint(expected) {
+		t.Fatalf("expected snapshot %v, got %v", expected, items)
+	}
+	if v, _ := m.Get("a"); v != "changed again" || m.Has("b") || !m.Has("d") {
+		t.Fatalf("writes after the snapshot were lost")
+	}
+
+	// once read, the snapshot no longer saves previous values
+	for _, shard := range m {
+		if len(shard.snapshots) != 0 {
+			t.Fatalf("snapshot still attached after it was read")
+		}
+	}
+	if m.Bytes() != Size("a", "changed again")+Size("c", "replaced")+Size("d", "added") {
+		t.Fatalf("unexpected memory usage %d", m.Bytes())
+	}
+}
+
+func Test_SnapshotClose(t *testing.T) {
+	m := New()
+	m.Set("a", "1")
+	snap := m.Snapshot()
+	snap.Close()
+	m.Set("a", "2")
+	for _, shard := range m {
+		if len(shard.snapshots) != 0 {
+			t.Fatalf("snapshot still attached after it was closed")
+		}
+	}
+	if items := snap.Items(); len(items) != 0 {
+		t.Fatalf("expected a closed snapshot to be empty, got %v", items)
+	}
+}
+
+// Keys moved between shards in a single step must never be saved twice or
+// not at all, however the writes interleave with the snapshot.
+func Test_SnapshotConsistentUnderWrites(t *testing.T) {
+	m := New()
+	const total = 64
+	for i := 0; i < total; i++ {
+		m.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	var mu sync.Mutex // serializes moves, as a multi-key write would
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			mu.Lock()
+			from, to := fmt.Sprintf("key%d", n%total), fmt.Sprintf("moved%d", n%total)
+			if v, ok := m.Pop(from); ok {
+				m.Set(to, v)
+			} else if v, ok := m.Pop(to); ok {
+				m.Set(from, v)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		mu.Lock()
+		snap := m.Snapshot()
+		mu.Unlock()
+		b, err := json.Marshal(snap.Items())
+		if err != nil {
+			t.Fatalf("failed to marshal snapshot: %s", err.Error())
+		}
+		var items map[string]int
+		json.Unmarshal(b, &items)
+		if len(items) != total {
+			t.Fatalf("expected %d keys in snapshot, got %d", total, len(items))
+		}
+	}
+	close(stop)
+	<-done
+}
+
+func Test_SnapshotHook(t *testing.T) {
+	var changes []string
+	revision := 0
+	m := NewWithHook(func(key string, value interface{}, deleted bool) {
+		revision++
+		changes = append(changes, fmt.Sprintf("%s=%v %v", key, value, deleted))
+	})
+	m.Set("a", "1")
+	m.Set("b", "2")
+	m.Remove("a")
+	m.Remove("missing")
+
+	var at int
+	snap := m.SnapshotFunc(func() { at = revision })
+	m.Set("c", "3")
+	if at != 3 || len(snap.Items()) != 1 {
+		t.Fatalf("expected the snapshot to hold the first 3 changes, got %d and %v", at, changes)
+	}
+	expected := "[a=1 false b=2 false a=<nil> true c=3 false]"
+	if fmt.Sprint(changes) != expected {
+		t.Fatalf("expected changes %s, got %v", expected, changes)
+	}
+}
@@ -1,3 +1,300 @@
+// Package common holds the pieces shared between the keev server and tools,
+// such as the keys used to sign namespace tokens.
 package common
 
-var JWTSigningToken []byte = []byte("keev-kvs")
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Environment variables that override the key file.
+const (
+	// KeyFileEnv names a JSON key file to load instead of the default one.
+	KeyFileEnv = "KEEV_JWT_KEYS"
+	// SecretEnv holds a single HS256 secret, used when no key file exists.
+	SecretEnv = "KEEV_JWT_SECRET"
+	// SecretKeyID is the key ID given to the key read from SecretEnv.
+	SecretKeyID = "env"
+)
+
+var (
+	ErrNoKeys        = errors.New("no JWT signing keys configured")
+	ErrNoActiveKey   = errors.New("active JWT key is missing or cannot sign")
+	ErrUnknownKeyID  = errors.New("token signed with an unknown key")
+	ErrUnexpectedAlg = errors.New("token signed with an unexpected algorithm")
+)
+
+// KeyConfig describes a single key in the key file. PEM paths are resolved
+// relative to the key file.
+type KeyConfig struct {
+	ID         string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	Secret     string `json:"secret,omitempty"`      // HS256/HS384/HS512
+	PrivateKey string `json:"private_key,omitempty"` // PEM file, can sign and verify
+	PublicKey  string `json:"public_key,omitempty"`  // PEM file, can only verify
+}
+
+// KeyFile is the on-disk layout of the JWT key file.
+type KeyFile struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+// SigningKey is a loaded key. Keys without a private half are kept around so
+// that tokens signed before a rotation still verify.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// KeyRing holds the key used to sign new tokens along with every key that is
+// still accepted when verifying, indexed by key ID. It is safe for concurrent
+// use and can be reloaded in place to rotate keys.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeyRing returns an empty key ring.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string]*SigningKey)}
+}
+
+// LoadKeyRing loads keys from the file named by KEEV_JWT_KEYS, or path if the
+// variable is unset. If that file does not exist, a single HS256 key is taken
+// from KEEV_JWT_SECRET.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	k := NewKeyRing()
+	if err := k.Reload(path); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload replaces the keys in the ring, following the same lookup rules as
+// LoadKeyRing. The ring is left untouched if loading fails.
+func (k *KeyRing) Reload(path string) error {
+	if env := os.Getenv(KeyFileEnv); env != "" {
+		path = env
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		secret := os.Getenv(SecretEnv)
+		if secret == "" {
+			return ErrNoKeys
+		}
+		return k.load(&KeyFile{
+			Active: SecretKeyID,
+			Keys:   []KeyConfig{{ID: SecretKeyID, Algorithm: "HS256", Secret: secret}},
+		}, "")
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return k.Load(file, filepath.Dir(path))
+}
+
+// Load reads a key file from r. PEM paths are resolved relative to dir.
+func (k *KeyRing) Load(r io.Reader, dir string) error {
+	var kf KeyFile
+	if err := json.NewDecoder(r).Decode(&kf); err != nil {
+		return err
+	}
+	return k.load(&kf, dir)
+}
+
+func (k *KeyRing) load(kf *KeyFile, dir string) error {
+	if len(kf.Keys) == 0 {
+		return ErrNoKeys
+	}
+	keys := make(map[string]*SigningKey, len(kf.Keys))
+	for _, c := range kf.Keys {
+		if c.ID == "" {
+			return fmt.Errorf("jwt key without kid")
+		}
+		if _, ok := keys[c.ID]; ok {
+			return fmt.Errorf("duplicate jwt key %q", c.ID)
+		}
+		key, err := parseKey(c, dir)
+		if err != nil {
+			return fmt.Errorf("jwt key %q: %s", c.ID, err)
+		}
+		keys[c.ID] = key
+	}
+	active, ok := keys[kf.Active]
+	if !ok || active.sign == nil {
+		return ErrNoActiveKey
+	}
+
+	k.mu.Lock()
+	k.active = active
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func parseKey(c KeyConfig, dir string) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(c.Algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+	key := &SigningKey{ID: c.ID, Method: method}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if c.Secret == "" {
+			return nil, errors.New("missing secret")
+		}
+		key.sign = []byte(c.Secret)
+		key.verify = key.sign
+		return key, nil
+	}
+	if c.Secret != "" {
+		return nil, fmt.Errorf("secret given for asymmetric algorithm %s", c.Algorithm)
+	}
+
+	var err error
+	switch {
+	case c.PrivateKey != "":
+		key.sign, key.verify, err = readPrivateKey(method, resolve(dir, c.PrivateKey))
+	case c.PublicKey != "":
+		key.verify, err = readPublicKey(method, resolve(dir, c.PublicKey))
+	default:
+		err = errors.New("missing private_key or public_key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func readPrivateKey(method jwt.SigningMethod, path string) (interface{}, interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return priv, &priv.PublicKey, nil
+	case *jwt.SigningMethodECDSA:
+		priv, err := jwt.ParseECPrivateKeyFromPEM(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if priv.Curve.Params().BitSize != m.CurveBits {
+			return nil, nil, errors.New("curve does not match algorithm")
+		}
+		return priv, &priv.PublicKey, nil
+	case *SigningMethodEd25519:
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, nil, jwt.ErrKeyMustBePEMEncoded
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("not an Ed25519 private key")
+		}
+		return priv, priv.Public(), nil
+	}
+	return nil, nil, fmt.Errorf("unsupported algorithm %q", method.Alg())
+}
+
+func readPublicKey(method jwt.SigningMethod, path string) (interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return jwt.ParseRSAPublicKeyFromPEM(b)
+	case *jwt.SigningMethodECDSA:
+		pub, err := jwt.ParseECPublicKeyFromPEM(b)
+		if err != nil {
+			return nil, err
+		}
+		if pub.Curve.Params().BitSize != m.CurveBits {
+			return nil, errors.New("curve does not match algorithm")
+		}
+		return pub, nil
+	case *SigningMethodEd25519:
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, jwt.ErrKeyMustBePEMEncoded
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 public key")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", method.Alg())
+}
+
+// Sign signs claims with the active key and stamps the key ID into the
+// token header.
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key := k.active
+	k.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoActiveKey
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.sign)
+}
+
+// Keyfunc looks up the verification key for a parsed token. The token must
+// name a known key ID and use exactly that key's algorithm, so a token can
+// never pick its own algorithm (e.g. "none" or HS256 with a public key).
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method == nil || token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectedAlg
+	}
+	return key.verify, nil
+}
+
+// Parse parses and verifies a token string into claims.
+func (k *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, k.Keyfunc)
+}
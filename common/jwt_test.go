@@ -0,0 +1,180 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) {
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", name, err.Error())
+	}
+}
+
+// writeKeys writes an RSA, an ECDSA P-256 and an Ed25519 key pair into dir.
+func writeKeys(t *testing.T, dir string) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %s", err.Error())
+	}
+	writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	pub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	writePEM(t, dir, "rsa.pub.pem", "PUBLIC KEY", pub)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %s", err.Error())
+	}
+	der, _ := x509.MarshalECPrivateKey(ecKey)
+	writePEM(t, dir, "ec.pem", "EC PRIVATE KEY", der)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %s", err.Error())
+	}
+	der, _ = x509.MarshalPKCS8PrivateKey(edKey)
+	writePEM(t, dir, "ed.pem", "PRIVATE KEY", der)
+}
+
+func loadRing(t *testing.T, dir, keyFile string) *KeyRing {
+	k := NewKeyRing()
+	if err := k.Load(strings.NewReader(keyFile), dir); err != nil {
+		t.Fatalf("failed to load key file: %s", err.Error())
+	}
+	return k
+}
+
+func Test_KeyRingSignVerify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-jwt")
+	defer os.RemoveAll(dir)
+	writeKeys(t, dir)
+
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		file := map[string]string{"RS256": "rsa.pem", "ES256": "ec.pem", "EdDSA": "ed.pem"}[alg]
+		k := loadRing(t, dir, `{"active": "k1", "keys": [{"kid": "k1", "alg": "`+alg+`", "private_key": "`+file+`"}]}`)
+
+		ss, err := k.Sign(jwt.StandardClaims{Issuer: "keev"})
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %s", alg, err.Error())
+		}
+		token, err := k.Parse(ss, &jwt.StandardClaims{})
+		if err != nil || !token.Valid {
+			t.Fatalf("%s: failed to verify: %v", alg, err)
+		}
+		if token.Header["kid"] != "k1" || token.Method.Alg() != alg {
+			t.Fatalf("%s: wrong header: %v", alg, token.Header)
+		}
+	}
+}
+
+func Test_KeyRingRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-jwt")
+	defer os.RemoveAll(dir)
+	writeKeys(t, dir)
+
+	old := loadRing(t, dir, `{"active": "old", "keys": [{"kid": "old", "alg": "RS256", "private_key": "rsa.pem"}]}`)
+	oldToken, err := old.Sign(jwt.StandardClaims{Issuer: "keev"})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	// rotate: sign with the new key, keep only the public half of the old one
+	k := loadRing(t, dir, `{"active": "new", "keys": [
+		{"kid": "new", "alg": "ES256", "private_key": "ec.pem"},
+		{"kid": "old", "alg": "RS256", "public_key": "rsa.pub.pem"}
+	]}`)
+	if _, err := k.Parse(oldToken, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("token signed with retired key rejected: %s", err.Error())
+	}
+	newToken, _ := k.Sign(jwt.StandardClaims{Issuer: "keev"})
+	if _, err := k.Parse(newToken, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("token signed with active key rejected: %s", err.Error())
+	}
+
+	// drop the old key entirely
+	k = loadRing(t, dir, `{"active": "new", "keys": [{"kid": "new", "alg": "ES256", "private_key": "ec.pem"}]}`)
+	if _, err := k.Parse(oldToken, &jwt.StandardClaims{}); err == nil {
+		t.Fatalf("token signed with removed key accepted")
+	}
+
+	// a verify-only key cannot be active
+	if err := NewKeyRing().Load(strings.NewReader(`{"active": "old", "keys": [
+		{"kid": "old", "alg": "RS256", "public_key": "rsa.pub.pem"}
+	]}`), dir); err != ErrNoActiveKey {
+		t.Fatalf("expected ErrNoActiveKey, got %v", err)
+	}
+}
+
+func Test_KeyRingRejectsAlgorithmConfusion(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-jwt")
+	defer os.RemoveAll(dir)
+	writeKeys(t, dir)
+
+	k := loadRing(t, dir, `{"active": "k1", "keys": [{"kid": "k1", "alg": "RS256", "private_key": "rsa.pem"}]}`)
+
+	// HS256 token keyed with the RSA public key, claiming the RSA key's kid
+	pub, _ := ioutil.ReadFile(filepath.Join(dir, "rsa.pub.pem"))
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Issuer: "keev"})
+	forged.Header["kid"] = "k1"
+	ss, _ := forged.SignedString(pub)
+	if _, err := k.Parse(ss, &jwt.StandardClaims{}); err == nil {
+		t.Fatalf("HS256 token accepted for RS256 key")
+	}
+
+	// unsigned token
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.StandardClaims{Issuer: "keev"})
+	none.Header["kid"] = "k1"
+	ss, _ = none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := k.Parse(ss, &jwt.StandardClaims{}); err == nil {
+		t.Fatalf("unsigned token accepted")
+	}
+
+	// missing kid
+	valid := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{Issuer: "keev"})
+	priv, _ := jwt.ParseRSAPrivateKeyFromPEM(mustRead(t, filepath.Join(dir, "rsa.pem")))
+	ss, _ = valid.SignedString(priv)
+	if _, err := k.Parse(ss, &jwt.StandardClaims{}); err == nil {
+		t.Fatalf("token without kid accepted")
+	}
+}
+
+func Test_KeyRingSecretFromEnv(t *testing.T) {
+	os.Setenv(SecretEnv, "s3cret")
+	defer os.Unsetenv(SecretEnv)
+
+	k, err := LoadKeyRing(filepath.Join(os.TempDir(), "keev-missing-keys.json"))
+	if err != nil {
+		t.Fatalf("failed to load key from environment: %s", err.Error())
+	}
+	ss, _ := k.Sign(jwt.StandardClaims{Issuer: "keev"})
+	token, err := k.Parse(ss, &jwt.StandardClaims{})
+	if err != nil || token.Header["kid"] != SecretKeyID {
+		t.Fatalf("token signed with environment key rejected: %v", err)
+	}
+
+	os.Unsetenv(SecretEnv)
+	if _, err := LoadKeyRing(filepath.Join(os.TempDir(), "keev-missing-keys.json")); err != ErrNoKeys {
+		t.Fatalf("expected ErrNoKeys, got %v", err)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err.Error())
+	}
+	return b
+}
@@ -0,0 +1,198 @@
+// Package conflict merges the versions of a key written at several sites,
+// each accepting writes on its own.
+//
+// Every version carries a version vector, its clock: the timestamp of the
+// last write of each site it follows. A version follows another if its
+// clock is as late or later for every site; versions neither of which
+// follows the other were written concurrently, without one site seeing the
+// write of the other, and conflict. Merging keeps the versions no other
+// follows and resolves conflicts either with last-writer-wins, keeping the
+// version with the latest timestamp, or by keeping them all as siblings
+// until the next write. A deletion is a version too, a tombstone: a key
+// whose latest version is a tombstone is deleted, even if it has siblings.
+//
+// Merging is commutative, associative and idempotent: sites exchanging
+// their versions in any order, as often as they like, end up with the same
+// ones.
+package conflict
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/imjching/keev/protobuf"
+)
+
+// The ways conflicts are resolved.
+const (
+	LastWriterWins = "lww"
+	KeepSiblings   = "siblings"
+)
+
+// Write returns the version written at site at timestamp ts, which follows
+// every version in current. ts must be later than every timestamp of site
+// in current.
+func Write(current []*pb.Version, site string, ts uint64, value string, expires int64, deleted bool) *pb.Version {
+	var clock []*pb.SiteClock
+	for _, v := range current {
+		clock = join(clock, v.Clock)
+	}
+	return &pb.Version{
+		Value:   value,
+		Expires: expires,
+		Deleted: deleted,
+		Site:    site,
+		Hlc:     ts,
+		Clock:   join(clock, []*pb.SiteClock{{Site: site, Hlc: ts}}),
+	}
+}
+
+// Merge returns the versions of a key holding both a and b, the latest
+// first, and whether they differ from a. conflicted is true if some of them
+// were written concurrently.
+func Merge(a, b []*pb.Version, resolution string) (merged []*pb.Version, changed, conflicted bool) {
+	all := append([]*pb.Version(nil), a...)
+next:
+	for _, v := range b {
+		for i, w := range all {
+			if same(v, w) {
+				if !equalClocks(v.Clock, w.Clock) {
+					all[i] = withClock(w, join(w.Clock, v.Clock))
+				}
+				continue next
+			}
+		}
+		all = append(all, v)
+	}
+	for _, v := range all {
+		followed := false
+		for _, w := range all {
+			if w != v && follows(w, v) {
+				followed = true
+				break
+			}
+		}
+		if !followed {
+			merged = append(merged, v)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return later(merged[i], merged[j]) })
+	if conflicted = len(merged) > 1; conflicted {
+		merged = resolve(merged, resolution)
+	}
+	return merged, !equal(a, merged), conflicted
+}
+
+// resolve resolves the conflicting versions vs, the latest first. With
+// last-writer-wins it only keeps the latest, made to follow the others so
+// they are dropped wherever they are merged with it. Siblings are all kept,
+// tombstones included: resolving them depending on which versions were
+// merged so far would keep sites merging in different orders from agreeing.
+func resolve(vs []*pb.Version, resolution string) []*pb.Version {
+	if resolution == KeepSiblings {
+		return vs
+	}
+	var clock []*pb.SiteClock
+	for _, v := range vs {
+		clock = join(clock, v.Clock)
+	}
+	return []*pb.Version{withClock(vs[0], clock)}
+}
+
+// Deleted returns true if the latest of vs is a tombstone, the key is
+// deleted whatever siblings it has.
+func Deleted(vs []*pb.Version) bool {
+	return len(vs) > 0 && vs[0].Deleted
+}
+
+// Siblings returns the values of vs other than the latest, none if the key
+// is deleted.
+func Siblings(vs []*pb.Version) []*pb.Version {
+	if Deleted(vs) {
+		return nil
+	}
+	var siblings []*pb.Version
+	for _, v := range vs[1:] {
+		if !v.Deleted {
+			siblings = append(siblings, v)
+		}
+	}
+	return siblings
+}
+
+// same returns true if a and b are the same write.
+func same(a, b *pb.Version) bool {
+	return a.Site == b.Site && a.Hlc == b.Hlc
+}
+
+// later orders versions by timestamp, then by site.
+func later(a, b *pb.Version) bool {
+	if a.Hlc != b.Hlc {
+		return a.Hlc > b.Hlc
+	}
+	return a.Site > b.Site
+}
+
+// follows returns true if a follows b and not the other way around.
+func follows(a, b *pb.Version) bool {
+	return covers(a.Clock, b.Clock) && !equalClocks(a.Clock, b.Clock)
+}
+
+// covers returns true if a is as late as b for every site.
+func covers(a, b []*pb.SiteClock) bool {
+	i := 0
+	for _, c := range b {
+		for i < len(a) && a[i].Site < c.Site {
+			i++
+		}
+		if i == len(a) || a[i].Site != c.Site || a[i].Hlc < c.Hlc {
+			return false
+		}
+	}
+	return true
+}
+
+// join returns the latest timestamp of every site in a or b, which are
+// sorted by site.
+func join(a, b []*pb.SiteClock) []*pb.SiteClock {
+	out := make([]*pb.SiteClock, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0].Site < b[0].Site:
+			out, a = append(out, a[0]), a[1:]
+		case len(a) == 0 || b[0].Site < a[0].Site:
+			out, b = append(out, b[0]), b[1:]
+		default:
+			c := a[0]
+			if b[0].Hlc > c.Hlc {
+				c = b[0]
+			}
+			out, a, b = append(out, c), a[1:], b[1:]
+		}
+	}
+	return out
+}
+
+func equalClocks(a, b []*pb.SiteClock) bool {
+	return covers(a, b) && covers(b, a)
+}
+
+func equal(a, b []*pb.Version) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// withClock returns a copy of v with clock, leaving v as it is: versions
+// are shared with the log and the other sites.
+func withClock(v *pb.Version, clock []*pb.SiteClock) *pb.Version {
+	c := *v
+	c.Clock = clock
+	return &c
+}
@@ -0,0 +1,132 @@
+package conflict
+
+import (
+	"testing"
+
+	pb "github.com/imjching/keev/protobuf"
+)
+
+func values(vs []*pb.Version) []string {
+	var out []string
+	for _, v := range vs {
+		if v.Deleted {
+			out = append(out, "(deleted)")
+		} else {
+			out = append(out, v.Value)
+		}
+	}
+	return out
+}
+
+func expect(t *testing.T, vs []*pb.Version, want ...string) {
+	got := values(vs)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func Test_MergeFollowing(t *testing.T) {
+	a1 := []*pb.Version{Write(nil, "a", 10, "one", 0, false)}
+	// b saw a1 before writing
+	b1 := []*pb.Version{Write(a1, "b", 5, "two", 0, false)}
+	for _, resolution := range []string{LastWriterWins, KeepSiblings} {
+		merged, changed, conflicted := Merge(a1, b1, resolution)
+		if !changed || conflicted {
+			t.Fatalf("expected b1 to replace a1 without a conflict")
+		}
+		// b1 wins despite its earlier timestamp, it followed a1
+		expect(t, merged, "two")
+		if _, changed, _ := Merge(b1, a1, resolution); changed {
+			t.Fatalf("expected a1 to be ignored by b1")
+		}
+	}
+}
+
+func Test_MergeLastWriterWins(t *testing.T) {
+	base := []*pb.Version{Write(nil, "a", 1, "base", 0, false)}
+	a := []*pb.Version{Write(base, "a", 10, "from a", 0, false)}
+	b := []*pb.Version{Write(base, "b", 20, "from b", 0, false)}
+	ab, changed, conflicted := Merge(a, b, LastWriterWins)
+	if !changed || !conflicted {
+		t.Fatalf("expected a conflict")
+	}
+	expect(t, ab, "from b")
+	ba, _, _ := Merge(b, a, LastWriterWins)
+	if !equal(ab, ba) {
+		t.Fatalf("expected both sites to agree, got %v and %v", ab, ba)
+	}
+	// the loser is dropped wherever it arrives later
+	for _, vs := range [][]*pb.Version{a, b, base} {
+		if merged, changed, _ := Merge(ab, vs, LastWriterWins); changed || !equal(merged, ab) {
+			t.Fatalf("expected merging %v again to change nothing, got %v", values(vs), values(merged))
+		}
+	}
+	// a tie on the timestamp goes by site
+	c := []*pb.Version{Write(base, "c", 20, "from c", 0, false)}
+	merged, _, _ := Merge(b, c, LastWriterWins)
+	expect(t, merged, "from c")
+}
+
+func Test_MergeSiblings(t *testing.T) {
+	a := []*pb.Version{Write(nil, "a", 10, "from a", 0, false)}
+	b := []*pb.Version{Write(nil, "b", 20, "from b", 0, false)}
+	ab, changed, conflicted := Merge(a, b, KeepSiblings)
+	if !changed || !conflicted {
+		t.Fatalf("expected a conflict")
+	}
+	expect(t, ab, "from b", "from a")
+	ba, _, _ := Merge(b, a, KeepSiblings)
+	if !equal(ab, ba) {
+		t.Fatalf("expected both sites to agree, got %v and %v", values(ab), values(ba))
+	}
+	if _, changed, _ := Merge(ab, a, KeepSiblings); changed {
+		t.Fatalf("expected merging a again to change nothing")
+	}
+	// the next write follows both siblings
+	next := []*pb.Version{Write(ab, "a", 30, "resolved", 0, false)}
+	merged, _, conflicted := Merge(ab, next, KeepSiblings)
+	if conflicted {
+		t.Fatalf("expected the write to follow the siblings")
+	}
+	expect(t, merged, "resolved")
+
+	// a later deletion hides the siblings, an earlier one is kept with them
+	del := []*pb.Version{Write(nil, "c", 40, "", 0, true)}
+	merged, _, _ = Merge(ab, del, KeepSiblings)
+	if !Deleted(merged) || len(Siblings(merged)) != 0 {
+		t.Fatalf("expected the key to be deleted, got %v", values(merged))
+	}
+	del = []*pb.Version{Write(nil, "c", 5, "", 0, true)}
+	merged, _, _ = Merge(ab, del, KeepSiblings)
+	expect(t, merged, "from b", "from a", "(deleted)")
+	if Deleted(merged) || len(Siblings(merged)) != 1 {
+		t.Fatalf("expected one sibling, got %v", values(Siblings(merged)))
+	}
+}
+
+func Test_MergeThreeSites(t *testing.T) {
+	a := []*pb.Version{Write(nil, "a", 10, "a", 0, false)}
+	b := []*pb.Version{Write(nil, "b", 20, "b", 0, false)}
+	c := []*pb.Version{Write(nil, "c", 15, "c", 0, true)}
+	// every order of merging gives the same versions
+	orders := [][][]*pb.Version{{a, b, c}, {c, b, a}, {b, a, c}, {c, a, b}}
+	for _, resolution := range []string{LastWriterWins, KeepSiblings} {
+		var first []*pb.Version
+		for _, order := range orders {
+			var merged []*pb.Version
+			for _, vs := range order {
+				merged, _, _ = Merge(merged, vs, resolution)
+			}
+			if first == nil {
+				first = merged
+			} else if !equal(first, merged) {
+				t.Fatalf("%s: expected %v, got %v", resolution, values(first), values(merged))
+			}
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Package encrypt encrypts files at rest with AES-256-GCM.
+//
+// An encrypted file starts with an 8 byte magic, the ID of the key it was
+// encrypted with and a random nonce prefix, followed by chunks of at most
+// 64KiB. Each chunk is sealed on its own with a nonce made of the prefix and
+// the chunk number, and the header as additional data, so chunks cannot be
+// reordered or moved between files. The last chunk is marked, a file cut
+// short is detected rather than read as a shorter one. Keys are looked up by
+// the ID in the header, so files written before a key rotation stay readable
+// as long as the old key is kept in the key file.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// KeyEnv holds a single base64 encoded key, used when no key file is set.
+const KeyEnv = "KEEV_ENCRYPTION_KEY"
+
+// EnvKeyID is the key ID given to the key read from KeyEnv.
+const EnvKeyID = "env"
+
+// MagicLen is the number of bytes IsEncrypted needs to recognize a file.
+const MagicLen = len(magic)
+
+const (
+	magic      = "KEEVENC1"
+	prefixSize = 8
+	chunkSize  = 64 << 10
+	finalChunk = 1 << 31 // set in the length of the last chunk
+)
+
+var (
+	ErrNoKeys       = errors.New("no encryption keys configured")
+	ErrNoActiveKey  = errors.New("active encryption key is missing")
+	ErrUnknownKeyID = errors.New("file encrypted with an unknown key")
+	ErrCorrupt      = errors.New("encrypted file is truncated or has been tampered with")
+)
+
+// KeyConfig describes a single key in the key file.
+type KeyConfig struct {
+	ID  string `json:"id"`
+	Key string `json:"key"` // 32 bytes, base64 encoded
+}
+
+// KeyFile is the on-disk layout of the encryption key file.
+type KeyFile struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+// KeyRing holds the key new files are encrypted with along with every key
+// files may still be encrypted with, indexed by key ID. It is safe for
+// concurrent use and can be reloaded in place to rotate keys.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// LoadKeyRing loads keys from the key file at path or, if path is empty, a
+// single key from KEEV_ENCRYPTION_KEY.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	k := &KeyRing{}
+	if err := k.Reload(path); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload replaces the keys in the ring, following the same lookup rules as
+// LoadKeyRing. The ring is left untouched if loading fails.
+func (k *KeyRing) Reload(path string) error {
+	if path == "" {
+		key := os.Getenv(KeyEnv)
+		if key == "" {
+			return ErrNoKeys
+		}
+		return k.load(&KeyFile{Active: EnvKeyID, Keys: []KeyConfig{{ID: EnvKeyID, Key: key}}})
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return k.Load(file)
+}
+
+// Load reads a key file from r.
+func (k *KeyRing) Load(r io.Reader) error {
+	var kf KeyFile
+	if err := json.NewDecoder(r).Decode(&kf); err != nil {
+		return err
+	}
+	return k.load(&kf)
+}
+
+func (k *KeyRing) load(kf *KeyFile) error {
+	if len(kf.Keys) == 0 {
+		return ErrNoKeys
+	}
+	keys := make(map[string]cipher.AEAD, len(kf.Keys))
+	for _, c := range kf.Keys {
+		if c.ID == "" || len(c.ID) > 255 {
+			return fmt.Errorf("encryption key without id or with an id over 255 bytes")
+		}
+		if _, ok := keys[c.ID]; ok {
+			return fmt.Errorf("duplicate encryption key %q", c.ID)
+		}
+		aead, err := newAEAD(c.Key)
+		if err != nil {
+			return fmt.Errorf("encryption key %q: %s", c.ID, err)
+		}
+		keys[c.ID] = aead
+	}
+	if _, ok := keys[kf.Active]; !ok {
+		return ErrNoActiveKey
+	}
+
+	k.mu.Lock()
+	k.active = kf.Active
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func newAEAD(encoded string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("key is not valid base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected a 32 byte key, got %d bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Active returns the ID of the key new files are encrypted with.
+func (k *KeyRing) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *KeyRing) key(id string) (cipher.AEAD, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	aead, ok := k.keys[id]
+	return aead, ok
+}
+
+// IsEncrypted reports whether a file starting with header was written by
+// NewWriter. header should hold at least the first MagicLen bytes of the
+// file.
+func IsEncrypted(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(magic))
+}
+
+// KeyID returns the ID of the key the file read by r was encrypted with.
+func KeyID(r io.Reader) (string, error) {
+	header, err := readHeader(bufio.NewReader(r))
+	if err != nil {
+		return "", err
+	}
+	return header.keyID, nil
+}
+
+// Seal encrypts a small message, such as a log record, on its own with the
+// active key. The result holds the key ID and a random nonce.
+func (k *KeyRing) Seal(plain []byte) ([]byte, error) {
+	k.mu.RLock()
+	id, aead := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	sealed := make([]byte, 1+len(id)+aead.NonceSize(), 1+len(id)+aead.NonceSize()+len(plain)+aead.Overhead())
+	sealed[0] = byte(len(id))
+	copy(sealed[1:], id)
+	nonce := sealed[1+len(id):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, nonce, plain, sealed[:1+len(id)]), nil
+}
+
+// Open decrypts a message encrypted by Seal.
+func (k *KeyRing) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 || len(sealed) < 1+int(sealed[0]) {
+		return nil, ErrCorrupt
+	}
+	id := string(sealed[1 : 1+sealed[0]])
+	aead, ok := k.key(id)
+	if !ok {
+		return nil, fmt.Errorf("%s: %q", ErrUnknownKeyID, id)
+	}
+	rest := sealed[1+len(id):]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCorrupt
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], sealed[:1+len(id)])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
+
+// Writer encrypts what is written to it. Close must be called to write the
+// last chunk.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	n      uint32 // number of the next chunk
+	buf    []byte
+	out    []byte
+}
+
+// NewWriter writes the header to w and returns a Writer encrypting with the
+// active key.
+func (k *KeyRing) NewWriter(w io.Writer) (*Writer, error) {
+	k.mu.RLock()
+	id, aead := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	header := make([]byte, 0, len(magic)+1+len(id)+prefixSize)
+	header = append(header, magic...)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close writes the last chunk, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.seal(true)
+}
+
+func (w *Writer) seal(final bool) error {
+	length := uint32(len(w.buf))
+	if final {
+		length |= finalChunk
+	}
+	w.out = appendUint32(w.out[:0], length)
+	w.out = w.aead.Seal(w.out, nonce(w.prefix, w.n), w.buf, additionalData(w.header, length))
+	w.n++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(w.out)
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func nonce(prefix []byte, n uint32) []byte {
+	return appendUint32(append([]byte(nil), prefix...), n)
+}
+
+// additionalData binds a chunk to its file and its length, including the
+// final flag.
+func additionalData(header []byte, length uint32) []byte {
+	return appendUint32(append([]byte(nil), header...), length)
+}
+
+type header struct {
+	raw    []byte
+	keyID  string
+	prefix []byte
+}
+
+func readHeader(r *bufio.Reader) (*header, error) {
+	start := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return nil, ErrCorrupt
+	}
+	if !IsEncrypted(start) {
+		return nil, errors.New("not an encrypted file")
+	}
+	rest := make([]byte, int(start[len(magic)])+prefixSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, ErrCorrupt
+	}
+	raw := append(start, rest...)
+	return &header{
+		raw:    raw,
+		keyID:  string(rest[:len(rest)-prefixSize]),
+		prefix: rest[len(rest)-prefixSize:],
+	}, nil
+}
+
+// Reader decrypts a file written by a Writer.
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header *header
+	n      uint32
+	buf    []byte // decrypted data not read yet
+	chunk  []byte
+	done   bool
+}
+
+// NewReader reads the header from r and returns a Reader decrypting the rest
+// with the key named in the header.
+func (k *KeyRing) NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := k.key(h.keyID)
+	if !ok {
+		return nil, fmt.Errorf("%s: %q", ErrUnknownKeyID, h.keyID)
+	}
+	return &Reader{r: br, aead: aead, header: h}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (r *Reader) open() error {
+	var l [4]byte
+	if _, err := io.ReadFull(r.r, l[:]); err != nil {
+		return ErrCorrupt
+	}
+	length := binary.BigEndian.Uint32(l[:])
+	size := length &^ finalChunk
+	if size > chunkSize {
+		return ErrCorrupt
+	}
+	if cap(r.chunk) < int(size)+r.aead.Overhead() {
+		r.chunk = make([]byte, int(size)+r.aead.Overhead())
+	}
+	sealed := r.chunk[:int(size)+r.aead.Overhead()]
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return ErrCorrupt
+	}
+	plain, err := r.aead.Open(sealed[:0], nonce(r.header.prefix, r.n), sealed, additionalData(r.header.raw, length))
+	if err != nil {
+		return ErrCorrupt
+	}
+	r.n++
+	r.buf = plain
+	if length&finalChunk != 0 {
+		// nothing may follow the last chunk
+		if _, err := r.r.ReadByte(); err != io.EOF {
+			return ErrCorrupt
+		}
+		r.done = true
+	}
+	return nil
+}
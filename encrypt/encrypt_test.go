@@ -0,0 +1,164 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newKeyRing(t *testing.T, kf *KeyFile) *KeyRing {
+	k := &KeyRing{}
+	if err := k.load(kf); err != nil {
+		t.Fatalf("failed to load keys: %s", err.Error())
+	}
+	return k
+}
+
+func encrypt(t *testing.T, k *KeyRing, plain []byte) []byte {
+	var buf bytes.Buffer
+	w, err := k.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("failed to create writer: %s", err.Error())
+	}
+	// odd sized writes cross chunk boundaries
+	for len(plain) > 0 {
+		n := 1000
+		if n > len(plain) {
+			n = len(plain)
+		}
+		w.Write(plain[:n])
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func decrypt(k *KeyRing, b []byte) ([]byte, error) {
+	r, err := k.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func Test_EncryptRoundTrip(t *testing.T) {
+	k := newKeyRing(t, &KeyFile{Active: "a", Keys: []KeyConfig{{ID: "a", Key: newKey()}}})
+	for _, size := range []int{0, 1, chunkSize, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		b := encrypt(t, k, plain)
+		if !IsEncrypted(b) {
+			t.Fatalf("expected encrypted file to be detected")
+		}
+		if size > 16 && bytes.Contains(b, plain[:size/2]) {
+			t.Fatalf("plaintext found in encrypted file")
+		}
+		got, err := decrypt(k, b)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes: failed to decrypt: %v", size, err)
+		}
+	}
+}
+
+func Test_EncryptRotation(t *testing.T) {
+	old, next := KeyConfig{ID: "2026-01", Key: newKey()}, KeyConfig{ID: "2026-07", Key: newKey()}
+	before := newKeyRing(t, &KeyFile{Active: old.ID, Keys: []KeyConfig{old}})
+	b := encrypt(t, before, []byte("secret"))
+
+	after := newKeyRing(t, &KeyFile{Active: next.ID, Keys: []KeyConfig{old, next}})
+	if got, err := decrypt(after, b); err != nil || string(got) != "secret" {
+		t.Fatalf("file encrypted with the previous key not readable: %v", err)
+	}
+	if id, _ := KeyID(bytes.NewReader(b)); id != old.ID {
+		t.Fatalf("expected key ID %q, got %q", old.ID, id)
+	}
+	if id, _ := KeyID(bytes.NewReader(encrypt(t, after, nil))); id != next.ID {
+		t.Fatalf("expected new files to use %q, got %q", next.ID, id)
+	}
+
+	removed := newKeyRing(t, &KeyFile{Active: next.ID, Keys: []KeyConfig{next}})
+	if _, err := decrypt(removed, b); err == nil || !strings.Contains(err.Error(), ErrUnknownKeyID.Error()) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func Test_EncryptTamper(t *testing.T) {
+	k := newKeyRing(t, &KeyFile{Active: "a", Keys: []KeyConfig{{ID: "a", Key: newKey()}}})
+	plain := make([]byte, 2*chunkSize+5)
+	b := encrypt(t, k, plain)
+
+	for _, n := range []int{len(b) - 1, len(b) - 21, 2*chunkSize + 20} {
+		if _, err := decrypt(k, b[:n]); err != ErrCorrupt {
+			t.Fatalf("file truncated to %d of %d bytes: expected ErrCorrupt, got %v", n, len(b), err)
+		}
+	}
+	flipped := append([]byte(nil), b...)
+	flipped[len(flipped)/2] ^= 1
+	if _, err := decrypt(k, flipped); err != ErrCorrupt {
+		t.Fatalf("expected tampering to be detected, got %v", err)
+	}
+	if _, err := decrypt(k, append(b, 0)); err != ErrCorrupt {
+		t.Fatalf("expected trailing data to be detected, got %v", err)
+	}
+	other := newKeyRing(t, &KeyFile{Active: "a", Keys: []KeyConfig{{ID: "a", Key: newKey()}}})
+	if _, err := decrypt(other, b); err != ErrCorrupt {
+		t.Fatalf("expected a different key with the same ID to fail, got %v", err)
+	}
+}
+
+func Test_EncryptSeal(t *testing.T) {
+	old := KeyConfig{ID: "a", Key: newKey()}
+	k := newKeyRing(t, &KeyFile{Active: "a", Keys: []KeyConfig{old}})
+	sealed, err := k.Seal([]byte("record"))
+	if err != nil {
+		t.Fatalf("failed to seal: %s", err.Error())
+	}
+	again, _ := k.Seal([]byte("record"))
+	if bytes.Equal(sealed, again) {
+		t.Fatalf("expected a fresh nonce for every message")
+	}
+	rotated := newKeyRing(t, &KeyFile{Active: "b", Keys: []KeyConfig{old, {ID: "b", Key: newKey()}}})
+	if plain, err := rotated.Open(sealed); err != nil || string(plain) != "record" {
+		t.Fatalf("failed to open: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := k.Open(sealed); err != ErrCorrupt {
+		t.Fatalf("expected tampering to be detected, got %v", err)
+	}
+	if _, err := k.Open(sealed[:3]); err != ErrCorrupt {
+		t.Fatalf("expected a short message to be rejected, got %v", err)
+	}
+}
+
+func Test_EncryptKeyRing(t *testing.T) {
+	k := &KeyRing{}
+	if err := k.load(&KeyFile{Active: "a", Keys: []KeyConfig{{ID: "a", Key: "c2hvcnQ="}}}); err == nil {
+		t.Fatalf("expected short key to be rejected")
+	}
+	if err := k.load(&KeyFile{Active: "b", Keys: []KeyConfig{{ID: "a", Key: newKey()}}}); err != ErrNoActiveKey {
+		t.Fatalf("expected missing active key to be rejected, got %v", err)
+	}
+
+	os.Setenv(KeyEnv, newKey())
+	defer os.Unsetenv(KeyEnv)
+	k, err := LoadKeyRing("")
+	if err != nil || k.Active() != EnvKeyID {
+		t.Fatalf("failed to load key from %s: %v", KeyEnv, err)
+	}
+	os.Unsetenv(KeyEnv)
+	if _, err := LoadKeyRing(""); err != ErrNoKeys {
+		t.Fatalf("expected ErrNoKeys, got %v", err)
+	}
+}
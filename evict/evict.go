@@ -0,0 +1,275 @@
+// Package evict keeps the access and expiry metadata of keys and picks keys
+// to evict when memory runs out.
+//
+// Like Redis, eviction is approximate: a handful of keys are sampled and the
+// best candidate among them according to the Policy is evicted. This keeps
+// the cost of every access constant.
+package evict
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultSamples is the number of keys sampled to pick a victim.
+const DefaultSamples = 5
+
+// Entry is the metadata kept for a key.
+type Entry struct {
+	Key     string
+	Access  int64  // unix nanoseconds of the last access
+	Hits    uint64 // number of accesses
+	Expires int64  // unix seconds, 0 if the key does not expire
+}
+
+// Policy chooses which keys to evict.
+type Policy interface {
+	// Name is the name used to configure the policy.
+	Name() string
+	// Volatile returns true if only keys with an expiry may be evicted.
+	Volatile() bool
+	// Less returns true if a should be evicted before b.
+	Less(a, b *Entry) bool
+}
+
+type lru struct{}
+
+func (lru) Name() string          { return "allkeys-lru" }
+func (lru) Volatile() bool        { return false }
+func (lru) Less(a, b *Entry) bool { return a.Access < b.Access }
+
+type lfu struct{}
+
+func (lfu) Name() string   { return "allkeys-lfu" }
+func (lfu) Volatile() bool { return false }
+func (lfu) Less(a, b *Entry) bool {
+	if a.Hits != b.Hits {
+		return a.Hits < b.Hits
+	}
+	return a.Access < b.Access
+}
+
+type volatileTTL struct{}
+
+func (volatileTTL) Name() string          { return "volatile-ttl" }
+func (volatileTTL) Volatile() bool        { return true }
+func (volatileTTL) Less(a, b *Entry) bool { return a.Expires < b.Expires }
+
+// NoEviction is the name of the policy that never evicts, writes fail instead.
+const NoEviction = "noeviction"
+
+var policies = map[string]Policy{
+	"allkeys-lru":  lru{},
+	"allkeys-lfu":  lfu{},
+	"volatile-ttl": volatileTTL{},
+}
+
+// Lookup returns the policy with the given name, nil for NoEviction.
+func Lookup(name string) (Policy, error) {
+	if name == NoEviction {
+		return nil, nil
+	}
+	if p, ok := policies[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %q, expected %s, allkeys-lru, allkeys-lfu or volatile-ttl", name, NoEviction)
+}
+
+// Stats are the eviction and expiry counters.
+type Stats struct {
+	Evicted uint64
+	Expired uint64
+}
+
+// Tracker holds the metadata of every key. It is safe for concurrent use.
+type Tracker struct {
+	// Samples is the number of keys sampled to pick a victim.
+	Samples int
+
+	mu       sync.Mutex
+	policy   Policy
+	entries  map[string]*Entry
+	volatile map[string]*Entry // entries with an expiry
+	stats    Stats
+	now      func() time.Time
+}
+
+// New returns an empty Tracker evicting with policy, which may be nil.
+func New(policy Policy) *Tracker {
+	return &Tracker{
+		Samples:  DefaultSamples,
+		policy:   policy,
+		entries:  make(map[string]*Entry),
+		volatile: make(map[string]*Entry),
+		now:      time.Now,
+	}
+}
+
+// SetPolicy changes the eviction policy, nil for NoEviction.
+func (t *Tracker) SetPolicy(policy Policy) {
+	t.mu.Lock()
+	t.policy = policy
+	t.mu.Unlock()
+}
+
+func (t *Tracker) get(key string) *Entry {
+	e, ok := t.entries[key]
+	if !ok {
+		e = &Entry{Key: key}
+		t.entries[key] = e
+	}
+	return e
+}
+
+// Touch records an access to key.
+func (t *Tracker) Touch(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.get(key)
+	e.Access = t.now().UnixNano()
+	e.Hits++
+}
+
+// SetExpiry sets the unix time in seconds at which key expires, 0 to keep it
+// forever.
+func (t *Tracker) SetExpiry(key string, expires int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.get(key)
+	e.Expires = expires
+	if expires == 0 {
+		delete(t.volatile, key)
+	} else {
+		t.volatile[key] = e
+	}
+}
+
+// Expiry returns the expiry of key, 0 if it does not expire.
+func (t *Tracker) Expiry(key string) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.volatile[key]; ok {
+		return e.Expires
+	}
+	return 0
+}
+
+// IsExpired returns true if key has an expiry that has passed.
+func (t *Tracker) IsExpired(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.volatile[key]
+	return ok && e.Expires <= t.now().Unix()
+}
+
+// ExpiredKeys returns every key whose expiry has passed.
+func (t *Tracker) ExpiredKeys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now().Unix()
+	var keys []string
+	for key, e := range t.volatile {
+		if e.Expires <= now {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Remove forgets key.
+func (t *Tracker) Remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+	delete(t.volatile, key)
+}
+
+// Evicted forgets key and counts it as evicted.
+func (t *Tracker) Evicted(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+	delete(t.volatile, key)
+	t.stats.Evicted++
+}
+
+// Expired forgets key and counts it as expired.
+func (t *Tracker) Expired(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+	delete(t.volatile, key)
+	t.stats.Expired++
+}
+
+// Victim samples keys and returns the one the policy would evict first,
+// skipping exclude. It returns false if the policy is NoEviction or no key
+// can be evicted.
+func (t *Tracker) Victim(exclude string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.policy == nil {
+		return "", false
+	}
+	candidates := t.entries
+	if t.policy.Volatile() {
+		candidates = t.volatile
+	}
+	var victim *Entry
+	n := 0
+	// map iteration starts at a random position, which is good enough for
+	// sampling
+	for key, e := range candidates {
+		if key == exclude {
+			continue
+		}
+		if victim == nil || t.policy.Less(e, victim) {
+			victim = e
+		}
+		if n++; n >= t.Samples {
+			break
+		}
+	}
+	if victim == nil {
+		return "", false
+	}
+	return victim.Key, true
+}
+
+// Stats returns the eviction and expiry counters.
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// Expiries returns the expiry of every volatile key.
+func (t *Tracker) Expiries() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expires := make(map[string]int64, len(t.volatile))
+	for key, e := range t.volatile {
+		expires[key] = e.Expires
+	}
+	return expires
+}
+
+// MarshalJSON writes the expiry of every volatile key, the access metadata is
+// not worth keeping across restarts.
+func (t *Tracker) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Expiries())
+}
+
+// UnmarshalJSON restores the expiries written by MarshalJSON.
+func (t *Tracker) UnmarshalJSON(b []byte) error {
+	var expires map[string]int64
+	if err := json.Unmarshal(b, &expires); err != nil {
+		return err
+	}
+	for key, exp := range expires {
+		t.SetExpiry(key, exp)
+	}
+	return nil
+}
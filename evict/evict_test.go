@@ -0,0 +1,109 @@
+package evict
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTracker returns a tracker whose clock advances one second per call.
+func newTracker(t *testing.T, name string) *Tracker {
+	policy, err := Lookup(name)
+	if err != nil {
+		t.Fatalf("failed to look up policy: %s", err.Error())
+	}
+	tr := New(policy)
+	now := time.Unix(1000, 0)
+	tr.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return tr
+}
+
+func Test_EvictLRU(t *testing.T) {
+	tr := newTracker(t, "allkeys-lru")
+	tr.Touch("a")
+	tr.Touch("b")
+	tr.Touch("c")
+	tr.Touch("a")
+
+	if key, ok := tr.Victim(""); !ok || key != "b" {
+		t.Fatalf("expected b to be evicted, got %q", key)
+	}
+	if key, ok := tr.Victim("b"); !ok || key != "c" {
+		t.Fatalf("expected c to be evicted when b is excluded, got %q", key)
+	}
+}
+
+func Test_EvictLFU(t *testing.T) {
+	tr := newTracker(t, "allkeys-lfu")
+	tr.Touch("a")
+	tr.Touch("a")
+	tr.Touch("b")
+	tr.Touch("c")
+	tr.Touch("c")
+	tr.Touch("b")
+	tr.Touch("b")
+
+	if key, ok := tr.Victim(""); !ok || key != "a" {
+		t.Fatalf("expected a to be evicted, got %q", key)
+	}
+}
+
+func Test_EvictVolatileTTL(t *testing.T) {
+	tr := newTracker(t, "volatile-ttl")
+	tr.Touch("forever")
+	tr.SetExpiry("late", 5000)
+	tr.SetExpiry("soon", 2000)
+
+	if key, ok := tr.Victim(""); !ok || key != "soon" {
+		t.Fatalf("expected soon to be evicted, got %q", key)
+	}
+	tr.Evicted("soon")
+	tr.Remove("late")
+	if key, ok := tr.Victim(""); ok {
+		t.Fatalf("key without expiry %q evicted", key)
+	}
+	if tr.Stats().Evicted != 1 {
+		t.Fatalf("eviction not counted")
+	}
+}
+
+func Test_EvictNoEviction(t *testing.T) {
+	tr := newTracker(t, NoEviction)
+	tr.Touch("a")
+	if _, ok := tr.Victim(""); ok {
+		t.Fatalf("noeviction evicted a key")
+	}
+	if _, err := Lookup("random"); err == nil {
+		t.Fatalf("unknown policy accepted")
+	}
+}
+
+func Test_EvictExpiry(t *testing.T) {
+	tr := newTracker(t, NoEviction)
+	tr.SetExpiry("old", 500)
+	tr.SetExpiry("new", 5000)
+	tr.SetExpiry("cleared", 500)
+	tr.SetExpiry("cleared", 0)
+
+	if !tr.IsExpired("old") || tr.IsExpired("new") || tr.IsExpired("cleared") {
+		t.Fatalf("expiry not tracked correctly")
+	}
+	if keys := tr.ExpiredKeys(); len(keys) != 1 || keys[0] != "old" {
+		t.Fatalf("unexpected expired keys %v", keys)
+	}
+
+	b, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatalf("failed to marshal expiries: %s", err.Error())
+	}
+	restored := New(nil)
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatalf("failed to unmarshal expiries: %s", err.Error())
+	}
+	if restored.Expiry("old") != 500 || restored.Expiry("new") != 5000 || restored.Expiry("cleared") != 0 {
+		t.Fatalf("expiries not restored: %s", b)
+	}
+}
@@ -0,0 +1,86 @@
+// Package hlc implements hybrid logical clocks, which order the writes made
+// at several sites.
+//
+// A timestamp is the wall time in milliseconds followed by a logical
+// counter, packed in a uint64 so timestamps compare as integers. A clock
+// never goes back: it follows the wall time while it is ahead, counts up
+// from the last timestamp otherwise, and moves past every timestamp it
+// receives from another site. A write that saw another thus always gets a
+// later timestamp, even if the clocks of the sites disagree.
+package hlc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// logicalBits is the size of the logical counter.
+const logicalBits = 16
+
+// Timestamp is a time of a hybrid logical clock.
+type Timestamp uint64
+
+// New returns the timestamp of wall time t with the logical counter l.
+func New(t time.Time, l uint16) Timestamp {
+	return Timestamp(uint64(t.UnixNano()/int64(time.Millisecond))<<logicalBits | uint64(l))
+}
+
+// Time returns the wall time of t, to the millisecond.
+func (t Timestamp) Time() time.Time {
+	ms := int64(t >> logicalBits)
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+// Logical returns the logical counter of t.
+func (t Timestamp) Logical() uint16 {
+	return uint16(t & (1<<logicalBits - 1))
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%s+%d", t.Time().UTC().Format("2006-01-02T15:04:05.000Z"), t.Logical())
+}
+
+// Clock is a hybrid logical clock, safe for concurrent use.
+type Clock struct {
+	mu   sync.Mutex
+	last Timestamp
+	now  func() time.Time
+}
+
+// NewClock returns a clock reading the wall time with now, time.Now if nil.
+func NewClock(now func() time.Time) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+	return &Clock{now: now}
+}
+
+// Now returns a timestamp later than every one the clock returned or
+// received.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if wall := New(c.now(), 0); wall > c.last {
+		c.last = wall
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// Update moves the clock past t, a timestamp received from another site.
+func (c *Clock) Update(t Timestamp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t > c.last {
+		c.last = t
+	}
+}
+
+// Last returns the last timestamp the clock returned or received.
+func (c *Clock) Last() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
@@ -0,0 +1,43 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ClockNow(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	c := NewClock(func() time.Time { return wall })
+	first := c.Now()
+	if first.Time() != wall || first.Logical() != 0 {
+		t.Fatalf("expected the wall time, got %s", first)
+	}
+	// the wall time stands still, then goes back
+	if next := c.Now(); next <= first || next.Logical() != 1 {
+		t.Fatalf("expected the counter to go up, got %s after %s", next, first)
+	}
+	wall = wall.Add(-time.Second)
+	if next := c.Now(); next <= first || next.Time() != first.Time() || next.Logical() != 2 {
+		t.Fatalf("expected the clock not to go back, got %s after %s", next, first)
+	}
+	wall = wall.Add(2 * time.Second)
+	if next := c.Now(); next.Time() != wall || next.Logical() != 0 {
+		t.Fatalf("expected the wall time again, got %s", next)
+	}
+}
+
+func Test_ClockUpdate(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	c := NewClock(func() time.Time { return wall })
+	c.Now()
+	// another site is a minute ahead
+	remote := New(wall.Add(time.Minute), 5)
+	c.Update(remote)
+	if next := c.Now(); next <= remote {
+		t.Fatalf("expected a timestamp after %s, got %s", remote, next)
+	}
+	c.Update(New(wall, 0))
+	if c.Last() <= remote {
+		t.Fatalf("expected an older timestamp to be ignored, got %s", c.Last())
+	}
+}
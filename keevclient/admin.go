@@ -0,0 +1,270 @@
+package keevclient
+
+import (
+	"io"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The requests below need no namespace. All but Usage of the caller are for
+// admins only; those changing the server return the message it answered.
+// Like the others they may fail over to another server, which then answers
+// about itself; Backup and Restore are neither retried nor failed over.
+
+// backupChunkSize is the size of the chunks a backup is restored in.
+const backupChunkSize = 64 << 10
+
+// Usage returns the keys and bytes stored by username and each of their
+// namespaces, with their quotas; by the caller if username is empty.
+func (c *Client) Usage(ctx context.Context, username string) (*pb.UsageResponse, error) {
+	var resp *pb.UsageResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.Usage(ctx, &pb.UsageRequest{Username: username}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// CreateAPIKey creates an API key acting on behalf of a user; the returned
+// key is the only place its secret is found.
+func (c *Client) CreateAPIKey(ctx context.Context, in *pb.APIKeyRequest) (*pb.APIKey, error) {
+	var resp *pb.APIKey
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.CreateAPIKey(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// RevokeAPIKey revokes the API key id.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.RevokeAPIKey(ctx, &pb.APIKeyID{Id: id}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// ListAPIKeys returns every API key, without their secrets.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]*pb.APIKey, error) {
+	var resp *pb.APIKeyList
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.ListAPIKeys(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// QueryAudit returns the audit records matching query, oldest first.
+func (c *Client) QueryAudit(ctx context.Context, query *pb.AuditQuery) ([]*pb.AuditRecord, error) {
+	var resp *pb.AuditRecords
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.QueryAudit(ctx, query, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Records, nil
+}
+
+// Stats returns the memory and rate limit statistics of the server.
+func (c *Client) Stats(ctx context.Context) (*pb.StatsResponse, error) {
+	var resp *pb.StatsResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.Stats(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// Reencrypt reloads the encryption keys of the server and rewrites its data
+// with the active one.
+func (c *Client) Reencrypt(ctx context.Context) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.Reencrypt(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// Backup writes a snapshot of the whole store, a user or a namespace to w
+// and returns its size.
+func (c *Client) Backup(ctx context.Context, w io.Writer, username, namespace string) (int64, error) {
+	// canceling ends the stream if w fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.server().direct.Backup(c.outgoing(ctx), &pb.BackupRequest{Username: username, Namespace: namespace})
+	if err != nil {
+		return 0, convert(err)
+	}
+	var size int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, convert(err)
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return size, err
+		}
+		size += int64(len(chunk.Data))
+	}
+}
+
+// Restore replaces the whole store, a user or a namespace with the backup
+// read from r, or only checks it if dryRun is true.
+func (c *Client) Restore(ctx context.Context, r io.Reader, username, namespace string, dryRun bool) (*pb.RestoreResponse, error) {
+	// canceling aborts the restore if r fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.server().direct.Restore(c.outgoing(ctx))
+	if err != nil {
+		return nil, convert(err)
+	}
+	chunk := &pb.RestoreChunk{Username: username, Namespace: namespace, DryRun: dryRun}
+	buf := make([]byte, backupChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 || chunk != nil {
+			if chunk == nil {
+				chunk = &pb.RestoreChunk{}
+			}
+			chunk.Data = buf[:n]
+			if serr := stream.Send(chunk); serr != nil {
+				break // the error is returned by CloseAndRecv
+			}
+			chunk = nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	return resp, convert(err)
+}
+
+// ClusterStatus returns the state of the cluster as the node sees it, with
+// the lag of every node when asked to the leader.
+func (c *Client) ClusterStatus(ctx context.Context) (*pb.ClusterStatusResponse, error) {
+	var resp *pb.ClusterStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.ClusterStatus(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// AddMember adds the node id at addr to the cluster, as a learner or as a
+// voter once it caught up.
+func (c *Client) AddMember(ctx context.Context, id, addr string, learner bool) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.AddMember(ctx, &pb.MemberRequest{Id: id, Addr: addr, Learner: learner}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// PromoteMember makes the learner id a voter once it caught up.
+func (c *Client) PromoteMember(ctx context.Context, id string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.PromoteMember(ctx, &pb.MemberRequest{Id: id}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// RemoveMember removes the node id from the cluster.
+func (c *Client) RemoveMember(ctx context.Context, id string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.RemoveMember(ctx, &pb.MemberRequest{Id: id}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// TransferLeadership hands leadership over to the voter id.
+func (c *Client) TransferLeadership(ctx context.Context, id string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.TransferLeadership(ctx, &pb.MemberRequest{Id: id}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// ReplicationStatus returns the role of the server in primary-replica
+// replication, with the lag of a replica or of every replica of a primary.
+func (c *Client) ReplicationStatus(ctx context.Context) (*pb.ReplicationStatusResponse, error) {
+	var resp *pb.ReplicationStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.ReplicationStatus(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// ShardStatus returns the shard map of the server and the keys it is
+// moving.
+func (c *Client) ShardStatus(ctx context.Context) (*pb.ShardStatusResponse, error) {
+	var resp *pb.ShardStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.ShardStatus(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// AddShard adds the server id at addr to the shard map.
+func (c *Client) AddShard(ctx context.Context, id, addr string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.AddShard(ctx, &pb.ShardNode{Id: id, Addr: addr}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// RemoveShard removes the server id from the shard map.
+func (c *Client) RemoveShard(ctx context.Context, id string) (string, error) {
+	var resp *pb.Response
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.RemoveShard(ctx, &pb.ShardNode{Id: id}, opts...)
+		return err
+	})
+	return message(resp, err)
+}
+
+// SiteStatus returns the sites the server exchanges writes with, and how
+// far behind each of them it is.
+func (c *Client) SiteStatus(ctx context.Context) (*pb.SiteStatusResponse, error) {
+	var resp *pb.SiteStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.SiteStatus(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	return resp, err
+}
+
+func message(resp *pb.Response, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
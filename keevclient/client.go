@@ -0,0 +1,323 @@
+// Package keevclient is a client of keev servers. A Client authenticates
+// with a username and password, a client certificate or an API key, sends
+// the requests for the keys of a namespace once Use selects it and, talking
+// to a sharded store, sends each of them to the shard holding its key.
+//
+//	c, err := keevclient.Dial("localhost:1234", keevclient.WithTLS(config), keevclient.WithLogin("user", "secret"))
+//	if err != nil {
+//		...
+//	}
+//	defer c.Close()
+//	if err := c.Use(ctx, "db"); err != nil {
+//		...
+//	}
+//	err = c.Set(ctx, "greeting", "hello", time.Hour)
+package keevclient
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/shard"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys the server reads.
+const (
+	requestIDHeader    = "x-request-id"
+	tokenHeader        = "token"
+	usernameHeader     = "username"
+	passwordHeader     = "password"
+	apiKeyHeader       = "api-key"
+	consistencyHeader  = "keev-consistency"
+	maxStalenessHeader = "keev-max-staleness"
+)
+
+// Read consistencies, see SetReadConsistency.
+const (
+	Linearizable = "linearizable"
+	Lease        = "lease"
+	Bounded      = "bounded"
+	Local        = "local"
+)
+
+// Client is a connection to a keev server, or to the first of several that
+// answers. It is safe for concurrent use; the namespace, credentials and read
+// consistency are shared by every request made with it.
+type Client struct {
+	opts    []grpc.DialOption // to dial the other servers and shards
+	timeout time.Duration
+	retry   RetryPolicy
+
+	mu           sync.RWMutex
+	servers      []*server
+	current      int // the server requests are sent to
+	creds        map[string]string
+	namespace    string
+	token        string
+	consistency  string
+	maxStaleness time.Duration
+}
+
+// server is a server the client fails over to.
+type server struct {
+	addr   string
+	conn   *grpc.ClientConn
+	direct pb.KVSClient
+	routed pb.KVSClient // direct, or a *shardedClient; nil until known
+}
+
+type options struct {
+	transport grpc.DialOption
+	creds     map[string]string
+	grpc      []grpc.DialOption
+	timeout   time.Duration
+	retry     RetryPolicy
+	failover  []string
+}
+
+// Option configures a Client in Dial.
+type Option func(*options)
+
+// WithTLS connects over TLS with config, which may hold a client
+// certificate. Without WithTLS or WithInsecure the server certificate is
+// verified against the system roots.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) { o.transport = grpc.WithTransportCredentials(credentials.NewTLS(config)) }
+}
+
+// WithInsecure connects without TLS, which sends credentials in the clear.
+func WithInsecure() Option {
+	return func(o *options) { o.transport = grpc.WithInsecure() }
+}
+
+// WithLogin authenticates every request with a username and password, see
+// also Login.
+func WithLogin(username, password string) Option {
+	return func(o *options) { o.creds = map[string]string{usernameHeader: username, passwordHeader: password} }
+}
+
+// WithAPIKey authenticates every request with an API key.
+func WithAPIKey(key string) Option {
+	return func(o *options) { o.creds = map[string]string{apiKeyHeader: key} }
+}
+
+// WithDialOptions adds gRPC dial options.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.grpc = append(o.grpc, opts...) }
+}
+
+// WithTimeout fails each attempt of a request after d, unless its context
+// ends sooner; the attempt is then retried like one the server did not
+// answer. Backup and Restore are only bounded by their context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetry sets how requests that failed are sent again, DefaultRetry
+// otherwise.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = policy }
+}
+
+// WithFailover adds servers requests are sent to when the server dialed
+// cannot serve them, e.g. the other nodes of a cluster or the replicas of a
+// primary.
+func WithFailover(addrs ...string) Option {
+	return func(o *options) { o.failover = append(o.failover, addrs...) }
+}
+
+// Dial connects to the server at addr, and to those of WithFailover. The
+// connections are made in the background, a server that cannot be reached
+// fails the requests.
+func Dial(addr string, opts ...Option) (*Client, error) {
+	o := &options{transport: grpc.WithTransportCredentials(credentials.NewTLS(nil)), retry: DefaultRetry}
+	for _, opt := range opts {
+		opt(o)
+	}
+	c := &Client{
+		opts:    append([]grpc.DialOption{o.transport}, o.grpc...),
+		timeout: o.timeout,
+		retry:   o.retry,
+		creds:   o.creds,
+	}
+	for _, addr := range append([]string{addr}, o.failover...) {
+		s, err := c.connect(addr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers = append(c.servers, s)
+	}
+	return c, nil
+}
+
+// connect dials the server at addr, in the background.
+func (c *Client) connect(addr string) (*server, error) {
+	conn, err := grpc.Dial(addr, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &server{addr: addr, conn: conn, direct: pb.NewKVSClient(conn)}, nil
+}
+
+// Close closes the connections to the servers and to the other shards.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for _, s := range c.servers {
+		if sc, ok := s.routed.(*shardedClient); ok {
+			sc.Close()
+		}
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Login authenticates the next requests with a username and password,
+// checking them with the server. The namespace in use, if any, is selected
+// again for the user.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	c.mu.Lock()
+	prev, namespace := c.creds, c.namespace
+	c.creds = map[string]string{usernameHeader: username, passwordHeader: password}
+	c.mu.Unlock()
+	var err error
+	if namespace != "" {
+		err = c.Use(ctx, namespace)
+	} else {
+		err = c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) error {
+			_, err := s.direct.Usage(ctx, &pb.UsageRequest{}, opts...)
+			return err
+		})
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.creds = prev
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Use selects the namespace the keys of the next requests are in.
+func (c *Client) Use(ctx context.Context, namespace string) error {
+	var resp *pb.NamespaceResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = s.direct.UseNamespace(ctx, &pb.Namespace{Namespace: namespace}, opts...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.namespace, c.token = namespace, resp.Token
+	c.mu.Unlock()
+	return nil
+}
+
+// Namespace returns the namespace in use, empty until Use.
+func (c *Client) Namespace() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.namespace
+}
+
+// SetReadConsistency chooses how fresh the next reads must be when served by
+// a cluster or a replica: Linearizable, Lease, Bounded, within maxStaleness
+// if not 0, or Local. An empty consistency leaves it to the server.
+func (c *Client) SetReadConsistency(consistency string, maxStaleness time.Duration) error {
+	switch consistency {
+	case "", Linearizable, Lease, Bounded, Local:
+	default:
+		return fmt.Errorf("unknown consistency %q", consistency)
+	}
+	if maxStaleness < 0 {
+		return fmt.Errorf("invalid max staleness %s", maxStaleness)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consistency, c.maxStaleness = consistency, maxStaleness
+	return nil
+}
+
+// ReadConsistency returns the read consistency set by SetReadConsistency.
+func (c *Client) ReadConsistency() (string, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.consistency, c.maxStaleness
+}
+
+// outgoing returns ctx carrying the credentials, token and read consistency
+// of the client, and an ID tagging the request in the server's logs.
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	md := metadata.Pairs(requestIDHeader, newRequestID())
+	c.mu.RLock()
+	for k, v := range c.creds {
+		md.Set(k, v)
+	}
+	if c.token != "" {
+		md.Set(tokenHeader, c.token)
+	}
+	if c.consistency != "" {
+		md.Set(consistencyHeader, c.consistency)
+	}
+	if c.maxStaleness > 0 {
+		md.Set(maxStalenessHeader, c.maxStaleness.String())
+	}
+	c.mu.RUnlock()
+	if prev, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = metadata.Join(prev, md)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// kvs returns the client requests to s are sent with: one routing them to
+// the shards if s is one, asking it the first time.
+func (c *Client) kvs(ctx context.Context, s *server) pb.KVSClient {
+	c.mu.RLock()
+	routed := s.routed
+	c.mu.RUnlock()
+	if routed != nil {
+		return routed
+	}
+	m, err := s.direct.ShardMap(ctx, &google_protobuf.Empty{})
+	switch {
+	case err == nil:
+		routed = newShardedClient(s.direct, c.opts, shard.FromProto(m))
+	case status.Code(err) == codes.FailedPrecondition:
+		routed = s.direct
+	default:
+		// e.g. a shard without a shard map yet, asked again next time
+		return s.direct
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.routed != nil {
+		if sc, ok := routed.(*shardedClient); ok {
+			sc.Close()
+		}
+		return s.routed
+	}
+	s.routed = routed
+	return routed
+}
@@ -0,0 +1,199 @@
+package keevclient
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServer answers the KVS requests the tests make, like a standalone
+// server with the user "user" and password "secret".
+type fakeServer struct {
+	mu     sync.Mutex
+	data   map[string]string
+	tokens map[string]string // namespace by token
+	md     metadata.MD       // of the last request
+	calls  map[string]int    // by method
+	// the next requests for keys fail with fail, setting trailer, or answer
+	// after delay
+	fail    []error
+	trailer metadata.MD
+	delay   time.Duration
+}
+
+func (f *fakeServer) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	name := method[strings.LastIndex(method, "/")+1:]
+	f.mu.Lock()
+	delay := f.delay
+	f.delay = 0
+	f.mu.Unlock()
+	time.Sleep(delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.md = md
+	f.calls[name]++
+	if first(md, "username") != "user" || first(md, "password") != "secret" {
+		return ErrAccessDenied
+	}
+	switch name {
+	case "ShardMap":
+		stream.RecvMsg(&google_protobuf.Empty{})
+		return status.Error(codes.FailedPrecondition, "server is not a shard")
+	case "Usage":
+		stream.RecvMsg(&pb.UsageRequest{})
+		return stream.SendMsg(&pb.UsageResponse{})
+	case "UseNamespace":
+		in := &pb.Namespace{}
+		stream.RecvMsg(in)
+		token := fmt.Sprintf("token-%d", f.calls[name])
+		f.tokens[token] = in.Namespace
+		return stream.SendMsg(&pb.NamespaceResponse{Token: token})
+	}
+	if len(f.fail) > 0 {
+		err := f.fail[0]
+		f.fail = f.fail[1:]
+		if f.trailer != nil {
+			stream.SetTrailer(f.trailer)
+		}
+		return err
+	}
+	if first(md, "token") == "" {
+		return ErrMissingToken
+	}
+	namespace, ok := f.tokens[first(md, "token")]
+	if !ok {
+		return ErrInvalidToken
+	}
+	switch name {
+	case "Set":
+		in := &pb.KeyValuePair{}
+		stream.RecvMsg(in)
+		if _, ok := f.data[namespace+"."+in.Key]; ok {
+			return ErrExists
+		}
+		f.data[namespace+"."+in.Key] = in.Value
+		return stream.SendMsg(&pb.Response{Success: true})
+	case "Get":
+		in := &pb.Key{}
+		stream.RecvMsg(in)
+		v, ok := f.data[namespace+"."+in.Key]
+		if !ok {
+			return ErrNotFound
+		}
+		return stream.SendMsg(&pb.KeyValuePair{Key: in.Key, Value: v, Ttl: 60})
+	case "Has":
+		in := &pb.Key{}
+		stream.RecvMsg(in)
+		_, ok := f.data[namespace+"."+in.Key]
+		return stream.SendMsg(&pb.Response{Success: ok})
+	}
+	return status.Error(codes.Unimplemented, name)
+}
+
+func first(md metadata.MD, key string) string {
+	if len(md[key]) == 0 {
+		return ""
+	}
+	return md[key][0]
+}
+
+// startFakeServer runs a fakeServer on loopback, without TLS.
+func startFakeServer(t *testing.T) (*fakeServer, string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	f := &fakeServer{data: make(map[string]string), tokens: make(map[string]string), calls: make(map[string]int)}
+	g := grpc.NewServer(grpc.UnknownServiceHandler(f.handle))
+	go g.Serve(lis)
+	return f, lis.Addr().String(), g.Stop
+}
+
+func Test_Client(t *testing.T) {
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, err := Dial(addr, WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err.Error())
+	}
+	defer c.Close()
+
+	if err := c.Login(ctx, "user", "wrong"); err != ErrAccessDenied {
+		t.Fatalf("expected the login to be denied, got %v", err)
+	}
+	if err := c.Login(ctx, "user", "secret"); err != nil {
+		t.Fatalf("failed to login: %s", err.Error())
+	}
+	if err := c.Set(ctx, "k", "v", 0); err != ErrMissingToken {
+		t.Fatalf("expected a namespace to be needed, got %v", err)
+	}
+	if err := c.Use(ctx, "db"); err != nil || c.Namespace() != "db" {
+		t.Fatalf("failed to use db: %v", err)
+	}
+
+	if err := c.Set(ctx, "k", "v", 0); err != nil {
+		t.Fatalf("failed to set: %s", err.Error())
+	}
+	if err := c.Set(ctx, "k", "v", 0); err != ErrExists {
+		t.Fatalf("expected the key to exist, got %v", err)
+	}
+	if e, err := c.Get(ctx, "k"); err != nil || e.Value != "v" || e.TTL != time.Minute {
+		t.Fatalf("unexpected entry: %v %v", e, err)
+	}
+	if _, err := c.Get(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("expected the key to be missing, got %v", err)
+	}
+	if found, err := c.Has(ctx, "k"); err != nil || !found {
+		t.Fatalf("expected the key to be found, got %v", err)
+	}
+
+	c.SetReadConsistency(Bounded, 2*time.Second)
+	c.Has(ctx, "k")
+	if first(f.md, "keev-consistency") != "bounded" || first(f.md, "keev-max-staleness") != "2s" || first(f.md, "x-request-id") == "" {
+		t.Fatalf("unexpected metadata: %v", f.md)
+	}
+	if err := c.SetReadConsistency("eventual", 0); err == nil {
+		t.Fatalf("unknown consistency accepted")
+	}
+}
+
+func Test_ClientConcurrent(t *testing.T) {
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, _ := Dial(addr, WithInsecure(), WithLogin("user", "secret"))
+	defer c.Close()
+	c.Use(ctx, "db")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := c.Set(ctx, fmt.Sprint(i), "v", 0); err != nil {
+				t.Errorf("failed to set %d: %s", i, err.Error())
+			}
+			c.Namespace()
+		}(i)
+	}
+	wg.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.data) != 20 {
+		t.Fatalf("expected 20 keys, got %d", len(f.data))
+	}
+}
@@ -0,0 +1,33 @@
+package keevclient
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/status"
+)
+
+// Errors of the server callers may want to tell apart. Other errors are
+// returned as the server sent them, with their gRPC status.
+var (
+	ErrExists       = errors.New("key already exists")
+	ErrNotFound     = errors.New("key does not exist")
+	ErrMissingToken = errors.New("missing token for namespace, use Use() to set a namespace")
+	ErrInvalidToken = errors.New("invalid token for namespace, use Use() to set a namespace")
+	ErrAccessDenied = errors.New("access denied: invalid username or password")
+)
+
+var known = []error{ErrExists, ErrNotFound, ErrMissingToken, ErrInvalidToken, ErrAccessDenied}
+
+// convert returns the error of the package the server sent, err otherwise.
+func convert(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := status.Convert(err).Message()
+	for _, e := range known {
+		if msg == e.Error() {
+			return e
+		}
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package keevclient
+
+import (
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Entry is a key-value pair of the namespace in use.
+type Entry struct {
+	Key   string
+	Value string
+	TTL   time.Duration // left before the key expires, 0 if it does not
+	// Siblings are the values written concurrently at other sites, kept
+	// besides Value by sites resolving conflicts with siblings
+	Siblings []Sibling
+}
+
+// Sibling is a value written at a site concurrently with another.
+type Sibling struct {
+	Value string
+	Site  string
+	HLC   uint64 // hybrid logical clock timestamp of the write
+}
+
+func entry(kvp *pb.KeyValuePair) *Entry {
+	e := &Entry{Key: kvp.Key, Value: kvp.Value, TTL: time.Duration(kvp.Ttl) * time.Second}
+	for _, s := range kvp.Siblings {
+		e.Siblings = append(e.Siblings, Sibling{Value: s.Value, Site: s.Site, HLC: s.Hlc})
+	}
+	return e
+}
+
+// Set inserts a key-value pair, expiring after ttl if not 0, unless the key
+// is present: it then fails with ErrExists. ttl is rounded down to seconds.
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) error {
+		_, err := c.kvs(ctx, s).Set(ctx, &pb.KeyValuePair{Key: key, Value: value, Ttl: int64(ttl / time.Second)}, opts...)
+		return err
+	})
+}
+
+// Update replaces the value of a key, expiring after ttl if not 0, unless
+// the key is missing: it then fails with ErrNotFound.
+func (c *Client) Update(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) error {
+		_, err := c.kvs(ctx, s).Update(ctx, &pb.KeyValuePair{Key: key, Value: value, Ttl: int64(ttl / time.Second)}, opts...)
+		return err
+	})
+}
+
+// Has returns true if key is present.
+func (c *Client) Has(ctx context.Context, key string) (bool, error) {
+	var resp *pb.Response
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).Has(ctx, &pb.Key{Key: key}, opts...)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Success, nil
+}
+
+// Unset removes key and returns the value it had, or fails with ErrNotFound.
+func (c *Client) Unset(ctx context.Context, key string) (string, error) {
+	var resp *pb.KeyValuePair
+	err := c.call(ctx, false, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).Unset(ctx, &pb.Key{Key: key}, opts...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// Get returns the value of key, or fails with ErrNotFound.
+func (c *Client) Get(ctx context.Context, key string) (*Entry, error) {
+	var resp *pb.KeyValuePair
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).Get(ctx, &pb.Key{Key: key}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry(resp), nil
+}
+
+// Count returns the number of keys. On a sharded store, keys moving between
+// shards may be counted twice.
+func (c *Client) Count(ctx context.Context) (int, error) {
+	var resp *pb.CountResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).Count(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Count), nil
+}
+
+// Keys returns every key.
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	var resp *pb.ShowKeysResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).ShowKeys(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Data returns every key-value pair.
+func (c *Client) Data(ctx context.Context) ([]*Entry, error) {
+	var resp *pb.ShowDataResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).ShowData(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, len(resp.Data))
+	for i, kvp := range resp.Data {
+		entries[i] = entry(kvp)
+	}
+	return entries, nil
+}
+
+// Namespaces returns the namespaces of the user, which need no Use.
+func (c *Client) Namespaces(ctx context.Context) ([]string, error) {
+	var resp *pb.ShowNamespacesResponse
+	err := c.call(ctx, true, func(ctx context.Context, s *server, opts ...grpc.CallOption) (err error) {
+		resp, err = c.kvs(ctx, s).ShowNamespaces(ctx, &google_protobuf.Empty{}, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Namespaces, nil
+}
@@ -0,0 +1,164 @@
+package keevclient
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// leaderHeader is the trailer carrying the address of the server to send a
+// write to, the leader of a cluster or the primary of a replica.
+const leaderHeader = "keev-leader"
+
+// RetryPolicy says how often, and how soon, a request that failed is sent
+// again. The wait doubles after each attempt, up to MaxBackoff, and is
+// picked at random in its upper half so clients do not retry in step.
+type RetryPolicy struct {
+	Attempts   int           // sends of a request at most, 1 to never retry
+	Backoff    time.Duration // waited before the second attempt
+	MaxBackoff time.Duration // waited between attempts at most
+}
+
+// DefaultRetry is the RetryPolicy of a Client without WithRetry.
+var DefaultRetry = RetryPolicy{Attempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+// refusals begin the messages of servers that did not make a change, so a
+// request that is not idempotent can be sent again: a node that is not the
+// leader, a replica, a server starting up or a throttled client. A request
+// that failed to connect never reached a server.
+var refusals = []string{
+	"connection error",
+	"server is not serving",
+	"the cluster has no leader",
+	"not the leader of the cluster",
+	"server is a read-only replica",
+	"keys are moving between shards",
+	"rate limit exceeded",
+}
+
+func refused(s *status.Status) bool {
+	for _, prefix := range refusals {
+		if strings.HasPrefix(s.Message(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable returns true if the request that failed with err may succeed if
+// sent again. Requests that are not idempotent are only sent again if the
+// server surely did not make them.
+func retryable(err error, idempotent bool) bool {
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.Unavailable:
+		return idempotent || refused(s)
+	case codes.ResourceExhausted:
+		return refused(s) // throttled, not out of quota or memory
+	case codes.DeadlineExceeded, codes.Aborted:
+		return idempotent
+	}
+	return false
+}
+
+// call sends a request with send, again as the retry policy allows when it
+// fails: to the server a redirect names, or to the next server if the one
+// it was sent to is unavailable. A token the server no longer accepts is
+// renewed once, without counting an attempt.
+func (c *Client) call(ctx context.Context, idempotent bool, send func(ctx context.Context, s *server, opts ...grpc.CallOption) error) error {
+	backoff, renewed := c.retry.Backoff, false
+	for attempt := 1; ; attempt++ {
+		s := c.server()
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if c.timeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, c.timeout)
+		}
+		var trailer metadata.MD
+		err := convert(send(c.outgoing(actx), s, grpc.Trailer(&trailer)))
+		cancel()
+		if err == ErrInvalidToken && !renewed {
+			renewed, attempt = true, attempt-1
+			if c.renew(ctx) == nil {
+				continue
+			}
+		}
+		if err == nil || !retryable(err, idempotent) || attempt >= c.retry.Attempts || ctx.Err() != nil {
+			return err
+		}
+		if c.failover(s, err, trailer) {
+			continue // to the server named, right away
+		}
+		select {
+		case <-time.After(jitter(backoff)):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
+}
+
+// jitter returns a random wait between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// server returns the server requests are sent to.
+func (c *Client) server() *server {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.servers[c.current]
+}
+
+// failover picks the server the next attempt of a request that failed on s
+// goes to: the one the trailer names, dialing it if needed, or the next one
+// if s was unavailable. It returns true if the trailer named one.
+func (c *Client) failover(s *server, err error, trailer metadata.MD) bool {
+	if len(trailer[leaderHeader]) > 0 && trailer[leaderHeader][0] != s.addr {
+		addr := trailer[leaderHeader][0]
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, other := range c.servers {
+			if other.addr == addr {
+				c.current = i
+				return true
+			}
+		}
+		other, err := c.connect(addr)
+		if err != nil {
+			return false
+		}
+		c.servers = append(c.servers, other)
+		c.current = len(c.servers) - 1
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		c.mu.Lock()
+		if c.servers[c.current] == s {
+			c.current = (c.current + 1) % len(c.servers)
+		}
+		c.mu.Unlock()
+	}
+	return false
+}
+
+// renew asks for a new token for the namespace in use, once the server no
+// longer accepts the one it gave, e.g. after its signing keys changed.
+func (c *Client) renew(ctx context.Context) error {
+	namespace := c.Namespace()
+	if namespace == "" {
+		return ErrInvalidToken
+	}
+	return c.Use(ctx, namespace)
+}
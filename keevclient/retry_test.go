@@ -0,0 +1,142 @@
+package keevclient
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fastRetry keeps the tests from waiting.
+var fastRetry = WithRetry(RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+
+func Test_ClientRetry(t *testing.T) {
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, _ := Dial(addr, WithInsecure(), WithLogin("user", "secret"), fastRetry)
+	defer c.Close()
+	c.Use(ctx, "db")
+
+	notServing := status.Error(codes.Unavailable, "server is not serving, try again later")
+	f.mu.Lock()
+	f.fail = []error{notServing, notServing}
+	f.mu.Unlock()
+	if err := c.Set(ctx, "k", "v", 0); err != nil || f.calls["Set"] != 3 {
+		t.Fatalf("expected the refused set to be retried, got %v after %d", err, f.calls["Set"])
+	}
+
+	// the server may have made a write it did not answer
+	lost := status.Error(codes.Unavailable, "transport is closing")
+	f.mu.Lock()
+	f.fail = []error{lost}
+	f.mu.Unlock()
+	if err := c.Set(ctx, "other", "v", 0); status.Code(err) != codes.Unavailable || f.calls["Set"] != 4 {
+		t.Fatalf("expected the set not to be retried, got %v after %d", err, f.calls["Set"])
+	}
+	f.mu.Lock()
+	f.fail = []error{lost, lost}
+	f.mu.Unlock()
+	if e, err := c.Get(ctx, "k"); err != nil || e.Value != "v" || f.calls["Get"] != 3 {
+		t.Fatalf("expected the get to be retried, got %v after %d", err, f.calls["Get"])
+	}
+
+	f.mu.Lock()
+	f.fail = []error{lost, lost, lost}
+	f.mu.Unlock()
+	if _, err := c.Get(ctx, "k"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the attempts to run out, got %v", err)
+	}
+	f.mu.Lock()
+	f.fail = []error{status.Error(codes.ResourceExhausted, "quota exceeded")}
+	f.mu.Unlock()
+	if _, err := c.Get(ctx, "k"); status.Code(err) != codes.ResourceExhausted || f.calls["Get"] != 7 {
+		t.Fatalf("expected an exceeded quota not to be retried, got %v after %d", err, f.calls["Get"])
+	}
+}
+
+func Test_ClientRenewToken(t *testing.T) {
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, _ := Dial(addr, WithInsecure(), WithLogin("user", "secret"), fastRetry)
+	defer c.Close()
+	c.Use(ctx, "db")
+	c.Set(ctx, "k", "v", 0)
+
+	f.mu.Lock()
+	f.tokens = make(map[string]string)
+	f.mu.Unlock()
+	if e, err := c.Get(ctx, "k"); err != nil || e.Value != "v" || f.calls["UseNamespace"] != 2 {
+		t.Fatalf("expected the token to be renewed, got %v", err)
+	}
+}
+
+func Test_ClientTimeout(t *testing.T) {
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, _ := Dial(addr, WithInsecure(), WithLogin("user", "secret"), WithTimeout(100*time.Millisecond), fastRetry)
+	defer c.Close()
+	c.Use(ctx, "db")
+	c.Set(ctx, "k", "v", 0)
+
+	f.mu.Lock()
+	f.delay = time.Second
+	f.mu.Unlock()
+	start := time.Now()
+	if e, err := c.Get(ctx, "k"); err != nil || e.Value != "v" {
+		t.Fatalf("expected the slow get to be retried, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("the slow get took %s", time.Since(start))
+	}
+}
+
+func Test_ClientFailover(t *testing.T) {
+	// nothing listens on the first address
+	lis, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead := lis.Addr().String()
+	lis.Close()
+	f, addr, stop := startFakeServer(t)
+	defer stop()
+	ctx := context.Background()
+	c, _ := Dial(dead, WithInsecure(), WithLogin("user", "secret"), WithFailover(addr), fastRetry)
+	defer c.Close()
+
+	if err := c.Use(ctx, "db"); err != nil {
+		t.Fatalf("failed to fail over: %s", err.Error())
+	}
+	if err := c.Set(ctx, "k", "v", 0); err != nil || f.data["db.k"] != "v" {
+		t.Fatalf("failed to set: %v", err)
+	}
+}
+
+func Test_ClientRedirect(t *testing.T) {
+	follower, addr, stop := startFakeServer(t)
+	defer stop()
+	leader, leaderAddr, stopLeader := startFakeServer(t)
+	defer stopLeader()
+	ctx := context.Background()
+	c, _ := Dial(addr, WithInsecure(), WithLogin("user", "secret"), fastRetry)
+	defer c.Close()
+	c.Use(ctx, "db")
+
+	follower.mu.Lock()
+	follower.fail = []error{status.Error(codes.Unavailable, "not the leader of the cluster, retry the write on its leader")}
+	follower.trailer = metadata.Pairs(leaderHeader, leaderAddr)
+	follower.mu.Unlock()
+	// the leader does not know the token of the follower, so it is renewed
+	if err := c.Set(ctx, "k", "v", 0); err != nil {
+		t.Fatalf("failed to set on the leader: %s", err.Error())
+	}
+	leader.mu.Lock()
+	defer leader.mu.Unlock()
+	if leader.data["db.k"] != "v" || len(follower.data) != 0 {
+		t.Fatalf("expected the write to be redirected, got %v and %v", leader.data, follower.data)
+	}
+}
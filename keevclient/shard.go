@@ -0,0 +1,295 @@
+package keevclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/shard"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// shardVersionHeader is the trailer carrying the version of the shard map
+// of a shard that redirected a request.
+const shardVersionHeader = "keev-shard-version"
+
+// shardAttempts is how many times a request for a key is sent while the
+// shard map changes or keys move.
+const shardAttempts = 5
+
+// shardedClient sends the requests for a key to the shard holding it, as the
+// shard map of the servers says, and every other request to the server the
+// client dialed. Requests about a whole namespace are sent to every shard
+// and their answers merged.
+type shardedClient struct {
+	pb.KVSClient
+	opts []grpc.DialOption
+
+	mu      sync.Mutex
+	m       *shard.Map
+	clients map[string]pb.KVSClient // by address
+	conns   []*grpc.ClientConn
+}
+
+func newShardedClient(client pb.KVSClient, opts []grpc.DialOption, m *shard.Map) *shardedClient {
+	return &shardedClient{KVSClient: client, opts: opts, m: m, clients: make(map[string]pb.KVSClient)}
+}
+
+// Close closes the connections to the other shards.
+func (c *shardedClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+}
+
+// client returns the client of the shard at addr.
+func (c *shardedClient) client(addr string) (pb.KVSClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[addr]; ok {
+		return client, nil
+	}
+	conn, err := grpc.Dial(addr, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns = append(c.conns, conn)
+	c.clients[addr] = pb.NewKVSClient(conn)
+	return c.clients[addr], nil
+}
+
+// shards returns the client of every shard, or of the server connected to
+// if there is no shard map.
+func (c *shardedClient) shards() ([]pb.KVSClient, error) {
+	c.mu.Lock()
+	m := c.m
+	c.mu.Unlock()
+	if m == nil {
+		return []pb.KVSClient{c.KVSClient}, nil
+	}
+	clients := make([]pb.KVSClient, len(m.Nodes))
+	for i, n := range m.Nodes {
+		client, err := c.client(n.Addr)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = client
+	}
+	return clients, nil
+}
+
+// owner returns the client of the shard holding key, in the namespace of
+// the token ctx carries.
+func (c *shardedClient) owner(ctx context.Context, key string) (pb.KVSClient, error) {
+	c.mu.Lock()
+	m := c.m
+	c.mu.Unlock()
+	username, namespace, ok := tokenScope(ctx)
+	if m == nil || !ok {
+		return c.KVSClient, nil // answers with the error
+	}
+	n, _ := m.Owner(username + "." + namespace + "." + key)
+	return c.client(n.Addr)
+}
+
+// tokenScope returns the username and namespace of the token ctx carries, as
+// the server reads them.
+func tokenScope(ctx context.Context) (string, string, bool) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if len(md[tokenHeader]) == 0 {
+		return "", "", false
+	}
+	parts := strings.Split(md[tokenHeader][0], ".")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+	var claims struct {
+		Username  string `json:"username"`
+		Namespace string `json:"database"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", "", false
+	}
+	return claims.Username, claims.Namespace, true
+}
+
+// call sends a request for key to its shard. Redirected by a shard with a
+// newer shard map, it fetches that map and sends the request again; while
+// keys move, it waits a little before sending it again.
+func (c *shardedClient) call(ctx context.Context, key string, send func(client pb.KVSClient, opts ...grpc.CallOption) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var client pb.KVSClient
+		if client, err = c.owner(ctx, key); err != nil {
+			return err
+		}
+		var trailer metadata.MD
+		err = send(client, grpc.Trailer(&trailer))
+		if status.Code(err) != codes.Unavailable || attempt == shardAttempts {
+			return err
+		}
+		if len(trailer[shardVersionHeader]) > 0 {
+			version, _ := strconv.ParseUint(trailer[shardVersionHeader][0], 10, 64)
+			c.refresh(ctx, client, version)
+			continue
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// refresh fetches the shard map from client if it is newer than version.
+func (c *shardedClient) refresh(ctx context.Context, client pb.KVSClient, version uint64) {
+	c.mu.Lock()
+	stale := c.m == nil || c.m.Version < version
+	c.mu.Unlock()
+	if !stale {
+		return
+	}
+	resp, err := client.ShardMap(ctx, &google_protobuf.Empty{})
+	if m := shard.FromProto(resp); err == nil && m != nil {
+		c.mu.Lock()
+		if c.m == nil || c.m.Version < m.Version {
+			c.m = m
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *shardedClient) Set(ctx context.Context, in *pb.KeyValuePair, opts ...grpc.CallOption) (resp *pb.Response, err error) {
+	err = c.call(ctx, in.Key, func(client pb.KVSClient, o ...grpc.CallOption) error {
+		resp, err = client.Set(ctx, in, append(opts, o...)...)
+		return err
+	})
+	return resp, err
+}
+
+func (c *shardedClient) Update(ctx context.Context, in *pb.KeyValuePair, opts ...grpc.CallOption) (resp *pb.Response, err error) {
+	err = c.call(ctx, in.Key, func(client pb.KVSClient, o ...grpc.CallOption) error {
+		resp, err = client.Update(ctx, in, append(opts, o...)...)
+		return err
+	})
+	return resp, err
+}
+
+func (c *shardedClient) Has(ctx context.Context, in *pb.Key, opts ...grpc.CallOption) (resp *pb.Response, err error) {
+	err = c.call(ctx, in.Key, func(client pb.KVSClient, o ...grpc.CallOption) error {
+		resp, err = client.Has(ctx, in, append(opts, o...)...)
+		return err
+	})
+	return resp, err
+}
+
+func (c *shardedClient) Unset(ctx context.Context, in *pb.Key, opts ...grpc.CallOption) (resp *pb.KeyValuePair, err error) {
+	err = c.call(ctx, in.Key, func(client pb.KVSClient, o ...grpc.CallOption) error {
+		resp, err = client.Unset(ctx, in, append(opts, o...)...)
+		return err
+	})
+	return resp, err
+}
+
+func (c *shardedClient) Get(ctx context.Context, in *pb.Key, opts ...grpc.CallOption) (resp *pb.KeyValuePair, err error) {
+	err = c.call(ctx, in.Key, func(client pb.KVSClient, o ...grpc.CallOption) error {
+		resp, err = client.Get(ctx, in, append(opts, o...)...)
+		return err
+	})
+	return resp, err
+}
+
+// Keys that are moving may be counted twice.
+func (c *shardedClient) Count(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*pb.CountResponse, error) {
+	shards, err := c.shards()
+	if err != nil {
+		return nil, err
+	}
+	total := &pb.CountResponse{}
+	for _, client := range shards {
+		resp, err := client.Count(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		total.Count += resp.Count
+	}
+	return total, nil
+}
+
+func (c *shardedClient) ShowKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*pb.ShowKeysResponse, error) {
+	shards, err := c.shards()
+	if err != nil {
+		return nil, err
+	}
+	all, seen := &pb.ShowKeysResponse{}, make(map[string]bool)
+	for _, client := range shards {
+		resp, err := client.ShowKeys(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range resp.Keys {
+			if !seen[key] {
+				seen[key] = true
+				all.Keys = append(all.Keys, key)
+			}
+		}
+	}
+	return all, nil
+}
+
+func (c *shardedClient) ShowData(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*pb.ShowDataResponse, error) {
+	shards, err := c.shards()
+	if err != nil {
+		return nil, err
+	}
+	all, seen := &pb.ShowDataResponse{}, make(map[string]bool)
+	for _, client := range shards {
+		resp, err := client.ShowData(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, kvp := range resp.Data {
+			if !seen[kvp.Key] {
+				seen[kvp.Key] = true
+				all.Data = append(all.Data, kvp)
+			}
+		}
+	}
+	return all, nil
+}
+
+func (c *shardedClient) ShowNamespaces(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*pb.ShowNamespacesResponse, error) {
+	shards, err := c.shards()
+	if err != nil {
+		return nil, err
+	}
+	all, seen := &pb.ShowNamespacesResponse{}, make(map[string]bool)
+	for _, client := range shards {
+		resp, err := client.ShowNamespaces(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range resp.Namespaces {
+			if ns != "" && !seen[ns] {
+				seen[ns] = true
+				all.Namespaces = append(all.Namespaces, ns)
+			}
+		}
+	}
+	return all, nil
+}
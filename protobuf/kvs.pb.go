@@ -10,6 +10,7 @@ It is generated from these files:
 
 It has these top-level messages:
 	KeyValuePair
+	Sibling
 	Key
 	Namespace
 	Response
@@ -18,6 +19,58 @@ It has these top-level messages:
 	ShowDataResponse
 	ShowNamespacesResponse
 	NamespaceResponse
+	APIKeyRequest
+	APIKey
+	APIKeyID
+	APIKeyList
+	AuditQuery
+	AuditRecord
+	AuditRecords
+	RateLimitStats
+	MemoryStats
+	StatsResponse
+	UsageRequest
+	QuotaUsage
+	UsageResponse
+	MemberRequest
+	ClusterMember
+	ClusterStatusResponse
+	ReplicaStatus
+	ReplicationStatusResponse
+	SitePeer
+	SiteStatusResponse
+	ShardNode
+	ShardMap
+	ShardStatusResponse
+	SnapshotEntry
+	Version
+	SiteClock
+	BackupRequest
+	BackupChunk
+	RestoreChunk
+	RestoreResponse
+	SnapshotHeader
+	LogEntry
+	RaftMember
+	RaftConfig
+	RaftEntry
+	VoteRequest
+	VoteResponse
+	AppendRequest
+	AppendResponse
+	SnapshotChunk
+	InstallSnapshotResponse
+	TimeoutNowRequest
+	TimeoutNowResponse
+	RaftSnapshotMeta
+	Command
+	ReplicaAck
+	ReplicationMessage
+	ShardState
+	UpdateShardMapRequest
+	MigrateRequest
+	HandoffRequest
+	HandoffResponse
 */
 package protobuf
 
@@ -42,9 +95,96 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type LogOp int32
+
+const (
+	LogOp_SET      LogOp = 0
+	LogOp_DELETE   LogOp = 1
+	LogOp_EXPIRE   LogOp = 2
+	LogOp_VERSIONS LogOp = 3
+)
+
+var LogOp_name = map[int32]string{
+	0: "SET",
+	1: "DELETE",
+	2: "EXPIRE",
+	3: "VERSIONS",
+}
+var LogOp_value = map[string]int32{
+	"SET":      0,
+	"DELETE":   1,
+	"EXPIRE":   2,
+	"VERSIONS": 3,
+}
+
+func (x LogOp) String() string {
+	return proto.EnumName(LogOp_name, int32(x))
+}
+func (LogOp) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type RaftEntryType int32
+
+const (
+	RaftEntryType_ENTRY_COMMAND RaftEntryType = 0
+	RaftEntryType_ENTRY_NOOP    RaftEntryType = 1
+	RaftEntryType_ENTRY_CONFIG  RaftEntryType = 2
+)
+
+var RaftEntryType_name = map[int32]string{
+	0: "ENTRY_COMMAND",
+	1: "ENTRY_NOOP",
+	2: "ENTRY_CONFIG",
+}
+var RaftEntryType_value = map[string]int32{
+	"ENTRY_COMMAND": 0,
+	"ENTRY_NOOP":    1,
+	"ENTRY_CONFIG":  2,
+}
+
+func (x RaftEntryType) String() string {
+	return proto.EnumName(RaftEntryType_name, int32(x))
+}
+func (RaftEntryType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+type CommandOp int32
+
+const (
+	CommandOp_CMD_SET     CommandOp = 0
+	CommandOp_CMD_UPDATE  CommandOp = 1
+	CommandOp_CMD_UNSET   CommandOp = 2
+	CommandOp_CMD_EXPIRE  CommandOp = 3
+	CommandOp_CMD_RESTORE CommandOp = 4
+)
+
+var CommandOp_name = map[int32]string{
+	0: "CMD_SET",
+	1: "CMD_UPDATE",
+	2: "CMD_UNSET",
+	3: "CMD_EXPIRE",
+	4: "CMD_RESTORE",
+}
+var CommandOp_value = map[string]int32{
+	"CMD_SET":     0,
+	"CMD_UPDATE":  1,
+	"CMD_UNSET":   2,
+	"CMD_EXPIRE":  3,
+	"CMD_RESTORE": 4,
+}
+
+func (x CommandOp) String() string {
+	return proto.EnumName(CommandOp_name, int32(x))
+}
+func (CommandOp) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
 type KeyValuePair struct {
 	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
 	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	// Seconds until the key expires, 0 for never. Get returns the seconds left.
+	Ttl int64 `protobuf:"varint,3,opt,name=ttl" json:"ttl,omitempty"`
+	// Get only: the other values of a key written concurrently at different
+	// sites, kept when conflicts are resolved with siblings. The next write
+	// replaces them all.
+	Siblings []*Sibling `protobuf:"bytes,4,rep,name=siblings" json:"siblings,omitempty"`
 }
 
 func (m *KeyValuePair) Reset()                    { *m = KeyValuePair{} }
@@ -66,6 +206,52 @@ func (m *KeyValuePair) GetValue() string {
 	return ""
 }
 
+func (m *KeyValuePair) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *KeyValuePair) GetSiblings() []*Sibling {
+	if m != nil {
+		return m.Siblings
+	}
+	return nil
+}
+
+type Sibling struct {
+	Value string `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
+	Site  string `protobuf:"bytes,2,opt,name=site" json:"site,omitempty"`
+	Hlc   uint64 `protobuf:"varint,3,opt,name=hlc" json:"hlc,omitempty"`
+}
+
+func (m *Sibling) Reset()                    { *m = Sibling{} }
+func (m *Sibling) String() string            { return proto.CompactTextString(m) }
+func (*Sibling) ProtoMessage()               {}
+func (*Sibling) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Sibling) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *Sibling) GetSite() string {
+	if m != nil {
+		return m.Site
+	}
+	return ""
+}
+
+func (m *Sibling) GetHlc() uint64 {
+	if m != nil {
+		return m.Hlc
+	}
+	return 0
+}
+
 type Key struct {
 	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
 }
@@ -73,7 +259,7 @@ type Key struct {
 func (m *Key) Reset()                    { *m = Key{} }
 func (m *Key) String() string            { return proto.CompactTextString(m) }
 func (*Key) ProtoMessage()               {}
-func (*Key) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*Key) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *Key) GetKey() string {
 	if m != nil {
@@ -89,7 +275,7 @@ type Namespace struct {
 func (m *Namespace) Reset()                    { *m = Namespace{} }
 func (m *Namespace) String() string            { return proto.CompactTextString(m) }
 func (*Namespace) ProtoMessage()               {}
-func (*Namespace) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*Namespace) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *Namespace) GetNamespace() string {
 	if m != nil {
@@ -106,7 +292,7 @@ type Response struct {
 func (m *Response) Reset()                    { *m = Response{} }
 func (m *Response) String() string            { return proto.CompactTextString(m) }
 func (*Response) ProtoMessage()               {}
-func (*Response) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*Response) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
 func (m *Response) GetSuccess() bool {
 	if m != nil {
@@ -129,7 +315,7 @@ type CountResponse struct {
 func (m *CountResponse) Reset()                    { *m = CountResponse{} }
 func (m *CountResponse) String() string            { return proto.CompactTextString(m) }
 func (*CountResponse) ProtoMessage()               {}
-func (*CountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*CountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func (m *CountResponse) GetCount() int32 {
 	if m != nil {
@@ -145,7 +331,7 @@ type ShowKeysResponse struct {
 func (m *ShowKeysResponse) Reset()                    { *m = ShowKeysResponse{} }
 func (m *ShowKeysResponse) String() string            { return proto.CompactTextString(m) }
 func (*ShowKeysResponse) ProtoMessage()               {}
-func (*ShowKeysResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ShowKeysResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
 func (m *ShowKeysResponse) GetKeys() []string {
 	if m != nil {
@@ -161,7 +347,7 @@ type ShowDataResponse struct {
 func (m *ShowDataResponse) Reset()                    { *m = ShowDataResponse{} }
 func (m *ShowDataResponse) String() string            { return proto.CompactTextString(m) }
 func (*ShowDataResponse) ProtoMessage()               {}
-func (*ShowDataResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*ShowDataResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *ShowDataResponse) GetData() []*KeyValuePair {
 	if m != nil {
@@ -177,7 +363,7 @@ type ShowNamespacesResponse struct {
 func (m *ShowNamespacesResponse) Reset()                    { *m = ShowNamespacesResponse{} }
 func (m *ShowNamespacesResponse) String() string            { return proto.CompactTextString(m) }
 func (*ShowNamespacesResponse) ProtoMessage()               {}
-func (*ShowNamespacesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*ShowNamespacesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 func (m *ShowNamespacesResponse) GetNamespaces() []string {
 	if m != nil {
@@ -193,7 +379,7 @@ type NamespaceResponse struct {
 func (m *NamespaceResponse) Reset()                    { *m = NamespaceResponse{} }
 func (m *NamespaceResponse) String() string            { return proto.CompactTextString(m) }
 func (*NamespaceResponse) ProtoMessage()               {}
-func (*NamespaceResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*NamespaceResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *NamespaceResponse) GetToken() string {
 	if m != nil {
@@ -202,407 +388,3948 @@ func (m *NamespaceResponse) GetToken() string {
 	return ""
 }
 
-func init() {
-	proto.RegisterType((*KeyValuePair)(nil), "protobuf.KeyValuePair")
-	proto.RegisterType((*Key)(nil), "protobuf.Key")
-	proto.RegisterType((*Namespace)(nil), "protobuf.Namespace")
-	proto.RegisterType((*Response)(nil), "protobuf.Response")
-	proto.RegisterType((*CountResponse)(nil), "protobuf.CountResponse")
-	proto.RegisterType((*ShowKeysResponse)(nil), "protobuf.ShowKeysResponse")
-	proto.RegisterType((*ShowDataResponse)(nil), "protobuf.ShowDataResponse")
-	proto.RegisterType((*ShowNamespacesResponse)(nil), "protobuf.ShowNamespacesResponse")
-	proto.RegisterType((*NamespaceResponse)(nil), "protobuf.NamespaceResponse")
+type APIKeyRequest struct {
+	Username string `protobuf:"bytes,1,opt,name=username" json:"username,omitempty"`
+	// Namespaces the key is restricted to, all namespaces if empty
+	Namespaces []string `protobuf:"bytes,2,rep,name=namespaces" json:"namespaces,omitempty"`
+	// Operations ("read", "write") the key is restricted to, all if empty
+	Ops []string `protobuf:"bytes,3,rep,name=ops" json:"ops,omitempty"`
+	// Unix time in seconds after which the key is rejected, 0 for never
+	ExpiresAt int64 `protobuf:"varint,4,opt,name=expires_at,json=expiresAt" json:"expires_at,omitempty"`
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *APIKeyRequest) Reset()                    { *m = APIKeyRequest{} }
+func (m *APIKeyRequest) String() string            { return proto.CompactTextString(m) }
+func (*APIKeyRequest) ProtoMessage()               {}
+func (*APIKeyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+func (m *APIKeyRequest) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
 
-// Client API for KVS service
+func (m *APIKeyRequest) GetNamespaces() []string {
+	if m != nil {
+		return m.Namespaces
+	}
+	return nil
+}
 
-type KVSClient interface {
-	// Inserts a key-value pair into a namespace, if not present
-	Set(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error)
-	// Updates a key-value pair in a namespace, if present
-	Update(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error)
-	// Checks if a key is in a namespace
-	Has(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
-	// Removes a key in a namespace, if present
-	Unset(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error)
-	// Retrieves an element from a namespace under given key
-	Get(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error)
-	// Returns the total number of key-value pairs in a namespace
-	Count(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*CountResponse, error)
-	// Retrieve all keys in a namespace
-	ShowKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowKeysResponse, error)
-	// Retrieve all key-value pairs in a namespace
-	ShowData(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowDataResponse, error)
-	// Retrieve all namespaces in the key-value store that belongs to the user
-	// NOTE: No token needed
-	ShowNamespaces(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowNamespacesResponse, error)
-	// Changes the current namespace, returns a token that must be used for
-	// subsequent requests
-	// NOTE: No token needed
-	UseNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*NamespaceResponse, error)
+func (m *APIKeyRequest) GetOps() []string {
+	if m != nil {
+		return m.Ops
+	}
+	return nil
 }
 
-type kVSClient struct {
-	cc *grpc.ClientConn
+func (m *APIKeyRequest) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
 }
 
-func NewKVSClient(cc *grpc.ClientConn) KVSClient {
-	return &kVSClient{cc}
+type APIKey struct {
+	Id         string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Username   string   `protobuf:"bytes,2,opt,name=username" json:"username,omitempty"`
+	Namespaces []string `protobuf:"bytes,3,rep,name=namespaces" json:"namespaces,omitempty"`
+	Ops        []string `protobuf:"bytes,4,rep,name=ops" json:"ops,omitempty"`
+	ExpiresAt  int64    `protobuf:"varint,5,opt,name=expires_at,json=expiresAt" json:"expires_at,omitempty"`
+	CreatedAt  int64    `protobuf:"varint,6,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+	LastUsed   int64    `protobuf:"varint,7,opt,name=last_used,json=lastUsed" json:"last_used,omitempty"`
+	// The full key, only set when the key is created
+	Key string `protobuf:"bytes,8,opt,name=key" json:"key,omitempty"`
 }
 
-func (c *kVSClient) Set(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Set", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) Reset()                    { *m = APIKey{} }
+func (m *APIKey) String() string            { return proto.CompactTextString(m) }
+func (*APIKey) ProtoMessage()               {}
+func (*APIKey) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *APIKey) GetId() string {
+	if m != nil {
+		return m.Id
 	}
-	return out, nil
+	return ""
 }
 
-func (c *kVSClient) Update(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Update", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetUsername() string {
+	if m != nil {
+		return m.Username
 	}
-	return out, nil
+	return ""
 }
 
-func (c *kVSClient) Has(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Has", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetNamespaces() []string {
+	if m != nil {
+		return m.Namespaces
 	}
-	return out, nil
+	return nil
 }
 
-func (c *kVSClient) Unset(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error) {
-	out := new(KeyValuePair)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Unset", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetOps() []string {
+	if m != nil {
+		return m.Ops
 	}
-	return out, nil
+	return nil
 }
 
-func (c *kVSClient) Get(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error) {
-	out := new(KeyValuePair)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Get", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
 	}
-	return out, nil
+	return 0
 }
 
-func (c *kVSClient) Count(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*CountResponse, error) {
-	out := new(CountResponse)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/Count", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
 	}
-	return out, nil
+	return 0
 }
 
-func (c *kVSClient) ShowKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowKeysResponse, error) {
-	out := new(ShowKeysResponse)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowKeys", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetLastUsed() int64 {
+	if m != nil {
+		return m.LastUsed
 	}
-	return out, nil
+	return 0
 }
 
-func (c *kVSClient) ShowData(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowDataResponse, error) {
-	out := new(ShowDataResponse)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowData", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKey) GetKey() string {
+	if m != nil {
+		return m.Key
 	}
-	return out, nil
+	return ""
 }
 
-func (c *kVSClient) ShowNamespaces(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowNamespacesResponse, error) {
-	out := new(ShowNamespacesResponse)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowNamespaces", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+type APIKeyID struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
 }
 
-func (c *kVSClient) UseNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*NamespaceResponse, error) {
-	out := new(NamespaceResponse)
-	err := grpc.Invoke(ctx, "/protobuf.KVS/UseNamespace", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *APIKeyID) Reset()                    { *m = APIKeyID{} }
+func (m *APIKeyID) String() string            { return proto.CompactTextString(m) }
+func (*APIKeyID) ProtoMessage()               {}
+func (*APIKeyID) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *APIKeyID) GetId() string {
+	if m != nil {
+		return m.Id
 	}
-	return out, nil
+	return ""
 }
 
-// Server API for KVS service
+type APIKeyList struct {
+	Keys []*APIKey `protobuf:"bytes,1,rep,name=keys" json:"keys,omitempty"`
+}
 
-type KVSServer interface {
-	// Inserts a key-value pair into a namespace, if not present
-	Set(context.Context, *KeyValuePair) (*Response, error)
-	// Updates a key-value pair in a namespace, if present
-	Update(context.Context, *KeyValuePair) (*Response, error)
-	// Checks if a key is in a namespace
-	Has(context.Context, *Key) (*Response, error)
-	// Removes a key in a namespace, if present
-	Unset(context.Context, *Key) (*KeyValuePair, error)
-	// Retrieves an element from a namespace under given key
-	Get(context.Context, *Key) (*KeyValuePair, error)
-	// Returns the total number of key-value pairs in a namespace
-	Count(context.Context, *google_protobuf.Empty) (*CountResponse, error)
-	// Retrieve all keys in a namespace
-	ShowKeys(context.Context, *google_protobuf.Empty) (*ShowKeysResponse, error)
-	// Retrieve all key-value pairs in a namespace
-	ShowData(context.Context, *google_protobuf.Empty) (*ShowDataResponse, error)
-	// Retrieve all namespaces in the key-value store that belongs to the user
-	// NOTE: No token needed
-	ShowNamespaces(context.Context, *google_protobuf.Empty) (*ShowNamespacesResponse, error)
-	// Changes the current namespace, returns a token that must be used for
-	// subsequent requests
-	// NOTE: No token needed
-	UseNamespace(context.Context, *Namespace) (*NamespaceResponse, error)
+func (m *APIKeyList) Reset()                    { *m = APIKeyList{} }
+func (m *APIKeyList) String() string            { return proto.CompactTextString(m) }
+func (*APIKeyList) ProtoMessage()               {}
+func (*APIKeyList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *APIKeyList) GetKeys() []*APIKey {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
 }
 
-func RegisterKVSServer(s *grpc.Server, srv KVSServer) {
-	s.RegisterService(&_KVS_serviceDesc, srv)
+type AuditQuery struct {
+	User string `protobuf:"bytes,1,opt,name=user" json:"user,omitempty"`
+	Key  string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	// Unix time in seconds, 0 for no bound
+	Since int64 `protobuf:"varint,3,opt,name=since" json:"since,omitempty"`
+	Until int64 `protobuf:"varint,4,opt,name=until" json:"until,omitempty"`
+	// Only return the most recent records, 0 for all
+	Limit int32 `protobuf:"varint,5,opt,name=limit" json:"limit,omitempty"`
 }
 
-func _KVS_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(KeyValuePair)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(KVSServer).Set(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/protobuf.KVS/Set",
+func (m *AuditQuery) Reset()                    { *m = AuditQuery{} }
+func (m *AuditQuery) String() string            { return proto.CompactTextString(m) }
+func (*AuditQuery) ProtoMessage()               {}
+func (*AuditQuery) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *AuditQuery) GetUser() string {
+	if m != nil {
+		return m.User
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Set(ctx, req.(*KeyValuePair))
+	return ""
+}
+
+func (m *AuditQuery) GetKey() string {
+	if m != nil {
+		return m.Key
 	}
-	return interceptor(ctx, in, info, handler)
+	return ""
 }
 
-func _KVS_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(KeyValuePair)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *AuditQuery) GetSince() int64 {
+	if m != nil {
+		return m.Since
+	}
+	return 0
+}
+
+func (m *AuditQuery) GetUntil() int64 {
+	if m != nil {
+		return m.Until
+	}
+	return 0
+}
+
+func (m *AuditQuery) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type AuditRecord struct {
+	Seq uint64 `protobuf:"varint,1,opt,name=seq" json:"seq,omitempty"`
+	// Unix time in nanoseconds
+	Time      int64  `protobuf:"varint,2,opt,name=time" json:"time,omitempty"`
+	User      string `protobuf:"bytes,3,opt,name=user" json:"user,omitempty"`
+	ApiKey    string `protobuf:"bytes,4,opt,name=api_key,json=apiKey" json:"api_key,omitempty"`
+	Namespace string `protobuf:"bytes,5,opt,name=namespace" json:"namespace,omitempty"`
+	Rpc       string `protobuf:"bytes,6,opt,name=rpc" json:"rpc,omitempty"`
+	Key       string `protobuf:"bytes,7,opt,name=key" json:"key,omitempty"`
+	Outcome   string `protobuf:"bytes,8,opt,name=outcome" json:"outcome,omitempty"`
+	Hash      string `protobuf:"bytes,9,opt,name=hash" json:"hash,omitempty"`
+}
+
+func (m *AuditRecord) Reset()                    { *m = AuditRecord{} }
+func (m *AuditRecord) String() string            { return proto.CompactTextString(m) }
+func (*AuditRecord) ProtoMessage()               {}
+func (*AuditRecord) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *AuditRecord) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *AuditRecord) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *AuditRecord) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetApiKey() string {
+	if m != nil {
+		return m.ApiKey
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetRpc() string {
+	if m != nil {
+		return m.Rpc
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetOutcome() string {
+	if m != nil {
+		return m.Outcome
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+type AuditRecords struct {
+	Records []*AuditRecord `protobuf:"bytes,1,rep,name=records" json:"records,omitempty"`
+}
+
+func (m *AuditRecords) Reset()                    { *m = AuditRecords{} }
+func (m *AuditRecords) String() string            { return proto.CompactTextString(m) }
+func (*AuditRecords) ProtoMessage()               {}
+func (*AuditRecords) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *AuditRecords) GetRecords() []*AuditRecord {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+type RateLimitStats struct {
+	// "user:<username>" or "key:<API key ID>"
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// Limits per second, 0 for unlimited
+	RequestsLimit float64 `protobuf:"fixed64,2,opt,name=requests_limit,json=requestsLimit" json:"requests_limit,omitempty"`
+	BytesLimit    float64 `protobuf:"fixed64,3,opt,name=bytes_limit,json=bytesLimit" json:"bytes_limit,omitempty"`
+	Allowed       uint64  `protobuf:"varint,4,opt,name=allowed" json:"allowed,omitempty"`
+	Throttled     uint64  `protobuf:"varint,5,opt,name=throttled" json:"throttled,omitempty"`
+	Bytes         uint64  `protobuf:"varint,6,opt,name=bytes" json:"bytes,omitempty"`
+}
+
+func (m *RateLimitStats) Reset()                    { *m = RateLimitStats{} }
+func (m *RateLimitStats) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitStats) ProtoMessage()               {}
+func (*RateLimitStats) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *RateLimitStats) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RateLimitStats) GetRequestsLimit() float64 {
+	if m != nil {
+		return m.RequestsLimit
+	}
+	return 0
+}
+
+func (m *RateLimitStats) GetBytesLimit() float64 {
+	if m != nil {
+		return m.BytesLimit
+	}
+	return 0
+}
+
+func (m *RateLimitStats) GetAllowed() uint64 {
+	if m != nil {
+		return m.Allowed
+	}
+	return 0
+}
+
+func (m *RateLimitStats) GetThrottled() uint64 {
+	if m != nil {
+		return m.Throttled
+	}
+	return 0
+}
+
+func (m *RateLimitStats) GetBytes() uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+type MemoryStats struct {
+	UsedBytes int64 `protobuf:"varint,1,opt,name=used_bytes,json=usedBytes" json:"used_bytes,omitempty"`
+	// 0 for unlimited
+	MaxBytes       int64  `protobuf:"varint,2,opt,name=max_bytes,json=maxBytes" json:"max_bytes,omitempty"`
+	EvictionPolicy string `protobuf:"bytes,3,opt,name=eviction_policy,json=evictionPolicy" json:"eviction_policy,omitempty"`
+	Evicted        uint64 `protobuf:"varint,4,opt,name=evicted" json:"evicted,omitempty"`
+	Expired        uint64 `protobuf:"varint,5,opt,name=expired" json:"expired,omitempty"`
+}
+
+func (m *MemoryStats) Reset()                    { *m = MemoryStats{} }
+func (m *MemoryStats) String() string            { return proto.CompactTextString(m) }
+func (*MemoryStats) ProtoMessage()               {}
+func (*MemoryStats) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *MemoryStats) GetUsedBytes() int64 {
+	if m != nil {
+		return m.UsedBytes
+	}
+	return 0
+}
+
+func (m *MemoryStats) GetMaxBytes() int64 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+func (m *MemoryStats) GetEvictionPolicy() string {
+	if m != nil {
+		return m.EvictionPolicy
+	}
+	return ""
+}
+
+func (m *MemoryStats) GetEvicted() uint64 {
+	if m != nil {
+		return m.Evicted
+	}
+	return 0
+}
+
+func (m *MemoryStats) GetExpired() uint64 {
+	if m != nil {
+		return m.Expired
+	}
+	return 0
+}
+
+type StatsResponse struct {
+	RateLimits []*RateLimitStats `protobuf:"bytes,1,rep,name=rate_limits,json=rateLimits" json:"rate_limits,omitempty"`
+	Memory     *MemoryStats      `protobuf:"bytes,2,opt,name=memory" json:"memory,omitempty"`
+}
+
+func (m *StatsResponse) Reset()                    { *m = StatsResponse{} }
+func (m *StatsResponse) String() string            { return proto.CompactTextString(m) }
+func (*StatsResponse) ProtoMessage()               {}
+func (*StatsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+func (m *StatsResponse) GetRateLimits() []*RateLimitStats {
+	if m != nil {
+		return m.RateLimits
+	}
+	return nil
+}
+
+func (m *StatsResponse) GetMemory() *MemoryStats {
+	if m != nil {
+		return m.Memory
+	}
+	return nil
+}
+
+type UsageRequest struct {
+	// Empty for the caller
+	Username string `protobuf:"bytes,1,opt,name=username" json:"username,omitempty"`
+}
+
+func (m *UsageRequest) Reset()                    { *m = UsageRequest{} }
+func (m *UsageRequest) String() string            { return proto.CompactTextString(m) }
+func (*UsageRequest) ProtoMessage()               {}
+func (*UsageRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+func (m *UsageRequest) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+type QuotaUsage struct {
+	// Empty for the total of the user
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Keys      int64  `protobuf:"varint,2,opt,name=keys" json:"keys,omitempty"`
+	Bytes     int64  `protobuf:"varint,3,opt,name=bytes" json:"bytes,omitempty"`
+	// 0 for unlimited
+	MaxKeys  int64 `protobuf:"varint,4,opt,name=max_keys,json=maxKeys" json:"max_keys,omitempty"`
+	MaxBytes int64 `protobuf:"varint,5,opt,name=max_bytes,json=maxBytes" json:"max_bytes,omitempty"`
+}
+
+func (m *QuotaUsage) Reset()                    { *m = QuotaUsage{} }
+func (m *QuotaUsage) String() string            { return proto.CompactTextString(m) }
+func (*QuotaUsage) ProtoMessage()               {}
+func (*QuotaUsage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+func (m *QuotaUsage) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *QuotaUsage) GetKeys() int64 {
+	if m != nil {
+		return m.Keys
+	}
+	return 0
+}
+
+func (m *QuotaUsage) GetBytes() int64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *QuotaUsage) GetMaxKeys() int64 {
+	if m != nil {
+		return m.MaxKeys
+	}
+	return 0
+}
+
+func (m *QuotaUsage) GetMaxBytes() int64 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+type UsageResponse struct {
+	Total      *QuotaUsage   `protobuf:"bytes,1,opt,name=total" json:"total,omitempty"`
+	Namespaces []*QuotaUsage `protobuf:"bytes,2,rep,name=namespaces" json:"namespaces,omitempty"`
+}
+
+func (m *UsageResponse) Reset()                    { *m = UsageResponse{} }
+func (m *UsageResponse) String() string            { return proto.CompactTextString(m) }
+func (*UsageResponse) ProtoMessage()               {}
+func (*UsageResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *UsageResponse) GetTotal() *QuotaUsage {
+	if m != nil {
+		return m.Total
+	}
+	return nil
+}
+
+func (m *UsageResponse) GetNamespaces() []*QuotaUsage {
+	if m != nil {
+		return m.Namespaces
+	}
+	return nil
+}
+
+type MemberRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// Address of a node added
+	Addr string `protobuf:"bytes,2,opt,name=addr" json:"addr,omitempty"`
+	// Adds the node as a learner, which is replicated to but does not vote
+	Learner bool `protobuf:"varint,3,opt,name=learner" json:"learner,omitempty"`
+}
+
+func (m *MemberRequest) Reset()                    { *m = MemberRequest{} }
+func (m *MemberRequest) String() string            { return proto.CompactTextString(m) }
+func (*MemberRequest) ProtoMessage()               {}
+func (*MemberRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *MemberRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *MemberRequest) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *MemberRequest) GetLearner() bool {
+	if m != nil {
+		return m.Learner
+	}
+	return false
+}
+
+type ClusterMember struct {
+	Id      string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Addr    string `protobuf:"bytes,2,opt,name=addr" json:"addr,omitempty"`
+	Learner bool   `protobuf:"varint,3,opt,name=learner" json:"learner,omitempty"`
+	// Known on the leader only
+	MatchIndex uint64 `protobuf:"varint,4,opt,name=match_index,json=matchIndex" json:"match_index,omitempty"`
+	// Entries the node is missing
+	Lag uint64 `protobuf:"varint,5,opt,name=lag" json:"lag,omitempty"`
+	// Since the node last acknowledged the leader, -1 if never
+	LastAckMs int64 `protobuf:"varint,6,opt,name=last_ack_ms,json=lastAckMs" json:"last_ack_ms,omitempty"`
+}
+
+func (m *ClusterMember) Reset()                    { *m = ClusterMember{} }
+func (m *ClusterMember) String() string            { return proto.CompactTextString(m) }
+func (*ClusterMember) ProtoMessage()               {}
+func (*ClusterMember) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *ClusterMember) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ClusterMember) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *ClusterMember) GetLearner() bool {
+	if m != nil {
+		return m.Learner
+	}
+	return false
+}
+
+func (m *ClusterMember) GetMatchIndex() uint64 {
+	if m != nil {
+		return m.MatchIndex
+	}
+	return 0
+}
+
+func (m *ClusterMember) GetLag() uint64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *ClusterMember) GetLastAckMs() int64 {
+	if m != nil {
+		return m.LastAckMs
+	}
+	return 0
+}
+
+type ClusterStatusResponse struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// "follower", "candidate" or "leader"
+	State         string           `protobuf:"bytes,2,opt,name=state" json:"state,omitempty"`
+	Term          uint64           `protobuf:"varint,3,opt,name=term" json:"term,omitempty"`
+	Leader        string           `protobuf:"bytes,4,opt,name=leader" json:"leader,omitempty"`
+	LeaderAddr    string           `protobuf:"bytes,5,opt,name=leader_addr,json=leaderAddr" json:"leader_addr,omitempty"`
+	LastIndex     uint64           `protobuf:"varint,6,opt,name=last_index,json=lastIndex" json:"last_index,omitempty"`
+	CommitIndex   uint64           `protobuf:"varint,7,opt,name=commit_index,json=commitIndex" json:"commit_index,omitempty"`
+	AppliedIndex  uint64           `protobuf:"varint,8,opt,name=applied_index,json=appliedIndex" json:"applied_index,omitempty"`
+	SnapshotIndex uint64           `protobuf:"varint,9,opt,name=snapshot_index,json=snapshotIndex" json:"snapshot_index,omitempty"`
+	Members       []*ClusterMember `protobuf:"bytes,10,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *ClusterStatusResponse) Reset()                    { *m = ClusterStatusResponse{} }
+func (m *ClusterStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*ClusterStatusResponse) ProtoMessage()               {}
+func (*ClusterStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+
+func (m *ClusterStatusResponse) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ClusterStatusResponse) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *ClusterStatusResponse) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *ClusterStatusResponse) GetLeader() string {
+	if m != nil {
+		return m.Leader
+	}
+	return ""
+}
+
+func (m *ClusterStatusResponse) GetLeaderAddr() string {
+	if m != nil {
+		return m.LeaderAddr
+	}
+	return ""
+}
+
+func (m *ClusterStatusResponse) GetLastIndex() uint64 {
+	if m != nil {
+		return m.LastIndex
+	}
+	return 0
+}
+
+func (m *ClusterStatusResponse) GetCommitIndex() uint64 {
+	if m != nil {
+		return m.CommitIndex
+	}
+	return 0
+}
+
+func (m *ClusterStatusResponse) GetAppliedIndex() uint64 {
+	if m != nil {
+		return m.AppliedIndex
+	}
+	return 0
+}
+
+func (m *ClusterStatusResponse) GetSnapshotIndex() uint64 {
+	if m != nil {
+		return m.SnapshotIndex
+	}
+	return 0
+}
+
+func (m *ClusterStatusResponse) GetMembers() []*ClusterMember {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+type ReplicaStatus struct {
+	// Address the replica connects from
+	Addr string `protobuf:"bytes,1,opt,name=addr" json:"addr,omitempty"`
+	// Last change the replica acknowledged
+	Revision uint64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	// Changes the replica is missing
+	Lag uint64 `protobuf:"varint,3,opt,name=lag" json:"lag,omitempty"`
+	// Since the replica last acknowledged a change or a heartbeat
+	LastAckMs int64 `protobuf:"varint,4,opt,name=last_ack_ms,json=lastAckMs" json:"last_ack_ms,omitempty"`
+}
+
+func (m *ReplicaStatus) Reset()                    { *m = ReplicaStatus{} }
+func (m *ReplicaStatus) String() string            { return proto.CompactTextString(m) }
+func (*ReplicaStatus) ProtoMessage()               {}
+func (*ReplicaStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+
+func (m *ReplicaStatus) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *ReplicaStatus) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetLag() uint64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetLastAckMs() int64 {
+	if m != nil {
+		return m.LastAckMs
+	}
+	return 0
+}
+
+type ReplicationStatusResponse struct {
+	// "primary" or "replica"
+	Role string `protobuf:"bytes,1,opt,name=role" json:"role,omitempty"`
+	// Last change made, on a replica the last change of the primary applied
+	Revision uint64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	// Changes when the primary restarts, see ReplicationMessage
+	History string `protobuf:"bytes,3,opt,name=history" json:"history,omitempty"`
+	// Replica only
+	Primary         string `protobuf:"bytes,4,opt,name=primary" json:"primary,omitempty"`
+	Connected       bool   `protobuf:"varint,5,opt,name=connected" json:"connected,omitempty"`
+	PrimaryRevision uint64 `protobuf:"varint,6,opt,name=primary_revision,json=primaryRevision" json:"primary_revision,omitempty"`
+	Lag             uint64 `protobuf:"varint,7,opt,name=lag" json:"lag,omitempty"`
+	// Since the replica last had every change of the primary, -1 if never
+	StalenessMs int64 `protobuf:"varint,8,opt,name=staleness_ms,json=stalenessMs" json:"staleness_ms,omitempty"`
+	// Primary only
+	Replicas []*ReplicaStatus `protobuf:"bytes,9,rep,name=replicas" json:"replicas,omitempty"`
+}
+
+func (m *ReplicationStatusResponse) Reset()                    { *m = ReplicationStatusResponse{} }
+func (m *ReplicationStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReplicationStatusResponse) ProtoMessage()               {}
+func (*ReplicationStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+
+func (m *ReplicationStatusResponse) GetRole() string {
+	if m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+func (m *ReplicationStatusResponse) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *ReplicationStatusResponse) GetHistory() string {
+	if m != nil {
+		return m.History
+	}
+	return ""
+}
+
+func (m *ReplicationStatusResponse) GetPrimary() string {
+	if m != nil {
+		return m.Primary
+	}
+	return ""
+}
+
+func (m *ReplicationStatusResponse) GetConnected() bool {
+	if m != nil {
+		return m.Connected
+	}
+	return false
+}
+
+func (m *ReplicationStatusResponse) GetPrimaryRevision() uint64 {
+	if m != nil {
+		return m.PrimaryRevision
+	}
+	return 0
+}
+
+func (m *ReplicationStatusResponse) GetLag() uint64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *ReplicationStatusResponse) GetStalenessMs() int64 {
+	if m != nil {
+		return m.StalenessMs
+	}
+	return 0
+}
+
+func (m *ReplicationStatusResponse) GetReplicas() []*ReplicaStatus {
+	if m != nil {
+		return m.Replicas
+	}
+	return nil
+}
+
+type SitePeer struct {
+	Id        string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Addr      string `protobuf:"bytes,2,opt,name=addr" json:"addr,omitempty"`
+	Connected bool   `protobuf:"varint,3,opt,name=connected" json:"connected,omitempty"`
+	// Last change of the site merged
+	Revision uint64 `protobuf:"varint,4,opt,name=revision" json:"revision,omitempty"`
+	// Last change made at the site known
+	SiteRevision uint64 `protobuf:"varint,5,opt,name=site_revision,json=siteRevision" json:"site_revision,omitempty"`
+	Lag          uint64 `protobuf:"varint,6,opt,name=lag" json:"lag,omitempty"`
+	// Since the server last had every change of the site, -1 if never
+	StalenessMs int64 `protobuf:"varint,7,opt,name=staleness_ms,json=stalenessMs" json:"staleness_ms,omitempty"`
+	// Writes of the site found concurrent with writes of the server
+	Conflicts uint64 `protobuf:"varint,8,opt,name=conflicts" json:"conflicts,omitempty"`
+}
+
+func (m *SitePeer) Reset()                    { *m = SitePeer{} }
+func (m *SitePeer) String() string            { return proto.CompactTextString(m) }
+func (*SitePeer) ProtoMessage()               {}
+func (*SitePeer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+
+func (m *SitePeer) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SitePeer) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *SitePeer) GetConnected() bool {
+	if m != nil {
+		return m.Connected
+	}
+	return false
+}
+
+func (m *SitePeer) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *SitePeer) GetSiteRevision() uint64 {
+	if m != nil {
+		return m.SiteRevision
+	}
+	return 0
+}
+
+func (m *SitePeer) GetLag() uint64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *SitePeer) GetStalenessMs() int64 {
+	if m != nil {
+		return m.StalenessMs
+	}
+	return 0
+}
+
+func (m *SitePeer) GetConflicts() uint64 {
+	if m != nil {
+		return m.Conflicts
+	}
+	return 0
+}
+
+type SiteStatusResponse struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// "lww" or "siblings"
+	Conflicts string `protobuf:"bytes,2,opt,name=conflicts" json:"conflicts,omitempty"`
+	// Current time of the hybrid logical clock of the server
+	Hlc uint64 `protobuf:"varint,3,opt,name=hlc" json:"hlc,omitempty"`
+	// Last change made on the server
+	Revision uint64      `protobuf:"varint,4,opt,name=revision" json:"revision,omitempty"`
+	Peers    []*SitePeer `protobuf:"bytes,5,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *SiteStatusResponse) Reset()                    { *m = SiteStatusResponse{} }
+func (m *SiteStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*SiteStatusResponse) ProtoMessage()               {}
+func (*SiteStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+
+func (m *SiteStatusResponse) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SiteStatusResponse) GetConflicts() string {
+	if m != nil {
+		return m.Conflicts
+	}
+	return ""
+}
+
+func (m *SiteStatusResponse) GetHlc() uint64 {
+	if m != nil {
+		return m.Hlc
+	}
+	return 0
+}
+
+func (m *SiteStatusResponse) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *SiteStatusResponse) GetPeers() []*SitePeer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type ShardNode struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// Address of a server added
+	Addr string `protobuf:"bytes,2,opt,name=addr" json:"addr,omitempty"`
+}
+
+func (m *ShardNode) Reset()                    { *m = ShardNode{} }
+func (m *ShardNode) String() string            { return proto.CompactTextString(m) }
+func (*ShardNode) ProtoMessage()               {}
+func (*ShardNode) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+
+func (m *ShardNode) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ShardNode) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+// ShardMap places every key on a server: the owner of a key is the server
+// following its hash on a ring of 128 points per server, see package shard
+type ShardMap struct {
+	// Incremented by every change, 0 if there is no map yet
+	Version uint64       `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Nodes   []*ShardNode `protobuf:"bytes,2,rep,name=nodes" json:"nodes,omitempty"`
+}
+
+func (m *ShardMap) Reset()                    { *m = ShardMap{} }
+func (m *ShardMap) String() string            { return proto.CompactTextString(m) }
+func (*ShardMap) ProtoMessage()               {}
+func (*ShardMap) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+
+func (m *ShardMap) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *ShardMap) GetNodes() []*ShardNode {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+type ShardStatusResponse struct {
+	Id  string    `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Map *ShardMap `protobuf:"bytes,2,opt,name=map" json:"map,omitempty"`
+	// Keys are moving to or from the server
+	Rebalancing bool `protobuf:"varint,3,opt,name=rebalancing" json:"rebalancing,omitempty"`
+	// Servers still sending keys to this one
+	Pending []string `protobuf:"bytes,4,rep,name=pending" json:"pending,omitempty"`
+	// Keys sent to other servers since the server started
+	Moved uint64 `protobuf:"varint,5,opt,name=moved" json:"moved,omitempty"`
+}
+
+func (m *ShardStatusResponse) Reset()                    { *m = ShardStatusResponse{} }
+func (m *ShardStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*ShardStatusResponse) ProtoMessage()               {}
+func (*ShardStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+
+func (m *ShardStatusResponse) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ShardStatusResponse) GetMap() *ShardMap {
+	if m != nil {
+		return m.Map
+	}
+	return nil
+}
+
+func (m *ShardStatusResponse) GetRebalancing() bool {
+	if m != nil {
+		return m.Rebalancing
+	}
+	return false
+}
+
+func (m *ShardStatusResponse) GetPending() []string {
+	if m != nil {
+		return m.Pending
+	}
+	return nil
+}
+
+func (m *ShardStatusResponse) GetMoved() uint64 {
+	if m != nil {
+		return m.Moved
+	}
+	return 0
+}
+
+// SnapshotEntry is a key, with its full name, as stored in a snapshot
+type SnapshotEntry struct {
+	Key      string     `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Value    string     `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	Expires  int64      `protobuf:"varint,3,opt,name=expires" json:"expires,omitempty"`
+	Versions []*Version `protobuf:"bytes,4,rep,name=versions" json:"versions,omitempty"`
+}
+
+func (m *SnapshotEntry) Reset()                    { *m = SnapshotEntry{} }
+func (m *SnapshotEntry) String() string            { return proto.CompactTextString(m) }
+func (*SnapshotEntry) ProtoMessage()               {}
+func (*SnapshotEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
+
+func (m *SnapshotEntry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *SnapshotEntry) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *SnapshotEntry) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *SnapshotEntry) GetVersions() []*Version {
+	if m != nil {
+		return m.Versions
+	}
+	return nil
+}
+
+// Version is a value of a key as written at a site, a key has several while
+// concurrent writes are kept as siblings
+type Version struct {
+	Value   string       `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
+	Expires int64        `protobuf:"varint,2,opt,name=expires" json:"expires,omitempty"`
+	Deleted bool         `protobuf:"varint,3,opt,name=deleted" json:"deleted,omitempty"`
+	Site    string       `protobuf:"bytes,4,opt,name=site" json:"site,omitempty"`
+	Hlc     uint64       `protobuf:"varint,5,opt,name=hlc" json:"hlc,omitempty"`
+	Clock   []*SiteClock `protobuf:"bytes,6,rep,name=clock" json:"clock,omitempty"`
+}
+
+func (m *Version) Reset()                    { *m = Version{} }
+func (m *Version) String() string            { return proto.CompactTextString(m) }
+func (*Version) ProtoMessage()               {}
+func (*Version) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
+
+func (m *Version) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *Version) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *Version) GetDeleted() bool {
+	if m != nil {
+		return m.Deleted
+	}
+	return false
+}
+
+func (m *Version) GetSite() string {
+	if m != nil {
+		return m.Site
+	}
+	return ""
+}
+
+func (m *Version) GetHlc() uint64 {
+	if m != nil {
+		return m.Hlc
+	}
+	return 0
+}
+
+func (m *Version) GetClock() []*SiteClock {
+	if m != nil {
+		return m.Clock
+	}
+	return nil
+}
+
+type SiteClock struct {
+	Site string `protobuf:"bytes,1,opt,name=site" json:"site,omitempty"`
+	Hlc  uint64 `protobuf:"varint,2,opt,name=hlc" json:"hlc,omitempty"`
+}
+
+func (m *SiteClock) Reset()                    { *m = SiteClock{} }
+func (m *SiteClock) String() string            { return proto.CompactTextString(m) }
+func (*SiteClock) ProtoMessage()               {}
+func (*SiteClock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
+
+func (m *SiteClock) GetSite() string {
+	if m != nil {
+		return m.Site
+	}
+	return ""
+}
+
+func (m *SiteClock) GetHlc() uint64 {
+	if m != nil {
+		return m.Hlc
+	}
+	return 0
+}
+
+// BackupRequest selects the keys of a backup: every key if username is
+// empty, the keys of a user, or of one namespace of that user
+type BackupRequest struct {
+	Username  string `protobuf:"bytes,1,opt,name=username" json:"username,omitempty"`
+	Namespace string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty"`
+}
+
+func (m *BackupRequest) Reset()                    { *m = BackupRequest{} }
+func (m *BackupRequest) String() string            { return proto.CompactTextString(m) }
+func (*BackupRequest) ProtoMessage()               {}
+func (*BackupRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+
+func (m *BackupRequest) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *BackupRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+// BackupChunk is the next part of a snapshot file
+type BackupChunk struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data" json:"data,omitempty"`
+}
+
+func (m *BackupChunk) Reset()                    { *m = BackupChunk{} }
+func (m *BackupChunk) String() string            { return proto.CompactTextString(m) }
+func (*BackupChunk) ProtoMessage()               {}
+func (*BackupChunk) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
+
+func (m *BackupChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type RestoreChunk struct {
+	Username  string `protobuf:"bytes,1,opt,name=username" json:"username,omitempty"`
+	Namespace string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty"`
+	DryRun    bool   `protobuf:"varint,3,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	Data      []byte `protobuf:"bytes,4,opt,name=data" json:"data,omitempty"`
+}
+
+func (m *RestoreChunk) Reset()                    { *m = RestoreChunk{} }
+func (m *RestoreChunk) String() string            { return proto.CompactTextString(m) }
+func (*RestoreChunk) ProtoMessage()               {}
+func (*RestoreChunk) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
+
+func (m *RestoreChunk) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *RestoreChunk) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *RestoreChunk) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+func (m *RestoreChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type RestoreResponse struct {
+	Keys    int64 `protobuf:"varint,1,opt,name=keys" json:"keys,omitempty"`
+	Removed int64 `protobuf:"varint,2,opt,name=removed" json:"removed,omitempty"`
+	DryRun  bool  `protobuf:"varint,3,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+}
+
+func (m *RestoreResponse) Reset()                    { *m = RestoreResponse{} }
+func (m *RestoreResponse) String() string            { return proto.CompactTextString(m) }
+func (*RestoreResponse) ProtoMessage()               {}
+func (*RestoreResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
+
+func (m *RestoreResponse) GetKeys() int64 {
+	if m != nil {
+		return m.Keys
+	}
+	return 0
+}
+
+func (m *RestoreResponse) GetRemoved() int64 {
+	if m != nil {
+		return m.Removed
+	}
+	return 0
+}
+
+func (m *RestoreResponse) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+// SnapshotHeader describes a snapshot, it is written before its entries
+type SnapshotHeader struct {
+	Revision uint64 `protobuf:"varint,1,opt,name=revision" json:"revision,omitempty"`
+	Created  int64  `protobuf:"varint,2,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *SnapshotHeader) Reset()                    { *m = SnapshotHeader{} }
+func (m *SnapshotHeader) String() string            { return proto.CompactTextString(m) }
+func (*SnapshotHeader) ProtoMessage()               {}
+func (*SnapshotHeader) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
+
+func (m *SnapshotHeader) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *SnapshotHeader) GetCreated() int64 {
+	if m != nil {
+		return m.Created
+	}
+	return 0
+}
+
+// LogEntry is a change to the data, as written to the write log
+type LogEntry struct {
+	Revision uint64     `protobuf:"varint,1,opt,name=revision" json:"revision,omitempty"`
+	Time     int64      `protobuf:"varint,2,opt,name=time" json:"time,omitempty"`
+	Op       LogOp      `protobuf:"varint,3,opt,name=op,enum=protobuf.LogOp" json:"op,omitempty"`
+	Key      string     `protobuf:"bytes,4,opt,name=key" json:"key,omitempty"`
+	Value    string     `protobuf:"bytes,5,opt,name=value" json:"value,omitempty"`
+	Expires  int64      `protobuf:"varint,6,opt,name=expires" json:"expires,omitempty"`
+	Versions []*Version `protobuf:"bytes,7,rep,name=versions" json:"versions,omitempty"`
+}
+
+func (m *LogEntry) Reset()                    { *m = LogEntry{} }
+func (m *LogEntry) String() string            { return proto.CompactTextString(m) }
+func (*LogEntry) ProtoMessage()               {}
+func (*LogEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{41} }
+
+func (m *LogEntry) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *LogEntry) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *LogEntry) GetOp() LogOp {
+	if m != nil {
+		return m.Op
+	}
+	return LogOp_SET
+}
+
+func (m *LogEntry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *LogEntry) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *LogEntry) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *LogEntry) GetVersions() []*Version {
+	if m != nil {
+		return m.Versions
+	}
+	return nil
+}
+
+// RaftMember is a node of a Raft group
+type RaftMember struct {
+	Id      string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Addr    string `protobuf:"bytes,2,opt,name=addr" json:"addr,omitempty"`
+	Learner bool   `protobuf:"varint,3,opt,name=learner" json:"learner,omitempty"`
+}
+
+func (m *RaftMember) Reset()                    { *m = RaftMember{} }
+func (m *RaftMember) String() string            { return proto.CompactTextString(m) }
+func (*RaftMember) ProtoMessage()               {}
+func (*RaftMember) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{42} }
+
+func (m *RaftMember) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RaftMember) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *RaftMember) GetLearner() bool {
+	if m != nil {
+		return m.Learner
+	}
+	return false
+}
+
+// RaftConfig is the members of a Raft group
+type RaftConfig struct {
+	Members []*RaftMember `protobuf:"bytes,1,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *RaftConfig) Reset()                    { *m = RaftConfig{} }
+func (m *RaftConfig) String() string            { return proto.CompactTextString(m) }
+func (*RaftConfig) ProtoMessage()               {}
+func (*RaftConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{43} }
+
+func (m *RaftConfig) GetMembers() []*RaftMember {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+// RaftEntry is an entry of the Raft log
+type RaftEntry struct {
+	Index uint64        `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	Term  uint64        `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+	Type  RaftEntryType `protobuf:"varint,3,opt,name=type,enum=protobuf.RaftEntryType" json:"type,omitempty"`
+	Data  []byte        `protobuf:"bytes,4,opt,name=data" json:"data,omitempty"`
+}
+
+func (m *RaftEntry) Reset()                    { *m = RaftEntry{} }
+func (m *RaftEntry) String() string            { return proto.CompactTextString(m) }
+func (*RaftEntry) ProtoMessage()               {}
+func (*RaftEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{44} }
+
+func (m *RaftEntry) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *RaftEntry) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *RaftEntry) GetType() RaftEntryType {
+	if m != nil {
+		return m.Type
+	}
+	return RaftEntryType_ENTRY_COMMAND
+}
+
+func (m *RaftEntry) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type VoteRequest struct {
+	Term      uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Candidate string `protobuf:"bytes,2,opt,name=candidate" json:"candidate,omitempty"`
+	LastIndex uint64 `protobuf:"varint,3,opt,name=last_index,json=lastIndex" json:"last_index,omitempty"`
+	LastTerm  uint64 `protobuf:"varint,4,opt,name=last_term,json=lastTerm" json:"last_term,omitempty"`
+	Transfer  bool   `protobuf:"varint,5,opt,name=transfer" json:"transfer,omitempty"`
+}
+
+func (m *VoteRequest) Reset()                    { *m = VoteRequest{} }
+func (m *VoteRequest) String() string            { return proto.CompactTextString(m) }
+func (*VoteRequest) ProtoMessage()               {}
+func (*VoteRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{45} }
+
+func (m *VoteRequest) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *VoteRequest) GetCandidate() string {
+	if m != nil {
+		return m.Candidate
+	}
+	return ""
+}
+
+func (m *VoteRequest) GetLastIndex() uint64 {
+	if m != nil {
+		return m.LastIndex
+	}
+	return 0
+}
+
+func (m *VoteRequest) GetLastTerm() uint64 {
+	if m != nil {
+		return m.LastTerm
+	}
+	return 0
+}
+
+func (m *VoteRequest) GetTransfer() bool {
+	if m != nil {
+		return m.Transfer
+	}
+	return false
+}
+
+type VoteResponse struct {
+	Term    uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Granted bool   `protobuf:"varint,2,opt,name=granted" json:"granted,omitempty"`
+}
+
+func (m *VoteResponse) Reset()                    { *m = VoteResponse{} }
+func (m *VoteResponse) String() string            { return proto.CompactTextString(m) }
+func (*VoteResponse) ProtoMessage()               {}
+func (*VoteResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{46} }
+
+func (m *VoteResponse) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *VoteResponse) GetGranted() bool {
+	if m != nil {
+		return m.Granted
+	}
+	return false
+}
+
+type AppendRequest struct {
+	Term      uint64       `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Leader    string       `protobuf:"bytes,2,opt,name=leader" json:"leader,omitempty"`
+	PrevIndex uint64       `protobuf:"varint,3,opt,name=prev_index,json=prevIndex" json:"prev_index,omitempty"`
+	PrevTerm  uint64       `protobuf:"varint,4,opt,name=prev_term,json=prevTerm" json:"prev_term,omitempty"`
+	Entries   []*RaftEntry `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	Commit    uint64       `protobuf:"varint,6,opt,name=commit" json:"commit,omitempty"`
+}
+
+func (m *AppendRequest) Reset()                    { *m = AppendRequest{} }
+func (m *AppendRequest) String() string            { return proto.CompactTextString(m) }
+func (*AppendRequest) ProtoMessage()               {}
+func (*AppendRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{47} }
+
+func (m *AppendRequest) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *AppendRequest) GetLeader() string {
+	if m != nil {
+		return m.Leader
+	}
+	return ""
+}
+
+func (m *AppendRequest) GetPrevIndex() uint64 {
+	if m != nil {
+		return m.PrevIndex
+	}
+	return 0
+}
+
+func (m *AppendRequest) GetPrevTerm() uint64 {
+	if m != nil {
+		return m.PrevTerm
+	}
+	return 0
+}
+
+func (m *AppendRequest) GetEntries() []*RaftEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func (m *AppendRequest) GetCommit() uint64 {
+	if m != nil {
+		return m.Commit
+	}
+	return 0
+}
+
+type AppendResponse struct {
+	Term    uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Success bool   `protobuf:"varint,2,opt,name=success" json:"success,omitempty"`
+	Hint    uint64 `protobuf:"varint,3,opt,name=hint" json:"hint,omitempty"`
+}
+
+func (m *AppendResponse) Reset()                    { *m = AppendResponse{} }
+func (m *AppendResponse) String() string            { return proto.CompactTextString(m) }
+func (*AppendResponse) ProtoMessage()               {}
+func (*AppendResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{48} }
+
+func (m *AppendResponse) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *AppendResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *AppendResponse) GetHint() uint64 {
+	if m != nil {
+		return m.Hint
+	}
+	return 0
+}
+
+type SnapshotChunk struct {
+	Term     uint64        `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Leader   string        `protobuf:"bytes,2,opt,name=leader" json:"leader,omitempty"`
+	Index    uint64        `protobuf:"varint,3,opt,name=index" json:"index,omitempty"`
+	LastTerm uint64        `protobuf:"varint,4,opt,name=last_term,json=lastTerm" json:"last_term,omitempty"`
+	Data     []byte        `protobuf:"bytes,5,opt,name=data" json:"data,omitempty"`
+	Members  []*RaftMember `protobuf:"bytes,6,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *SnapshotChunk) Reset()                    { *m = SnapshotChunk{} }
+func (m *SnapshotChunk) String() string            { return proto.CompactTextString(m) }
+func (*SnapshotChunk) ProtoMessage()               {}
+func (*SnapshotChunk) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{49} }
+
+func (m *SnapshotChunk) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *SnapshotChunk) GetLeader() string {
+	if m != nil {
+		return m.Leader
+	}
+	return ""
+}
+
+func (m *SnapshotChunk) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *SnapshotChunk) GetLastTerm() uint64 {
+	if m != nil {
+		return m.LastTerm
+	}
+	return 0
+}
+
+func (m *SnapshotChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *SnapshotChunk) GetMembers() []*RaftMember {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+type InstallSnapshotResponse struct {
+	Term uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+}
+
+func (m *InstallSnapshotResponse) Reset()                    { *m = InstallSnapshotResponse{} }
+func (m *InstallSnapshotResponse) String() string            { return proto.CompactTextString(m) }
+func (*InstallSnapshotResponse) ProtoMessage()               {}
+func (*InstallSnapshotResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{50} }
+
+func (m *InstallSnapshotResponse) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+type TimeoutNowRequest struct {
+	Term   uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Leader string `protobuf:"bytes,2,opt,name=leader" json:"leader,omitempty"`
+}
+
+func (m *TimeoutNowRequest) Reset()                    { *m = TimeoutNowRequest{} }
+func (m *TimeoutNowRequest) String() string            { return proto.CompactTextString(m) }
+func (*TimeoutNowRequest) ProtoMessage()               {}
+func (*TimeoutNowRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{51} }
+
+func (m *TimeoutNowRequest) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *TimeoutNowRequest) GetLeader() string {
+	if m != nil {
+		return m.Leader
+	}
+	return ""
+}
+
+type TimeoutNowResponse struct {
+	Term uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+}
+
+func (m *TimeoutNowResponse) Reset()                    { *m = TimeoutNowResponse{} }
+func (m *TimeoutNowResponse) String() string            { return proto.CompactTextString(m) }
+func (*TimeoutNowResponse) ProtoMessage()               {}
+func (*TimeoutNowResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{52} }
+
+func (m *TimeoutNowResponse) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+// RaftSnapshotMeta is written before the data of a Raft snapshot
+type RaftSnapshotMeta struct {
+	Index   uint64        `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	Term    uint64        `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+	Members []*RaftMember `protobuf:"bytes,3,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *RaftSnapshotMeta) Reset()                    { *m = RaftSnapshotMeta{} }
+func (m *RaftSnapshotMeta) String() string            { return proto.CompactTextString(m) }
+func (*RaftSnapshotMeta) ProtoMessage()               {}
+func (*RaftSnapshotMeta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{53} }
+
+func (m *RaftSnapshotMeta) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *RaftSnapshotMeta) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *RaftSnapshotMeta) GetMembers() []*RaftMember {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+// Command is a change to the data, replicated through the Raft log
+type Command struct {
+	Op      CommandOp `protobuf:"varint,1,opt,name=op,enum=protobuf.CommandOp" json:"op,omitempty"`
+	Key     string    `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Value   string    `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	Expires int64     `protobuf:"varint,4,opt,name=expires" json:"expires,omitempty"`
+	Now     int64     `protobuf:"varint,5,opt,name=now" json:"now,omitempty"`
+	// A restore is made of several commands, each with part of the keys of the
+	// backup or of those it removes, so that each fits in a message
+	Entries []*SnapshotEntry `protobuf:"bytes,6,rep,name=entries" json:"entries,omitempty"`
+	Removed []string         `protobuf:"bytes,7,rep,name=removed" json:"removed,omitempty"`
+}
+
+func (m *Command) Reset()                    { *m = Command{} }
+func (m *Command) String() string            { return proto.CompactTextString(m) }
+func (*Command) ProtoMessage()               {}
+func (*Command) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{54} }
+
+func (m *Command) GetOp() CommandOp {
+	if m != nil {
+		return m.Op
+	}
+	return CommandOp_CMD_SET
+}
+
+func (m *Command) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Command) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *Command) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *Command) GetNow() int64 {
+	if m != nil {
+		return m.Now
+	}
+	return 0
+}
+
+func (m *Command) GetEntries() []*SnapshotEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func (m *Command) GetRemoved() []string {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+// ReplicaAck is sent by a replica, the first one says where it resumes from
+type ReplicaAck struct {
+	History  string `protobuf:"bytes,1,opt,name=history" json:"history,omitempty"`
+	Revision uint64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	Site     string `protobuf:"bytes,3,opt,name=site" json:"site,omitempty"`
+}
+
+func (m *ReplicaAck) Reset()                    { *m = ReplicaAck{} }
+func (m *ReplicaAck) String() string            { return proto.CompactTextString(m) }
+func (*ReplicaAck) ProtoMessage()               {}
+func (*ReplicaAck) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{55} }
+
+func (m *ReplicaAck) GetHistory() string {
+	if m != nil {
+		return m.History
+	}
+	return ""
+}
+
+func (m *ReplicaAck) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *ReplicaAck) GetSite() string {
+	if m != nil {
+		return m.Site
+	}
+	return ""
+}
+
+// ReplicationMessage is sent by the primary: a heartbeat if it holds nothing
+// else
+type ReplicationMessage struct {
+	History  string      `protobuf:"bytes,1,opt,name=history" json:"history,omitempty"`
+	Revision uint64      `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	Full     bool        `protobuf:"varint,3,opt,name=full" json:"full,omitempty"`
+	Snapshot []byte      `protobuf:"bytes,4,opt,name=snapshot" json:"snapshot,omitempty"`
+	Entries  []*LogEntry `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	Through  uint64      `protobuf:"varint,6,opt,name=through" json:"through,omitempty"`
+}
+
+func (m *ReplicationMessage) Reset()                    { *m = ReplicationMessage{} }
+func (m *ReplicationMessage) String() string            { return proto.CompactTextString(m) }
+func (*ReplicationMessage) ProtoMessage()               {}
+func (*ReplicationMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{56} }
+
+func (m *ReplicationMessage) GetHistory() string {
+	if m != nil {
+		return m.History
+	}
+	return ""
+}
+
+func (m *ReplicationMessage) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *ReplicationMessage) GetFull() bool {
+	if m != nil {
+		return m.Full
+	}
+	return false
+}
+
+func (m *ReplicationMessage) GetSnapshot() []byte {
+	if m != nil {
+		return m.Snapshot
+	}
+	return nil
+}
+
+func (m *ReplicationMessage) GetEntries() []*LogEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func (m *ReplicationMessage) GetThrough() uint64 {
+	if m != nil {
+		return m.Through
+	}
+	return 0
+}
+
+// ShardState is the shard map of a shard, as saved in its data directory
+type ShardState struct {
+	Map     *ShardMap `protobuf:"bytes,1,opt,name=map" json:"map,omitempty"`
+	Prev    *ShardMap `protobuf:"bytes,2,opt,name=prev" json:"prev,omitempty"`
+	Pending []string  `protobuf:"bytes,3,rep,name=pending" json:"pending,omitempty"`
+}
+
+func (m *ShardState) Reset()                    { *m = ShardState{} }
+func (m *ShardState) String() string            { return proto.CompactTextString(m) }
+func (*ShardState) ProtoMessage()               {}
+func (*ShardState) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{57} }
+
+func (m *ShardState) GetMap() *ShardMap {
+	if m != nil {
+		return m.Map
+	}
+	return nil
+}
+
+func (m *ShardState) GetPrev() *ShardMap {
+	if m != nil {
+		return m.Prev
+	}
+	return nil
+}
+
+func (m *ShardState) GetPending() []string {
+	if m != nil {
+		return m.Pending
+	}
+	return nil
+}
+
+type UpdateShardMapRequest struct {
+	Prev *ShardMap `protobuf:"bytes,1,opt,name=prev" json:"prev,omitempty"`
+	Next *ShardMap `protobuf:"bytes,2,opt,name=next" json:"next,omitempty"`
+}
+
+func (m *UpdateShardMapRequest) Reset()                    { *m = UpdateShardMapRequest{} }
+func (m *UpdateShardMapRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateShardMapRequest) ProtoMessage()               {}
+func (*UpdateShardMapRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{58} }
+
+func (m *UpdateShardMapRequest) GetPrev() *ShardMap {
+	if m != nil {
+		return m.Prev
+	}
+	return nil
+}
+
+func (m *UpdateShardMapRequest) GetNext() *ShardMap {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+type MigrateRequest struct {
+	From    string           `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	Version uint64           `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
+	Entries []*SnapshotEntry `protobuf:"bytes,3,rep,name=entries" json:"entries,omitempty"`
+	Done    bool             `protobuf:"varint,4,opt,name=done" json:"done,omitempty"`
+}
+
+func (m *MigrateRequest) Reset()                    { *m = MigrateRequest{} }
+func (m *MigrateRequest) String() string            { return proto.CompactTextString(m) }
+func (*MigrateRequest) ProtoMessage()               {}
+func (*MigrateRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{59} }
+
+func (m *MigrateRequest) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *MigrateRequest) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *MigrateRequest) GetEntries() []*SnapshotEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func (m *MigrateRequest) GetDone() bool {
+	if m != nil {
+		return m.Done
+	}
+	return false
+}
+
+type HandoffRequest struct {
+	Version uint64   `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Keys    []string `protobuf:"bytes,2,rep,name=keys" json:"keys,omitempty"`
+}
+
+func (m *HandoffRequest) Reset()                    { *m = HandoffRequest{} }
+func (m *HandoffRequest) String() string            { return proto.CompactTextString(m) }
+func (*HandoffRequest) ProtoMessage()               {}
+func (*HandoffRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{60} }
+
+func (m *HandoffRequest) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *HandoffRequest) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+type HandoffResponse struct {
+	Entries []*SnapshotEntry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *HandoffResponse) Reset()                    { *m = HandoffResponse{} }
+func (m *HandoffResponse) String() string            { return proto.CompactTextString(m) }
+func (*HandoffResponse) ProtoMessage()               {}
+func (*HandoffResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{61} }
+
+func (m *HandoffResponse) GetEntries() []*SnapshotEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*KeyValuePair)(nil), "protobuf.KeyValuePair")
+	proto.RegisterType((*Sibling)(nil), "protobuf.Sibling")
+	proto.RegisterType((*Key)(nil), "protobuf.Key")
+	proto.RegisterType((*Namespace)(nil), "protobuf.Namespace")
+	proto.RegisterType((*Response)(nil), "protobuf.Response")
+	proto.RegisterType((*CountResponse)(nil), "protobuf.CountResponse")
+	proto.RegisterType((*ShowKeysResponse)(nil), "protobuf.ShowKeysResponse")
+	proto.RegisterType((*ShowDataResponse)(nil), "protobuf.ShowDataResponse")
+	proto.RegisterType((*ShowNamespacesResponse)(nil), "protobuf.ShowNamespacesResponse")
+	proto.RegisterType((*NamespaceResponse)(nil), "protobuf.NamespaceResponse")
+	proto.RegisterType((*APIKeyRequest)(nil), "protobuf.APIKeyRequest")
+	proto.RegisterType((*APIKey)(nil), "protobuf.APIKey")
+	proto.RegisterType((*APIKeyID)(nil), "protobuf.APIKeyID")
+	proto.RegisterType((*APIKeyList)(nil), "protobuf.APIKeyList")
+	proto.RegisterType((*AuditQuery)(nil), "protobuf.AuditQuery")
+	proto.RegisterType((*AuditRecord)(nil), "protobuf.AuditRecord")
+	proto.RegisterType((*AuditRecords)(nil), "protobuf.AuditRecords")
+	proto.RegisterType((*RateLimitStats)(nil), "protobuf.RateLimitStats")
+	proto.RegisterType((*MemoryStats)(nil), "protobuf.MemoryStats")
+	proto.RegisterType((*StatsResponse)(nil), "protobuf.StatsResponse")
+	proto.RegisterType((*UsageRequest)(nil), "protobuf.UsageRequest")
+	proto.RegisterType((*QuotaUsage)(nil), "protobuf.QuotaUsage")
+	proto.RegisterType((*UsageResponse)(nil), "protobuf.UsageResponse")
+	proto.RegisterType((*MemberRequest)(nil), "protobuf.MemberRequest")
+	proto.RegisterType((*ClusterMember)(nil), "protobuf.ClusterMember")
+	proto.RegisterType((*ClusterStatusResponse)(nil), "protobuf.ClusterStatusResponse")
+	proto.RegisterType((*ReplicaStatus)(nil), "protobuf.ReplicaStatus")
+	proto.RegisterType((*ReplicationStatusResponse)(nil), "protobuf.ReplicationStatusResponse")
+	proto.RegisterType((*SitePeer)(nil), "protobuf.SitePeer")
+	proto.RegisterType((*SiteStatusResponse)(nil), "protobuf.SiteStatusResponse")
+	proto.RegisterType((*ShardNode)(nil), "protobuf.ShardNode")
+	proto.RegisterType((*ShardMap)(nil), "protobuf.ShardMap")
+	proto.RegisterType((*ShardStatusResponse)(nil), "protobuf.ShardStatusResponse")
+	proto.RegisterType((*SnapshotEntry)(nil), "protobuf.SnapshotEntry")
+	proto.RegisterType((*Version)(nil), "protobuf.Version")
+	proto.RegisterType((*SiteClock)(nil), "protobuf.SiteClock")
+	proto.RegisterType((*BackupRequest)(nil), "protobuf.BackupRequest")
+	proto.RegisterType((*BackupChunk)(nil), "protobuf.BackupChunk")
+	proto.RegisterType((*RestoreChunk)(nil), "protobuf.RestoreChunk")
+	proto.RegisterType((*RestoreResponse)(nil), "protobuf.RestoreResponse")
+	proto.RegisterType((*SnapshotHeader)(nil), "protobuf.SnapshotHeader")
+	proto.RegisterType((*LogEntry)(nil), "protobuf.LogEntry")
+	proto.RegisterType((*RaftMember)(nil), "protobuf.RaftMember")
+	proto.RegisterType((*RaftConfig)(nil), "protobuf.RaftConfig")
+	proto.RegisterType((*RaftEntry)(nil), "protobuf.RaftEntry")
+	proto.RegisterType((*VoteRequest)(nil), "protobuf.VoteRequest")
+	proto.RegisterType((*VoteResponse)(nil), "protobuf.VoteResponse")
+	proto.RegisterType((*AppendRequest)(nil), "protobuf.AppendRequest")
+	proto.RegisterType((*AppendResponse)(nil), "protobuf.AppendResponse")
+	proto.RegisterType((*SnapshotChunk)(nil), "protobuf.SnapshotChunk")
+	proto.RegisterType((*InstallSnapshotResponse)(nil), "protobuf.InstallSnapshotResponse")
+	proto.RegisterType((*TimeoutNowRequest)(nil), "protobuf.TimeoutNowRequest")
+	proto.RegisterType((*TimeoutNowResponse)(nil), "protobuf.TimeoutNowResponse")
+	proto.RegisterType((*RaftSnapshotMeta)(nil), "protobuf.RaftSnapshotMeta")
+	proto.RegisterType((*Command)(nil), "protobuf.Command")
+	proto.RegisterType((*ReplicaAck)(nil), "protobuf.ReplicaAck")
+	proto.RegisterType((*ReplicationMessage)(nil), "protobuf.ReplicationMessage")
+	proto.RegisterType((*ShardState)(nil), "protobuf.ShardState")
+	proto.RegisterType((*UpdateShardMapRequest)(nil), "protobuf.UpdateShardMapRequest")
+	proto.RegisterType((*MigrateRequest)(nil), "protobuf.MigrateRequest")
+	proto.RegisterType((*HandoffRequest)(nil), "protobuf.HandoffRequest")
+	proto.RegisterType((*HandoffResponse)(nil), "protobuf.HandoffResponse")
+	proto.RegisterEnum("protobuf.LogOp", LogOp_name, LogOp_value)
+	proto.RegisterEnum("protobuf.RaftEntryType", RaftEntryType_name, RaftEntryType_value)
+	proto.RegisterEnum("protobuf.CommandOp", CommandOp_name, CommandOp_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for KVS service
+
+type KVSClient interface {
+	// Inserts a key-value pair into a namespace, if not present
+	Set(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error)
+	// Updates a key-value pair in a namespace, if present
+	Update(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error)
+	// Checks if a key is in a namespace
+	Has(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
+	// Removes a key in a namespace, if present
+	Unset(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error)
+	// Retrieves an element from a namespace under given key
+	Get(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error)
+	// Returns the total number of key-value pairs in a namespace
+	Count(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*CountResponse, error)
+	// Retrieve all keys in a namespace
+	ShowKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowKeysResponse, error)
+	// Retrieve all key-value pairs in a namespace
+	ShowData(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowDataResponse, error)
+	// Retrieve all namespaces in the key-value store that belongs to the user
+	// NOTE: No token needed
+	ShowNamespaces(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowNamespacesResponse, error)
+	// Changes the current namespace, returns a token that must be used for
+	// subsequent requests
+	// NOTE: No token needed
+	UseNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*NamespaceResponse, error)
+	// Returns the keys and bytes stored by a user and each of their
+	// namespaces, along with their quotas
+	// NOTE: No token needed, only admins may query other users
+	Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error)
+	// Creates an API key acting on behalf of a user, the full key is only
+	// returned here
+	// NOTE: Admin only, no token needed
+	CreateAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error)
+	// Revokes an API key
+	// NOTE: Admin only, no token needed
+	RevokeAPIKey(ctx context.Context, in *APIKeyID, opts ...grpc.CallOption) (*Response, error)
+	// Lists all API keys, without their secrets
+	// NOTE: Admin only, no token needed
+	ListAPIKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*APIKeyList, error)
+	// Returns audit records matching a query, oldest first
+	// NOTE: Admin only, no token needed
+	QueryAudit(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditRecords, error)
+	// Returns server statistics
+	// NOTE: Admin only, no token needed
+	Stats(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Reloads the encryption keys and rewrites the data on disk with the
+	// active key, so that older keys can be removed
+	// NOTE: Admin only, no token needed
+	Reencrypt(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*Response, error)
+	// Streams a consistent snapshot of the whole store, a user or a namespace
+	// NOTE: Admin only, no token needed
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (KVS_BackupClient, error)
+	// Replaces the whole store, a user or a namespace with a snapshot streamed
+	// by the caller, the scope and dry_run are taken from the first message
+	// NOTE: Admin only, no token needed
+	Restore(ctx context.Context, opts ...grpc.CallOption) (KVS_RestoreClient, error)
+	// Returns the state of the cluster as the node sees it, with the
+	// replication progress of every node when asked to the leader
+	// NOTE: Admin only, no token needed
+	ClusterStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error)
+	// Adds a node to the cluster, as a learner or as a voter once it has
+	// caught up with the leader
+	// NOTE: Admin only, no token needed
+	AddMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error)
+	// Makes a learner a voter once it has caught up with the leader
+	// NOTE: Admin only, no token needed
+	PromoteMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error)
+	// Removes a node from the cluster
+	// NOTE: Admin only, no token needed
+	RemoveMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error)
+	// Hands leadership over to a voter once it has caught up with the leader
+	// NOTE: Admin only, no token needed
+	TransferLeadership(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error)
+	// Returns the role of the server in primary-replica replication, with
+	// the lag of a replica or of every replica following a primary
+	// NOTE: Admin only, no token needed
+	ReplicationStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ReplicationStatusResponse, error)
+	// Returns the shard map, which says the server holding each key
+	// NOTE: No token needed
+	ShardMap(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardMap, error)
+	// Returns the shard map of the server and the keys it is moving
+	// NOTE: Admin only, no token needed
+	ShardStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardStatusResponse, error)
+	// Adds a server to the shard map, the keys it now holds move to it
+	// NOTE: Admin only, no token needed
+	AddShard(ctx context.Context, in *ShardNode, opts ...grpc.CallOption) (*Response, error)
+	// Removes a server from the shard map, its keys move to the others
+	// NOTE: Admin only, no token needed
+	RemoveShard(ctx context.Context, in *ShardNode, opts ...grpc.CallOption) (*Response, error)
+	// Returns the sites the server exchanges writes with, and how far behind
+	// each of them it is
+	// NOTE: Admin only, no token needed
+	SiteStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*SiteStatusResponse, error)
+}
+
+type kVSClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewKVSClient(cc *grpc.ClientConn) KVSClient {
+	return &kVSClient{cc}
+}
+
+func (c *kVSClient) Set(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Set", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Update(ctx context.Context, in *KeyValuePair, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Update", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Has(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Has", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Unset(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error) {
+	out := new(KeyValuePair)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Unset", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Get(ctx context.Context, in *Key, opts ...grpc.CallOption) (*KeyValuePair, error) {
+	out := new(KeyValuePair)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Get", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Count(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Count", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ShowKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowKeysResponse, error) {
+	out := new(ShowKeysResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ShowData(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowDataResponse, error) {
+	out := new(ShowDataResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowData", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ShowNamespaces(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShowNamespacesResponse, error) {
+	out := new(ShowNamespacesResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ShowNamespaces", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) UseNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*NamespaceResponse, error) {
+	out := new(NamespaceResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/UseNamespace", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error) {
+	out := new(UsageResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Usage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) CreateAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error) {
+	out := new(APIKey)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/CreateAPIKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) RevokeAPIKey(ctx context.Context, in *APIKeyID, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/RevokeAPIKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ListAPIKeys(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*APIKeyList, error) {
+	out := new(APIKeyList)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ListAPIKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) QueryAudit(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditRecords, error) {
+	out := new(AuditRecords)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/QueryAudit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Stats(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Stats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Reencrypt(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/Reencrypt", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (KVS_BackupClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_KVS_serviceDesc.Streams[0], c.cc, "/protobuf.KVS/Backup", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVSBackupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVS_BackupClient interface {
+	Recv() (*BackupChunk, error)
+	grpc.ClientStream
+}
+
+type kVSBackupClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVSBackupClient) Recv() (*BackupChunk, error) {
+	m := new(BackupChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVSClient) Restore(ctx context.Context, opts ...grpc.CallOption) (KVS_RestoreClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_KVS_serviceDesc.Streams[1], c.cc, "/protobuf.KVS/Restore", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVSRestoreClient{stream}
+	return x, nil
+}
+
+type KVS_RestoreClient interface {
+	Send(*RestoreChunk) error
+	CloseAndRecv() (*RestoreResponse, error)
+	grpc.ClientStream
+}
+
+type kVSRestoreClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVSRestoreClient) Send(m *RestoreChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *kVSRestoreClient) CloseAndRecv() (*RestoreResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RestoreResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVSClient) ClusterStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error) {
+	out := new(ClusterStatusResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ClusterStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) AddMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/AddMember", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) PromoteMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/PromoteMember", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) RemoveMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/RemoveMember", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) TransferLeadership(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/TransferLeadership", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ReplicationStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ReplicationStatusResponse, error) {
+	out := new(ReplicationStatusResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ReplicationStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ShardMap(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardMap, error) {
+	out := new(ShardMap)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ShardMap", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) ShardStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardStatusResponse, error) {
+	out := new(ShardStatusResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/ShardStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) AddShard(ctx context.Context, in *ShardNode, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/AddShard", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) RemoveShard(ctx context.Context, in *ShardNode, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/RemoveShard", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVSClient) SiteStatus(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*SiteStatusResponse, error) {
+	out := new(SiteStatusResponse)
+	err := grpc.Invoke(ctx, "/protobuf.KVS/SiteStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for KVS service
+
+type KVSServer interface {
+	// Inserts a key-value pair into a namespace, if not present
+	Set(context.Context, *KeyValuePair) (*Response, error)
+	// Updates a key-value pair in a namespace, if present
+	Update(context.Context, *KeyValuePair) (*Response, error)
+	// Checks if a key is in a namespace
+	Has(context.Context, *Key) (*Response, error)
+	// Removes a key in a namespace, if present
+	Unset(context.Context, *Key) (*KeyValuePair, error)
+	// Retrieves an element from a namespace under given key
+	Get(context.Context, *Key) (*KeyValuePair, error)
+	// Returns the total number of key-value pairs in a namespace
+	Count(context.Context, *google_protobuf.Empty) (*CountResponse, error)
+	// Retrieve all keys in a namespace
+	ShowKeys(context.Context, *google_protobuf.Empty) (*ShowKeysResponse, error)
+	// Retrieve all key-value pairs in a namespace
+	ShowData(context.Context, *google_protobuf.Empty) (*ShowDataResponse, error)
+	// Retrieve all namespaces in the key-value store that belongs to the user
+	// NOTE: No token needed
+	ShowNamespaces(context.Context, *google_protobuf.Empty) (*ShowNamespacesResponse, error)
+	// Changes the current namespace, returns a token that must be used for
+	// subsequent requests
+	// NOTE: No token needed
+	UseNamespace(context.Context, *Namespace) (*NamespaceResponse, error)
+	// Returns the keys and bytes stored by a user and each of their
+	// namespaces, along with their quotas
+	// NOTE: No token needed, only admins may query other users
+	Usage(context.Context, *UsageRequest) (*UsageResponse, error)
+	// Creates an API key acting on behalf of a user, the full key is only
+	// returned here
+	// NOTE: Admin only, no token needed
+	CreateAPIKey(context.Context, *APIKeyRequest) (*APIKey, error)
+	// Revokes an API key
+	// NOTE: Admin only, no token needed
+	RevokeAPIKey(context.Context, *APIKeyID) (*Response, error)
+	// Lists all API keys, without their secrets
+	// NOTE: Admin only, no token needed
+	ListAPIKeys(context.Context, *google_protobuf.Empty) (*APIKeyList, error)
+	// Returns audit records matching a query, oldest first
+	// NOTE: Admin only, no token needed
+	QueryAudit(context.Context, *AuditQuery) (*AuditRecords, error)
+	// Returns server statistics
+	// NOTE: Admin only, no token needed
+	Stats(context.Context, *google_protobuf.Empty) (*StatsResponse, error)
+	// Reloads the encryption keys and rewrites the data on disk with the
+	// active key, so that older keys can be removed
+	// NOTE: Admin only, no token needed
+	Reencrypt(context.Context, *google_protobuf.Empty) (*Response, error)
+	// Streams a consistent snapshot of the whole store, a user or a namespace
+	// NOTE: Admin only, no token needed
+	Backup(*BackupRequest, KVS_BackupServer) error
+	// Replaces the whole store, a user or a namespace with a snapshot streamed
+	// by the caller, the scope and dry_run are taken from the first message
+	// NOTE: Admin only, no token needed
+	Restore(KVS_RestoreServer) error
+	// Returns the state of the cluster as the node sees it, with the
+	// replication progress of every node when asked to the leader
+	// NOTE: Admin only, no token needed
+	ClusterStatus(context.Context, *google_protobuf.Empty) (*ClusterStatusResponse, error)
+	// Adds a node to the cluster, as a learner or as a voter once it has
+	// caught up with the leader
+	// NOTE: Admin only, no token needed
+	AddMember(context.Context, *MemberRequest) (*Response, error)
+	// Makes a learner a voter once it has caught up with the leader
+	// NOTE: Admin only, no token needed
+	PromoteMember(context.Context, *MemberRequest) (*Response, error)
+	// Removes a node from the cluster
+	// NOTE: Admin only, no token needed
+	RemoveMember(context.Context, *MemberRequest) (*Response, error)
+	// Hands leadership over to a voter once it has caught up with the leader
+	// NOTE: Admin only, no token needed
+	TransferLeadership(context.Context, *MemberRequest) (*Response, error)
+	// Returns the role of the server in primary-replica replication, with
+	// the lag of a replica or of every replica following a primary
+	// NOTE: Admin only, no token needed
+	ReplicationStatus(context.Context, *google_protobuf.Empty) (*ReplicationStatusResponse, error)
+	// Returns the shard map, which says the server holding each key
+	// NOTE: No token needed
+	ShardMap(context.Context, *google_protobuf.Empty) (*ShardMap, error)
+	// Returns the shard map of the server and the keys it is moving
+	// NOTE: Admin only, no token needed
+	ShardStatus(context.Context, *google_protobuf.Empty) (*ShardStatusResponse, error)
+	// Adds a server to the shard map, the keys it now holds move to it
+	// NOTE: Admin only, no token needed
+	AddShard(context.Context, *ShardNode) (*Response, error)
+	// Removes a server from the shard map, its keys move to the others
+	// NOTE: Admin only, no token needed
+	RemoveShard(context.Context, *ShardNode) (*Response, error)
+	// Returns the sites the server exchanges writes with, and how far behind
+	// each of them it is
+	// NOTE: Admin only, no token needed
+	SiteStatus(context.Context, *google_protobuf.Empty) (*SiteStatusResponse, error)
+}
+
+func RegisterKVSServer(s *grpc.Server, srv KVSServer) {
+	s.RegisterService(&_KVS_serviceDesc, srv)
+}
+
+func _KVS_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyValuePair)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Set",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Set(ctx, req.(*KeyValuePair))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyValuePair)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Update(ctx, req.(*KeyValuePair))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Has_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Has(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Has",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Has(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Unset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Unset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Unset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Unset(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Get(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Count",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Count(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ShowKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ShowKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ShowKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ShowKeys(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ShowData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ShowData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ShowData",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ShowData(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ShowNamespaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ShowNamespaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ShowNamespaces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ShowNamespaces(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_UseNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).UseNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/UseNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).UseNamespace(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Usage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Usage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Usage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Usage(ctx, req.(*UsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_CreateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).CreateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/CreateAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).CreateAPIKey(ctx, req.(*APIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_RevokeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).RevokeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/RevokeAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).RevokeAPIKey(ctx, req.(*APIKeyID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ListAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ListAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ListAPIKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ListAPIKeys(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_QueryAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).QueryAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/QueryAudit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).QueryAudit(ctx, req.(*AuditQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Stats(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Reencrypt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).Reencrypt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/Reencrypt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).Reencrypt(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_Backup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BackupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVSServer).Backup(m, &kVSBackupServer{stream})
+}
+
+type KVS_BackupServer interface {
+	Send(*BackupChunk) error
+	grpc.ServerStream
+}
+
+type kVSBackupServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVSBackupServer) Send(m *BackupChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KVS_Restore_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KVSServer).Restore(&kVSRestoreServer{stream})
+}
+
+type KVS_RestoreServer interface {
+	SendAndClose(*RestoreResponse) error
+	Recv() (*RestoreChunk, error)
+	grpc.ServerStream
+}
+
+type kVSRestoreServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVSRestoreServer) SendAndClose(m *RestoreResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *kVSRestoreServer) Recv() (*RestoreChunk, error) {
+	m := new(RestoreChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _KVS_ClusterStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).Update(ctx, in)
+		return srv.(KVSServer).ClusterStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ClusterStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ClusterStatus(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_AddMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).AddMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/AddMember",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).AddMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_PromoteMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).PromoteMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/PromoteMember",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).PromoteMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_RemoveMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).RemoveMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/RemoveMember",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).RemoveMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_TransferLeadership_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).TransferLeadership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/TransferLeadership",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).TransferLeadership(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ReplicationStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ReplicationStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ReplicationStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ReplicationStatus(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ShardMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ShardMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ShardMap",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ShardMap(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_ShardStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).ShardStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/ShardStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).ShardStatus(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_AddShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShardNode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).AddShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/AddShard",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).AddShard(ctx, req.(*ShardNode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_RemoveShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShardNode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).RemoveShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/RemoveShard",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).RemoveShard(ctx, req.(*ShardNode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVS_SiteStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVSServer).SiteStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.KVS/SiteStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVSServer).SiteStatus(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _KVS_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protobuf.KVS",
+	HandlerType: (*KVSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Set",
+			Handler:    _KVS_Set_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _KVS_Update_Handler,
+		},
+		{
+			MethodName: "Has",
+			Handler:    _KVS_Has_Handler,
+		},
+		{
+			MethodName: "Unset",
+			Handler:    _KVS_Unset_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _KVS_Get_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _KVS_Count_Handler,
+		},
+		{
+			MethodName: "ShowKeys",
+			Handler:    _KVS_ShowKeys_Handler,
+		},
+		{
+			MethodName: "ShowData",
+			Handler:    _KVS_ShowData_Handler,
+		},
+		{
+			MethodName: "ShowNamespaces",
+			Handler:    _KVS_ShowNamespaces_Handler,
+		},
+		{
+			MethodName: "UseNamespace",
+			Handler:    _KVS_UseNamespace_Handler,
+		},
+		{
+			MethodName: "Usage",
+			Handler:    _KVS_Usage_Handler,
+		},
+		{
+			MethodName: "CreateAPIKey",
+			Handler:    _KVS_CreateAPIKey_Handler,
+		},
+		{
+			MethodName: "RevokeAPIKey",
+			Handler:    _KVS_RevokeAPIKey_Handler,
+		},
+		{
+			MethodName: "ListAPIKeys",
+			Handler:    _KVS_ListAPIKeys_Handler,
+		},
+		{
+			MethodName: "QueryAudit",
+			Handler:    _KVS_QueryAudit_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _KVS_Stats_Handler,
+		},
+		{
+			MethodName: "Reencrypt",
+			Handler:    _KVS_Reencrypt_Handler,
+		},
+		{
+			MethodName: "ClusterStatus",
+			Handler:    _KVS_ClusterStatus_Handler,
+		},
+		{
+			MethodName: "AddMember",
+			Handler:    _KVS_AddMember_Handler,
+		},
+		{
+			MethodName: "PromoteMember",
+			Handler:    _KVS_PromoteMember_Handler,
+		},
+		{
+			MethodName: "RemoveMember",
+			Handler:    _KVS_RemoveMember_Handler,
+		},
+		{
+			MethodName: "TransferLeadership",
+			Handler:    _KVS_TransferLeadership_Handler,
+		},
+		{
+			MethodName: "ReplicationStatus",
+			Handler:    _KVS_ReplicationStatus_Handler,
+		},
+		{
+			MethodName: "ShardMap",
+			Handler:    _KVS_ShardMap_Handler,
+		},
+		{
+			MethodName: "ShardStatus",
+			Handler:    _KVS_ShardStatus_Handler,
+		},
+		{
+			MethodName: "AddShard",
+			Handler:    _KVS_AddShard_Handler,
+		},
+		{
+			MethodName: "RemoveShard",
+			Handler:    _KVS_RemoveShard_Handler,
+		},
+		{
+			MethodName: "SiteStatus",
+			Handler:    _KVS_SiteStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Backup",
+			Handler:       _KVS_Backup_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Restore",
+			Handler:       _KVS_Restore_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "kvs.proto",
+}
+
+// Client API for Raft service
+
+type RaftClient interface {
+	// Asks for a vote in an election
+	RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteResponse, error)
+	// Replicates log entries, or is a heartbeat if there are none
+	AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error)
+	// Sends a snapshot to a node that is missing entries already compacted,
+	// the first chunk carries the term, leader, index and last_term
+	InstallSnapshot(ctx context.Context, opts ...grpc.CallOption) (Raft_InstallSnapshotClient, error)
+	// Makes a node start an election right away, to take over from the leader
+	TimeoutNow(ctx context.Context, in *TimeoutNowRequest, opts ...grpc.CallOption) (*TimeoutNowResponse, error)
+}
+
+type raftClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRaftClient(cc *grpc.ClientConn) RaftClient {
+	return &raftClient{cc}
+}
+
+func (c *raftClient) RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteResponse, error) {
+	out := new(VoteResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Raft/RequestVote", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *raftClient) AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error) {
+	out := new(AppendResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Raft/AppendEntries", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *raftClient) InstallSnapshot(ctx context.Context, opts ...grpc.CallOption) (Raft_InstallSnapshotClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Raft_serviceDesc.Streams[0], c.cc, "/protobuf.Raft/InstallSnapshot", opts...)
+	if err != nil {
+		return nil, err
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/protobuf.KVS/Update",
+	x := &raftInstallSnapshotClient{stream}
+	return x, nil
+}
+
+type Raft_InstallSnapshotClient interface {
+	Send(*SnapshotChunk) error
+	CloseAndRecv() (*InstallSnapshotResponse, error)
+	grpc.ClientStream
+}
+
+type raftInstallSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *raftInstallSnapshotClient) Send(m *SnapshotChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *raftInstallSnapshotClient) CloseAndRecv() (*InstallSnapshotResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Update(ctx, req.(*KeyValuePair))
+	m := new(InstallSnapshotResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
 	}
-	return interceptor(ctx, in, info, handler)
+	return m, nil
 }
 
-func _KVS_Has_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Key)
+func (c *raftClient) TimeoutNow(ctx context.Context, in *TimeoutNowRequest, opts ...grpc.CallOption) (*TimeoutNowResponse, error) {
+	out := new(TimeoutNowResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Raft/TimeoutNow", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Raft service
+
+type RaftServer interface {
+	// Asks for a vote in an election
+	RequestVote(context.Context, *VoteRequest) (*VoteResponse, error)
+	// Replicates log entries, or is a heartbeat if there are none
+	AppendEntries(context.Context, *AppendRequest) (*AppendResponse, error)
+	// Sends a snapshot to a node that is missing entries already compacted,
+	// the first chunk carries the term, leader, index and last_term
+	InstallSnapshot(Raft_InstallSnapshotServer) error
+	// Makes a node start an election right away, to take over from the leader
+	TimeoutNow(context.Context, *TimeoutNowRequest) (*TimeoutNowResponse, error)
+}
+
+func RegisterRaftServer(s *grpc.Server, srv RaftServer) {
+	s.RegisterService(&_Raft_serviceDesc, srv)
+}
+
+func _Raft_RequestVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoteRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).Has(ctx, in)
+		return srv.(RaftServer).RequestVote(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/Has",
+		FullMethod: "/protobuf.Raft/RequestVote",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Has(ctx, req.(*Key))
+		return srv.(RaftServer).RequestVote(ctx, req.(*VoteRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_Unset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Key)
+func _Raft_AppendEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).Unset(ctx, in)
+		return srv.(RaftServer).AppendEntries(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/Unset",
+		FullMethod: "/protobuf.Raft/AppendEntries",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Unset(ctx, req.(*Key))
+		return srv.(RaftServer).AppendEntries(ctx, req.(*AppendRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Key)
+func _Raft_InstallSnapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RaftServer).InstallSnapshot(&raftInstallSnapshotServer{stream})
+}
+
+type Raft_InstallSnapshotServer interface {
+	SendAndClose(*InstallSnapshotResponse) error
+	Recv() (*SnapshotChunk, error)
+	grpc.ServerStream
+}
+
+type raftInstallSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *raftInstallSnapshotServer) SendAndClose(m *InstallSnapshotResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *raftInstallSnapshotServer) Recv() (*SnapshotChunk, error) {
+	m := new(SnapshotChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Raft_TimeoutNow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TimeoutNowRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).Get(ctx, in)
+		return srv.(RaftServer).TimeoutNow(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/Get",
+		FullMethod: "/protobuf.Raft/TimeoutNow",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Get(ctx, req.(*Key))
+		return srv.(RaftServer).TimeoutNow(ctx, req.(*TimeoutNowRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(google_protobuf.Empty)
-	if err := dec(in); err != nil {
+var _Raft_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protobuf.Raft",
+	HandlerType: (*RaftServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestVote",
+			Handler:    _Raft_RequestVote_Handler,
+		},
+		{
+			MethodName: "AppendEntries",
+			Handler:    _Raft_AppendEntries_Handler,
+		},
+		{
+			MethodName: "TimeoutNow",
+			Handler:    _Raft_TimeoutNow_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "InstallSnapshot",
+			Handler:       _Raft_InstallSnapshot_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "kvs.proto",
+}
+
+// Client API for Replication service
+
+type ReplicationClient interface {
+	// Streams the changes made after the revision the replica asks for in its
+	// first message, preceded by a snapshot if the primary no longer has them;
+	// the replica acknowledges the changes it applied
+	Replicate(ctx context.Context, opts ...grpc.CallOption) (Replication_ReplicateClient, error)
+}
+
+type replicationClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewReplicationClient(cc *grpc.ClientConn) ReplicationClient {
+	return &replicationClient{cc}
+}
+
+func (c *replicationClient) Replicate(ctx context.Context, opts ...grpc.CallOption) (Replication_ReplicateClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Replication_serviceDesc.Streams[0], c.cc, "/protobuf.Replication/Replicate", opts...)
+	if err != nil {
 		return nil, err
 	}
-	if interceptor == nil {
-		return srv.(KVSServer).Count(ctx, in)
+	x := &replicationReplicateClient{stream}
+	return x, nil
+}
+
+type Replication_ReplicateClient interface {
+	Send(*ReplicaAck) error
+	Recv() (*ReplicationMessage, error)
+	grpc.ClientStream
+}
+
+type replicationReplicateClient struct {
+	grpc.ClientStream
+}
+
+func (x *replicationReplicateClient) Send(m *ReplicaAck) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *replicationReplicateClient) Recv() (*ReplicationMessage, error) {
+	m := new(ReplicationMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/protobuf.KVS/Count",
+	return m, nil
+}
+
+// Server API for Replication service
+
+type ReplicationServer interface {
+	// Streams the changes made after the revision the replica asks for in its
+	// first message, preceded by a snapshot if the primary no longer has them;
+	// the replica acknowledges the changes it applied
+	Replicate(Replication_ReplicateServer) error
+}
+
+func RegisterReplicationServer(s *grpc.Server, srv ReplicationServer) {
+	s.RegisterService(&_Replication_serviceDesc, srv)
+}
+
+func _Replication_Replicate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReplicationServer).Replicate(&replicationReplicateServer{stream})
+}
+
+type Replication_ReplicateServer interface {
+	Send(*ReplicationMessage) error
+	Recv() (*ReplicaAck, error)
+	grpc.ServerStream
+}
+
+type replicationReplicateServer struct {
+	grpc.ServerStream
+}
+
+func (x *replicationReplicateServer) Send(m *ReplicationMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *replicationReplicateServer) Recv() (*ReplicaAck, error) {
+	m := new(ReplicaAck)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).Count(ctx, req.(*google_protobuf.Empty))
+	return m, nil
+}
+
+var _Replication_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protobuf.Replication",
+	HandlerType: (*ReplicationServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Replicate",
+			Handler:       _Replication_Replicate_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "kvs.proto",
+}
+
+// Client API for Sites service
+
+type SitesClient interface {
+	// Streams the versions of the keys written on the server after the
+	// revision the site asks for in its first message, preceded by a snapshot
+	// to merge if the server no longer has them; the site acknowledges the
+	// changes it merged
+	Follow(ctx context.Context, opts ...grpc.CallOption) (Sites_FollowClient, error)
+}
+
+type sitesClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSitesClient(cc *grpc.ClientConn) SitesClient {
+	return &sitesClient{cc}
+}
+
+func (c *sitesClient) Follow(ctx context.Context, opts ...grpc.CallOption) (Sites_FollowClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Sites_serviceDesc.Streams[0], c.cc, "/protobuf.Sites/Follow", opts...)
+	if err != nil {
+		return nil, err
 	}
-	return interceptor(ctx, in, info, handler)
+	x := &sitesFollowClient{stream}
+	return x, nil
 }
 
-func _KVS_ShowKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(google_protobuf.Empty)
+type Sites_FollowClient interface {
+	Send(*ReplicaAck) error
+	Recv() (*ReplicationMessage, error)
+	grpc.ClientStream
+}
+
+type sitesFollowClient struct {
+	grpc.ClientStream
+}
+
+func (x *sitesFollowClient) Send(m *ReplicaAck) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sitesFollowClient) Recv() (*ReplicationMessage, error) {
+	m := new(ReplicationMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Sites service
+
+type SitesServer interface {
+	// Streams the versions of the keys written on the server after the
+	// revision the site asks for in its first message, preceded by a snapshot
+	// to merge if the server no longer has them; the site acknowledges the
+	// changes it merged
+	Follow(Sites_FollowServer) error
+}
+
+func RegisterSitesServer(s *grpc.Server, srv SitesServer) {
+	s.RegisterService(&_Sites_serviceDesc, srv)
+}
+
+func _Sites_Follow_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SitesServer).Follow(&sitesFollowServer{stream})
+}
+
+type Sites_FollowServer interface {
+	Send(*ReplicationMessage) error
+	Recv() (*ReplicaAck, error)
+	grpc.ServerStream
+}
+
+type sitesFollowServer struct {
+	grpc.ServerStream
+}
+
+func (x *sitesFollowServer) Send(m *ReplicationMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sitesFollowServer) Recv() (*ReplicaAck, error) {
+	m := new(ReplicaAck)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Sites_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protobuf.Sites",
+	HandlerType: (*SitesServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Follow",
+			Handler:       _Sites_Follow_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "kvs.proto",
+}
+
+// Client API for Sharding service
+
+type ShardingClient interface {
+	// Replaces the shard map, whose version must follow that of the map the
+	// server holds, and starts moving the keys it no longer owns
+	UpdateMap(ctx context.Context, in *UpdateShardMapRequest, opts ...grpc.CallOption) (*google_protobuf.Empty, error)
+	// Returns the shard map of the server and the keys it is moving
+	Status(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardStatusResponse, error)
+	// Stores keys the sender no longer owns
+	Migrate(ctx context.Context, in *MigrateRequest, opts ...grpc.CallOption) (*google_protobuf.Empty, error)
+	// Removes keys the caller now owns and returns them, so the caller can
+	// serve them before they are sent
+	Handoff(ctx context.Context, in *HandoffRequest, opts ...grpc.CallOption) (*HandoffResponse, error)
+}
+
+type shardingClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewShardingClient(cc *grpc.ClientConn) ShardingClient {
+	return &shardingClient{cc}
+}
+
+func (c *shardingClient) UpdateMap(ctx context.Context, in *UpdateShardMapRequest, opts ...grpc.CallOption) (*google_protobuf.Empty, error) {
+	out := new(google_protobuf.Empty)
+	err := grpc.Invoke(ctx, "/protobuf.Sharding/UpdateMap", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) Status(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*ShardStatusResponse, error) {
+	out := new(ShardStatusResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Sharding/Status", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) Migrate(ctx context.Context, in *MigrateRequest, opts ...grpc.CallOption) (*google_protobuf.Empty, error) {
+	out := new(google_protobuf.Empty)
+	err := grpc.Invoke(ctx, "/protobuf.Sharding/Migrate", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) Handoff(ctx context.Context, in *HandoffRequest, opts ...grpc.CallOption) (*HandoffResponse, error) {
+	out := new(HandoffResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Sharding/Handoff", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Sharding service
+
+type ShardingServer interface {
+	// Replaces the shard map, whose version must follow that of the map the
+	// server holds, and starts moving the keys it no longer owns
+	UpdateMap(context.Context, *UpdateShardMapRequest) (*google_protobuf.Empty, error)
+	// Returns the shard map of the server and the keys it is moving
+	Status(context.Context, *google_protobuf.Empty) (*ShardStatusResponse, error)
+	// Stores keys the sender no longer owns
+	Migrate(context.Context, *MigrateRequest) (*google_protobuf.Empty, error)
+	// Removes keys the caller now owns and returns them, so the caller can
+	// serve them before they are sent
+	Handoff(context.Context, *HandoffRequest) (*HandoffResponse, error)
+}
+
+func RegisterShardingServer(s *grpc.Server, srv ShardingServer) {
+	s.RegisterService(&_Sharding_serviceDesc, srv)
+}
+
+func _Sharding_UpdateMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateShardMapRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).ShowKeys(ctx, in)
+		return srv.(ShardingServer).UpdateMap(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/ShowKeys",
+		FullMethod: "/protobuf.Sharding/UpdateMap",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).ShowKeys(ctx, req.(*google_protobuf.Empty))
+		return srv.(ShardingServer).UpdateMap(ctx, req.(*UpdateShardMapRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_ShowData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+func _Sharding_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(google_protobuf.Empty)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).ShowData(ctx, in)
+		return srv.(ShardingServer).Status(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/ShowData",
+		FullMethod: "/protobuf.Sharding/Status",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).ShowData(ctx, req.(*google_protobuf.Empty))
+		return srv.(ShardingServer).Status(ctx, req.(*google_protobuf.Empty))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_ShowNamespaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(google_protobuf.Empty)
+func _Sharding_Migrate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MigrateRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).ShowNamespaces(ctx, in)
+		return srv.(ShardingServer).Migrate(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/ShowNamespaces",
+		FullMethod: "/protobuf.Sharding/Migrate",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).ShowNamespaces(ctx, req.(*google_protobuf.Empty))
+		return srv.(ShardingServer).Migrate(ctx, req.(*MigrateRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _KVS_UseNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Namespace)
+func _Sharding_Handoff_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HandoffRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KVSServer).UseNamespace(ctx, in)
+		return srv.(ShardingServer).Handoff(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.KVS/UseNamespace",
+		FullMethod: "/protobuf.Sharding/Handoff",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KVSServer).UseNamespace(ctx, req.(*Namespace))
+		return srv.(ShardingServer).Handoff(ctx, req.(*HandoffRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-var _KVS_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "protobuf.KVS",
-	HandlerType: (*KVSServer)(nil),
+var _Sharding_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protobuf.Sharding",
+	HandlerType: (*ShardingServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "Set",
-			Handler:    _KVS_Set_Handler,
-		},
-		{
-			MethodName: "Update",
-			Handler:    _KVS_Update_Handler,
-		},
-		{
-			MethodName: "Has",
-			Handler:    _KVS_Has_Handler,
-		},
-		{
-			MethodName: "Unset",
-			Handler:    _KVS_Unset_Handler,
-		},
-		{
-			MethodName: "Get",
-			Handler:    _KVS_Get_Handler,
-		},
-		{
-			MethodName: "Count",
-			Handler:    _KVS_Count_Handler,
-		},
-		{
-			MethodName: "ShowKeys",
-			Handler:    _KVS_ShowKeys_Handler,
+			MethodName: "UpdateMap",
+			Handler:    _Sharding_UpdateMap_Handler,
 		},
 		{
-			MethodName: "ShowData",
-			Handler:    _KVS_ShowData_Handler,
+			MethodName: "Status",
+			Handler:    _Sharding_Status_Handler,
 		},
 		{
-			MethodName: "ShowNamespaces",
-			Handler:    _KVS_ShowNamespaces_Handler,
+			MethodName: "Migrate",
+			Handler:    _Sharding_Migrate_Handler,
 		},
 		{
-			MethodName: "UseNamespace",
-			Handler:    _KVS_UseNamespace_Handler,
+			MethodName: "Handoff",
+			Handler:    _Sharding_Handoff_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -612,32 +4339,200 @@ var _KVS_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("kvs.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 430 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x93, 0x5f, 0x6b, 0xd4, 0x40,
-	0x14, 0xc5, 0x53, 0xb3, 0xa9, 0xc9, 0xb5, 0x95, 0x7a, 0x2d, 0xdb, 0x25, 0x15, 0x29, 0x03, 0x4a,
-	0xdb, 0x87, 0x54, 0x5a, 0x28, 0xd2, 0x07, 0x11, 0xff, 0xa0, 0x10, 0x11, 0xc9, 0xb2, 0x7d, 0x9f,
-	0xa6, 0xd7, 0x55, 0xb2, 0x9b, 0x09, 0x3b, 0x93, 0x95, 0x7c, 0x4d, 0x3f, 0x91, 0x64, 0xb2, 0xc9,
-	0x24, 0xbb, 0x06, 0xba, 0x4f, 0x99, 0x7b, 0xe6, 0x77, 0xcf, 0xcd, 0x4c, 0x4e, 0xc0, 0x4b, 0x96,
-	0x32, 0xc8, 0x16, 0x42, 0x09, 0x74, 0xf5, 0xe3, 0x2e, 0xff, 0xe9, 0x1f, 0x4f, 0x85, 0x98, 0xce,
-	0xe8, 0xa2, 0x16, 0x2e, 0x68, 0x9e, 0xa9, 0xa2, 0xc2, 0xd8, 0x35, 0xec, 0x85, 0x54, 0xdc, 0xf2,
-	0x59, 0x4e, 0x3f, 0xf8, 0xef, 0x05, 0x1e, 0x80, 0x9d, 0x50, 0x31, 0xda, 0x39, 0xd9, 0x39, 0xf5,
-	0xa2, 0x72, 0x89, 0x87, 0xe0, 0x2c, 0xcb, 0xed, 0xd1, 0x23, 0xad, 0x55, 0x05, 0x3b, 0x02, 0x3b,
-	0xa4, 0x62, 0x13, 0x67, 0x67, 0xe0, 0x7d, 0xe7, 0x73, 0x92, 0x19, 0x8f, 0x09, 0x5f, 0x80, 0x97,
-	0xd6, 0xc5, 0x0a, 0x32, 0x02, 0xbb, 0x01, 0x37, 0x22, 0x99, 0x89, 0x54, 0x12, 0x8e, 0xe0, 0xb1,
-	0xcc, 0xe3, 0x98, 0xa4, 0xd4, 0x9c, 0x1b, 0xd5, 0x65, 0xcf, 0xfc, 0x57, 0xb0, 0xff, 0x51, 0xe4,
-	0xa9, 0x6a, 0x0c, 0x0e, 0xc1, 0x89, 0x4b, 0x41, 0xb7, 0x3b, 0x51, 0x55, 0xb0, 0xd7, 0x70, 0x30,
-	0xfe, 0x25, 0xfe, 0x84, 0x54, 0xc8, 0x86, 0x44, 0x18, 0x24, 0x54, 0x94, 0x73, 0xec, 0x53, 0x2f,
-	0xd2, 0x6b, 0xf6, 0xae, 0xe2, 0x3e, 0x71, 0xc5, 0x1b, 0xee, 0x1c, 0x06, 0xf7, 0x5c, 0x71, 0xcd,
-	0x3d, 0xb9, 0x1c, 0x06, 0xf5, 0xfd, 0x05, 0xed, 0x0b, 0x8b, 0x34, 0xc3, 0xde, 0xc2, 0xb0, 0xec,
-	0x6f, 0x4e, 0x6e, 0xa6, 0xbd, 0x04, 0x68, 0x4e, 0x5c, 0xcf, 0x6c, 0x29, 0xec, 0x0c, 0x9e, 0x35,
-	0x5d, 0xed, 0xc3, 0x28, 0x91, 0x50, 0xba, 0xba, 0xb3, 0xaa, 0xb8, 0xfc, 0x3b, 0x00, 0x3b, 0xbc,
-	0x1d, 0xe3, 0x15, 0xd8, 0x63, 0x52, 0xd8, 0xf3, 0x46, 0x3e, 0x1a, 0xbd, 0x36, 0x64, 0x16, 0x5e,
-	0xc3, 0xee, 0x24, 0xbb, 0xe7, 0x8a, 0xb6, 0xec, 0x3b, 0x07, 0xfb, 0x2b, 0x97, 0xb8, 0xdf, 0x69,
-	0xea, 0x61, 0xdf, 0x80, 0x33, 0x49, 0x25, 0xa9, 0x75, 0xba, 0x67, 0x22, 0xb3, 0x30, 0x00, 0xfb,
-	0xcb, 0x36, 0xfc, 0x0d, 0x38, 0xfa, 0xb3, 0xe3, 0x30, 0xa8, 0x52, 0x6d, 0xc8, 0xcf, 0x65, 0xaa,
-	0xfd, 0x23, 0x23, 0x74, 0xf2, 0xc1, 0x2c, 0x7c, 0x0f, 0x6e, 0x9d, 0x85, 0xde, 0x76, 0xdf, 0x08,
-	0xeb, 0xb9, 0x31, 0x0e, 0x65, 0x4a, 0x1e, 0xea, 0xd0, 0x4e, 0x14, 0xb3, 0xf0, 0x1b, 0x3c, 0xed,
-	0xe6, 0xa4, 0xd7, 0xe7, 0xa4, 0xeb, 0xb3, 0x99, 0x2c, 0x66, 0xe1, 0x07, 0xd8, 0x9b, 0x48, 0x32,
-	0xbf, 0xdb, 0x73, 0xd3, 0xd3, 0x88, 0xfe, 0xf1, 0x7f, 0x44, 0xe3, 0x71, 0xb7, 0xab, 0x77, 0xaf,
-	0xfe, 0x05, 0x00, 0x00, 0xff, 0xff, 0x67, 0x8b, 0x55, 0x5b, 0x3b, 0x04, 0x00, 0x00,
+	// 3116 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x39, 0xcd, 0x6f, 0xdc, 0xc6,
+	0xf5, 0xe2, 0x72, 0x3f, 0xdf, 0x6a, 0x57, 0xeb, 0x89, 0x6d, 0xad, 0x37, 0x76, 0x62, 0x8f, 0x93,
+	0xfc, 0x64, 0xff, 0x6a, 0x3b, 0x51, 0xda, 0x20, 0x49, 0x1d, 0x27, 0xb2, 0xb4, 0x4e, 0x14, 0xeb,
+	0x2b, 0x94, 0x6c, 0xa4, 0x27, 0x81, 0x5e, 0x8e, 0x24, 0x42, 0x5c, 0x92, 0x21, 0xb9, 0xb2, 0x17,
+	0xe8, 0xa1, 0x97, 0xde, 0x7a, 0x6e, 0x81, 0x02, 0x05, 0x7a, 0x28, 0x7a, 0xe8, 0x31, 0x87, 0x1e,
+	0x7b, 0xe8, 0xb5, 0x05, 0x5a, 0xb4, 0xff, 0x40, 0xff, 0x94, 0xe2, 0xcd, 0x07, 0x39, 0xe4, 0x7e,
+	0x58, 0x76, 0x7a, 0xe2, 0xbc, 0x37, 0x8f, 0x33, 0xef, 0x7b, 0xde, 0x9b, 0x81, 0xc6, 0xe9, 0x59,
+	0x7c, 0x37, 0x8c, 0x82, 0x24, 0x20, 0x75, 0xfe, 0x79, 0x36, 0x3a, 0xea, 0xbd, 0x79, 0x1c, 0x04,
+	0xc7, 0x1e, 0xbb, 0xa7, 0x10, 0xf7, 0xd8, 0x30, 0x4c, 0xc6, 0x82, 0x8c, 0x3e, 0x87, 0xc5, 0xc7,
+	0x6c, 0xfc, 0xd4, 0xf6, 0x46, 0x6c, 0xcf, 0x76, 0x23, 0xd2, 0x01, 0xf3, 0x94, 0x8d, 0xbb, 0xc6,
+	0x75, 0x63, 0xa5, 0x61, 0xe1, 0x90, 0x5c, 0x84, 0xca, 0x19, 0x4e, 0x77, 0x4b, 0x1c, 0x27, 0x00,
+	0xa4, 0x4b, 0x12, 0xaf, 0x6b, 0x5e, 0x37, 0x56, 0x4c, 0x0b, 0x87, 0xe4, 0x0e, 0xd4, 0x63, 0xf7,
+	0x99, 0xe7, 0xfa, 0xc7, 0x71, 0xb7, 0x7c, 0xdd, 0x5c, 0x69, 0xae, 0x5e, 0xb8, 0xab, 0xb6, 0xbc,
+	0xbb, 0x2f, 0x66, 0xac, 0x94, 0x84, 0xf6, 0xa1, 0x26, 0x91, 0xd9, 0x0e, 0x86, 0xbe, 0x03, 0x81,
+	0x72, 0xec, 0x26, 0x6a, 0x5b, 0x3e, 0xc6, 0x5d, 0x4f, 0xbc, 0x01, 0xdf, 0xb5, 0x6c, 0xe1, 0x90,
+	0x2e, 0x83, 0xf9, 0x98, 0x8d, 0x27, 0xd9, 0xa6, 0xb7, 0xa0, 0xb1, 0x63, 0x0f, 0x59, 0x1c, 0xda,
+	0x03, 0x46, 0xae, 0x42, 0xc3, 0x57, 0x80, 0x24, 0xca, 0x10, 0xf4, 0x53, 0xa8, 0x5b, 0x2c, 0x0e,
+	0x03, 0x3f, 0x66, 0xa4, 0x0b, 0xb5, 0x78, 0x34, 0x18, 0xb0, 0x38, 0xe6, 0x74, 0x75, 0x4b, 0x81,
+	0xd3, 0xf5, 0x40, 0xdf, 0x85, 0xd6, 0x7a, 0x30, 0xf2, 0x93, 0x74, 0x81, 0x8b, 0x50, 0x19, 0x20,
+	0x82, 0xff, 0x5e, 0xb1, 0x04, 0x40, 0xdf, 0x83, 0xce, 0xfe, 0x49, 0xf0, 0xfc, 0x31, 0x1b, 0xc7,
+	0x29, 0x25, 0x81, 0xf2, 0x29, 0x1b, 0xe3, 0x3e, 0x26, 0x0a, 0x88, 0x63, 0xfa, 0x40, 0xd0, 0x6d,
+	0xd8, 0x89, 0x9d, 0xd2, 0xdd, 0x86, 0xb2, 0x63, 0x27, 0x36, 0xa7, 0x6b, 0xae, 0x5e, 0xce, 0x94,
+	0xaa, 0x1b, 0xce, 0xe2, 0x34, 0xf4, 0x63, 0xb8, 0x8c, 0xff, 0xa7, 0x92, 0x67, 0xbb, 0xbd, 0x05,
+	0x90, 0x4a, 0xac, 0xf6, 0xd4, 0x30, 0xf4, 0x16, 0x5c, 0x48, 0xff, 0xd2, 0x85, 0x49, 0x82, 0x53,
+	0xe6, 0x2b, 0xcb, 0x70, 0x80, 0xfe, 0x1c, 0x5a, 0x6b, 0x7b, 0x9b, 0x8f, 0xd9, 0xd8, 0x62, 0xdf,
+	0x8d, 0x58, 0x9c, 0x90, 0x1e, 0xd4, 0x47, 0x31, 0x8b, 0x70, 0x35, 0x49, 0x99, 0xc2, 0x85, 0x7d,
+	0x4b, 0xc5, 0x7d, 0xd1, 0x72, 0x41, 0x18, 0x77, 0x4d, 0x3e, 0x81, 0x43, 0x72, 0x0d, 0x80, 0xbd,
+	0x08, 0xdd, 0x88, 0xc5, 0x87, 0x76, 0xd2, 0x2d, 0x73, 0x0f, 0x6b, 0x48, 0xcc, 0x5a, 0x42, 0xff,
+	0x6d, 0x40, 0x55, 0x6c, 0x4f, 0xda, 0x50, 0x72, 0x1d, 0xb9, 0x63, 0xc9, 0x75, 0x72, 0x7c, 0x94,
+	0xe6, 0xf2, 0x61, 0xce, 0xe2, 0xa3, 0x3c, 0x8b, 0x8f, 0x4a, 0x81, 0x0f, 0x9c, 0x1e, 0x44, 0xcc,
+	0x4e, 0x98, 0x83, 0xd3, 0x55, 0x31, 0x2d, 0x31, 0x6b, 0x09, 0x79, 0x13, 0x1a, 0x9e, 0x1d, 0x27,
+	0x87, 0xa3, 0x98, 0x39, 0xdd, 0x1a, 0x9f, 0xad, 0x23, 0xe2, 0x49, 0xcc, 0x1c, 0xe5, 0xae, 0xf5,
+	0xcc, 0x5d, 0x7b, 0x50, 0x17, 0x42, 0x6d, 0x6e, 0x14, 0xc5, 0xa2, 0xab, 0x00, 0x62, 0x6e, 0xcb,
+	0x8d, 0x13, 0xf2, 0x8e, 0xe6, 0x36, 0xcd, 0xd5, 0x4e, 0xe6, 0x0e, 0xd2, 0x26, 0xc2, 0x91, 0x12,
+	0x80, 0xb5, 0x91, 0xe3, 0x26, 0xdf, 0x8c, 0x58, 0x34, 0x46, 0x57, 0x43, 0x45, 0xc8, 0x35, 0xf9,
+	0x58, 0xf1, 0x50, 0xca, 0x45, 0x7a, 0xec, 0xfa, 0x03, 0x26, 0xa3, 0x5a, 0x00, 0x88, 0x1d, 0xf9,
+	0x89, 0xeb, 0x49, 0x4b, 0x08, 0x00, 0xb1, 0x9e, 0x3b, 0x74, 0x85, 0x5e, 0x2a, 0x96, 0x00, 0xe8,
+	0x3f, 0x0d, 0x68, 0xf2, 0x6d, 0x2d, 0x36, 0x08, 0x22, 0x2e, 0x67, 0xcc, 0xbe, 0xe3, 0xdb, 0x96,
+	0x2d, 0x1c, 0x22, 0x27, 0x89, 0x2b, 0xcd, 0x63, 0x5a, 0x7c, 0x9c, 0x72, 0x67, 0x6a, 0xdc, 0x2d,
+	0x43, 0xcd, 0x0e, 0xdd, 0x43, 0xe4, 0xb0, 0xcc, 0xd1, 0x55, 0x3b, 0x74, 0xd1, 0xe6, 0xb9, 0x50,
+	0xae, 0x14, 0x42, 0x19, 0x37, 0x8c, 0xc2, 0x01, 0xb7, 0x46, 0xc3, 0xc2, 0xa1, 0x12, 0xb3, 0x96,
+	0x89, 0xd9, 0x85, 0x5a, 0x30, 0x4a, 0x06, 0xc1, 0x90, 0x49, 0x03, 0x28, 0x10, 0x19, 0x39, 0xb1,
+	0xe3, 0x93, 0x6e, 0x43, 0x30, 0x82, 0x63, 0xfa, 0x39, 0x2c, 0x6a, 0x12, 0xc5, 0xe4, 0x1e, 0xd4,
+	0x22, 0x31, 0x94, 0x16, 0xb8, 0xa4, 0x59, 0x20, 0x23, 0xb4, 0x14, 0x15, 0xfd, 0xb3, 0x01, 0x6d,
+	0xcb, 0x4e, 0xd8, 0x16, 0x6a, 0x68, 0x3f, 0xb1, 0x93, 0x78, 0xc2, 0x6f, 0xdf, 0x85, 0x76, 0x24,
+	0x42, 0x29, 0x3e, 0x14, 0x5a, 0x45, 0xf5, 0x18, 0x56, 0x4b, 0x61, 0xf9, 0xbf, 0xe4, 0x6d, 0x68,
+	0x3e, 0x1b, 0x27, 0x4c, 0xd1, 0x98, 0x9c, 0x06, 0x38, 0x4a, 0x10, 0x74, 0xa1, 0x66, 0x7b, 0x5e,
+	0xf0, 0x9c, 0x39, 0x5c, 0x69, 0x65, 0x4b, 0x81, 0xa8, 0xb5, 0xe4, 0x24, 0x0a, 0x92, 0xc4, 0x63,
+	0x0e, 0xd7, 0x5a, 0xd9, 0xca, 0x10, 0x68, 0x4c, 0xbe, 0x0a, 0xd7, 0x5b, 0xd9, 0x12, 0x00, 0xfd,
+	0xa3, 0x01, 0xcd, 0x6d, 0x36, 0x0c, 0xa2, 0xb1, 0xe0, 0xfa, 0x1a, 0x00, 0x3a, 0xf3, 0xa1, 0x20,
+	0x35, 0x84, 0xc3, 0x23, 0xe6, 0x21, 0x22, 0xd0, 0xe1, 0x87, 0xf6, 0x0b, 0x39, 0x2b, 0xcc, 0x5b,
+	0x1f, 0xda, 0x2f, 0xc4, 0xe4, 0xff, 0xc1, 0x12, 0x3b, 0x73, 0x07, 0x89, 0x1b, 0xf8, 0x87, 0x61,
+	0xe0, 0xb9, 0x83, 0xb1, 0xb4, 0x76, 0x5b, 0xa1, 0xf7, 0x38, 0x16, 0x45, 0xe0, 0x98, 0x4c, 0x04,
+	0x09, 0xf2, 0x19, 0x1e, 0x7c, 0x4a, 0x00, 0x05, 0xd2, 0x31, 0xb4, 0x38, 0x87, 0x69, 0xda, 0xfa,
+	0x04, 0x9a, 0x91, 0x9d, 0x30, 0xa1, 0x27, 0x65, 0xa7, 0x6e, 0x66, 0xa7, 0xbc, 0x39, 0x2c, 0x88,
+	0x14, 0x1c, 0x93, 0x3b, 0x50, 0x1d, 0x72, 0x99, 0xb9, 0x08, 0x39, 0xeb, 0x6a, 0xba, 0xb0, 0x24,
+	0x11, 0xbd, 0x0d, 0x8b, 0x4f, 0x62, 0xfb, 0x98, 0x9d, 0x23, 0x13, 0xd2, 0x5f, 0x19, 0x00, 0xdf,
+	0x8c, 0x82, 0xc4, 0xe6, 0x7f, 0xcc, 0x3f, 0x93, 0xd2, 0xc3, 0x41, 0xc6, 0x09, 0x8e, 0x33, 0x33,
+	0xc9, 0xf8, 0xe4, 0x00, 0xb9, 0x02, 0xa8, 0xe6, 0x43, 0x4e, 0x2d, 0x42, 0xb4, 0x36, 0xb4, 0x5f,
+	0xe0, 0x49, 0x93, 0x37, 0x49, 0x25, 0x6f, 0x12, 0xfa, 0x1d, 0xb4, 0x24, 0xeb, 0xe9, 0x39, 0x53,
+	0x49, 0x82, 0xc4, 0xf6, 0x38, 0x33, 0xcd, 0xd5, 0x8b, 0x99, 0xe4, 0x19, 0xd7, 0x96, 0x20, 0x21,
+	0x3f, 0x9e, 0xc8, 0xea, 0xb3, 0x7e, 0xd0, 0xcf, 0x98, 0x6d, 0x68, 0x6d, 0xb3, 0xe1, 0x33, 0x16,
+	0x29, 0x75, 0x15, 0x03, 0x81, 0x40, 0xd9, 0x76, 0x9c, 0x48, 0x9d, 0xf9, 0x38, 0x46, 0xbb, 0x7b,
+	0xcc, 0x8e, 0x7c, 0x99, 0x20, 0xea, 0x96, 0x02, 0xe9, 0xef, 0x0d, 0x68, 0xad, 0x7b, 0xa3, 0x38,
+	0x61, 0x91, 0x58, 0xf6, 0x87, 0xad, 0x87, 0xf1, 0x35, 0xb4, 0x93, 0xc1, 0xc9, 0xa1, 0xeb, 0x3b,
+	0xec, 0x85, 0xf4, 0x3f, 0xe0, 0xa8, 0x4d, 0xc4, 0x60, 0x2e, 0xf1, 0xec, 0x63, 0xe9, 0x7e, 0x38,
+	0x24, 0x6f, 0x41, 0x93, 0x67, 0x79, 0x7b, 0x70, 0x7a, 0x38, 0x8c, 0xd5, 0x29, 0x80, 0xa8, 0xb5,
+	0xc1, 0xe9, 0x76, 0x4c, 0xff, 0x56, 0x82, 0x4b, 0x92, 0x45, 0x74, 0x9c, 0x51, 0xe6, 0xa3, 0x45,
+	0x56, 0x31, 0xf9, 0x26, 0x76, 0x5a, 0xef, 0x08, 0x80, 0xa7, 0x4b, 0x16, 0x0d, 0x65, 0xc5, 0xc3,
+	0xc7, 0xe4, 0x32, 0x54, 0x3d, 0x66, 0x3b, 0x2c, 0x52, 0x99, 0x51, 0x40, 0xc8, 0xbe, 0x18, 0x1d,
+	0x72, 0x99, 0x45, 0x6e, 0x04, 0x81, 0x5a, 0x43, 0xc9, 0xaf, 0x01, 0x70, 0x66, 0x85, 0x78, 0x22,
+	0xd6, 0x39, 0xaf, 0x42, 0xba, 0x1b, 0xb0, 0x38, 0x08, 0x86, 0x43, 0x57, 0x11, 0xd4, 0x38, 0x41,
+	0x53, 0xe0, 0x04, 0xc9, 0x4d, 0x68, 0xd9, 0x61, 0xe8, 0xb9, 0xcc, 0x91, 0x34, 0x75, 0x4e, 0xb3,
+	0x28, 0x91, 0x82, 0xe8, 0x5d, 0x68, 0xc7, 0xbe, 0x1d, 0xc6, 0x27, 0x81, 0x5a, 0xa9, 0xc1, 0xa9,
+	0x5a, 0x0a, 0x2b, 0xc8, 0x3e, 0x80, 0xda, 0x90, 0x5b, 0x2d, 0xee, 0x02, 0xf7, 0x9f, 0xe5, 0xcc,
+	0x7f, 0x72, 0x56, 0xb5, 0x14, 0x1d, 0xba, 0xac, 0xc5, 0x42, 0xcf, 0x1d, 0xd8, 0x42, 0x99, 0xa9,
+	0x7d, 0x0d, 0xcd, 0xbe, 0x3d, 0xa8, 0x47, 0xec, 0xcc, 0x8d, 0xdd, 0xc0, 0xe7, 0xba, 0x2c, 0x5b,
+	0x29, 0xac, 0x0c, 0x68, 0xce, 0x34, 0x60, 0xb9, 0x68, 0xc0, 0xef, 0x4b, 0x70, 0x45, 0xee, 0x89,
+	0x59, 0xaa, 0x60, 0x44, 0x02, 0xe5, 0x28, 0xf0, 0x54, 0xf8, 0xf2, 0xf1, 0xdc, 0xfd, 0xbb, 0x50,
+	0x3b, 0x71, 0xe3, 0x04, 0xd3, 0x8b, 0x48, 0x7f, 0x0a, 0xc4, 0x99, 0x30, 0x72, 0x87, 0x76, 0xa4,
+	0xce, 0x3b, 0x05, 0x62, 0x9e, 0x18, 0x04, 0xbe, 0xcf, 0x78, 0x4e, 0xac, 0x70, 0x8f, 0xcd, 0x10,
+	0xe4, 0x16, 0x74, 0x24, 0xe1, 0x61, 0xba, 0xab, 0xb0, 0xec, 0x92, 0xc4, 0x5b, 0x05, 0xe1, 0x6b,
+	0x99, 0xf0, 0x37, 0x60, 0x31, 0x4e, 0x6c, 0x8f, 0xf9, 0x2c, 0x8e, 0x51, 0xfa, 0x3a, 0x97, 0xbe,
+	0x99, 0xe2, 0xb6, 0x63, 0xf2, 0x21, 0x4a, 0xc3, 0xc5, 0x8f, 0xbb, 0x8d, 0xa2, 0x99, 0x72, 0xc6,
+	0xb0, 0x52, 0x42, 0xfa, 0x1f, 0x03, 0xea, 0xfb, 0x6e, 0xc2, 0xf6, 0xd8, 0x39, 0x63, 0x32, 0x27,
+	0xa3, 0x59, 0x94, 0x51, 0xd7, 0x68, 0xb9, 0xa0, 0xd1, 0x9b, 0xd0, 0x8a, 0xdd, 0x84, 0x65, 0xc2,
+	0x8b, 0xe0, 0x5c, 0x44, 0x64, 0x51, 0xf2, 0xea, 0x6c, 0xc9, 0x6b, 0x93, 0x92, 0x0b, 0x9e, 0x8e,
+	0x3c, 0x77, 0x90, 0xc4, 0xd2, 0xcf, 0x33, 0x04, 0xfd, 0xad, 0x01, 0x04, 0x45, 0x7c, 0x49, 0x54,
+	0xe7, 0x16, 0x11, 0x12, 0x67, 0x88, 0xc9, 0x76, 0x66, 0xae, 0xa8, 0x2b, 0x50, 0x09, 0x19, 0x86,
+	0x4b, 0x85, 0xdb, 0x81, 0xe8, 0xdd, 0x95, 0xd0, 0xb5, 0x25, 0x08, 0xe8, 0x3d, 0x68, 0xec, 0x9f,
+	0xd8, 0x91, 0xb3, 0x13, 0x38, 0xec, 0x3c, 0xfa, 0xa7, 0xbb, 0x50, 0xe7, 0x3f, 0x6c, 0xdb, 0x21,
+	0x7a, 0xe2, 0x19, 0x8b, 0x38, 0x07, 0xa2, 0x6e, 0x53, 0x20, 0xb9, 0x05, 0x15, 0x3f, 0x70, 0xd2,
+	0x7c, 0xff, 0x86, 0xc6, 0x80, 0xda, 0xcd, 0x12, 0x14, 0xf4, 0x77, 0x06, 0xbc, 0xc1, 0x91, 0x2f,
+	0xd1, 0xcf, 0x3b, 0x60, 0x0e, 0xed, 0x50, 0x9e, 0xb5, 0xa4, 0xb0, 0xe0, 0xb6, 0x1d, 0x5a, 0x38,
+	0x4d, 0xae, 0x43, 0x33, 0x62, 0xcf, 0x6c, 0xcf, 0xf6, 0x07, 0xae, 0x7f, 0x2c, 0x1d, 0x44, 0x47,
+	0xf1, 0xf0, 0x61, 0xbe, 0x83, 0xb3, 0xa2, 0x82, 0x57, 0x20, 0xe6, 0xd5, 0x61, 0x70, 0x96, 0x16,
+	0x0d, 0x02, 0xa0, 0xbf, 0x30, 0xa0, 0xb5, 0x2f, 0xd3, 0x51, 0xdf, 0x4f, 0xa2, 0xf1, 0xb9, 0x1b,
+	0xdf, 0xb4, 0x0c, 0x51, 0xc7, 0xb0, 0x02, 0xb1, 0x01, 0x96, 0x9a, 0x9a, 0xd2, 0x00, 0x3f, 0x15,
+	0x33, 0x56, 0x4a, 0x42, 0xff, 0x60, 0x40, 0x4d, 0x62, 0x67, 0x74, 0xc0, 0xda, 0x56, 0xa5, 0xfc,
+	0x56, 0x5d, 0xa8, 0x39, 0xcc, 0x63, 0x59, 0xb4, 0x28, 0x30, 0xed, 0x9a, 0xcb, 0x93, 0x5d, 0x73,
+	0x25, 0x73, 0xb3, 0x5b, 0x50, 0x19, 0x78, 0xc1, 0xe0, 0xb4, 0x5b, 0x9d, 0xb0, 0xa4, 0x9b, 0xb0,
+	0x75, 0x9c, 0xb2, 0x04, 0x05, 0xfd, 0x00, 0x1a, 0x29, 0x2e, 0x5d, 0xdd, 0x98, 0x5c, 0xbd, 0x94,
+	0xf5, 0xe4, 0x9b, 0xd0, 0x7a, 0x68, 0x0f, 0x4e, 0x47, 0xe1, 0x79, 0xfa, 0xc3, 0x5c, 0x19, 0x54,
+	0x2a, 0xb6, 0xe6, 0x37, 0xa0, 0x29, 0x96, 0x5a, 0x3f, 0x19, 0xf9, 0x7c, 0x7f, 0xd9, 0x0a, 0x1b,
+	0x2b, 0x8b, 0xb2, 0xe5, 0x1d, 0xc1, 0xa2, 0xc5, 0x30, 0x89, 0x32, 0x41, 0xf3, 0xda, 0x9b, 0x61,
+	0xcf, 0xe1, 0x60, 0x1e, 0x1d, 0xf9, 0x52, 0xab, 0x55, 0x27, 0x1a, 0x5b, 0x23, 0x3f, 0xdd, 0xb6,
+	0xac, 0x6d, 0xfb, 0x2d, 0x2c, 0xc9, 0x6d, 0xa7, 0x34, 0xf4, 0x59, 0xcd, 0xd6, 0xc5, 0x76, 0x41,
+	0x38, 0xa0, 0xb4, 0xa1, 0x04, 0x67, 0xee, 0x46, 0x1f, 0x41, 0x5b, 0xb9, 0xe6, 0x57, 0xe2, 0x64,
+	0xd7, 0xb3, 0x82, 0x31, 0x79, 0xa4, 0xc8, 0xa6, 0x53, 0x6d, 0x20, 0x41, 0xfa, 0x77, 0x03, 0xea,
+	0x5b, 0xc1, 0xb1, 0x70, 0xef, 0x79, 0x4b, 0x4c, 0xeb, 0xc9, 0xde, 0x86, 0x52, 0x10, 0x72, 0xc6,
+	0xda, 0xab, 0x4b, 0x99, 0x7b, 0x6c, 0x05, 0xc7, 0xbb, 0xa1, 0x55, 0x0a, 0x42, 0x15, 0x2f, 0xe5,
+	0x29, 0xf1, 0x52, 0x99, 0xe1, 0xc4, 0xd5, 0xd9, 0xf1, 0x52, 0x7b, 0x79, 0xbc, 0x7c, 0x0d, 0x60,
+	0xd9, 0x47, 0xc9, 0xff, 0xa2, 0xd2, 0xa3, 0xf7, 0xc5, 0x5a, 0xeb, 0x81, 0x7f, 0xe4, 0x1e, 0x93,
+	0xbb, 0x59, 0x25, 0x62, 0x14, 0x2b, 0xd9, 0x6c, 0xcb, 0xac, 0x0c, 0x39, 0x83, 0x06, 0xa2, 0x85,
+	0x62, 0x2f, 0x42, 0x45, 0x14, 0x39, 0x42, 0xab, 0x02, 0x48, 0xeb, 0xb6, 0x92, 0x56, 0xb7, 0xfd,
+	0x3f, 0x94, 0x93, 0x71, 0xc8, 0xa4, 0x52, 0x97, 0xf3, 0x7b, 0xf0, 0xc5, 0x0e, 0xc6, 0x21, 0xb3,
+	0x38, 0xd1, 0x54, 0x97, 0xfb, 0x8d, 0x01, 0xcd, 0xa7, 0x41, 0x92, 0x36, 0x1b, 0x6a, 0x13, 0x43,
+	0xdb, 0x04, 0x0f, 0x1c, 0xdb, 0x77, 0x5c, 0x27, 0x2b, 0x25, 0x33, 0x44, 0xa1, 0x02, 0x34, 0x8b,
+	0x15, 0xa0, 0xba, 0xb3, 0xe0, 0xab, 0xca, 0xe3, 0x07, 0x11, 0x07, 0xb8, 0x72, 0x0f, 0xea, 0x49,
+	0x64, 0xfb, 0xf1, 0x11, 0x8b, 0x64, 0x19, 0x92, 0xc2, 0xf4, 0x3e, 0x2c, 0x0a, 0xc6, 0xb2, 0x48,
+	0x98, 0xe0, 0xac, 0x0b, 0xb5, 0xe3, 0xc8, 0xf6, 0x95, 0xa3, 0xd6, 0x2d, 0x05, 0xd2, 0xbf, 0x18,
+	0xd0, 0x5a, 0x0b, 0x31, 0x61, 0xcf, 0x93, 0x2c, 0x2b, 0x7b, 0x4b, 0xb9, 0xb2, 0xf7, 0x1a, 0x40,
+	0x18, 0xb1, 0xb3, 0xbc, 0x4c, 0x88, 0x49, 0x65, 0xe2, 0xd3, 0xba, 0x4c, 0x88, 0xe0, 0x32, 0xdd,
+	0x81, 0x1a, 0xf3, 0x93, 0xc8, 0x65, 0xea, 0x50, 0x7d, 0x63, 0x8a, 0x55, 0x2c, 0x45, 0x83, 0x2c,
+	0x88, 0x6a, 0x58, 0x96, 0x12, 0x12, 0xa2, 0x16, 0xb4, 0x15, 0xff, 0xf3, 0x15, 0xa0, 0xae, 0x16,
+	0x4b, 0xf9, 0xab, 0x45, 0xbc, 0x77, 0x70, 0xfd, 0x44, 0x55, 0xf9, 0x38, 0xa6, 0xdf, 0x6b, 0x27,
+	0x54, 0x9a, 0xfc, 0xce, 0xad, 0x94, 0xd4, 0x2b, 0x4d, 0xdd, 0x2b, 0xe7, 0xda, 0x57, 0x79, 0x5c,
+	0x25, 0xf3, 0x38, 0x3d, 0x32, 0xaa, 0xe7, 0x89, 0x8c, 0x3b, 0xb0, 0xbc, 0xe9, 0x63, 0x11, 0xe5,
+	0x29, 0xd6, 0xe7, 0x69, 0x84, 0x7e, 0x0e, 0x17, 0x0e, 0xdc, 0x21, 0x0b, 0x46, 0xc9, 0x4e, 0xf0,
+	0xfc, 0x35, 0x6c, 0x4f, 0x57, 0x80, 0xe8, 0x0b, 0xcc, 0xd9, 0xca, 0x83, 0x0e, 0x32, 0xac, 0xd8,
+	0xda, 0x66, 0x89, 0xfd, 0x0a, 0xa1, 0xab, 0xe9, 0xc1, 0x3c, 0x8f, 0x1e, 0xfe, 0x61, 0x40, 0x6d,
+	0x3d, 0x18, 0x0e, 0x6d, 0xdf, 0x21, 0x37, 0x79, 0x26, 0x35, 0x78, 0xd0, 0x6b, 0xee, 0x25, 0xa7,
+	0xf3, 0xd9, 0xb4, 0x34, 0x25, 0x9b, 0x9a, 0x33, 0xb2, 0x69, 0x39, 0x9f, 0x4d, 0x3b, 0x60, 0xfa,
+	0xc1, 0x73, 0xd9, 0xe5, 0xe3, 0x10, 0x1b, 0x2c, 0xe5, 0xdc, 0xd5, 0x62, 0xe5, 0x9e, 0xab, 0x7d,
+	0x32, 0x07, 0xd7, 0x4e, 0xab, 0x9a, 0x28, 0xa3, 0x24, 0x48, 0x9f, 0x02, 0xc8, 0x6a, 0x7f, 0x6d,
+	0x70, 0xaa, 0xf7, 0x31, 0x46, 0xbe, 0x8f, 0x99, 0xd7, 0xfd, 0xa8, 0xea, 0xc1, 0xcc, 0xaa, 0x07,
+	0xfa, 0x57, 0x03, 0x88, 0xd6, 0x5f, 0x6d, 0xb3, 0x98, 0x5f, 0x8e, 0xbc, 0xf6, 0x06, 0x47, 0x23,
+	0xcf, 0x93, 0xd9, 0x9e, 0x8f, 0x91, 0x5e, 0xf5, 0x9d, 0x32, 0x99, 0xa6, 0x30, 0xf9, 0x51, 0x31,
+	0xfc, 0x49, 0xee, 0xa4, 0x9b, 0x54, 0x0e, 0x5e, 0x99, 0x8d, 0x8e, 0x4f, 0x64, 0xf8, 0x2b, 0x10,
+	0x2f, 0x5b, 0xd3, 0x62, 0x97, 0xa9, 0x9a, 0xd6, 0x98, 0x5f, 0xd3, 0xbe, 0x07, 0x65, 0x4c, 0x43,
+	0x73, 0x4a, 0x5f, 0x3e, 0xaf, 0x57, 0xb6, 0x66, 0xae, 0xb2, 0xa5, 0xc7, 0x70, 0xe9, 0x49, 0x88,
+	0x69, 0x3d, 0xfd, 0x43, 0x46, 0x90, 0x5a, 0xda, 0x78, 0xc9, 0xd2, 0xef, 0x41, 0xd9, 0x67, 0x2f,
+	0x92, 0x79, 0x2c, 0xe0, 0x3c, 0xfd, 0xa5, 0x01, 0xed, 0x6d, 0xf7, 0x38, 0xb2, 0x73, 0x47, 0xcf,
+	0x51, 0x14, 0x0c, 0x55, 0x21, 0x88, 0x63, 0xbd, 0x71, 0x28, 0xe5, 0x1b, 0x07, 0xcd, 0x13, 0xcd,
+	0x73, 0x7a, 0x22, 0x66, 0xa3, 0xc0, 0x17, 0x75, 0x6c, 0xdd, 0xe2, 0x63, 0xfa, 0x00, 0xda, 0x5f,
+	0xd9, 0xbe, 0x13, 0x1c, 0x1d, 0x29, 0x36, 0x66, 0xf7, 0x2a, 0xd9, 0xfd, 0x59, 0xf6, 0xb8, 0xb2,
+	0x01, 0x4b, 0xe9, 0xff, 0x32, 0x55, 0x68, 0x9c, 0x19, 0xe7, 0xe3, 0xec, 0xf6, 0x47, 0x50, 0xe1,
+	0x55, 0x10, 0xa9, 0x81, 0xb9, 0xdf, 0x3f, 0xe8, 0x2c, 0x10, 0x80, 0xea, 0x46, 0x7f, 0xab, 0x7f,
+	0xd0, 0xef, 0x18, 0x38, 0xee, 0x7f, 0xbb, 0xb7, 0x69, 0xf5, 0x3b, 0x25, 0xb2, 0x08, 0xf5, 0xa7,
+	0x7d, 0x6b, 0x7f, 0x73, 0x77, 0x67, 0xbf, 0x63, 0xde, 0xde, 0x80, 0x56, 0xee, 0xa0, 0x27, 0x17,
+	0xa0, 0xd5, 0xdf, 0x39, 0xb0, 0x7e, 0x76, 0xb8, 0xbe, 0xbb, 0xbd, 0xbd, 0xb6, 0xb3, 0xd1, 0x59,
+	0x20, 0x6d, 0x00, 0x81, 0xda, 0xd9, 0xdd, 0xdd, 0xeb, 0x18, 0xa4, 0x03, 0x8b, 0x8a, 0x64, 0xe7,
+	0xd1, 0xe6, 0x97, 0x9d, 0xd2, 0xed, 0x6f, 0xa1, 0x91, 0x66, 0x0e, 0xd2, 0x84, 0xda, 0xfa, 0xf6,
+	0xc6, 0xa1, 0xe0, 0xa2, 0x0d, 0x80, 0xc0, 0x93, 0xbd, 0x8d, 0x35, 0xce, 0x49, 0x0b, 0x1a, 0x1c,
+	0xde, 0xc1, 0xe9, 0x92, 0x9a, 0x96, 0xcc, 0x99, 0x64, 0x09, 0x9a, 0x08, 0x5b, 0xfd, 0xfd, 0x83,
+	0x5d, 0xab, 0xdf, 0x29, 0xaf, 0xfe, 0xab, 0x0d, 0xe6, 0xe3, 0xa7, 0xfb, 0xe4, 0x43, 0x30, 0xf7,
+	0x59, 0x42, 0x66, 0xbc, 0x33, 0xf5, 0x88, 0xde, 0xfe, 0x0b, 0x2d, 0xd2, 0x05, 0xf2, 0x11, 0x54,
+	0x85, 0x2f, 0xbe, 0xe2, 0x7f, 0xb7, 0xc1, 0xfc, 0xca, 0x8e, 0x49, 0x2b, 0xf7, 0xd3, 0x0c, 0xda,
+	0xf7, 0xa1, 0xf2, 0xc4, 0x8f, 0x59, 0x52, 0xa4, 0x9e, 0xb1, 0x23, 0x5d, 0x20, 0x77, 0xc1, 0xfc,
+	0xf2, 0x55, 0xe8, 0x3f, 0x85, 0x0a, 0x7f, 0xcc, 0x23, 0x97, 0xef, 0x8a, 0x37, 0xd3, 0x8c, 0xb2,
+	0x8f, 0x6f, 0xa6, 0x3d, 0xfd, 0x8a, 0x4a, 0x7f, 0xf5, 0xa3, 0x0b, 0xe4, 0x0b, 0xa8, 0xab, 0x17,
+	0xbe, 0x99, 0xbf, 0xf7, 0xf4, 0x10, 0xcb, 0xbf, 0x06, 0x66, 0x2b, 0xe0, 0xdb, 0xdf, 0x79, 0x57,
+	0xd0, 0xdf, 0x09, 0xe9, 0x02, 0xd9, 0x82, 0x76, 0xfe, 0xf5, 0x6f, 0xe6, 0x3a, 0xd7, 0xf3, 0xeb,
+	0x4c, 0xbe, 0x17, 0xd2, 0x05, 0xf2, 0x10, 0xef, 0xb6, 0x59, 0x3a, 0x45, 0xb4, 0xc3, 0x2b, 0x45,
+	0xf6, 0xde, 0x9c, 0x82, 0xd4, 0xd6, 0xf8, 0x14, 0x2a, 0xe2, 0xb6, 0x5b, 0x53, 0xba, 0x7e, 0x61,
+	0xde, 0x5b, 0x9e, 0xc0, 0xa7, 0xff, 0xfe, 0x14, 0x16, 0xd7, 0x79, 0x2b, 0x23, 0x5f, 0xfb, 0x96,
+	0x27, 0x9e, 0xba, 0xe4, 0x1a, 0x13, 0x6f, 0x60, 0x74, 0x81, 0x7c, 0x8c, 0x5d, 0xe1, 0x59, 0x70,
+	0xaa, 0x7e, 0x26, 0x45, 0x9a, 0xcd, 0x8d, 0x19, 0x6e, 0xf6, 0x19, 0x34, 0xf1, 0x9d, 0x4d, 0x50,
+	0xcd, 0xd6, 0xe0, 0xc5, 0xe2, 0x82, 0xf8, 0x13, 0x5d, 0x20, 0xf7, 0xf1, 0x92, 0x9f, 0x45, 0x63,
+	0xfe, 0x16, 0x44, 0x2e, 0x16, 0x1e, 0x87, 0xf8, 0x54, 0xef, 0x72, 0x01, 0x2b, 0xdf, 0x96, 0x84,
+	0xbe, 0xc4, 0x63, 0xcb, 0x39, 0x3c, 0x30, 0xf7, 0xe6, 0x41, 0x17, 0xc8, 0x27, 0xd0, 0xb0, 0x18,
+	0xf3, 0x07, 0xd1, 0x38, 0x9c, 0xed, 0xc1, 0xd3, 0x65, 0xbe, 0x0f, 0x55, 0xd1, 0x66, 0xeb, 0x4a,
+	0xce, 0xf5, 0xf0, 0xbd, 0x4b, 0xc5, 0x09, 0x5e, 0x94, 0xd2, 0x85, 0xf7, 0x0d, 0xf2, 0x05, 0xd4,
+	0x64, 0x2b, 0xac, 0x9b, 0x59, 0x6f, 0xca, 0x7b, 0x57, 0x26, 0xf0, 0xd9, 0xee, 0x2b, 0x06, 0xf9,
+	0x3a, 0xbd, 0xc8, 0x97, 0x17, 0xbb, 0xb3, 0xd8, 0x7f, 0x7b, 0xe2, 0x8e, 0x38, 0x7f, 0xc1, 0xc4,
+	0x55, 0xd8, 0x58, 0x73, 0x1c, 0xd9, 0x26, 0x2e, 0xe7, 0x9e, 0x6f, 0xb2, 0x97, 0x87, 0x19, 0x7a,
+	0x78, 0x00, 0xad, 0xbd, 0x28, 0x18, 0x06, 0x09, 0x7b, 0xbd, 0xff, 0x3f, 0x43, 0xaf, 0xc3, 0x82,
+	0xe9, 0xf5, 0x7e, 0x5f, 0x07, 0x72, 0x20, 0x5b, 0xaa, 0x2d, 0x5e, 0xe0, 0xc6, 0x27, 0x6e, 0xf8,
+	0xaa, 0x8b, 0x58, 0x70, 0x61, 0xe2, 0xc2, 0x7a, 0xa6, 0x3e, 0x6f, 0x4e, 0x5c, 0xe6, 0x4e, 0xde,
+	0x72, 0xf3, 0x68, 0xca, 0xee, 0x07, 0xcf, 0xe1, 0x59, 0x8a, 0x96, 0x2e, 0x90, 0x47, 0xd0, 0xd4,
+	0xee, 0x01, 0x67, 0xfe, 0x7c, 0xad, 0xf0, 0xf3, 0x04, 0x07, 0x3f, 0x81, 0xfa, 0x9a, 0xe3, 0xf0,
+	0x39, 0x32, 0xed, 0xe2, 0x71, 0x86, 0x32, 0x3e, 0x86, 0xa6, 0x30, 0xc8, 0x2b, 0xff, 0xb9, 0x01,
+	0x90, 0xdd, 0xef, 0xce, 0xe4, 0xfb, 0x6a, 0xfe, 0xe6, 0xac, 0xc8, 0xf6, 0xea, 0x9f, 0x4a, 0x50,
+	0xc6, 0x53, 0x9f, 0x3c, 0x80, 0xa6, 0x34, 0x1b, 0x36, 0xca, 0x44, 0x8b, 0x26, 0xad, 0xa3, 0xef,
+	0x5d, 0x2e, 0xa2, 0x35, 0x76, 0x64, 0x8b, 0xdc, 0x97, 0x05, 0x92, 0x9e, 0x0d, 0xf5, 0xde, 0xb9,
+	0xd7, 0x9d, 0x9c, 0x48, 0x57, 0xf9, 0x06, 0x96, 0x0a, 0xfd, 0x19, 0x99, 0x52, 0xf0, 0x88, 0x90,
+	0xbd, 0x91, 0x4d, 0xcc, 0xe8, 0xe9, 0x78, 0xe8, 0x6e, 0x02, 0x64, 0x2d, 0x18, 0xd1, 0x8e, 0x83,
+	0x89, 0xce, 0xae, 0x77, 0x75, 0xfa, 0x64, 0xaa, 0xac, 0x03, 0x68, 0x6a, 0x4e, 0x48, 0xfa, 0xd0,
+	0x50, 0x20, 0xd3, 0x13, 0x69, 0xd6, 0x87, 0xf4, 0xae, 0x4e, 0x60, 0xb5, 0x26, 0x02, 0xd9, 0x7b,
+	0xdf, 0x58, 0x7d, 0x0c, 0x15, 0x34, 0x4d, 0x4c, 0x1e, 0x42, 0xf5, 0x51, 0x80, 0xef, 0xe1, 0x3f,
+	0x60, 0xb1, 0x5f, 0x97, 0x64, 0x24, 0xe0, 0xd5, 0xf2, 0x23, 0x68, 0x88, 0xa2, 0x07, 0xc3, 0x42,
+	0xcb, 0x4c, 0x53, 0xab, 0xf2, 0xde, 0x0c, 0x17, 0xa2, 0x0b, 0x64, 0x0d, 0xaa, 0x3f, 0x34, 0x3c,
+	0x3e, 0x83, 0x9a, 0xac, 0xd0, 0x89, 0x66, 0xff, 0x7c, 0xd1, 0x3e, 0x87, 0x83, 0x2f, 0xa0, 0x26,
+	0x2b, 0x63, 0xfd, 0xf7, 0x7c, 0xb1, 0xdd, 0xbb, 0x32, 0x65, 0x46, 0x31, 0xf0, 0xac, 0xca, 0xe7,
+	0x3e, 0xfc, 0xef, 0x00, 0x90, 0x97, 0xaf, 0x3f, 0x82, 0x26, 0x00, 0x00,
 }
@@ -0,0 +1,166 @@
+// Package quota tracks how many keys and bytes each user and namespace
+// stores, and checks writes against their limits.
+//
+// Usage is updated incrementally by the caller on every write, so checking a
+// quota never scans the store.
+package quota
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Limit is a maximum number of keys and bytes, where 0 means unlimited.
+type Limit struct {
+	Keys  int64
+	Bytes int64
+}
+
+// Usage is the number of keys and bytes in use.
+type Usage struct {
+	Keys  int64
+	Bytes int64
+}
+
+// ExceededError is returned by Reserve when a write would go over a limit.
+type ExceededError struct {
+	User      string
+	Namespace string // empty if the user's quota was exceeded
+	Resource  string // "keys" or "bytes"
+	Limit     int64
+}
+
+func (e *ExceededError) Error() string {
+	if e.Namespace == "" {
+		return fmt.Sprintf("quota exceeded: user %q is limited to %d %s", e.User, e.Limit, e.Resource)
+	}
+	return fmt.Sprintf("quota exceeded: namespace %q is limited to %d %s", e.Namespace, e.Limit, e.Resource)
+}
+
+// Tracker holds the usage of every user and namespace. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu         sync.Mutex
+	users      map[string]*Usage
+	namespaces map[string]map[string]*Usage
+}
+
+// New returns an empty Tracker.
+func New() *Tracker {
+	return &Tracker{
+		users:      make(map[string]*Usage),
+		namespaces: make(map[string]map[string]*Usage),
+	}
+}
+
+func (t *Tracker) get(user, namespace string) (*Usage, *Usage) {
+	u, ok := t.users[user]
+	if !ok {
+		u = &Usage{}
+		t.users[user] = u
+	}
+	nss, ok := t.namespaces[user]
+	if !ok {
+		nss = make(map[string]*Usage)
+		t.namespaces[user] = nss
+	}
+	ns, ok := nss[namespace]
+	if !ok {
+		ns = &Usage{}
+		nss[namespace] = ns
+	}
+	return u, ns
+}
+
+// over returns the resource that adding keys and bytes to u would take past
+// limit. Writes that do not grow usage are always allowed.
+func over(u *Usage, keys, bytes int64, limit Limit) (string, int64) {
+	if keys > 0 && limit.Keys > 0 && u.Keys+keys > limit.Keys {
+		return "keys", limit.Keys
+	}
+	if bytes > 0 && limit.Bytes > 0 && u.Bytes+bytes > limit.Bytes {
+		return "bytes", limit.Bytes
+	}
+	return "", 0
+}
+
+// Reserve adds keys and bytes to the usage of user and namespace if neither
+// goes over its limit, and returns an *ExceededError otherwise. Callers must
+// give the reservation back with Add if the write does not happen.
+func (t *Tracker) Reserve(user, namespace string, keys, bytes int64, userLimit, nsLimit Limit) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ns := t.get(user, namespace)
+	if res, limit := over(u, keys, bytes, userLimit); res != "" {
+		return &ExceededError{User: user, Resource: res, Limit: limit}
+	}
+	if res, limit := over(ns, keys, bytes, nsLimit); res != "" {
+		return &ExceededError{User: user, Namespace: namespace, Resource: res, Limit: limit}
+	}
+	u.Keys, u.Bytes = u.Keys+keys, u.Bytes+bytes
+	ns.Keys, ns.Bytes = ns.Keys+keys, ns.Bytes+bytes
+	return nil
+}
+
+// Add adds keys and bytes, which may be negative, without checking limits.
+func (t *Tracker) Add(user, namespace string, keys, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ns := t.get(user, namespace)
+	u.Keys, u.Bytes = u.Keys+keys, u.Bytes+bytes
+	ns.Keys, ns.Bytes = ns.Keys+keys, ns.Bytes+bytes
+	if ns.Keys == 0 && ns.Bytes == 0 {
+		delete(t.namespaces[user], namespace)
+	}
+}
+
+// User returns the usage of user across all namespaces.
+func (t *Tracker) User(user string) Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.users[user]; ok {
+		return *u
+	}
+	return Usage{}
+}
+
+// Users returns every user with tracked usage, ordered by name.
+func (t *Tracker) Users() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	users := make([]string, 0, len(t.users))
+	for user := range t.users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// NamespaceUsage is the usage of one namespace.
+type NamespaceUsage struct {
+	Namespace string
+	Usage
+}
+
+// Namespaces returns the usage of each namespace of user, ordered by name.
+func (t *Tracker) Namespaces(user string) []NamespaceUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := make([]NamespaceUsage, 0, len(t.namespaces[user]))
+	for name, u := range t.namespaces[user] {
+		if u.Keys != 0 || u.Bytes != 0 {
+			usage = append(usage, NamespaceUsage{name, *u})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Namespace < usage[j].Namespace })
+	return usage
+}
+
+// Reset forgets all usage.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.users = make(map[string]*Usage)
+	t.namespaces = make(map[string]map[string]*Usage)
+}
@@ -0,0 +1,57 @@
+package quota
+
+import "testing"
+
+func Test_QuotaReserve(t *testing.T) {
+	tr := New()
+	user := Limit{Keys: 3}
+	ns := Limit{Bytes: 10}
+
+	if err := tr.Reserve("u", "a", 1, 6, user, ns); err != nil {
+		t.Fatalf("reservation within quota rejected: %s", err.Error())
+	}
+	err := tr.Reserve("u", "a", 1, 6, user, ns)
+	if e, ok := err.(*ExceededError); !ok || e.Namespace != "a" || e.Resource != "bytes" {
+		t.Fatalf("namespace byte quota not enforced: %v", err)
+	}
+	// other namespaces have their own byte quota
+	if err := tr.Reserve("u", "b", 1, 6, user, ns); err != nil {
+		t.Fatalf("reservation in another namespace rejected: %s", err.Error())
+	}
+	if err := tr.Reserve("u", "c", 1, 1, user, ns); err != nil {
+		t.Fatalf("reservation within quota rejected: %s", err.Error())
+	}
+	err = tr.Reserve("u", "d", 1, 1, user, ns)
+	if e, ok := err.(*ExceededError); !ok || e.Namespace != "" || e.Resource != "keys" {
+		t.Fatalf("user key quota not enforced: %v", err)
+	}
+	// rejected reservations are not counted
+	if u := tr.User("u"); u != (Usage{Keys: 3, Bytes: 13}) {
+		t.Fatalf("unexpected usage %v", u)
+	}
+	// shrinking is always allowed, even over quota
+	if err := tr.Reserve("u", "a", 0, -2, user, Limit{Bytes: 1}); err != nil {
+		t.Fatalf("shrinking write rejected: %s", err.Error())
+	}
+}
+
+func Test_QuotaAdd(t *testing.T) {
+	tr := New()
+	tr.Add("u", "a", 2, 20)
+	tr.Add("u", "b", 1, 5)
+	tr.Add("v", "a", 1, 1)
+	tr.Add("u", "b", -1, -5)
+
+	if u := tr.User("u"); u != (Usage{Keys: 2, Bytes: 20}) {
+		t.Fatalf("unexpected usage %v", u)
+	}
+	nss := tr.Namespaces("u")
+	if len(nss) != 1 || nss[0].Namespace != "a" || nss[0].Usage != (Usage{Keys: 2, Bytes: 20}) {
+		t.Fatalf("unexpected namespace usage %v", nss)
+	}
+
+	tr.Reset()
+	if u := tr.User("u"); u != (Usage{}) {
+		t.Fatalf("usage not reset: %v", u)
+	}
+}
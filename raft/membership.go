@@ -0,0 +1,191 @@
+package raft
+
+import (
+	"github.com/golang/protobuf/proto"
+	pb "github.com/imjching/keev/protobuf"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Members returns the members of the group as the node knows them.
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	members := make([]Member, 0, len(n.members))
+	for _, p := range n.progress() {
+		members = append(members, p.Member)
+	}
+	return members
+}
+
+// AddLearner adds a learner, which the leader replicates to, sending it the
+// snapshot if it starts empty, but which does not vote. It returns once the
+// change is applied and fails with ErrNotLeader on any node but the leader.
+func (n *Node) AddLearner(ctx context.Context, id, addr string) error {
+	return n.changeMembers(ctx, func(members []*pb.RaftMember) ([]*pb.RaftMember, error) {
+		if findMember(members, id) >= 0 {
+			return nil, ErrMemberExists
+		}
+		return append(members, &pb.RaftMember{Id: id, Addr: addr, Learner: true}), nil
+	})
+}
+
+// Promote makes a learner a voter once it has caught up with the commit
+// index of the leader.
+func (n *Node) Promote(ctx context.Context, id string) error {
+	n.mu.Lock()
+	err := n.await(ctx, func() (bool, error) {
+		if n.state != Leader {
+			return false, ErrNotLeader
+		}
+		if i := findMember(n.members, id); i < 0 {
+			return false, ErrUnknownMember
+		} else if !n.members[i].Learner {
+			return false, ErrNotLearner
+		}
+		return n.matchIndex[id] >= n.commit, nil
+	})
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return n.changeMembers(ctx, func(members []*pb.RaftMember) ([]*pb.RaftMember, error) {
+		i := findMember(members, id)
+		if i < 0 {
+			return nil, ErrUnknownMember
+		}
+		if !members[i].Learner {
+			return nil, ErrNotLearner
+		}
+		members[i] = &pb.RaftMember{Id: id, Addr: members[i].Addr}
+		return members, nil
+	})
+}
+
+// AddVoter adds a voter: a learner first, promoted once it has caught up.
+func (n *Node) AddVoter(ctx context.Context, id, addr string) error {
+	if err := n.AddLearner(ctx, id, addr); err != nil && err != ErrMemberExists {
+		return err
+	}
+	return n.Promote(ctx, id)
+}
+
+// RemoveMember removes a member. A leader removing itself steps down once
+// the change is applied; the removed node should then be stopped.
+func (n *Node) RemoveMember(ctx context.Context, id string) error {
+	return n.changeMembers(ctx, func(members []*pb.RaftMember) ([]*pb.RaftMember, error) {
+		i := findMember(members, id)
+		if i < 0 {
+			return nil, ErrUnknownMember
+		}
+		members = append(members[:i], members[i+1:]...)
+		for _, m := range members {
+			if !m.Learner {
+				return members, nil
+			}
+		}
+		return nil, ErrLastVoter
+	})
+}
+
+// changeMembers appends the configuration change returns, given a copy of
+// the current members, and waits until it is applied. Only one change is
+// made at a time, until it is committed.
+func (n *Node) changeMembers(ctx context.Context, change func(members []*pb.RaftMember) ([]*pb.RaftMember, error)) error {
+	n.mu.Lock()
+	if n.state != Leader || n.stopped() {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+	if n.configIndex > n.commit {
+		n.mu.Unlock()
+		return ErrChangePending
+	}
+	members, err := change(append([]*pb.RaftMember(nil), n.members...))
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	data, err := proto.Marshal(&pb.RaftConfig{Members: members})
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	index, p, err := n.appendProposal(pb.RaftEntryType_ENTRY_CONFIG, data)
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.log.WithFields(logrus.Fields{"index": index, "members": len(members)}).Info("changing members")
+	_, err = n.waitProposal(ctx, index, p)
+	return err
+}
+
+func findMember(members []*pb.RaftMember, id string) int {
+	for i, m := range members {
+		if m.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// TransferLeadership hands leadership over to a voter: once it has every
+// entry of the leader, it is told to start an election, which the voters
+// answer even though they heard from the leader, so ReadIndex no longer
+// relies on its lease. It returns once the node no longer leads.
+func (n *Node) TransferLeadership(ctx context.Context, id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state != Leader || n.stopped() {
+		return ErrNotLeader
+	}
+	if id == n.id {
+		return nil
+	}
+	term := n.term
+	n.wakeReplicators()
+	err := n.await(ctx, func() (bool, error) {
+		if n.state != Leader || n.term != term {
+			return false, ErrLeadershipLost
+		}
+		if !n.isVoter(id) {
+			return false, ErrNotVoter
+		}
+		return n.matchIndex[id] >= n.storage.lastIndex(), nil
+	})
+	if err != nil {
+		return err
+	}
+	addr := n.peers[id]
+	n.log.WithFields(logrus.Fields{"term": term, "to": id}).Info("transferring leadership")
+	// the voter may win even if the call fails, without the node hearing of
+	// it until its lease is over: reads confirm it still leads from now on
+	n.transferTerm = term
+	n.mu.Unlock()
+	resp, err := n.transport.TimeoutNow(ctx, addr, &pb.TimeoutNowRequest{Term: term, Leader: n.id})
+	n.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+	}
+	return n.await(ctx, func() (bool, error) {
+		return n.state != Leader || n.term != term, nil
+	})
+}
+
+// HandleTimeoutNow answers a TimeoutNow RPC.
+func (n *Node) HandleTimeoutNow(req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return nil, ErrStopped
+	}
+	if req.Term == n.term && req.Leader == n.leader && n.state == Follower && n.isVoter(n.id) {
+		n.startElection(true)
+	}
+	return &pb.TimeoutNowResponse{Term: n.term}, nil
+}
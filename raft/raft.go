@@ -0,0 +1,1226 @@
+// Package raft replicates a state machine across a group of nodes with the
+// Raft consensus algorithm (https://raft.github.io/raft.pdf).
+//
+// Every node holds a log of commands. The leader, elected by a majority of
+// the nodes, appends the commands proposed to it and replicates them; once a
+// majority has stored an entry it is committed and every node applies it to
+// its state machine, in log order. A group of 2f+1 nodes keeps working with
+// f nodes down. Applied entries are regularly compacted into a snapshot of
+// the state machine, which is also sent to nodes too far behind to catch up
+// from the log.
+//
+// The members of the group change one at a time through entries of the log,
+// in effect as soon as they are appended. New nodes join as learners, which
+// are replicated to but do not vote, and are promoted once they caught up.
+//
+// Nodes talk to each other through a Transport, see GRPCTransport.
+package raft
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrNotLeader is returned when a command is proposed to a node that is
+	// not the leader, see Leader.
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrLeadershipLost is returned when the leader steps down before a
+	// command it accepted is applied. The command may still be applied by
+	// the next leader.
+	ErrLeadershipLost = errors.New("raft: leadership lost, the command may or may not be applied")
+	// ErrStopped is returned once the node is stopped.
+	ErrStopped = errors.New("raft: node stopped")
+	// ErrStale is returned by ReadStale when the node has not heard from a
+	// leader recently enough.
+	ErrStale = errors.New("raft: too far behind the leader")
+
+	// Errors of membership changes.
+	ErrMemberExists  = errors.New("raft: already a member")
+	ErrUnknownMember = errors.New("raft: not a member")
+	ErrNotLearner    = errors.New("raft: not a learner")
+	ErrNotVoter      = errors.New("raft: not a voter")
+	ErrLastVoter     = errors.New("raft: cannot remove the last voter")
+	ErrChangePending = errors.New("raft: another membership change is in progress")
+)
+
+// State is the role of a node.
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+// StateMachine is the state replicated by the group.
+type StateMachine interface {
+	// Apply applies a committed command and returns the result given to
+	// whoever proposed it. It must be deterministic: every node applies the
+	// same commands in the same order and must end up in the same state.
+	Apply(index uint64, command []byte) interface{}
+	// Snapshot captures the state after the last command applied. Nothing
+	// is applied until it returns, so it should be quick, e.g. copy-on-write;
+	// the snapshot is written out later with Persist.
+	Snapshot() (Snapshot, error)
+	// Restore replaces the state with a snapshot written by Persist.
+	Restore(r io.Reader) error
+}
+
+// Snapshot is a point-in-time state of a StateMachine.
+type Snapshot interface {
+	Persist(w io.Writer) error
+	Release()
+}
+
+// Config configures a node.
+type Config struct {
+	// ID names the node, it must be a key of Peers.
+	ID string
+	// Peers maps the ID of every node of the group to its address when it
+	// is formed. Once the members change, they are taken from the log.
+	Peers map[string]string
+	// Join makes the node wait to be added to an existing group, through
+	// AddLearner on its leader, instead of forming one with Peers.
+	Join bool
+	// Dir holds the log, the term and vote, and the snapshot.
+	Dir string
+	// Cipher encrypts the log, nil to store it in plaintext. Snapshots are
+	// stored as the state machine writes them.
+	Cipher Cipher
+
+	Transport    Transport
+	StateMachine StateMachine
+	Logger       logrus.FieldLogger // nil to log nothing
+
+	// HeartbeatInterval is how often the leader contacts idle followers.
+	HeartbeatInterval time.Duration
+	// ElectionTimeout is how long a follower waits without hearing from a
+	// leader before it starts an election, randomized up to twice as long.
+	ElectionTimeout time.Duration
+	// SnapshotEntries is the number of entries applied after which a
+	// snapshot is taken and the log compacted, 0 to only snapshot when
+	// Snapshot is called.
+	SnapshotEntries uint64
+	// MaxAppendSize is the most bytes of entries sent in one AppendEntries
+	// request, one entry is sent even if it is larger.
+	MaxAppendSize int
+}
+
+// Defaults for Config.
+const (
+	DefaultHeartbeatInterval = 100 * time.Millisecond
+	DefaultElectionTimeout   = time.Second
+	DefaultSnapshotEntries   = 10000
+	DefaultMaxAppendSize     = 1 << 20
+)
+
+// maxAppend is the most entries sent in one AppendEntries request.
+const maxAppend = 256
+
+// proposal waits for an entry the leader appended to be applied.
+type proposal struct {
+	term   uint64
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+// Member is a node of the group.
+type Member struct {
+	ID      string
+	Addr    string
+	Learner bool // replicated to but does not vote
+}
+
+// Node is a member of a Raft group.
+type Node struct {
+	id         string
+	bootstrap  []*pb.RaftMember // the members the group was formed with
+	transport  Transport
+	fsm        StateMachine
+	log        logrus.FieldLogger
+	heartbeat  time.Duration
+	election   time.Duration
+	threshold  uint64
+	appendSize int
+
+	// applyMu is held while entries are applied and while the state machine
+	// is snapshot or restored, before mu if both are taken
+	applyMu sync.Mutex
+	// appliedMembers are the members as of the last entry applied, nil if
+	// the group never changed. Guarded by applyMu.
+	appliedMembers []*pb.RaftMember
+
+	snapMu   sync.Mutex // serializes writing snapshots
+	mu       sync.Mutex
+	state    State
+	term     uint64
+	votedFor string
+	leader   string
+	storage  *storage
+	commit   uint64
+	applied  uint64
+	deadline time.Time // of the election timeout
+	rand     *rand.Rand
+	started  time.Time
+	// members of the group as of the last configuration in the log, and
+	// the address of each and learners by ID
+	members     []*pb.RaftMember
+	peers       map[string]string
+	learners    map[string]bool
+	configIndex uint64 // of the configuration entry, or the snapshot
+	// when a follower last heard from the leader, and the leader's commit
+	// index then
+	contact      time.Time
+	leaderCommit uint64
+	// transferTerm is the last term the leader tried to hand leadership over
+	// in: the voters elect the node it told to campaign despite its lease
+	transferTerm uint64
+	// replication state of the leader, by peer
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	acked      map[string]time.Time // when the last request acknowledged was sent
+	wake       map[string]chan struct{}
+	waiters    map[uint64]*proposal
+	// changed is closed, and replaced, when the commit or applied index or
+	// an acknowledgement of the leader changes
+	changed chan struct{}
+
+	applyCh chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates a node from the storage in cfg.Dir, restoring the state
+// machine from the last snapshot. Call Start to join the group.
+func New(cfg Config) (*Node, error) {
+	if _, ok := cfg.Peers[cfg.ID]; !ok && !cfg.Join {
+		return nil, errors.New("raft: the node is not one of its peers")
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = DefaultElectionTimeout
+	}
+	if cfg.MaxAppendSize <= 0 {
+		cfg.MaxAppendSize = DefaultMaxAppendSize
+	}
+	if cfg.Logger == nil {
+		l := logrus.New()
+		l.Out = ioutil.Discard
+		cfg.Logger = l
+	}
+	s, state, err := openStorage(cfg.Dir, cfg.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		id:         cfg.ID,
+		transport:  cfg.Transport,
+		fsm:        cfg.StateMachine,
+		log:        cfg.Logger.WithField("node", cfg.ID),
+		heartbeat:  cfg.HeartbeatInterval,
+		election:   cfg.ElectionTimeout,
+		threshold:  cfg.SnapshotEntries,
+		appendSize: cfg.MaxAppendSize,
+		term:       state.Term,
+		votedFor:   state.VotedFor,
+		storage:    s,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		waiters:    make(map[uint64]*proposal),
+		changed:    make(chan struct{}),
+		applyCh:    make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	if !cfg.Join {
+		for id, addr := range cfg.Peers {
+			n.bootstrap = append(n.bootstrap, &pb.RaftMember{Id: id, Addr: addr})
+		}
+		sort.Slice(n.bootstrap, func(i, j int) bool { return n.bootstrap[i].Id < n.bootstrap[j].Id })
+	}
+	if err := n.loadMembers(); err != nil {
+		s.close()
+		return nil, err
+	}
+	n.appliedMembers = s.members
+	if index := s.snapshotIndex(); index > 0 {
+		_, r, err := s.openSnapshot("snapshot")
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		err = n.fsm.Restore(r)
+		r.Close()
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		n.commit, n.applied = index, index
+	}
+	return n, nil
+}
+
+// Start starts the election timer and applying committed entries.
+func (n *Node) Start() {
+	n.mu.Lock()
+	n.started = time.Now()
+	n.resetElectionTimer()
+	n.mu.Unlock()
+	n.wg.Add(2)
+	go n.ticker()
+	go n.applier()
+}
+
+// Stop stops the node. Commands waiting to be applied fail with ErrStopped.
+func (n *Node) Stop() error {
+	close(n.stop)
+	n.wg.Wait()
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failWaiters(ErrStopped)
+	n.state = Follower
+	return n.storage.close()
+}
+
+func (n *Node) stopped() bool {
+	select {
+	case <-n.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// ID returns the ID of the node.
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Leader returns the ID and address of the leader, empty if it is unknown.
+func (n *Node) Leader() (id, addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader, n.peers[n.leader]
+}
+
+// IsLeader returns true if the node believes it is the leader.
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state == Leader
+}
+
+// Status describes a node.
+type Status struct {
+	ID            string
+	State         State
+	Term          uint64
+	Leader        string
+	LastIndex     uint64
+	CommitIndex   uint64
+	AppliedIndex  uint64
+	SnapshotIndex uint64
+	SnapshotSize  int64 // bytes
+	Members       []Progress
+}
+
+// Progress is the replication state of a member, known on the leader only.
+type Progress struct {
+	Member
+	Match   uint64    // index of the last entry it is known to store
+	LastAck time.Time // when the last request it acknowledged was sent, zero if none
+}
+
+// Status returns the current status of the node.
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.id,
+		State:         n.state,
+		Term:          n.term,
+		Leader:        n.leader,
+		LastIndex:     n.storage.lastIndex(),
+		CommitIndex:   n.commit,
+		AppliedIndex:  n.applied,
+		SnapshotIndex: n.storage.snapshotIndex(),
+		SnapshotSize:  n.storage.snapshotSize(),
+		Members:       n.progress(),
+	}
+}
+
+// progress returns the replication state of every member, mu must be held.
+func (n *Node) progress() []Progress {
+	members := make([]Progress, 0, len(n.members))
+	for _, m := range n.members {
+		p := Progress{Member: Member{ID: m.Id, Addr: m.Addr, Learner: m.Learner}}
+		if n.state == Leader {
+			p.Match, p.LastAck = n.matchIndex[m.Id], n.acked[m.Id]
+			if m.Id == n.id {
+				p.LastAck = time.Now()
+			}
+		}
+		members = append(members, p)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// Propose appends a command to the log and waits until it is applied,
+// returning the result of the state machine. It fails with ErrNotLeader on
+// any node but the leader.
+func (n *Node) Propose(ctx context.Context, command []byte) (interface{}, error) {
+	n.mu.Lock()
+	if n.state != Leader || n.stopped() {
+		n.mu.Unlock()
+		return nil, ErrNotLeader
+	}
+	index, p, err := n.appendProposal(pb.RaftEntryType_ENTRY_COMMAND, command)
+	n.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return n.waitProposal(ctx, index, p)
+}
+
+// appendProposal appends an entry to the log of the leader and returns its
+// index and the proposal waiting for it, mu must be held.
+func (n *Node) appendProposal(typ pb.RaftEntryType, data []byte) (uint64, *proposal, error) {
+	e := &pb.RaftEntry{Index: n.storage.lastIndex() + 1, Term: n.term, Type: typ, Data: data}
+	if err := n.storage.append(e); err != nil {
+		return 0, nil, err
+	}
+	if typ == pb.RaftEntryType_ENTRY_CONFIG {
+		members, _ := decodeConfig(data) // encoded by changeMembers
+		n.setMembers(members, e.Index)
+	}
+	p := &proposal{term: n.term, done: make(chan struct{})}
+	n.waiters[e.Index] = p
+	n.matchIndex[n.id] = e.Index
+	n.advanceCommit()
+	n.wakeReplicators()
+	return e.Index, p, nil
+}
+
+// waitProposal waits until the entry at index is applied.
+func (n *Node) waitProposal(ctx context.Context, index uint64, p *proposal) (interface{}, error) {
+	select {
+	case <-p.done:
+		return p.result, p.err
+	case <-ctx.Done():
+		n.mu.Lock()
+		if n.waiters[index] == p {
+			delete(n.waiters, index)
+		}
+		n.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// ReadIndex waits until the state machine holds every command committed
+// before it was called and returns the index applied, so that reading the
+// state machine next is linearizable. It fails with ErrNotLeader on any node
+// but the leader, which confirms it still leads with a round of heartbeats.
+// With lease, the round is skipped while a majority acknowledged the leader
+// within the election timeout, during which they do not vote for another
+// node; this relies on the clocks of the nodes running at about the same
+// rate. Once the leader tried to transfer leadership, the lease is not used
+// for the rest of its term.
+func (n *Node) ReadIndex(ctx context.Context, lease bool) (uint64, error) {
+	start := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state != Leader || n.stopped() {
+		return 0, ErrNotLeader
+	}
+	term := n.term
+	confirmed := lease && n.transferTerm != term && start.Before(n.quorumAck().Add(n.election*9/10))
+	if !confirmed {
+		n.wakeReplicators()
+	}
+	var index uint64
+	err := n.await(ctx, func() (bool, error) {
+		if n.state != Leader || n.term != term {
+			return false, ErrLeadershipLost
+		}
+		// the commit index is only known once an entry of the term is
+		// committed
+		if t, _ := n.storage.term(n.commit); t != term {
+			return false, nil
+		}
+		if !confirmed && n.quorumAck().Before(start) {
+			return false, nil
+		}
+		index = n.commit
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n.waitApplied(ctx, index)
+}
+
+// ReadStale waits until the state machine holds every command the leader
+// had committed when the node last heard from it and returns the index
+// applied. The state machine then lags the leader by at most the time since,
+// which fails with ErrStale if it is longer than maxStaleness. On the leader,
+// it is the time since a majority last acknowledged it.
+func (n *Node) ReadStale(ctx context.Context, maxStaleness time.Duration) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return 0, ErrStopped
+	}
+	contact, commit := n.contact, n.leaderCommit
+	if n.state == Leader {
+		contact, commit = n.quorumAck(), n.commit
+	}
+	if n.state == Candidate || time.Since(contact) > maxStaleness {
+		return 0, ErrStale
+	}
+	return n.waitApplied(ctx, commit)
+}
+
+// waitApplied waits until index is applied and returns the index applied,
+// mu must be held.
+func (n *Node) waitApplied(ctx context.Context, index uint64) (uint64, error) {
+	err := n.await(ctx, func() (bool, error) {
+		return n.applied >= index, nil
+	})
+	return n.applied, err
+}
+
+// await waits until done returns true or an error, checking it each time
+// the node changes. mu must be held, it is released while waiting.
+func (n *Node) await(ctx context.Context, done func() (bool, error)) error {
+	for {
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		if n.stopped() {
+			return ErrStopped
+		}
+		changed := n.changed
+		n.mu.Unlock()
+		select {
+		case <-changed:
+		case <-n.stop:
+		case <-ctx.Done():
+			n.mu.Lock()
+			return ctx.Err()
+		}
+		n.mu.Lock()
+	}
+}
+
+// notify wakes up the readers waiting for the node to change, mu must be
+// held.
+func (n *Node) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// quorumAck returns when the oldest request acknowledged by the latest
+// majority to acknowledge the leader was sent, mu must be held.
+func (n *Node) quorumAck() time.Time {
+	var acks []time.Time
+	for id := range n.peers {
+		switch {
+		case n.learners[id]:
+		case id == n.id:
+			acks = append(acks, time.Now())
+		default:
+			acks = append(acks, n.acked[id])
+		}
+	}
+	if len(acks) == 0 {
+		return time.Time{}
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].After(acks[j]) })
+	return acks[len(acks)/2]
+}
+
+// failWaiters fails every proposal waiting to be applied, mu must be held.
+func (n *Node) failWaiters(err error) {
+	for index, p := range n.waiters {
+		p.err = err
+		close(p.done)
+		delete(n.waiters, index)
+	}
+}
+
+// resetElectionTimer picks a new random election timeout, mu must be held.
+func (n *Node) resetElectionTimer() {
+	n.deadline = time.Now().Add(n.election + time.Duration(n.rand.Int63n(int64(n.election))))
+}
+
+// saveState persists the term and vote, mu must be held.
+func (n *Node) saveState() error {
+	return n.storage.saveState(hardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+// stepDown becomes a follower, in term if it is newer. mu must be held.
+func (n *Node) stepDown(term uint64) {
+	if term > n.term {
+		n.term, n.votedFor = term, ""
+		if err := n.saveState(); err != nil {
+			n.log.WithError(err).Error("failed to save raft state")
+		}
+	}
+	if n.state == Leader {
+		n.log.WithField("term", n.term).Info("stepping down")
+		n.failWaiters(ErrLeadershipLost)
+		n.notify()
+	}
+	if n.state != Follower {
+		n.state = Follower
+		n.resetElectionTimer()
+	}
+}
+
+// ticker starts an election when the leader has not been heard from within
+// the election timeout.
+func (n *Node) ticker() {
+	defer n.wg.Done()
+	t := time.NewTicker(n.election / 20)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-t.C:
+		}
+		n.mu.Lock()
+		if n.state != Leader && n.isVoter(n.id) && time.Now().After(n.deadline) {
+			n.startElection(false)
+		}
+		n.mu.Unlock()
+	}
+}
+
+// startElection votes for itself and asks the other voters for their vote,
+// mu must be held. transfer is set when the leader hands over to the node.
+func (n *Node) startElection(transfer bool) {
+	n.state = Candidate
+	n.term++
+	n.votedFor = n.id
+	n.leader = ""
+	n.resetElectionTimer()
+	if err := n.saveState(); err != nil {
+		n.log.WithError(err).Error("failed to save raft state")
+		return
+	}
+	n.log.WithField("term", n.term).Info("starting election")
+	term, votes, voters := n.term, 1, n.voters()
+	if votes*2 > voters {
+		n.becomeLeader()
+		return
+	}
+	req := &pb.VoteRequest{Term: n.term, Candidate: n.id, LastIndex: n.storage.lastIndex(), LastTerm: n.storage.lastTerm(), Transfer: transfer}
+	for id, addr := range n.peers {
+		if id == n.id || n.learners[id] {
+			continue
+		}
+		go func(addr string) {
+			ctx, cancel := context.WithTimeout(context.Background(), n.election)
+			defer cancel()
+			resp, err := n.transport.RequestVote(ctx, addr, req)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if resp.Term > n.term {
+				n.stepDown(resp.Term)
+				return
+			}
+			if n.state != Candidate || n.term != term || !resp.Granted || n.stopped() {
+				return
+			}
+			votes++
+			if votes*2 > voters {
+				n.becomeLeader()
+			}
+		}(addr)
+	}
+}
+
+// becomeLeader takes over the log, mu must be held.
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leader = n.id
+	n.log.WithField("term", n.term).Info("elected leader")
+	// entries of earlier terms are only committed along with one of this
+	// term, so commit a no-op right away
+	e := &pb.RaftEntry{Index: n.storage.lastIndex() + 1, Term: n.term, Type: pb.RaftEntryType_ENTRY_NOOP}
+	if err := n.storage.append(e); err != nil {
+		n.log.WithError(err).Error("failed to append to the raft log")
+		n.stepDown(n.term)
+		return
+	}
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = map[string]uint64{n.id: e.Index}
+	n.acked = make(map[string]time.Time)
+	n.wake = make(map[string]chan struct{})
+	n.startReplicators()
+	n.advanceCommit()
+}
+
+// startReplicators starts replicating to the members that were added and
+// stops replicating to those removed, mu must be held by the leader.
+func (n *Node) startReplicators() {
+	for id := range n.peers {
+		if _, ok := n.wake[id]; ok || id == n.id {
+			continue
+		}
+		n.nextIndex[id] = n.storage.lastIndex()
+		n.wake[id] = make(chan struct{}, 1)
+		n.wg.Add(1)
+		go n.replicate(id, n.term, n.wake[id])
+	}
+	for id := range n.wake {
+		if _, ok := n.peers[id]; !ok {
+			delete(n.wake, id)
+			delete(n.nextIndex, id)
+			delete(n.matchIndex, id)
+			delete(n.acked, id)
+		}
+	}
+}
+
+// loadMembers takes the members from the last configuration in the log or
+// the snapshot, or those the group was formed with. mu must be held.
+func (n *Node) loadMembers() error {
+	members, index, err := n.storage.config()
+	if err != nil {
+		return err
+	}
+	if members == nil {
+		members = n.bootstrap
+	}
+	n.setMembers(members, index)
+	return nil
+}
+
+// setMembers makes members, from the configuration at index, the members of
+// the group. mu must be held.
+func (n *Node) setMembers(members []*pb.RaftMember, index uint64) {
+	n.members, n.configIndex = members, index
+	n.peers = make(map[string]string, len(members))
+	n.learners = make(map[string]bool)
+	for _, m := range members {
+		n.peers[m.Id] = m.Addr
+		if m.Learner {
+			n.learners[m.Id] = true
+		}
+	}
+	if n.state == Leader {
+		n.startReplicators()
+	}
+}
+
+// isVoter returns true if id is a member that votes, mu must be held.
+func (n *Node) isVoter(id string) bool {
+	_, ok := n.peers[id]
+	return ok && !n.learners[id]
+}
+
+// voters returns the number of members that vote, mu must be held.
+func (n *Node) voters() int {
+	return len(n.peers) - len(n.learners)
+}
+
+// wakeReplicators makes the replicators send new entries now, mu must be
+// held.
+func (n *Node) wakeReplicators() {
+	for _, ch := range n.wake {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// advanceCommit commits the entries stored by a majority, mu must be held.
+func (n *Node) advanceCommit() {
+	matches := make([]uint64, 0, len(n.peers))
+	for id := range n.peers {
+		if !n.learners[id] {
+			matches = append(matches, n.matchIndex[id])
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i] < matches[j] })
+	index := matches[(len(matches)-1)/2]
+	// only entries of the current term are committed by counting, earlier
+	// ones are committed with them
+	if term, ok := n.storage.term(index); index > n.commit && ok && term == n.term {
+		n.commit = index
+		n.signalApply()
+		n.wakeReplicators()
+		n.notify()
+	}
+}
+
+func (n *Node) signalApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+// replicate sends entries, or the snapshot, to a peer for as long as the
+// node leads in term and the peer is a member, woken up by wake.
+func (n *Node) replicate(peer string, term uint64, wake chan struct{}) {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		if n.state != Leader || n.term != term || n.wake[peer] != wake || n.stopped() {
+			n.mu.Unlock()
+			return
+		}
+		addr := n.peers[peer]
+		next := n.nextIndex[peer]
+		if next <= n.storage.snapshotIndex() {
+			n.mu.Unlock()
+			if err := n.sendSnapshot(peer, addr, term); err != nil {
+				n.log.WithError(err).WithField("peer", peer).Warn("failed to send snapshot")
+				n.wait(wake, n.heartbeat)
+			}
+			continue
+		}
+		prevTerm, _ := n.storage.term(next - 1)
+		req := &pb.AppendRequest{
+			Term:      term,
+			Leader:    n.id,
+			PrevIndex: next - 1,
+			PrevTerm:  prevTerm,
+			Entries:   n.storage.slice(next, maxAppend, n.appendSize),
+			Commit:    n.commit,
+		}
+		n.mu.Unlock()
+
+		sent := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), n.election)
+		resp, err := n.transport.AppendEntries(ctx, addr, req)
+		cancel()
+		if err != nil {
+			n.wait(wake, n.heartbeat)
+			continue
+		}
+		n.mu.Lock()
+		if resp.Term > n.term {
+			n.stepDown(resp.Term)
+			n.mu.Unlock()
+			return
+		}
+		if n.state != Leader || n.term != term || n.wake[peer] != wake {
+			n.mu.Unlock()
+			return
+		}
+		// the peer acknowledges the leader even if its log does not match
+		if sent.After(n.acked[peer]) {
+			n.acked[peer] = sent
+			n.notify()
+		}
+		more := false
+		if resp.Success {
+			match := req.PrevIndex + uint64(len(req.Entries))
+			if match > n.matchIndex[peer] {
+				n.matchIndex[peer] = match
+			}
+			n.nextIndex[peer] = match + 1
+			n.advanceCommit()
+			more = match < n.storage.lastIndex()
+		} else {
+			// back up to where the logs may agree, at least one entry
+			next := resp.Hint + 1
+			if next >= req.PrevIndex+1 {
+				next = req.PrevIndex
+			}
+			if next < 1 {
+				next = 1
+			}
+			n.nextIndex[peer] = next
+			more = true
+		}
+		n.mu.Unlock()
+		if !more {
+			n.wait(wake, n.heartbeat)
+		}
+	}
+}
+
+// wait waits for d, a wake-up or the node to stop.
+func (n *Node) wait(wake chan struct{}, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-wake:
+	case <-t.C:
+	case <-n.stop:
+	}
+}
+
+// sendSnapshot sends the last snapshot to a peer.
+func (n *Node) sendSnapshot(peer, addr string, term uint64) error {
+	n.snapMu.Lock()
+	meta, r, err := n.storage.openSnapshot("snapshot")
+	n.snapMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n.log.WithFields(logrus.Fields{"peer": peer, "index": meta.Index}).Info("sending snapshot")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-n.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	first := &pb.SnapshotChunk{Term: term, Leader: n.id, Index: meta.Index, LastTerm: meta.Term, Members: meta.Members}
+	resp, err := n.transport.InstallSnapshot(ctx, addr, first, r)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return nil
+	}
+	if _, ok := n.wake[peer]; ok && n.state == Leader && n.term == term {
+		if meta.Index > n.matchIndex[peer] {
+			n.matchIndex[peer] = meta.Index
+		}
+		n.nextIndex[peer] = meta.Index + 1
+		n.notify()
+	}
+	return nil
+}
+
+// applier applies committed entries in order.
+func (n *Node) applier() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.applyCh:
+		}
+		for n.applyBatch() {
+		}
+		if n.threshold > 0 {
+			n.mu.Lock()
+			due := n.applied-n.storage.snapshotIndex() >= n.threshold
+			n.mu.Unlock()
+			if due {
+				if err := n.Snapshot(); err != nil {
+					n.log.WithError(err).Error("failed to snapshot")
+				}
+			}
+		}
+	}
+}
+
+// applyBatch applies some committed entries, returning false once there are
+// none left.
+func (n *Node) applyBatch() bool {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	if n.applied >= n.commit || n.stopped() {
+		n.mu.Unlock()
+		return false
+	}
+	entries := n.storage.slice(n.applied+1, int(n.commit-n.applied), 0)
+	n.mu.Unlock()
+	for _, e := range entries {
+		var result interface{}
+		switch e.Type {
+		case pb.RaftEntryType_ENTRY_COMMAND:
+			result = n.fsm.Apply(e.Index, e.Data)
+		case pb.RaftEntryType_ENTRY_CONFIG:
+			n.appliedMembers, _ = decodeConfig(e.Data) // checked when stored
+		}
+		n.mu.Lock()
+		n.applied = e.Index
+		n.notify()
+		if p, ok := n.waiters[e.Index]; ok {
+			delete(n.waiters, e.Index)
+			if p.term == e.Term {
+				p.result = result
+			} else {
+				p.err = ErrLeadershipLost // replaced by another leader's entry
+			}
+			close(p.done)
+		}
+		// a leader that removed itself hands over once the change is applied
+		if n.state == Leader && e.Index == n.configIndex && !n.isVoter(n.id) {
+			n.stepDown(n.term)
+		}
+		n.mu.Unlock()
+	}
+	return true
+}
+
+// Snapshot snapshots the state machine and compacts the log up to the last
+// entry applied. Both are rewritten even if nothing was applied since the
+// last snapshot, e.g. to encrypt them with a new key.
+func (n *Node) Snapshot() error {
+	n.snapMu.Lock()
+	defer n.snapMu.Unlock()
+	n.applyMu.Lock()
+	members := n.appliedMembers
+	n.mu.Lock()
+	index := n.applied
+	term, _ := n.storage.term(index)
+	n.mu.Unlock()
+	if index == 0 {
+		n.applyMu.Unlock()
+		return nil
+	}
+	snap, err := n.fsm.Snapshot()
+	n.applyMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	// written while later entries are applied
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(snap.Persist(pw))
+	}()
+	err = n.storage.saveSnapshot("snapshot", &pb.RaftSnapshotMeta{Index: index, Term: term, Members: members}, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if index < n.storage.snapshotIndex() {
+		return nil // a snapshot installed meanwhile is newer
+	}
+	n.log.WithFields(logrus.Fields{"index": index, "term": term}).Info("compacted raft log")
+	return n.storage.compact(index, term, members)
+}
+
+// HandleVote answers a RequestVote RPC.
+func (n *Node) HandleVote(req *pb.VoteRequest) (*pb.VoteResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return nil, ErrStopped
+	}
+	// a node that heard from a leader, or started, within the election
+	// timeout does not help depose it, which leader leases rely on
+	if now := time.Now(); !req.Transfer && (now.Before(n.contact.Add(n.election)) || now.Before(n.started.Add(n.election))) {
+		return &pb.VoteResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term {
+		n.stepDown(req.Term)
+	}
+	resp := &pb.VoteResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp, nil
+	}
+	// only vote for candidates whose log holds every committed entry
+	upToDate := req.LastTerm > n.storage.lastTerm() ||
+		(req.LastTerm == n.storage.lastTerm() && req.LastIndex >= n.storage.lastIndex())
+	if (n.votedFor == "" || n.votedFor == req.Candidate) && upToDate {
+		n.votedFor = req.Candidate
+		if err := n.saveState(); err != nil {
+			return nil, err
+		}
+		n.resetElectionTimer()
+		resp.Granted = true
+	}
+	return resp, nil
+}
+
+// HandleAppend answers an AppendEntries RPC.
+func (n *Node) HandleAppend(req *pb.AppendRequest) (*pb.AppendResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return nil, ErrStopped
+	}
+	resp := &pb.AppendResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp, nil
+	}
+	n.stepDown(req.Term)
+	resp.Term = n.term
+	n.leader = req.Leader
+	n.contact, n.leaderCommit = time.Now(), req.Commit
+	n.resetElectionTimer()
+
+	prev, entries := req.PrevIndex, req.Entries
+	if first := n.storage.snapshotIndex(); prev < first {
+		// the entries up to the snapshot are committed and match
+		skip := first - prev
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		prev, entries = first, entries[skip:]
+	} else if prev > n.storage.lastIndex() {
+		resp.Hint = n.storage.lastIndex()
+		return resp, nil
+	} else if term, _ := n.storage.term(prev); term != req.PrevTerm {
+		// skip the whole conflicting term
+		hint := prev - 1
+		for hint > n.storage.snapshotIndex() {
+			if t, _ := n.storage.term(hint); t != term {
+				break
+			}
+			hint--
+		}
+		resp.Hint = hint
+		return resp, nil
+	}
+
+	for i, e := range entries {
+		if term, ok := n.storage.term(e.Index); ok {
+			if term == e.Term {
+				continue
+			}
+			if e.Index <= n.commit {
+				return nil, ErrCorrupt // never happens unless safety is broken
+			}
+			if err := n.storage.truncate(e.Index - 1); err != nil {
+				return nil, err
+			}
+		}
+		if err := n.storage.append(entries[i:]...); err != nil {
+			return nil, err
+		}
+		// the members may have changed with the entries appended or those
+		// truncated
+		if err := n.loadMembers(); err != nil {
+			return nil, err
+		}
+		break
+	}
+	if last := prev + uint64(len(entries)); req.Commit > n.commit && last > n.commit {
+		n.commit = req.Commit
+		if n.commit > last {
+			n.commit = last
+		}
+		n.signalApply()
+	}
+	resp.Success = true
+	return resp, nil
+}
+
+// HandleSnapshot answers an InstallSnapshot RPC, first being its first chunk
+// and data the snapshot.
+func (n *Node) HandleSnapshot(first *pb.SnapshotChunk, data io.Reader) (*pb.InstallSnapshotResponse, error) {
+	n.mu.Lock()
+	if n.stopped() {
+		n.mu.Unlock()
+		return nil, ErrStopped
+	}
+	resp := &pb.InstallSnapshotResponse{Term: n.term}
+	if first.Term < n.term {
+		n.mu.Unlock()
+		return resp, nil
+	}
+	n.stepDown(first.Term)
+	resp.Term = n.term
+	n.leader = first.Leader
+	n.contact, n.leaderCommit = time.Now(), first.Index
+	n.resetElectionTimer()
+	n.mu.Unlock()
+
+	n.snapMu.Lock()
+	defer n.snapMu.Unlock()
+	// a large snapshot must not time the leader out
+	meta := &pb.RaftSnapshotMeta{Index: first.Index, Term: first.LastTerm, Members: first.Members}
+	err := n.storage.saveSnapshot("snapshot.recv", meta, &keepAlive{data, n})
+	if err != nil {
+		return nil, err
+	}
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	if first.Index <= n.applied {
+		n.mu.Unlock()
+		return resp, nil // already has it
+	}
+	if err := n.storage.installSnapshot(); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	if err := n.storage.compact(first.Index, first.LastTerm, first.Members); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	if err := n.loadMembers(); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	n.mu.Unlock()
+
+	_, r, err := n.storage.openSnapshot("snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if err := n.fsm.Restore(r); err != nil {
+		return nil, err
+	}
+	n.appliedMembers = first.Members
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.applied = first.Index
+	if n.commit < first.Index {
+		n.commit = first.Index
+	}
+	n.notify()
+	n.log.WithFields(logrus.Fields{"index": first.Index, "leader": first.Leader}).Info("installed snapshot")
+	return resp, nil
+}
+
+// keepAlive resets the election timer while a snapshot is received.
+type keepAlive struct {
+	r io.Reader
+	n *Node
+}
+
+func (k *keepAlive) Read(p []byte) (int, error) {
+	k.n.mu.Lock()
+	k.n.contact = time.Now()
+	k.n.resetElectionTimer()
+	k.n.mu.Unlock()
+	return k.r.Read(p)
+}
@@ -0,0 +1,493 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// kv is a state machine of "key=value" commands.
+type kv struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newKV() *kv {
+	return &kv{data: make(map[string]string)}
+}
+
+func (m *kv) Apply(index uint64, command []byte) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kv := strings.SplitN(string(command), "=", 2)
+	m.data[kv[0]] = kv[1]
+	return len(m.data)
+}
+
+func (m *kv) get(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key]
+}
+
+type kvSnapshot map[string]string
+
+func (s kvSnapshot) Persist(w io.Writer) error { return json.NewEncoder(w).Encode(s) }
+func (s kvSnapshot) Release()                  {}
+
+func (m *kv) Snapshot() (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := make(kvSnapshot, len(m.data))
+	for k, v := range m.data {
+		s[k] = v
+	}
+	return s, nil
+}
+
+func (m *kv) Restore(r io.Reader) error {
+	data := make(map[string]string)
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = data
+	return nil
+}
+
+// cluster runs nodes on loopback, each with its own gRPC server.
+type cluster struct {
+	t         *testing.T
+	dir       string
+	peers     map[string]string
+	listeners map[string]net.Listener
+	nodes     map[string]*Node
+	fsms      map[string]*kv
+	servers   map[string]*grpc.Server
+	threshold uint64
+	// beforeTimeoutNow, if set, is called before a node sends TimeoutNow
+	// and fails it with its error
+	beforeTimeoutNow func() error
+}
+
+// hookedTransport calls the hooks of the cluster.
+type hookedTransport struct {
+	Transport
+	c *cluster
+}
+
+func (t hookedTransport) TimeoutNow(ctx context.Context, addr string, req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error) {
+	if t.c.beforeTimeoutNow != nil {
+		if err := t.c.beforeTimeoutNow(); err != nil {
+			return nil, err
+		}
+	}
+	return t.Transport.TimeoutNow(ctx, addr, req)
+}
+
+func newCluster(t *testing.T, size int, threshold uint64) *cluster {
+	dir, _ := ioutil.TempDir("", "keev-raft")
+	c := &cluster{t: t, dir: dir, peers: make(map[string]string), listeners: make(map[string]net.Listener),
+		nodes: make(map[string]*Node), fsms: make(map[string]*kv), servers: make(map[string]*grpc.Server), threshold: threshold}
+	for i := 0; i < size; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %s", err.Error())
+		}
+		id := fmt.Sprintf("n%d", i)
+		c.peers[id], c.listeners[id] = lis.Addr().String(), lis
+	}
+	for id := range c.peers {
+		c.start(id)
+	}
+	return c
+}
+
+// start starts the node id, reusing its address and storage.
+func (c *cluster) start(id string) {
+	c.startNode(id, false)
+}
+
+// join starts a new node waiting to be added to the group.
+func (c *cluster) join(id string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.t.Fatalf("failed to listen: %s", err.Error())
+	}
+	c.peers[id], c.listeners[id] = lis.Addr().String(), lis
+	c.startNode(id, true)
+}
+
+func (c *cluster) startNode(id string, join bool) {
+	lis := c.listeners[id]
+	if lis == nil {
+		var err error
+		if lis, err = net.Listen("tcp", c.peers[id]); err != nil {
+			c.t.Fatalf("failed to listen again: %s", err.Error())
+		}
+	}
+	c.listeners[id] = nil
+	fsm := newKV()
+	n, err := New(Config{
+		ID:                id,
+		Peers:             c.peers,
+		Join:              join,
+		Dir:               filepath.Join(c.dir, id),
+		Transport:         hookedTransport{NewGRPCTransport(grpc.WithInsecure()), c},
+		StateMachine:      fsm,
+		HeartbeatInterval: 20 * time.Millisecond,
+		ElectionTimeout:   150 * time.Millisecond,
+		SnapshotEntries:   c.threshold,
+	})
+	if err != nil {
+		c.t.Fatalf("failed to create node %s: %s", id, err.Error())
+	}
+	service := NewService()
+	service.Attach(n)
+	server := grpc.NewServer()
+	pb.RegisterRaftServer(server, service)
+	go server.Serve(lis)
+	n.Start()
+	c.nodes[id], c.fsms[id], c.servers[id] = n, fsm, server
+}
+
+// stop stops the node id, as if it crashed.
+func (c *cluster) stop(id string) {
+	c.servers[id].Stop()
+	c.nodes[id].Stop()
+	delete(c.nodes, id)
+}
+
+func (c *cluster) close() {
+	for id := range c.nodes {
+		c.stop(id)
+	}
+	os.RemoveAll(c.dir)
+}
+
+// leader waits for a single running node to lead.
+func (c *cluster) leader() *Node {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var leaders []*Node
+		for _, n := range c.nodes {
+			if n.IsLeader() {
+				leaders = append(leaders, n)
+			}
+		}
+		if len(leaders) == 1 {
+			return leaders[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatalf("no leader elected")
+	return nil
+}
+
+func (c *cluster) propose(command string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		_, err := c.leader().Propose(ctx, []byte(command))
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			c.t.Fatalf("failed to propose %q: %s", command, err.Error())
+		}
+		time.Sleep(10 * time.Millisecond) // leadership changed
+	}
+}
+
+// converge waits for every running node to have key set to value.
+func (c *cluster) converge(key, value string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for id := range c.nodes {
+		for c.fsms[id].get(key) != value {
+			if time.Now().After(deadline) {
+				c.t.Fatalf("node %s has %s=%q, expected %q", id, key, c.fsms[id].get(key), value)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func Test_ReplicateAndFailover(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	defer c.close()
+
+	leader := c.leader()
+	result, err := leader.Propose(context.Background(), []byte("a=1"))
+	if err != nil || result.(int) != 1 {
+		t.Fatalf("expected the command to be applied, got %v, %v", result, err)
+	}
+	c.converge("a", "1")
+	for _, n := range c.nodes {
+		if n != leader {
+			if _, err := n.Propose(context.Background(), []byte("b=2")); err != ErrNotLeader {
+				t.Fatalf("expected a follower to refuse proposals, got %v", err)
+			}
+			if id, addr := n.Leader(); id != leader.ID() || addr != c.peers[id] {
+				t.Fatalf("expected the follower to know the leader, got %s at %s", id, addr)
+			}
+		}
+	}
+
+	// the others elect a new leader and keep going
+	old := leader.ID()
+	c.stop(old)
+	c.propose("a=2")
+	if c.leader().ID() == old {
+		t.Fatalf("expected a new leader")
+	}
+	c.converge("a", "2")
+
+	// the old leader catches up from the log when it comes back
+	c.start(old)
+	c.converge("a", "2")
+	if s := c.nodes[old].Status(); s.State != Follower || s.Term < 2 {
+		t.Fatalf("unexpected status of the restarted node: %+v", s)
+	}
+}
+
+func Test_CompactAndInstallSnapshot(t *testing.T) {
+	c := newCluster(t, 3, 10)
+	defer c.close()
+
+	leader := c.leader()
+	var lagging string
+	for id := range c.nodes {
+		if id != leader.ID() {
+			lagging = id
+			break
+		}
+	}
+	c.stop(lagging)
+	for i := 0; i < 50; i++ {
+		c.propose(fmt.Sprintf("k%d=%d", i, i))
+	}
+	c.converge("k49", "49")
+	if s := c.leader().Status(); s.SnapshotIndex == 0 || s.LastIndex-s.SnapshotIndex > 20 {
+		t.Fatalf("expected the log to be compacted, got %+v", s)
+	}
+
+	// the entries it is missing are gone, it is sent the snapshot
+	c.start(lagging)
+	c.converge("k49", "49")
+	if v := c.fsms[lagging].get("k0"); v != "0" {
+		t.Fatalf("expected the snapshot to be installed, got k0=%q", v)
+	}
+	c.propose("after=1")
+	c.converge("after", "1")
+}
+
+func Test_RestartAll(t *testing.T) {
+	c := newCluster(t, 3, 5)
+	defer c.close()
+
+	for i := 0; i < 8; i++ {
+		c.propose(fmt.Sprintf("k%d=%d", i, i))
+	}
+	c.converge("k7", "7")
+	ids := make([]string, 0, len(c.nodes))
+	for id := range c.nodes {
+		ids = append(ids, id)
+	}
+	terms := make(map[string]uint64)
+	for _, id := range ids {
+		terms[id] = c.nodes[id].Status().Term
+		c.stop(id)
+	}
+	for _, id := range ids {
+		c.start(id)
+		if s := c.nodes[id].Status(); s.Term != terms[id] || s.AppliedIndex == 0 {
+			t.Fatalf("expected the term and snapshot to survive a restart, got %+v", s)
+		}
+	}
+	c.converge("k7", "7")
+	c.propose("k8=8")
+	c.converge("k8", "8")
+	c.converge("k0", "0")
+}
+
+func Test_SingleNode(t *testing.T) {
+	c := newCluster(t, 1, 0)
+	defer c.close()
+
+	c.propose("a=1")
+	c.converge("a", "1")
+	if err := c.leader().Snapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+	if s := c.leader().Status(); s.SnapshotIndex != s.AppliedIndex || s.LastIndex != s.AppliedIndex {
+		t.Fatalf("expected the whole log to be compacted, got %+v", s)
+	}
+}
+
+func Test_Reads(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	defer c.close()
+
+	leader := c.leader()
+	c.propose("a=1")
+	ctx := context.Background()
+	for _, lease := range []bool{false, true} {
+		index, err := leader.ReadIndex(ctx, lease)
+		if err != nil || index < 2 || c.fsms[leader.ID()].get("a") != "1" {
+			t.Fatalf("expected a linearizable read of a=1, got index %d, %v", index, err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // a heartbeat tells the followers a=1 is committed
+	for id, n := range c.nodes {
+		if n == leader {
+			continue
+		}
+		if _, err := n.ReadIndex(ctx, false); err != ErrNotLeader {
+			t.Fatalf("expected a follower to refuse linearizable reads, got %v", err)
+		}
+		if _, err := n.ReadStale(ctx, time.Second); err != nil || c.fsms[id].get("a") != "1" {
+			t.Fatalf("expected a follower to serve a=1, got %q, %v", c.fsms[id].get("a"), err)
+		}
+		if _, err := n.ReadStale(ctx, 0); err != ErrStale {
+			t.Fatalf("expected the follower to be too stale, got %v", err)
+		}
+	}
+
+	// cut off from the others, the leader can no longer confirm it leads
+	for id, n := range c.nodes {
+		if n != leader {
+			c.stop(id)
+		}
+	}
+	time.Sleep(200 * time.Millisecond) // past the lease
+	for _, lease := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err := leader.ReadIndex(ctx, lease)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected an isolated leader to block reads, got %v", err)
+		}
+	}
+	if _, err := leader.ReadStale(ctx, 100*time.Millisecond); err != ErrStale {
+		t.Fatalf("expected an isolated leader to be too stale, got %v", err)
+	}
+}
+
+func Test_ReadsDuringTransfer(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	defer c.close()
+
+	leader := c.leader()
+	c.propose("a=1")
+	var target string
+	for id := range c.nodes {
+		if id != leader.ID() {
+			target = id
+		}
+	}
+	// the target may win as soon as it is told to campaign, with the leader
+	// cut off from the others and still holding its lease
+	var readErr error
+	c.beforeTimeoutNow = func() error {
+		for id := range c.nodes {
+			if id != leader.ID() {
+				c.servers[id].Stop()
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, readErr = leader.ReadIndex(ctx, true)
+		return errors.New("cut off")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := leader.TransferLeadership(ctx, target); err == nil {
+		t.Fatalf("expected the transfer to fail")
+	}
+	if readErr != context.DeadlineExceeded {
+		t.Fatalf("expected the leader to stop serving reads from its lease, got %v", readErr)
+	}
+}
+
+func Test_Membership(t *testing.T) {
+	c := newCluster(t, 3, 5)
+	defer c.close()
+
+	for i := 0; i < 10; i++ {
+		c.propose(fmt.Sprintf("k%d=%d", i, i))
+	}
+	// the learner starts empty and is sent the snapshot
+	c.join("n3")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	leader := c.leader()
+	if err := leader.AddLearner(ctx, "n3", c.peers["n3"]); err != nil {
+		t.Fatalf("failed to add a learner: %s", err.Error())
+	}
+	if err := leader.AddLearner(ctx, "n3", c.peers["n3"]); err != ErrMemberExists {
+		t.Fatalf("expected the learner to exist, got %v", err)
+	}
+	c.converge("k9", "9")
+	if m := c.nodes["n3"].Members(); len(m) != 4 || !m[3].Learner {
+		t.Fatalf("expected the learner to know the members, got %+v", m)
+	}
+	if err := leader.Promote(ctx, "n3"); err != nil {
+		t.Fatalf("failed to promote: %s", err.Error())
+	}
+	for _, p := range leader.Status().Members {
+		if p.Learner || p.Match == 0 {
+			t.Fatalf("expected 4 voters caught up, got %+v", leader.Status().Members)
+		}
+	}
+
+	// a voter is removed, the others keep going without it
+	var removed string
+	for id := range c.nodes {
+		if id != leader.ID() && id != "n3" {
+			removed = id
+			break
+		}
+	}
+	if err := leader.RemoveMember(ctx, removed); err != nil {
+		t.Fatalf("failed to remove %s: %s", removed, err.Error())
+	}
+	c.stop(removed)
+	c.propose("after=1")
+	c.converge("after", "1")
+
+	// leadership is handed over to the new node
+	if err := c.leader().TransferLeadership(ctx, "n3"); err != nil {
+		t.Fatalf("failed to transfer leadership: %s", err.Error())
+	}
+	if c.leader().ID() != "n3" {
+		t.Fatalf("expected n3 to lead, got %s", c.leader().ID())
+	}
+	c.propose("after=2")
+	c.converge("after", "2")
+
+	// the leader removes itself and steps down
+	if err := c.nodes["n3"].RemoveMember(ctx, "n3"); err != nil {
+		t.Fatalf("failed to remove the leader: %s", err.Error())
+	}
+	c.stop("n3")
+	c.propose("after=3")
+	c.converge("after", "3")
+	if m := c.leader().Members(); len(m) != 2 {
+		t.Fatalf("expected 2 members left, got %+v", m)
+	}
+}
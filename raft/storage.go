@@ -0,0 +1,470 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/imjching/keev/protobuf"
+)
+
+// ErrCorrupt is returned when the log or the snapshot of a node is damaged
+// anywhere but at the end of the log.
+var ErrCorrupt = errors.New("raft: corrupt storage")
+
+// errEncrypted is returned when an encrypted entry is read without a Cipher.
+var errEncrypted = errors.New("raft: log is encrypted")
+
+// Record flags, as in package wal.
+const (
+	plain  = 0
+	sealed = 1
+)
+
+// maxRecord guards against allocating a huge buffer for a damaged length.
+const maxRecord = 1 << 30
+
+// Cipher encrypts log entries, see encrypt.KeyRing.
+type Cipher interface {
+	Seal(plain []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+// hardState is what a node must remember across restarts besides its log.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+// storage keeps the state, the log and the snapshot of a node in a
+// directory:
+//
+//	state     the current term and vote, as JSON
+//	log       the entries after the snapshot, as records like the write log
+//	snapshot  a RaftSnapshotMeta record followed by the state machine's data
+//
+// The entries are also held in memory: the log only grows until the next
+// snapshot compacts it. storage is not safe for concurrent use.
+type storage struct {
+	dir    string
+	cipher Cipher
+	file   *os.File
+	// entries[0] is a placeholder for the last entry in the snapshot, the
+	// log starts at entries[1]
+	entries []*pb.RaftEntry
+	offsets []int64 // in the log file, of each entry, offsets[0] is unused
+	size    int64
+	members []*pb.RaftMember // of the snapshot, nil if the group never changed
+}
+
+func (s *storage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// openStorage reads the storage in dir, creating it if needed. A record cut
+// short at the end of the log is removed.
+func openStorage(dir string, c Cipher) (*storage, hardState, error) {
+	var state hardState
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, state, err
+	}
+	s := &storage{dir: dir, cipher: c}
+	if b, err := ioutil.ReadFile(s.path("state")); err == nil {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return nil, state, ErrCorrupt
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, state, err
+	}
+	meta, err := s.snapshotMeta("snapshot")
+	if os.IsNotExist(err) {
+		meta, err = &pb.RaftSnapshotMeta{}, nil
+	}
+	if err != nil {
+		return nil, state, err
+	}
+	s.entries = []*pb.RaftEntry{{Index: meta.Index, Term: meta.Term}}
+	s.offsets = []int64{0}
+	s.members = meta.Members
+
+	file, err := os.OpenFile(s.path("log"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, state, err
+	}
+	r := bufio.NewReader(file)
+	for {
+		b, n, err := readRecord(r, c)
+		if err == io.EOF || err == errTorn {
+			break // drop the torn record, it was never acknowledged
+		}
+		if err != nil {
+			file.Close()
+			return nil, state, err
+		}
+		e := &pb.RaftEntry{}
+		if err := proto.Unmarshal(b, e); err != nil {
+			file.Close()
+			return nil, state, ErrCorrupt
+		}
+		// entries already in the snapshot remain if a crash came between
+		// saving it and compacting the log
+		if e.Index > s.lastIndex() {
+			if e.Index != s.lastIndex()+1 {
+				file.Close()
+				return nil, state, ErrCorrupt
+			}
+			s.entries = append(s.entries, e)
+			s.offsets = append(s.offsets, s.size)
+		}
+		s.size += n
+	}
+	if err := file.Truncate(s.size); err != nil {
+		file.Close()
+		return nil, state, err
+	}
+	if _, err := file.Seek(s.size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, state, err
+	}
+	s.file = file
+	return s, state, nil
+}
+
+var errTorn = errors.New("raft: torn record")
+
+// readRecord reads a record, returning its payload and its size on disk.
+func readRecord(r *bufio.Reader, c Cipher) ([]byte, int64, error) {
+	length, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil || length == 0 || length > maxRecord {
+		return nil, 0, errTorn
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], length)
+	record := make([]byte, int(length)+4)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, 0, errTorn
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(prefix[:n])
+	crc.Write(record[:length])
+	if crc.Sum32() != binary.BigEndian.Uint32(record[length:]) {
+		return nil, 0, errTorn
+	}
+	b := record[1:length]
+	switch record[0] {
+	case plain:
+	case sealed:
+		if c == nil {
+			return nil, 0, errEncrypted
+		}
+		if b, err = c.Open(b); err != nil {
+			return nil, 0, err
+		}
+	default:
+		return nil, 0, ErrCorrupt
+	}
+	return b, int64(n) + int64(len(record)), nil
+}
+
+// encodeRecord encodes m as a record, encrypted if c is not nil.
+func encodeRecord(m proto.Message, c Cipher) ([]byte, error) {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	flag := byte(plain)
+	if c != nil {
+		if b, err = c.Seal(b); err != nil {
+			return nil, err
+		}
+		flag = sealed
+	}
+	record := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+1+len(b)+4)
+	record = append(record[:binary.PutUvarint(record, uint64(1+len(b)))], flag)
+	record = append(record, b...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(record))
+	return append(record, crc[:]...), nil
+}
+
+// writeFile replaces the file name through a temporary file and syncs it.
+func (s *storage) writeFile(name string, write func(w io.Writer) error) error {
+	tmp := s.path(name + ".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	err = write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path(name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if dir, err := os.Open(s.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// saveState persists the term and vote.
+func (s *storage) saveState(state hardState) error {
+	return s.writeFile("state", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+}
+
+func (s *storage) snapshotIndex() uint64 {
+	return s.entries[0].Index
+}
+
+func (s *storage) lastIndex() uint64 {
+	return s.entries[len(s.entries)-1].Index
+}
+
+func (s *storage) lastTerm() uint64 {
+	return s.entries[len(s.entries)-1].Term
+}
+
+// term returns the term of the entry at index, false if it was compacted
+// or is past the end of the log.
+func (s *storage) term(index uint64) (uint64, bool) {
+	first := s.snapshotIndex()
+	if index < first || index > s.lastIndex() {
+		return 0, false
+	}
+	return s.entries[index-first].Term, true
+}
+
+// slice returns at most max entries from index from on, and at most bytes
+// of data unless bytes is 0, but at least one entry. The entries must not be
+// changed.
+func (s *storage) slice(from uint64, max, bytes int) []*pb.RaftEntry {
+	first := s.snapshotIndex()
+	if from <= first || from > s.lastIndex() {
+		return nil
+	}
+	entries := s.entries[from-first:]
+	if len(entries) > max {
+		entries = entries[:max]
+	}
+	if bytes > 0 {
+		size := 0
+		for i, e := range entries {
+			if size += len(e.Data); size > bytes && i > 0 {
+				entries = entries[:i]
+				break
+			}
+		}
+	}
+	return append([]*pb.RaftEntry(nil), entries...)
+}
+
+// append writes entries following the last one and syncs them.
+func (s *storage) append(entries ...*pb.RaftEntry) error {
+	var buf []byte
+	offsets := make([]int64, len(entries))
+	for i, e := range entries {
+		record, err := encodeRecord(e, s.cipher)
+		if err != nil {
+			return err
+		}
+		offsets[i] = s.size + int64(len(buf))
+		buf = append(buf, record...)
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		// leave no partial record behind the entries kept in memory
+		s.file.Truncate(s.size)
+		s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, entries...)
+	s.offsets = append(s.offsets, offsets...)
+	s.size += int64(len(buf))
+	return nil
+}
+
+// truncate removes the entries after index, which must not be compacted.
+func (s *storage) truncate(index uint64) error {
+	if index >= s.lastIndex() {
+		return nil
+	}
+	i := index - s.snapshotIndex() + 1
+	size := s.offsets[i]
+	if err := s.file.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	s.entries, s.offsets, s.size = s.entries[:i], s.offsets[:i], size
+	return nil
+}
+
+// compact drops the entries up to index, which a snapshot holds along with
+// members, and rewrites the log with the rest. If the log does not hold index
+// with term, the whole log is dropped: it conflicts with the snapshot.
+func (s *storage) compact(index, term uint64, members []*pb.RaftMember) error {
+	var rest []*pb.RaftEntry
+	if t, ok := s.term(index); ok && t == term {
+		rest = s.entries[index-s.snapshotIndex()+1:]
+	}
+	offsets := []int64{0}
+	var size int64
+	err := s.writeFile("log", func(w io.Writer) error {
+		for _, e := range rest {
+			record, err := encodeRecord(e, s.cipher)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+			offsets = append(offsets, size)
+			size += int64(len(record))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path("log"), os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	s.file.Close()
+	s.file = file
+	s.entries = append([]*pb.RaftEntry{{Index: index, Term: term}}, rest...)
+	s.offsets, s.size = offsets, size
+	s.members = members
+	return nil
+}
+
+// config returns the members in the last configuration entry of the log and
+// its index, or those of the snapshot if there is none, nil if the group
+// never changed.
+func (s *storage) config() ([]*pb.RaftMember, uint64, error) {
+	for i := len(s.entries) - 1; i > 0; i-- {
+		if e := s.entries[i]; e.Type == pb.RaftEntryType_ENTRY_CONFIG {
+			members, err := decodeConfig(e.Data)
+			return members, e.Index, err
+		}
+	}
+	return s.members, s.snapshotIndex(), nil
+}
+
+func decodeConfig(data []byte) ([]*pb.RaftMember, error) {
+	c := &pb.RaftConfig{}
+	if err := proto.Unmarshal(data, c); err != nil {
+		return nil, ErrCorrupt
+	}
+	return c.Members, nil
+}
+
+// saveSnapshot writes a snapshot to the file name, "snapshot" or a file
+// renamed to it once it is checked.
+func (s *storage) saveSnapshot(name string, meta *pb.RaftSnapshotMeta, data io.Reader) error {
+	return s.writeFile(name, func(w io.Writer) error {
+		record, err := encodeRecord(meta, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		_, err = io.Copy(w, data)
+		return err
+	})
+}
+
+// openSnapshot returns the metadata of the snapshot in the file name and a
+// reader of its data, which must be closed.
+func (s *storage) openSnapshot(name string) (*pb.RaftSnapshotMeta, io.ReadCloser, error) {
+	file, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(file)
+	b, _, err := readRecord(r, nil)
+	meta := &pb.RaftSnapshotMeta{}
+	if err == nil {
+		err = proto.Unmarshal(b, meta)
+	}
+	if err != nil {
+		file.Close()
+		if err == io.EOF || err == errTorn {
+			err = ErrCorrupt
+		}
+		return nil, nil, err
+	}
+	return meta, readCloser{r, file}, nil
+}
+
+// installSnapshot makes the snapshot received from the leader the snapshot
+// of the node. The log must be compacted after it.
+func (s *storage) installSnapshot() error {
+	if err := os.Rename(s.path("snapshot.recv"), s.path("snapshot")); err != nil {
+		return err
+	}
+	if dir, err := os.Open(s.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// snapshotSize returns the size of the snapshot file, 0 if there is none.
+func (s *storage) snapshotSize() int64 {
+	info, err := os.Stat(s.path("snapshot"))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (s *storage) snapshotMeta(name string) (*pb.RaftSnapshotMeta, error) {
+	meta, r, err := s.openSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	r.Close()
+	return meta, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (s *storage) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,214 @@
+package raft
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the largest chunk of a snapshot sent in one message.
+const chunkSize = 64 << 10
+
+// Transport sends the RPCs of a node to the node at addr.
+type Transport interface {
+	RequestVote(ctx context.Context, addr string, req *pb.VoteRequest) (*pb.VoteResponse, error)
+	AppendEntries(ctx context.Context, addr string, req *pb.AppendRequest) (*pb.AppendResponse, error)
+	// InstallSnapshot sends a snapshot, described by first, and its data.
+	InstallSnapshot(ctx context.Context, addr string, first *pb.SnapshotChunk, data io.Reader) (*pb.InstallSnapshotResponse, error)
+	TimeoutNow(ctx context.Context, addr string, req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error)
+}
+
+// GRPCTransport is a Transport over the Raft gRPC service, see Service.
+type GRPCTransport struct {
+	opts  []grpc.DialOption
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewGRPCTransport returns a transport dialing the nodes with opts.
+func NewGRPCTransport(opts ...grpc.DialOption) *GRPCTransport {
+	// a node coming back must be reached before its election timeout, not
+	// after the default backoff of up to two minutes
+	opts = append([]grpc.DialOption{grpc.WithBackoffMaxDelay(time.Second)}, opts...)
+	return &GRPCTransport{opts: opts, conns: make(map[string]*grpc.ClientConn)}
+}
+
+// client returns a client of the node at addr, reusing its connection.
+func (t *GRPCTransport) client(addr string) (pb.RaftClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, ok := t.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = grpc.Dial(addr, t.opts...); err != nil {
+			return nil, err
+		}
+		t.conns[addr] = conn
+	}
+	return pb.NewRaftClient(conn), nil
+}
+
+func (t *GRPCTransport) RequestVote(ctx context.Context, addr string, req *pb.VoteRequest) (*pb.VoteResponse, error) {
+	c, err := t.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.RequestVote(ctx, req)
+}
+
+func (t *GRPCTransport) AppendEntries(ctx context.Context, addr string, req *pb.AppendRequest) (*pb.AppendResponse, error) {
+	c, err := t.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.AppendEntries(ctx, req)
+}
+
+func (t *GRPCTransport) InstallSnapshot(ctx context.Context, addr string, first *pb.SnapshotChunk, data io.Reader) (*pb.InstallSnapshotResponse, error) {
+	c, err := t.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.InstallSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunk := *first
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(data, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		chunk.Data = buf[:n]
+		if err := stream.Send(&chunk); err != nil {
+			return nil, err
+		}
+		chunk = pb.SnapshotChunk{}
+	}
+	if chunk.Leader != "" {
+		// an empty snapshot still describes itself
+		if err := stream.Send(&chunk); err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func (t *GRPCTransport) TimeoutNow(ctx context.Context, addr string, req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error) {
+	c, err := t.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.TimeoutNow(ctx, req)
+}
+
+// Close closes the connections to the nodes.
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, conn := range t.conns {
+		conn.Close()
+		delete(t.conns, addr)
+	}
+	return nil
+}
+
+// Service serves the RPCs of the node attached to it. It is registered with
+// the gRPC server before the node is created, which needs the server to
+// listen already to know its address.
+type Service struct {
+	mu   sync.RWMutex
+	node *Node
+}
+
+// NewService returns a service with no node attached, answering every RPC
+// with codes.Unavailable.
+func NewService() *Service {
+	return &Service{}
+}
+
+// Attach makes the service answer the RPCs of n.
+func (s *Service) Attach(n *Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.node = n
+}
+
+func (s *Service) attached() (*Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.node == nil {
+		return nil, status.Error(codes.Unavailable, "raft: no node attached")
+	}
+	return s.node, nil
+}
+
+func (s *Service) RequestVote(ctx context.Context, req *pb.VoteRequest) (*pb.VoteResponse, error) {
+	n, err := s.attached()
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleVote(req)
+}
+
+func (s *Service) AppendEntries(ctx context.Context, req *pb.AppendRequest) (*pb.AppendResponse, error) {
+	n, err := s.attached()
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleAppend(req)
+}
+
+func (s *Service) InstallSnapshot(stream pb.Raft_InstallSnapshotServer) error {
+	n, err := s.attached()
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	resp, err := n.HandleSnapshot(first, &chunkReader{stream: stream, buf: first.Data})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *Service) TimeoutNow(ctx context.Context, req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error) {
+	n, err := s.attached()
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleTimeoutNow(req)
+}
+
+// chunkReader reads the data of snapshot chunks.
+type chunkReader struct {
+	stream pb.Raft_InstallSnapshotServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
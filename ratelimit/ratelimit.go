@@ -0,0 +1,193 @@
+// Package ratelimit implements per-identity token bucket rate limits on both
+// the number of requests and the number of bytes transferred.
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limit is a rate per second, where 0 means unlimited. The burst of each
+// bucket is one second worth of tokens.
+type Limit struct {
+	Requests float64
+	Bytes    float64
+}
+
+// bucket is a token bucket. Requests larger than the burst are let through
+// once the bucket is full and leave it in debt, so they are never starved.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, now time.Time) *bucket {
+	return &bucket{rate: rate, tokens: rate, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns how long until n tokens can be taken.
+func (b *bucket) wait(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	need := math.Min(n, b.rate)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(n float64) {
+	b.tokens -= n
+}
+
+// full returns true if b is nil or holds its whole burst.
+func (b *bucket) full(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= b.rate
+}
+
+// Stats are the counters kept for each identity.
+type Stats struct {
+	ID        string
+	Limit     Limit
+	Allowed   uint64
+	Throttled uint64
+	Bytes     uint64
+}
+
+type entry struct {
+	stats    Stats
+	requests *bucket
+	bytes    *bucket
+	seen     time.Time // of the last request or charge
+}
+
+// Limiter tracks the buckets and counters of every identity it has seen. It
+// is safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// New returns an empty Limiter.
+func New() *Limiter {
+	return &Limiter{entries: make(map[string]*entry), now: time.Now}
+}
+
+// get returns the entry for id, resetting its buckets if the limit changed.
+func (l *Limiter) get(id string, limit Limit, now time.Time) *entry {
+	e, ok := l.entries[id]
+	if !ok {
+		e = &entry{stats: Stats{ID: id}}
+		l.entries[id] = e
+	}
+	if !ok || e.stats.Limit != limit {
+		e.stats.Limit = limit
+		e.requests, e.bytes = nil, nil
+		if limit.Requests > 0 {
+			e.requests = newBucket(limit.Requests, now)
+		}
+		if limit.Bytes > 0 {
+			e.bytes = newBucket(limit.Bytes, now)
+		}
+	}
+	e.seen = now
+	return e
+}
+
+// Allow takes one request and n bytes from the buckets of every identity in
+// ids, which must all have room. Otherwise nothing is taken and Allow returns
+// how long the caller should wait before retrying.
+func (l *Limiter) Allow(ids []string, limits []Limit, n int) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	entries := make([]*entry, len(ids))
+	var wait time.Duration
+	for i, id := range ids {
+		e := l.get(id, limits[i], now)
+		entries[i] = e
+		if e.requests != nil {
+			if w := e.requests.wait(now, 1); w > wait {
+				wait = w
+			}
+		}
+		if e.bytes != nil {
+			if w := e.bytes.wait(now, float64(n)); w > wait {
+				wait = w
+			}
+		}
+	}
+	for _, e := range entries {
+		if wait > 0 {
+			e.stats.Throttled++
+			continue
+		}
+		e.stats.Allowed++
+		e.stats.Bytes += uint64(n)
+		if e.requests != nil {
+			e.requests.take(1)
+		}
+		if e.bytes != nil {
+			e.bytes.take(float64(n))
+		}
+	}
+	return wait, wait == 0
+}
+
+// Charge takes n bytes from the byte buckets of ids without checking them,
+// used for responses whose size is only known after the request is allowed.
+func (l *Limiter) Charge(ids []string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for _, id := range ids {
+		e, ok := l.entries[id]
+		if !ok {
+			continue
+		}
+		e.seen = now
+		e.stats.Bytes += uint64(n)
+		if e.bytes != nil {
+			e.bytes.refill(now)
+			e.bytes.take(float64(n))
+		}
+	}
+}
+
+// Forget drops the buckets and counters of the identities idle for longer
+// than idle whose buckets are full again: the next request of one starts
+// from a full bucket, as it would have.
+func (l *Limiter) Forget(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for id, e := range l.entries {
+		if now.Sub(e.seen) > idle && e.requests.full(now) && e.bytes.full(now) {
+			delete(l.entries, id)
+		}
+	}
+}
+
+// Stats returns the counters of every identity, ordered by ID.
+func (l *Limiter) Stats() []Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make([]Stats, 0, len(l.entries))
+	for _, e := range l.entries {
+		stats = append(stats, e.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Unix(1500000000, 0)}
+	l := New()
+	l.now = c.now
+	return l, c
+}
+
+func Test_RateLimitRequests(t *testing.T) {
+	l, c := newTestLimiter()
+	ids, limits := []string{"user:a"}, []Limit{{Requests: 10}}
+
+	for i := 0; i < 10; i++ {
+		if _, ok := l.Allow(ids, limits, 0); !ok {
+			t.Fatalf("request %d within burst throttled", i)
+		}
+	}
+	wait, ok := l.Allow(ids, limits, 0)
+	if ok || wait != 100*time.Millisecond {
+		t.Fatalf("expected throttle with 100ms wait, got %v %v", ok, wait)
+	}
+
+	c.advance(100 * time.Millisecond)
+	if _, ok := l.Allow(ids, limits, 0); !ok {
+		t.Fatalf("request after refill throttled")
+	}
+
+	stats := l.Stats()
+	if len(stats) != 1 || stats[0].Allowed != 11 || stats[0].Throttled != 1 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func Test_RateLimitBytes(t *testing.T) {
+	l, c := newTestLimiter()
+	ids, limits := []string{"user:a"}, []Limit{{Bytes: 1000}}
+
+	if _, ok := l.Allow(ids, limits, 600); !ok {
+		t.Fatalf("request within byte burst throttled")
+	}
+	if _, ok := l.Allow(ids, limits, 600); ok {
+		t.Fatalf("request over byte burst allowed")
+	}
+
+	// responses are charged after the fact and put the bucket in debt
+	c.advance(time.Second)
+	l.Charge(ids, 1500)
+	wait, ok := l.Allow(ids, limits, 1)
+	if ok || wait != 501*time.Millisecond {
+		t.Fatalf("expected throttle with 501ms wait, got %v %v", ok, wait)
+	}
+
+	// requests larger than the burst go through once the bucket is full
+	c.advance(2 * time.Second)
+	if _, ok := l.Allow(ids, limits, 5000); !ok {
+		t.Fatalf("large request starved")
+	}
+}
+
+func Test_RateLimitMultipleIdentities(t *testing.T) {
+	l, _ := newTestLimiter()
+	user := Limit{Requests: 5}
+	key := Limit{Requests: 2}
+
+	// an API key is limited by its own bucket and its user's bucket
+	for i := 0; i < 2; i++ {
+		if _, ok := l.Allow([]string{"user:a", "key:k"}, []Limit{user, key}, 0); !ok {
+			t.Fatalf("request %d throttled", i)
+		}
+	}
+	if _, ok := l.Allow([]string{"user:a", "key:k"}, []Limit{user, key}, 0); ok {
+		t.Fatalf("API key limit not enforced")
+	}
+	// the throttled request did not consume the user's tokens
+	for i := 0; i < 3; i++ {
+		if _, ok := l.Allow([]string{"user:a"}, []Limit{user}, 0); !ok {
+			t.Fatalf("user request %d throttled", i)
+		}
+	}
+	if _, ok := l.Allow([]string{"user:a"}, []Limit{user}, 0); ok {
+		t.Fatalf("user limit not enforced")
+	}
+
+	// unlimited identities are only counted
+	for i := 0; i < 100; i++ {
+		if _, ok := l.Allow([]string{"user:b"}, []Limit{{}}, 100); !ok {
+			t.Fatalf("unlimited identity throttled")
+		}
+	}
+}
+
+func Test_RateLimitChanged(t *testing.T) {
+	l, _ := newTestLimiter()
+	ids := []string{"user:a"}
+	l.Allow(ids, []Limit{{Requests: 1}}, 0)
+	if _, ok := l.Allow(ids, []Limit{{Requests: 1}}, 0); ok {
+		t.Fatalf("limit not enforced")
+	}
+	if _, ok := l.Allow(ids, []Limit{{Requests: 10}}, 0); !ok {
+		t.Fatalf("raised limit not applied")
+	}
+}
+
+func Test_RateLimitForget(t *testing.T) {
+	l, c := newTestLimiter()
+	limits := []Limit{{Bytes: 1000}}
+	l.Allow([]string{"user:a"}, limits, 0)
+	l.Allow([]string{"user:b"}, limits, 0)
+	l.Charge([]string{"user:b"}, 5000)
+
+	c.advance(2 * time.Second)
+	l.Allow([]string{"user:c"}, limits, 0)
+	l.Forget(time.Second)
+	// b still owes bytes and c was just seen
+	stats := l.Stats()
+	if len(stats) != 2 || stats[0].ID != "user:b" || stats[1].ID != "user:c" {
+		t.Fatalf("expected only the idle identity with a full bucket forgotten, got %+v", stats)
+	}
+
+	c.advance(5 * time.Second)
+	l.Forget(time.Second)
+	if stats := l.Stats(); len(stats) != 0 {
+		t.Fatalf("expected every idle identity forgotten, got %+v", stats)
+	}
+}
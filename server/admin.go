@@ -0,0 +1,118 @@
+package main
+
+import (
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+)
+
+func apiKeyToProto(k *auth.APIKey) *pb.APIKey {
+	return &pb.APIKey{
+		Id:         k.ID,
+		Username:   k.Username,
+		Namespaces: k.Namespaces,
+		Ops:        k.Ops,
+		ExpiresAt:  k.ExpiresAt,
+		CreatedAt:  k.CreatedAt,
+		LastUsed:   k.LastUsed,
+	}
+}
+
+// Creates an API key acting on behalf of a user, the full key is only returned here
+// NOTE: Admin only, no token needed
+func (s *Server) CreateAPIKey(ctx context.Context, in *pb.APIKeyRequest) (*pb.APIKey, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if !users.Exists(in.Username) {
+		return nil, InvalidUsernameErr
+	}
+	for _, ns := range in.Namespaces {
+		if !namespacePattern.MatchString(ns) {
+			return nil, InvalidNamespaceErr
+		}
+	}
+	key, secret, err := apiKeys.Create(in.Username, in.Namespaces, in.Ops, in.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	saveAPIKeys()
+	resp := apiKeyToProto(key)
+	resp.Key = secret
+	return resp, nil
+}
+
+// Revokes an API key
+// NOTE: Admin only, no token needed
+func (s *Server) RevokeAPIKey(ctx context.Context, in *pb.APIKeyID) (*pb.Response, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if !apiKeys.Revoke(in.Id) {
+		return nil, APIKeyMissingErr
+	}
+	saveAPIKeys()
+	return &pb.Response{Success: true, Value: "(1 key(s) revoked)"}, nil
+}
+
+// Lists all API keys, without their secrets
+// NOTE: Admin only, no token needed
+func (s *Server) ListAPIKeys(ctx context.Context, in *google_protobuf.Empty) (*pb.APIKeyList, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	keys := apiKeys.List()
+	resp := &pb.APIKeyList{Keys: make([]*pb.APIKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Keys = append(resp.Keys, apiKeyToProto(k))
+	}
+	return resp, nil
+}
+
+// Returns server statistics
+// NOTE: Admin only, no token needed
+func (s *Server) Stats(ctx context.Context, in *google_protobuf.Empty) (*pb.StatsResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	resp := &pb.StatsResponse{}
+	for _, st := range limiter.Stats() {
+		resp.RateLimits = append(resp.RateLimits, &pb.RateLimitStats{
+			Id:            st.ID,
+			RequestsLimit: st.Limit.Requests,
+			BytesLimit:    st.Limit.Bytes,
+			Allowed:       st.Allowed,
+			Throttled:     st.Throttled,
+			Bytes:         st.Bytes,
+		})
+	}
+	mem := s.Meta.Stats()
+	resp.Memory = &pb.MemoryStats{
+		UsedBytes:      s.Data.Bytes(),
+		MaxBytes:       cfg.MaxMemory,
+		EvictionPolicy: cfg.EvictionPolicy,
+		Evicted:        mem.Evicted,
+		Expired:        mem.Expired,
+	}
+	return resp, nil
+}
+
+// Reloads the encryption keys and rewrites the data on disk with the active key, so that older keys can be removed
+// NOTE: Admin only, no token needed
+func (s *Server) Reencrypt(ctx context.Context, in *google_protobuf.Empty) (*pb.Response, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if dataKeys == nil {
+		return nil, EncryptionDisabledErr
+	}
+	if err := dataKeys.Reload(cfg.EncryptionKeys); err != nil {
+		return nil, err
+	}
+	if err := reencrypt(s); err != nil {
+		return nil, err
+	}
+	return &pb.Response{Success: true, Value: "(data re-encrypted with key " + dataKeys.Active() + ")"}, nil
+}
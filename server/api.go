@@ -7,17 +7,57 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	google_protobuf "github.com/golang/protobuf/ptypes/empty"
 	"github.com/imjching/keev/cmap"
-	"github.com/imjching/keev/common"
+	"github.com/imjching/keev/evict"
 	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/quota"
+	"github.com/imjching/keev/raft"
+	"github.com/imjching/keev/wal"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/metadata"
 )
 
 type Server struct {
+	// applied is the index of the last Raft entry applied, accessed
+	// atomically so it comes first to be 64-bit aligned
+	applied uint64
+
 	Data cmap.ConcurrentMap `json:"data"`
+	// Meta holds the access metadata and expiry of every key, only the
+	// expiries are persisted
+	Meta *evict.Tracker `json:"expires"`
+
+	// usage is the number of keys and bytes stored per user and namespace
+	usage *quota.Tracker
+	// log records every change once the data is loaded, nil if it is
+	// disabled
+	log *wal.Log
+	// baseRevision is the revision of the snapshot the data was loaded from
+	baseRevision uint64
+	// raft replicates the changes to the other nodes of the cluster, nil
+	// when running standalone
+	raft *raft.Node
+	// feed keeps the changes of a primary for its replicas, nil unless the
+	// server is a primary
+	feed *feed
+	// replica follows the primary, nil unless the server is a replica
+	replica *replica
+	// shards holds the shard map and moves keys between the shards, nil
+	// unless the server is a shard
+	shards *sharding
+	// versions holds the versions of the keys written at sites, empty
+	// unless the data comes from one
+	versions *versionStore
+	// sites exchanges writes with the other sites, nil unless the server is
+	// a site
+	sites *sites
 }
 
+// namespacePattern matches the namespaces that can be used. Keys are stored
+// as username.namespace.key, so a namespace must not hold a dot: it would
+// make the keys of one namespace those of another.
+var namespacePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type Token struct {
 	Username  string `json:"username"`
 	Namespace string `json:"database"`
@@ -25,9 +65,13 @@ type Token struct {
 }
 
 func NewServer() *Server {
-	return &Server{
-		Data: cmap.New(),
+	s := &Server{
+		Meta:     evict.New(nil),
+		usage:    quota.New(),
+		versions: newVersionStore(),
 	}
+	s.Data = cmap.NewWithHook(s.logChange)
+	return s
 }
 
 func verifyToken(ctx context.Context) (*Token, error) {
@@ -40,15 +84,20 @@ func verifyToken(ctx context.Context) (*Token, error) {
 	if len(tokenString) == 0 {
 		return nil, MissingTokenErr
 	}
-	// retrieve the jwt parser
-	token, err := jwt.ParseWithClaims(tokenString[0], &Token{}, func(token *jwt.Token) (interface{}, error) {
-		return common.JWTSigningToken, nil
-	})
+	// parse the token, only accepting keys and algorithms from our key ring
+	token, err := keyRing.Parse(tokenString[0], &Token{})
 	if err != nil {
 		return nil, InvalidTokenErr
 	}
-	// check if token is valid
-	if claims, ok := token.Claims.(*Token); ok && token.Valid {
+	// check if token is valid and issued to the caller
+	if claims, ok := token.Claims.(*Token); ok && token.Valid && namespacePattern.MatchString(claims.Namespace) {
+		if username, ok := usernameFromContext(ctx); !ok || claims.Username != username {
+			return nil, InvalidTokenErr
+		}
+		if err := checkNamespace(ctx, claims.Namespace); err != nil {
+			return nil, err
+		}
+		setNamespace(ctx, claims.Namespace)
 		return claims, nil
 	}
 	// otherwise, token is invalid
@@ -62,10 +111,16 @@ func (s *Server) Set(ctx context.Context, in *pb.KeyValuePair) (*pb.Response, er
 		return nil, err
 	}
 	newKey := token.Username + "." + token.Namespace + "." + in.Key
-	if !s.Data.SetIfAbsent(newKey, in.Value) {
-		return nil, KVPExistsErr
+	done, err := s.route(ctx, newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	resp, err := s.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: newKey, Value: in.Value, Expires: expiresAt(in.Ttl)})
+	if err != nil {
+		return nil, err
 	}
-	return &pb.Response{Success: true, Value: "(1 pair(s) affected)"}, nil
+	return resp.(*pb.Response), nil
 }
 
 // Updates a key-value pair in a namespace, if present
@@ -75,11 +130,16 @@ func (s *Server) Update(ctx context.Context, in *pb.KeyValuePair) (*pb.Response,
 		return nil, err
 	}
 	newKey := token.Username + "." + token.Namespace + "." + in.Key
-	if !s.Data.Has(newKey) {
-		return nil, KVPMissingErr
+	done, err := s.route(ctx, newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	resp, err := s.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UPDATE, Key: newKey, Value: in.Value, Expires: expiresAt(in.Ttl)})
+	if err != nil {
+		return nil, err
 	}
-	s.Data.Set(newKey, in.Value)
-	return &pb.Response{Success: true, Value: "(1 pair(s) affected)"}, nil
+	return resp.(*pb.Response), nil
 }
 
 // Checks if a key is in a namespace
@@ -88,11 +148,19 @@ func (s *Server) Has(ctx context.Context, in *pb.Key) (*pb.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	newKey := token.Username + "." + token.Namespace + "." + in.Key
-	ok := s.Data.Has(newKey)
-	if !ok {
+	done, err := s.route(ctx, newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	if s.expire(newKey) || !s.Data.Has(newKey) {
 		return &pb.Response{Success: false, Value: "(0 pair(s) found)"}, nil
 	}
+	s.Meta.Touch(newKey)
 	return &pb.Response{Success: true, Value: "(1 pair(s) found)"}, nil
 }
 
@@ -103,11 +171,16 @@ func (s *Server) Unset(ctx context.Context, in *pb.Key) (*pb.KeyValuePair, error
 		return nil, err
 	}
 	newKey := token.Username + "." + token.Namespace + "." + in.Key
-	value, ok := s.Data.Pop(newKey)
-	if !ok {
-		return nil, KVPMissingErr
+	done, err := s.route(ctx, newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	resp, err := s.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: newKey})
+	if err != nil {
+		return nil, err
 	}
-	return &pb.KeyValuePair{Key: in.Key, Value: value.(string)}, nil
+	return resp.(*pb.KeyValuePair), nil
 }
 
 // Retrieves an element from a namespace under given key
@@ -116,12 +189,24 @@ func (s *Server) Get(ctx context.Context, in *pb.Key) (*pb.KeyValuePair, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	newKey := token.Username + "." + token.Namespace + "." + in.Key
+	done, err := s.route(ctx, newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	if s.expire(newKey) {
+		return nil, KVPMissingErr
+	}
 	value, ok := s.Data.Get(newKey)
 	if !ok {
 		return nil, KVPMissingErr
 	}
-	return &pb.KeyValuePair{Key: in.Key, Value: value.(string)}, nil
+	s.Meta.Touch(newKey)
+	return &pb.KeyValuePair{Key: in.Key, Value: value.(string), Ttl: s.ttlLeft(newKey), Siblings: s.siblings(newKey)}, nil
 }
 
 // Returns the total number of key-value pairs in a namespace
@@ -130,6 +215,9 @@ func (s *Server) Count(ctx context.Context, in *google_protobuf.Empty) (*pb.Coun
 	if err != nil {
 		return nil, err
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	newKey := token.Username + "." + token.Namespace + "."
 	count := 0
 	for _, i := range s.Data.Keys() {
@@ -146,6 +234,9 @@ func (s *Server) ShowKeys(ctx context.Context, in *google_protobuf.Empty) (*pb.S
 	if err != nil {
 		return nil, err
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	newKey := token.Username + "." + token.Namespace + "."
 	keys := make([]string, 0)
 	for _, i := range s.Data.Keys() {
@@ -162,6 +253,9 @@ func (s *Server) ShowData(ctx context.Context, in *google_protobuf.Empty) (*pb.S
 	if err != nil {
 		return nil, err
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	newKey := token.Username + "." + token.Namespace + "."
 	kvps := make([]*pb.KeyValuePair, 0)
 	for i, v := range s.Data.Items() {
@@ -175,14 +269,17 @@ func (s *Server) ShowData(ctx context.Context, in *google_protobuf.Empty) (*pb.S
 // Retrieve all namespaces in the key-value store that belongs to the user
 // NOTE: No token needed
 func (s *Server) ShowNamespaces(ctx context.Context, in *google_protobuf.Empty) (*pb.ShowNamespacesResponse, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
+	username, ok := usernameFromContext(ctx)
 	if !ok {
 		return nil, EmptyMetadataErr // should not occur
 	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
 	namespaces := make(map[string]bool, 0)
 	for _, i := range s.Data.Keys() {
 		split := strings.Split(i, ".")
-		if split[0] == md["username"][0] {
+		if split[0] == username && checkNamespace(ctx, split[1]) == nil {
 			namespaces[split[1]] = true
 		}
 	}
@@ -197,26 +294,26 @@ func (s *Server) ShowNamespaces(ctx context.Context, in *google_protobuf.Empty)
 // NOTE: No token needed
 func (s *Server) UseNamespace(ctx context.Context, in *pb.Namespace) (*pb.NamespaceResponse, error) {
 	// verifies that namespace is alphanumeric
-	re := regexp.MustCompile(`[a-zA-Z]`)
-	match := re.FindStringSubmatch(in.Namespace)
-	if len(match) == 0 {
+	if !namespacePattern.MatchString(in.Namespace) {
 		return nil, InvalidNamespaceErr
 	}
-	md, ok := metadata.FromIncomingContext(ctx)
+	username, ok := usernameFromContext(ctx)
 	if !ok {
 		return nil, EmptyMetadataErr // should not occur
 	}
+	if err := checkNamespace(ctx, in.Namespace); err != nil {
+		return nil, err
+	}
 	// initialize token
 	claims := Token{
-		md["username"][0],
+		username,
 		in.Namespace,
 		jwt.StandardClaims{
 			Issuer: "keev",
 		},
 	}
-	// sign the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString(common.JWTSigningToken)
+	// sign the token with the active key
+	ss, err := keyRing.Sign(claims)
 	if err != nil {
 		return nil, TokenSigningErr
 	}
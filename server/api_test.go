@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+)
+
+func Test_UseNamespace(t *testing.T) {
+	s := NewServer()
+	ctx := withCaller(context.Background(), &caller{Username: "alice", APIKey: &auth.APIKey{Namespaces: []string{"metrics"}}})
+	// metrics.secret.k would be the key secret.k of metrics
+	for _, ns := range []string{"metrics.secret", "metrics.", "a b", ""} {
+		if _, err := s.UseNamespace(ctx, &pb.Namespace{Namespace: ns}); err != InvalidNamespaceErr {
+			t.Fatalf("expected %q to be rejected, got %v", ns, err)
+		}
+	}
+	if _, err := s.UseNamespace(ctx, &pb.Namespace{Namespace: "other_ns-2"}); err != APIKeyScopeErr {
+		t.Fatalf("expected a namespace outside the API key's to be refused, got %v", err)
+	}
+}
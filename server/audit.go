@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+
+	"github.com/imjching/keev/audit"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// auditRequest appends the outcome of an RPC to the audit log. Requests that
+// failed to authenticate are recorded under the username they claimed.
+func auditRequest(ctx context.Context, method string, req interface{}, err error) {
+	if auditLog == nil {
+		return
+	}
+	r := audit.Record{RPC: method, Outcome: "OK"}
+	if req, ok := requestFromContext(ctx); ok {
+		r.RequestID = req.ID
+	}
+	if c, ok := callerFromContext(ctx); ok {
+		r.User, r.Namespace = c.Username, c.Namespace
+		if c.APIKey != nil {
+			r.APIKey = c.APIKey.ID
+		}
+	} else if md, ok := metadata.FromIncomingContext(ctx); ok && len(md["username"]) > 0 {
+		r.User = md["username"][0]
+	}
+	switch in := req.(type) {
+	case *pb.Key:
+		r.Key = in.Key
+	case *pb.KeyValuePair:
+		r.Key = in.Key
+	case *pb.Namespace:
+		r.Namespace = in.Namespace
+	}
+	if err != nil {
+		r.Outcome = err.Error()
+	}
+	if err := auditLog.Append(r); err != nil {
+		requestLogger(ctx).WithError(err).Error("failed to write audit record")
+	}
+}
+
+// Returns audit records matching a query, oldest first
+// NOTE: Admin only, no token needed
+func (s *Server) QueryAudit(ctx context.Context, in *pb.AuditQuery) (*pb.AuditRecords, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if auditLog == nil {
+		return nil, AuditDisabledErr
+	}
+	filter := audit.Filter{User: in.User, Key: in.Key, Limit: int(in.Limit)}
+	if in.Since != 0 {
+		filter.Since = time.Unix(in.Since, 0)
+	}
+	if in.Until != 0 {
+		filter.Until = time.Unix(in.Until, 0)
+	}
+	records, err := auditLog.Query(filter)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.AuditRecords{Records: make([]*pb.AuditRecord, 0, len(records))}
+	for _, r := range records {
+		resp.Records = append(resp.Records, &pb.AuditRecord{
+			Seq:       r.Seq,
+			Time:      r.Time,
+			User:      r.User,
+			ApiKey:    r.APIKey,
+			Namespace: r.Namespace,
+			Rpc:       r.RPC,
+			Key:       r.Key,
+			Outcome:   r.Outcome,
+			Hash:      r.Hash,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/x509"
+
+	"github.com/imjching/keev/auth"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// caller is the authenticated identity of a request.
+type caller struct {
+	Username  string
+	APIKey    *auth.APIKey // set when authenticated with an API key
+	Namespace string       // set once the namespace token has been verified
+}
+
+type callerKey struct{}
+
+// withCaller returns a context carrying the authenticated caller.
+func withCaller(ctx context.Context, c *caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// callerFromContext returns the caller set by the interceptors.
+func callerFromContext(ctx context.Context) (*caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(*caller)
+	return c, ok && c.Username != ""
+}
+
+// usernameFromContext returns the username set by the interceptors.
+func usernameFromContext(ctx context.Context) (string, bool) {
+	c, ok := callerFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return c.Username, true
+}
+
+// setNamespace records the namespace the caller is working in.
+func setNamespace(ctx context.Context, namespace string) {
+	if c, ok := callerFromContext(ctx); ok {
+		c.Namespace = namespace
+	}
+}
+
+// methodOps maps the RPCs an API key may call to the operation they perform.
+// RPCs missing from this map, such as admin RPCs, are never allowed for keys.
+var methodOps = map[string]string{
+	"/protobuf.KVS/Set":            auth.OpWrite,
+	"/protobuf.KVS/Update":         auth.OpWrite,
+	"/protobuf.KVS/Unset":          auth.OpWrite,
+	"/protobuf.KVS/Has":            auth.OpRead,
+	"/protobuf.KVS/Get":            auth.OpRead,
+	"/protobuf.KVS/Count":          auth.OpRead,
+	"/protobuf.KVS/ShowKeys":       auth.OpRead,
+	"/protobuf.KVS/ShowData":       auth.OpRead,
+	"/protobuf.KVS/ShowNamespaces": auth.OpRead,
+	"/protobuf.KVS/UseNamespace":   "",
+	"/protobuf.KVS/Usage":          auth.OpRead,
+}
+
+// checkAPIKeyMethod returns an error if key may not call method.
+func checkAPIKeyMethod(key *auth.APIKey, method string) error {
+	op, ok := methodOps[method]
+	if !ok || (op != "" && !key.AllowsOp(op)) {
+		return APIKeyScopeErr
+	}
+	return nil
+}
+
+// checkNamespace returns an error if the caller is restricted to other
+// namespaces.
+func checkNamespace(ctx context.Context, namespace string) error {
+	if c, ok := callerFromContext(ctx); ok && c.APIKey != nil && !c.APIKey.AllowsNamespace(namespace) {
+		return APIKeyScopeErr
+	}
+	return nil
+}
+
+// isAdmin returns true if the caller is an admin user. API keys are never
+// admins, even if their user is.
+func isAdmin(ctx context.Context) bool {
+	c, ok := callerFromContext(ctx)
+	return ok && c.APIKey == nil && users.HasPerm(c.Username, "ADMIN")
+}
+
+// clientCertificate returns the leaf of the client certificate chain verified
+// during the TLS handshake, if the client presented one.
+func clientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return tlsInfo.State.VerifiedChains[0][0]
+}
+
+// authorizedStream overrides the stream context with the authorized one.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/imjching/keev/conflict"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/snapshot"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// backupChunkSize is the largest chunk of a snapshot sent in one message.
+const backupChunkSize = 64 << 10
+
+// backupScope returns the prefix of the keys a backup or restore covers:
+// every key, the keys of a user or of one of their namespaces. Namespaces
+// never hold a dot, so the prefix of one is not that of another.
+func backupScope(username, namespace string) (string, error) {
+	if strings.Contains(username, ".") || (namespace != "" && !namespacePattern.MatchString(namespace)) {
+		return "", InvalidScopeErr
+	}
+	switch {
+	case username == "" && namespace == "":
+		return "", nil
+	case username == "":
+		return "", InvalidScopeErr
+	case namespace == "":
+		return username + ".", nil
+	}
+	return username + "." + namespace + ".", nil
+}
+
+// chunkWriter sends what is written to it in chunks, as backup chunks or
+// as the snapshot of a replica.
+type chunkWriter struct {
+	send func(data []byte) error
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > backupChunkSize {
+			n = backupChunkSize
+		}
+		if err := w.send(p[:n]); err != nil {
+			return written, err
+		}
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// chunkReader reads the data of restore chunks.
+type chunkReader struct {
+	stream pb.KVS_RestoreServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF once the client is done
+		}
+		r.buf = chunk.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Streams a consistent snapshot of the whole store, a user or a namespace
+// NOTE: Admin only, no token needed
+func (s *Server) Backup(in *pb.BackupRequest, stream pb.KVS_BackupServer) error {
+	if !isAdmin(stream.Context()) {
+		return AdminOnlyErr
+	}
+	prefix, err := backupScope(in.Username, in.Namespace)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(chunkWriter{func(p []byte) error {
+		return stream.Send(&pb.BackupChunk{Data: p})
+	}}, backupChunkSize)
+	keys, _, err := s.writeSnapshot(w, snapshot.Gzip, prefix)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	requestLogger(stream.Context()).WithFields(logrus.Fields{"scope": prefix, "keys": keys}).Info("backup sent")
+	return nil
+}
+
+// Replaces the whole store, a user or a namespace with a snapshot streamed by the caller, the scope and dry_run are taken from the first message
+// NOTE: Admin only, no token needed
+func (s *Server) Restore(stream pb.KVS_RestoreServer) error {
+	if !isAdmin(stream.Context()) {
+		return AdminOnlyErr
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return EmptyBackupErr
+	}
+	if err != nil {
+		return err
+	}
+	prefix, err := backupScope(first.Username, first.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// read and check the whole snapshot before changing anything
+	entries, err := readBackup(&chunkReader{stream: stream, buf: first.Data}, prefix)
+	if err != nil {
+		return err
+	}
+	resp := &pb.RestoreResponse{Keys: int64(len(entries)), DryRun: first.DryRun}
+	if first.DryRun {
+		resp.Removed = int64(len(s.staleKeys(prefix, entries)))
+	} else {
+		removed, err := s.restoreBackup(stream.Context(), prefix, entries)
+		if err != nil {
+			return err
+		}
+		resp.Removed = int64(removed)
+		requestLogger(stream.Context()).WithFields(logrus.Fields{"scope": prefix, "keys": resp.Keys, "removed": resp.Removed}).Warn("backup restored")
+		if s.shards != nil {
+			// keys of other shards move to their owner, unless it holds them
+			s.shards.rebalance()
+		}
+	}
+	return stream.SendAndClose(resp)
+}
+
+// readBackup reads a snapshot, which must only hold keys starting with prefix.
+func readBackup(r io.Reader, prefix string) ([]*pb.SnapshotEntry, error) {
+	sr, err := snapshot.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*pb.SnapshotEntry
+	for {
+		e, err := sr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(e.Key, prefix) || len(strings.SplitN(e.Key, ".", 3)) != 3 {
+			return nil, fmt.Errorf("%s: %q", KeyOutOfScopeErr, e.Key)
+		}
+		if conflict.Deleted(e.Versions) {
+			continue // a key deleted at a site
+		}
+		entries = append(entries, e)
+	}
+}
+
+// staleKeys returns the keys starting with prefix that are not in entries.
+func (s *Server) staleKeys(prefix string, entries []*pb.SnapshotEntry) []string {
+	restored := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		restored[e.Key] = true
+	}
+	var stale []string
+	for _, key := range s.Data.Keys() {
+		if strings.HasPrefix(key, prefix) && !restored[key] {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// restoreBackup replaces the keys starting with prefix with entries and
+// returns how many keys were removed. The change is made in as many commands
+// as it takes for each to fit in a message, removing the keys missing from
+// the backup first: a restore that failed part way can be made again.
+func (s *Server) restoreBackup(ctx context.Context, prefix string, entries []*pb.SnapshotEntry) (int, error) {
+	removed := 0
+	for _, cmd := range restoreCommands(prefix, s.staleKeys(prefix, entries), entries) {
+		resp, err := s.mutate(ctx, cmd)
+		if err != nil {
+			return removed, err
+		}
+		removed += resp.(int)
+	}
+	return removed, nil
+}
+
+// restoreCommands splits a restore into commands that fit in a message.
+func restoreCommands(prefix string, stale []string, entries []*pb.SnapshotEntry) []*pb.Command {
+	// leaves room for the op, the prefix and the time of a command, and
+	// for the tag and length of each key or entry
+	limit := int(cfg.MaxMessageSize/2) - len(prefix) - 32
+	var cmds []*pb.Command
+	size := 0
+	add := func(n int) *pb.Command {
+		if n += 8; len(cmds) == 0 || (size > 0 && size+n > limit) {
+			cmds = append(cmds, &pb.Command{Op: pb.CommandOp_CMD_RESTORE, Key: prefix})
+			size = 0
+		}
+		size += n
+		return cmds[len(cmds)-1]
+	}
+	for _, key := range stale {
+		cmd := add(len(key))
+		cmd.Removed = append(cmd.Removed, key)
+	}
+	for _, e := range entries {
+		cmd := add(proto.Size(e))
+		cmd.Entries = append(cmd.Entries, e)
+	}
+	return cmds
+}
+
+// restore makes one of the commands of a restore: it removes the keys of
+// removed, writes entries and returns how many keys were removed. Writes
+// to the scope made while the restore runs may be overwritten, or kept if
+// made to a key of the backup before it is written. --max-memory is not
+// enforced, keys are evicted by later writes.
+func (s *Server) restore(removed []string, entries []*pb.SnapshotEntry) int {
+	n := 0
+	for _, key := range removed {
+		if _, ok := s.Data.Pop(key); ok {
+			n++
+		}
+		s.Meta.Remove(key)
+		s.versions.forget(key)
+	}
+	for _, e := range entries {
+		s.Data.Set(e.Key, e.Value)
+		s.versions.forget(e.Key)
+		s.Meta.Touch(e.Key)
+		s.setExpiry(e.Key, e.Expires)
+	}
+	s.rebuildUsage()
+	return n
+}
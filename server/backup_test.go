@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/imjching/keev/snapshot"
+
+	"golang.org/x/net/context"
+)
+
+func Test_BackupScope(t *testing.T) {
+	for _, c := range []struct {
+		username, namespace, prefix string
+		ok                          bool
+	}{
+		{"", "", "", true},
+		{"alice", "", "alice.", true},
+		{"alice", "metrics", "alice.metrics.", true},
+		{"", "metrics", "", false},
+		{"al.ice", "", "", false},
+		{"alice", "metrics.x", "", false},
+	} {
+		prefix, err := backupScope(c.username, c.namespace)
+		if (err == nil) != c.ok || prefix != c.prefix {
+			t.Fatalf("scope %q/%q: expected %q, %v, got %q, %v", c.username, c.namespace, c.prefix, c.ok, prefix, err)
+		}
+	}
+}
+
+func Test_BackupRestore(t *testing.T) {
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	s := NewServer()
+	s.Data.Set("alice.ns.a", "1")
+	s.Data.Set("alice.ns.b", "2")
+	s.Data.Set("alice.other.c", "3")
+	s.Data.Set("bob.ns.a", "4")
+	s.Meta.SetExpiry("alice.ns.b", 4102444800)
+	s.rebuildUsage()
+
+	var buf bytes.Buffer
+	if n, _, err := s.writeSnapshot(&buf, snapshot.Gzip, "alice.ns."); err != nil || n != 2 {
+		t.Fatalf("expected a backup of 2 keys, got %d, %v", n, err)
+	}
+	backup := buf.Bytes()
+
+	// the namespace changes after the backup
+	s.Data.Set("alice.ns.a", "changed")
+	s.Data.Remove("alice.ns.b")
+	s.Data.Set("alice.ns.new", "5")
+
+	entries, err := readBackup(bytes.NewReader(backup), "alice.ns.")
+	if err != nil {
+		t.Fatalf("failed to read backup: %s", err.Error())
+	}
+	if stale := s.staleKeys("alice.ns.", entries); len(stale) != 1 || stale[0] != "alice.ns.new" {
+		t.Fatalf("expected alice.ns.new to be removed by a restore, got %v", stale)
+	}
+	if removed, err := s.restoreBackup(context.Background(), "alice.ns.", entries); err != nil || removed != 1 {
+		t.Fatalf("expected 1 key removed, got %d, %v", removed, err)
+	}
+	if v, _ := s.Data.Get("alice.ns.a"); v != "1" || !s.Data.Has("alice.ns.b") || s.Data.Has("alice.ns.new") {
+		t.Fatalf("namespace not restored: %v", s.Data.Items())
+	}
+	if s.Meta.Expiry("alice.ns.b") != 4102444800 {
+		t.Fatalf("expiry not restored")
+	}
+	if !s.Data.Has("alice.other.c") || !s.Data.Has("bob.ns.a") {
+		t.Fatalf("keys outside the scope were changed: %v", s.Data.Items())
+	}
+	if u := s.usage.User("alice"); u.Keys != 3 {
+		t.Fatalf("expected usage of 3 keys after the restore, got %d", u.Keys)
+	}
+
+	// a backup of a user cannot be restored into one of their namespaces
+	buf.Reset()
+	s.writeSnapshot(&buf, snapshot.None, "alice.")
+	if _, err := readBackup(bytes.NewReader(buf.Bytes()), "alice.ns."); err == nil || !strings.Contains(err.Error(), KeyOutOfScopeErr.Error()) {
+		t.Fatalf("expected keys outside the scope to be rejected, got %v", err)
+	}
+	if _, err := readBackup(bytes.NewReader(backup[:len(backup)-4]), ""); err == nil {
+		t.Fatalf("expected a truncated backup to be rejected")
+	}
+}
+
+func Test_BackupSiblingNamespaces(t *testing.T) {
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	s := NewServer()
+	s.Data.Set("alice.metrics.a", "1")
+	for _, key := range []string{"alice.metrics-x.b", "alice.metrics_2.c", "alice.metricsx.d"} {
+		s.Data.Set(key, "2")
+	}
+	s.rebuildUsage()
+	prefix, _ := backupScope("alice", "metrics")
+
+	var buf bytes.Buffer
+	if n, _, err := s.writeSnapshot(&buf, snapshot.Gzip, prefix); err != nil || n != 1 {
+		t.Fatalf("expected a backup of 1 key, got %d, %v", n, err)
+	}
+	entries, err := readBackup(&buf, prefix)
+	if err != nil {
+		t.Fatalf("failed to read backup: %s", err.Error())
+	}
+	s.Data.Set("alice.metrics.new", "3")
+	if removed, err := s.restoreBackup(context.Background(), prefix, entries); err != nil || removed != 1 {
+		t.Fatalf("expected 1 key removed, got %d, %v", removed, err)
+	}
+	if s.Data.Count() != 4 || !s.Data.Has("alice.metrics-x.b") || !s.Data.Has("alice.metrics_2.c") || !s.Data.Has("alice.metricsx.d") {
+		t.Fatalf("expected the other namespaces to survive the restore, got %v", s.Data.Items())
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/imjching/keev/cmap"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/raft"
+	"github.com/imjching/keev/snapshot"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// raftMethods is the prefix of the methods of the Raft service, called by the
+// other nodes of the cluster.
+const raftMethods = "/protobuf.Raft/"
+
+// clusterSecretHeader is the metadata key carrying the cluster secret.
+const clusterSecretHeader = "cluster-secret"
+
+// leaderHeader is the trailer carrying the address of the leader when a
+// write, or a linearizable read, is sent to another node.
+const leaderHeader = "keev-leader"
+
+func isClusterMethod(method string) bool {
+	return strings.HasPrefix(method, raftMethods)
+}
+
+// checkClusterSecret authenticates another node of the cluster.
+func checkClusterSecret(ctx context.Context) error {
+	if !cfg.ClusterEnabled() || !hasSecret(ctx, clusterSecretHeader, cfg.Cluster.Secret) {
+		return status.Error(codes.Unauthenticated, ClusterSecretErr.Error())
+	}
+	return nil
+}
+
+// hasSecret returns true if the caller sent secret in the header named
+// header.
+func hasSecret(ctx context.Context, header, secret string) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md[header]) > 0 && subtle.ConstantTimeCompare([]byte(md[header][0]), []byte(secret)) == 1
+}
+
+// secretCredentials sends a shared secret with every call to another
+// server, in the header named header.
+type secretCredentials struct {
+	header, secret string
+}
+
+func (c secretCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{c.header: c.secret}, nil
+}
+
+func (c secretCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// clusterDialOptions returns the options the other nodes are dialed with.
+func clusterDialOptions(c *Config) ([]grpc.DialOption, error) {
+	return peerDialOptions(c, c.Cluster.CA, "--cluster-ca", secretCredentials{clusterSecretHeader, c.Cluster.Secret})
+}
+
+// peerDialOptions returns the options another server is dialed with: TLS,
+// verified against the CA certificate(s) in ca set by the flag named flag,
+// and the secret. The secret is never sent to a server that is not verified.
+func peerDialOptions(c *Config, ca, flag string, creds secretCredentials) ([]grpc.DialOption, error) {
+	if ca == "" {
+		return nil, fmt.Errorf("%s is required", flag)
+	}
+	pem, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{RootCAs: x509.NewCertPool()}
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", ca)
+	}
+	if c.TLS.RequireClientCert {
+		cert, err := tls.LoadX509KeyPair(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(config)),
+		grpc.WithPerRPCCredentials(creds),
+	}, nil
+}
+
+// applyResult is what a change applied through the Raft log returns to the
+// node that proposed it.
+type applyResult struct {
+	resp interface{}
+	err  error
+}
+
+// stateMachine applies the changes replicated by the Raft group to the data.
+type stateMachine struct {
+	s *Server
+}
+
+func (m stateMachine) Apply(index uint64, data []byte) interface{} {
+	var r applyResult
+	cmd := &pb.Command{}
+	if err := proto.Unmarshal(data, cmd); err != nil {
+		logger.WithError(err).WithField("index", index).Error("failed to decode a replicated change")
+		r.err = err
+	} else {
+		r.resp, r.err = m.s.apply(cmd)
+	}
+	atomic.StoreUint64(&m.s.applied, index)
+	return r
+}
+
+// Snapshot is called between changes, so the expiries are copied along with
+// the data they belong to.
+func (m stateMachine) Snapshot() (raft.Snapshot, error) {
+	return &clusterSnapshot{
+		header:   &pb.SnapshotHeader{Revision: atomic.LoadUint64(&m.s.applied), Created: time.Now().UnixNano()},
+		data:     m.s.Data.Snapshot(),
+		expiries: m.s.Meta.Expiries(),
+	}, nil
+}
+
+func (m stateMachine) Restore(r io.Reader) error {
+	s := m.s
+	r, err := openData(r)
+	if err != nil {
+		return err
+	}
+	for _, key := range s.Data.Keys() {
+		s.Data.Remove(key)
+		s.Meta.Remove(key)
+	}
+	s.versions.clear()
+	keys, err := s.readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&s.applied, s.baseRevision)
+	s.rebuildUsage()
+	s.trackKeys()
+	logger.WithFields(logrus.Fields{"keys": keys, "revision": s.baseRevision}).Info("loaded data from the raft snapshot")
+	return nil
+}
+
+// clusterSnapshot is a snapshot of the data of a cluster node, written in
+// the format of data.snap.
+type clusterSnapshot struct {
+	header   *pb.SnapshotHeader
+	data     *cmap.Snapshot
+	expiries map[string]int64
+}
+
+func (c *clusterSnapshot) Persist(w io.Writer) error {
+	compression, _ := snapshot.ParseCompression(cfg.SnapshotCompression) // checked by Validate
+	return sealData(w, func(w io.Writer) error {
+		_, err := writeSnapshotOf(w, compression, c.data, c.header, "", func(e *pb.SnapshotEntry) {
+			e.Expires = c.expiries[e.Key]
+		}, nil)
+		return err
+	})
+}
+
+func (c *clusterSnapshot) Release() {
+	c.data.Close()
+}
+
+// joinCluster makes the server a node of a Raft group, loading the data from
+// the node's snapshot and log, then attaches it to service and starts it.
+func (s *Server) joinCluster(c raft.Config, service *raft.Service) error {
+	c.StateMachine = stateMachine{s}
+	n, err := raft.New(c)
+	if err != nil {
+		return err
+	}
+	s.raft = n
+	service.Attach(n)
+	n.Start()
+	return nil
+}
+
+// startCluster joins the cluster configured in cfg.
+func startCluster(server *Server, service *raft.Service) (*raft.GRPCTransport, error) {
+	var peers map[string]string
+	if !cfg.Cluster.Join {
+		peers, _ = cfg.ClusterPeers() // checked by Validate
+	}
+	opts, err := clusterDialOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := raft.NewGRPCTransport(opts...)
+	err = server.joinCluster(raft.Config{
+		ID:        cfg.Cluster.ID,
+		Peers:     peers,
+		Join:      cfg.Cluster.Join,
+		Dir:       cfg.RaftDir(),
+		Cipher:    logCipher(),
+		Transport: transport,
+		Logger:    logger,
+		// a batch of entries must fit in a message
+		MaxAppendSize:   int(cfg.MaxMessageSize / 2),
+		SnapshotEntries: raft.DefaultSnapshotEntries,
+	}, service)
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+	logger.WithFields(logrus.Fields{"id": cfg.Cluster.ID, "nodes": len(server.raft.Members()), "path": cfg.RaftDir()}).Info("joined cluster")
+	return transport, nil
+}
+
+// propose replicates cmd through the Raft log and returns the response of
+// applying it. Only the leader accepts changes, the other nodes redirect the
+// client to it.
+func (s *Server) propose(ctx context.Context, cmd *pb.Command) (interface{}, error) {
+	if proto.Size(cmd) > int(cfg.MaxMessageSize/2) {
+		return nil, status.Error(codes.ResourceExhausted, CommandTooLargeErr.Error())
+	}
+	data, err := proto.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.raft.Propose(ctx, data)
+	if err != nil {
+		return nil, s.raftError(ctx, err)
+	}
+	r := result.(applyResult)
+	return r.resp, r.err
+}
+
+// raftError returns the error a request the Raft node failed is answered
+// with.
+func (s *Server) raftError(ctx context.Context, err error) error {
+	switch err {
+	case raft.ErrNotLeader:
+		return s.redirect(ctx)
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// redirect returns the error a node that is not the leader answers writes
+// with, setting the leader's address in the trailer.
+func (s *Server) redirect(ctx context.Context) error {
+	_, addr := s.raft.Leader()
+	if addr == "" {
+		return status.Error(codes.Unavailable, NoLeaderErr.Error())
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(leaderHeader, addr))
+	return status.Error(codes.Unavailable, fmt.Sprintf("%s: %q", NotLeaderErr, addr))
+}
+
+// snapshotRaft snapshots the data of a cluster node and compacts its log.
+func snapshotRaft(server *Server) error {
+	start := time.Now()
+	err := server.raft.Snapshot()
+	st := server.raft.Status()
+	observeSnapshot(start, st.SnapshotSize, err)
+	if err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{"path": cfg.RaftDir(), "bytes": st.SnapshotSize, "revision": st.SnapshotIndex}).Info("saved raft snapshot")
+	return nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/raft"
+	"github.com/imjching/keev/snapshot"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testCluster runs servers as the nodes of a Raft group on loopback, serving
+// only the Raft service, without TLS.
+type testCluster struct {
+	t       *testing.T
+	dir     string
+	peers   map[string]string
+	servers map[string]*Server
+	grpc    map[string]*grpc.Server
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	dir, _ := ioutil.TempDir("", "keev-cluster")
+	c := &testCluster{t: t, dir: dir, peers: make(map[string]string),
+		servers: make(map[string]*Server), grpc: make(map[string]*grpc.Server)}
+	listeners := make(map[string]net.Listener)
+	for i := 0; i < size; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %s", err.Error())
+		}
+		id := fmt.Sprintf("node%d", i)
+		c.peers[id], listeners[id] = lis.Addr().String(), lis
+	}
+	for id, lis := range listeners {
+		c.start(id, lis)
+	}
+	return c
+}
+
+// start starts the node id, on its address if lis is nil.
+func (c *testCluster) start(id string, lis net.Listener) *Server {
+	return c.startNode(id, lis, false)
+}
+
+// join starts a new node waiting to be added to the cluster.
+func (c *testCluster) join(id string) *Server {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.t.Fatalf("failed to listen: %s", err.Error())
+	}
+	c.peers[id] = lis.Addr().String()
+	return c.startNode(id, lis, true)
+}
+
+func (c *testCluster) startNode(id string, lis net.Listener, join bool) *Server {
+	if lis == nil {
+		var err error
+		if lis, err = net.Listen("tcp", c.peers[id]); err != nil {
+			c.t.Fatalf("failed to listen again: %s", err.Error())
+		}
+	}
+	s := NewServer()
+	service := raft.NewService()
+	g := grpc.NewServer()
+	pb.RegisterRaftServer(g, service)
+	go g.Serve(lis)
+	err := s.joinCluster(raft.Config{
+		ID:                id,
+		Peers:             c.peers,
+		Join:              join,
+		Dir:               filepath.Join(c.dir, id),
+		Transport:         raft.NewGRPCTransport(grpc.WithInsecure()),
+		HeartbeatInterval: 20 * time.Millisecond,
+		ElectionTimeout:   150 * time.Millisecond,
+	}, service)
+	if err != nil {
+		c.t.Fatalf("failed to join the cluster: %s", err.Error())
+	}
+	c.servers[id], c.grpc[id] = s, g
+	return s
+}
+
+func (c *testCluster) stop(id string) {
+	c.grpc[id].Stop()
+	c.servers[id].raft.Stop()
+	delete(c.servers, id)
+}
+
+func (c *testCluster) close() {
+	for id := range c.servers {
+		c.stop(id)
+	}
+	os.RemoveAll(c.dir)
+}
+
+func (c *testCluster) leader() *Server {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, s := range c.servers {
+			if s.raft.IsLeader() {
+				return s
+			}
+		}
+	}
+	c.t.Fatalf("no leader elected")
+	return nil
+}
+
+// mutate applies cmd through the leader, trying again if leadership changes.
+func (c *testCluster) mutate(cmd *pb.Command) (interface{}, error) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := c.leader().mutate(context.Background(), cmd)
+		if status.Code(err) != codes.Unavailable || time.Now().After(deadline) {
+			return resp, err
+		}
+	}
+}
+
+// wait waits until every running node satisfies ok.
+func (c *testCluster) wait(what string, ok func(s *Server) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for id, s := range c.servers {
+		for !ok(s) {
+			if time.Now().After(deadline) {
+				c.t.Fatalf("%s: not replicated to %s, which has %v", what, id, s.Data.Items())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func Test_ClusterReplicatesWrites(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	c := newTestCluster(t, 3)
+	defer c.close()
+
+	leader := c.leader()
+	ctx := context.Background()
+	if _, err := leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.a", Value: "1"}); err != nil {
+		t.Fatalf("failed to set: %s", err.Error())
+	}
+	if _, err := leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.a", Value: "2"}); err != KVPExistsErr {
+		t.Fatalf("expected the key to exist, got %v", err)
+	}
+	resp, err := leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UPDATE, Key: "user.ns.a", Value: "3"})
+	if err != nil || !resp.(*pb.Response).Success {
+		t.Fatalf("failed to update: %v", err)
+	}
+	c.wait("update", func(s *Server) bool {
+		v, _ := s.Data.Get("user.ns.a")
+		return v == "3" && s.usage.User("user").Keys == 1
+	})
+
+	// the other nodes send the client to the leader
+	for _, s := range c.servers {
+		if s == leader {
+			continue
+		}
+		_, err := s.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: "user.ns.a"})
+		_, addr := leader.raft.Leader()
+		if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), addr) {
+			t.Fatalf("expected a redirect to %s, got %v", addr, err)
+		}
+	}
+
+	// expired keys are only removed through the log
+	past := time.Now().Unix() - 1
+	leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.ttl", Value: "x", Expires: past})
+	c.wait("expiring set", func(s *Server) bool { return s.Data.Has("user.ns.ttl") })
+	for _, s := range c.servers {
+		if !s.expire("user.ns.ttl") || (s != leader && !s.Data.Has("user.ns.ttl")) {
+			t.Fatalf("expected the key to be expired but kept until the leader removes it")
+		}
+	}
+	leader.expireKeys()
+	c.wait("expiry", func(s *Server) bool { return !s.Data.Has("user.ns.ttl") && s.Meta.Expiry("user.ns.ttl") == 0 })
+}
+
+func Test_ClusterCatchesUpFromSnapshot(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	c := newTestCluster(t, 3)
+	defer c.close()
+
+	leader := c.leader()
+	var lagging string
+	for id, s := range c.servers {
+		if s != leader {
+			lagging = id
+			break
+		}
+	}
+	c.stop(lagging)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("user.ns.k%d", i)
+		if _, err := leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: key, Value: "v", Expires: 4102444800}); err != nil {
+			t.Fatalf("failed to set: %s", err.Error())
+		}
+	}
+	leader.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: "user.ns.k0"})
+	if err := leader.raft.Snapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+	if st := leader.raft.Status(); st.SnapshotIndex != st.LastIndex || st.SnapshotSize == 0 {
+		t.Fatalf("expected the log to be compacted, got %+v", st)
+	}
+
+	// the entries it missed are gone, the leader sends its snapshot
+	s := c.start(lagging, nil)
+	c.wait("snapshot", func(s *Server) bool { return s.Data.Count() == 9 })
+	if s.Meta.Expiry("user.ns.k1") != 4102444800 || s.usage.User("user").Keys != 9 || s.revision() != leader.revision() {
+		t.Fatalf("snapshot not fully restored: expiry %d, usage %+v, revision %d", s.Meta.Expiry("user.ns.k1"), s.usage.User("user"), s.revision())
+	}
+	if _, err := c.mutate(&pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.after", Value: "1"}); err != nil {
+		t.Fatalf("failed to set after the snapshot: %s", err.Error())
+	}
+	c.wait("write after the snapshot", func(s *Server) bool { return s.Data.Has("user.ns.after") })
+}
+
+func Test_ClusterRestore(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	cfg.MaxMessageSize = 64 << 10
+	users = auth.NewCredentialsStore()
+	c := newTestCluster(t, 3)
+	defer c.close()
+
+	// a backup too large to be restored in one command
+	b := NewServer()
+	value := strings.Repeat("x", 1<<10)
+	for i := 0; i < 300; i++ {
+		b.Data.Set(fmt.Sprintf("user.ns.%d", i), value)
+	}
+	var buf bytes.Buffer
+	b.writeSnapshot(&buf, snapshot.Gzip, "user.ns.")
+	entries, err := readBackup(&buf, "user.ns.")
+	if err != nil {
+		t.Fatalf("failed to read the backup: %s", err.Error())
+	}
+	if cmds := restoreCommands("user.ns.", []string{"user.ns.stale"}, entries); len(cmds) < 2 || cmds[0].Removed[0] != "user.ns.stale" {
+		t.Fatalf("expected the restore to be split, removals first, got %d commands", len(cmds))
+	}
+
+	c.mutate(&pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.stale", Value: "1"})
+	c.wait("stale key", func(s *Server) bool { return s.Data.Has("user.ns.stale") })
+	removed, err := c.leader().restoreBackup(context.Background(), "user.ns.", entries)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected the restore to remove 1 key, got %d, %v", removed, err)
+	}
+	c.wait("restore", func(s *Server) bool {
+		return s.Data.Count() == 300 && !s.Data.Has("user.ns.stale") && s.usage.User("user").Keys == 300
+	})
+}
+
+func Test_ClusterReadConsistency(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	c := newTestCluster(t, 3)
+	defer c.close()
+
+	leader := c.leader()
+	if _, err := c.mutate(&pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.a", Value: "1"}); err != nil {
+		t.Fatalf("failed to set: %s", err.Error())
+	}
+	read := func(s *Server, md ...string) error {
+		return s.read(metadata.NewIncomingContext(context.Background(), metadata.Pairs(md...)))
+	}
+	for _, consistency := range []string{ConsistencyLinearizable, ConsistencyLease} {
+		if err := read(leader, consistencyHeader, consistency); err != nil || !leader.Data.Has("user.ns.a") {
+			t.Fatalf("expected a %s read from the leader, got %v", consistency, err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond) // a heartbeat tells the followers the key is committed
+	_, addr := leader.raft.Leader()
+	for _, s := range c.servers {
+		if s == leader {
+			continue
+		}
+		if err := read(s, consistencyHeader, ConsistencyLinearizable); status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), addr) {
+			t.Fatalf("expected a redirect to %s, got %v", addr, err)
+		}
+		if err := read(s, consistencyHeader, ConsistencyBounded, maxStalenessHeader, "1s"); err != nil || !s.Data.Has("user.ns.a") {
+			t.Fatalf("expected a bounded read from a follower, got %v", err)
+		}
+		if err := read(s, consistencyHeader, ConsistencyBounded, maxStalenessHeader, "1ns"); status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected the follower to be too stale, got %v", err)
+		}
+		if err := read(s); err != nil {
+			t.Fatalf("expected a local read by default, got %v", err)
+		}
+	}
+	for _, md := range [][]string{{consistencyHeader, "eventual"}, {maxStalenessHeader, "soon"}} {
+		if err := read(leader, md...); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected %v to be rejected, got %v", md, err)
+		}
+	}
+}
+
+func Test_ClusterMembership(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	c := newTestCluster(t, 3)
+	defer c.close()
+
+	if _, err := c.mutate(&pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.a", Value: "1"}); err != nil {
+		t.Fatalf("failed to set: %s", err.Error())
+	}
+	leader := c.leader()
+	if err := leader.raft.Snapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+
+	// the new node catches up from the snapshot, then votes
+	s := c.join("node3")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := leader.raft.AddVoter(ctx, "node3", c.peers["node3"]); err != nil {
+		t.Fatalf("failed to add a voter: %s", err.Error())
+	}
+	c.wait("new member", func(s *Server) bool {
+		m := s.raft.Members()
+		return s.Data.Has("user.ns.a") && s.usage.User("user").Keys == 1 && len(m) == 4 && m[3].ID == "node3" && !m[3].Learner
+	})
+	if st := s.raft.Status(); st.SnapshotIndex == 0 {
+		t.Fatalf("expected the new node to be sent the snapshot, got %+v", st)
+	}
+
+	err := leader.membershipError(ctx, "node3", leader.raft.AddLearner(ctx, "node3", c.peers["node3"]))
+	if status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), MemberExistsErr.Error()) {
+		t.Fatalf("expected the node to exist, got %v", err)
+	}
+	for _, other := range c.servers {
+		if other != leader {
+			err := other.membershipError(ctx, "node3", other.raft.RemoveMember(ctx, "node3"))
+			if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), NotLeaderErr.Error()) {
+				t.Fatalf("expected a redirect to the leader, got %v", err)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/imjching/keev/cmap"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+)
+
+// mutate makes the change cmd describes, stamped with the current time. A
+// standalone server applies it right away, stamping it with a version if it
+// is a site, a cluster node proposes it to the Raft group and returns once
+// it has applied it, a replica redirects it to the primary.
+func (s *Server) mutate(ctx context.Context, cmd *pb.Command) (interface{}, error) {
+	cmd.Now = time.Now().Unix()
+	if s.replica != nil {
+		return nil, s.replica.redirect(ctx)
+	}
+	if s.sites != nil {
+		return s.sites.apply(cmd)
+	}
+	if s.raft == nil {
+		return s.apply(cmd)
+	}
+	return s.propose(ctx, cmd)
+}
+
+// apply makes the change cmd describes and returns the response of the RPC
+// that made it. Given the same data, every node of a cluster must make the
+// same change: it only depends on cmd, the data and the users and quotas,
+// which must be the same on every node.
+func (s *Server) apply(cmd *pb.Command) (interface{}, error) {
+	switch cmd.Op {
+	case pb.CommandOp_CMD_SET:
+		return s.applySet(cmd)
+	case pb.CommandOp_CMD_UPDATE:
+		return s.applyUpdate(cmd)
+	case pb.CommandOp_CMD_UNSET:
+		return s.applyUnset(cmd)
+	case pb.CommandOp_CMD_EXPIRE:
+		s.applyExpire(cmd)
+		return nil, nil
+	case pb.CommandOp_CMD_RESTORE:
+		return s.restore(cmd.Removed, cmd.Entries), nil
+	}
+	return nil, nil
+}
+
+// splitKey splits a full key into the username, namespace and key.
+func splitKey(key string) (username, namespace, name string) {
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) != 3 {
+		return key, "", ""
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func (s *Server) applySet(cmd *pb.Command) (interface{}, error) {
+	username, namespace, name := splitKey(cmd.Key)
+	s.expireAt(cmd.Key, cmd.Now)
+	size := entrySize(name, cmd.Value)
+	if err := s.reserve(username, namespace, 1, size); err != nil {
+		return nil, err
+	}
+	if err := s.makeRoom(cmd.Key, cmap.Size(cmd.Key, cmd.Value)); err != nil {
+		s.release(username, namespace, 1, size)
+		return nil, err
+	}
+	if !s.Data.SetIfAbsent(cmd.Key, cmd.Value) {
+		s.release(username, namespace, 1, size)
+		return nil, KVPExistsErr
+	}
+	s.versions.forget(cmd.Key)
+	s.Meta.Touch(cmd.Key)
+	s.setExpiry(cmd.Key, cmd.Expires)
+	return &pb.Response{Success: true, Value: "(1 pair(s) affected)"}, nil
+}
+
+func (s *Server) applyUpdate(cmd *pb.Command) (interface{}, error) {
+	username, namespace, _ := splitKey(cmd.Key)
+	s.expireAt(cmd.Key, cmd.Now)
+	value, ok := s.Data.Get(cmd.Key)
+	if !ok {
+		return nil, KVPMissingErr
+	}
+	// reserve for the value seen now and correct if it changed in the meantime
+	growth := int64(len(cmd.Value) - len(value.(string)))
+	if err := s.reserve(username, namespace, 0, growth); err != nil {
+		return nil, err
+	}
+	if err := s.makeRoom(cmd.Key, growth); err != nil {
+		s.release(username, namespace, 0, growth)
+		return nil, err
+	}
+	old, ok := s.Data.Replace(cmd.Key, cmd.Value)
+	if !ok {
+		s.release(username, namespace, 0, growth)
+		return nil, KVPMissingErr
+	}
+	s.release(username, namespace, 0, int64(len(old.(string))-len(value.(string))))
+	s.versions.forget(cmd.Key)
+	s.Meta.Touch(cmd.Key)
+	s.setExpiry(cmd.Key, cmd.Expires)
+	return &pb.Response{Success: true, Value: "(1 pair(s) affected)"}, nil
+}
+
+func (s *Server) applyUnset(cmd *pb.Command) (interface{}, error) {
+	username, namespace, name := splitKey(cmd.Key)
+	s.expireAt(cmd.Key, cmd.Now)
+	value, ok := s.Data.Pop(cmd.Key)
+	if !ok {
+		return nil, KVPMissingErr
+	}
+	s.release(username, namespace, 1, entrySize(name, value.(string)))
+	s.versions.forget(cmd.Key)
+	s.Meta.Remove(cmd.Key)
+	return &pb.KeyValuePair{Key: name, Value: value.(string)}, nil
+}
+
+// applyExpire removes a key the leader found expired, unless it was written
+// again since.
+func (s *Server) applyExpire(cmd *pb.Command) {
+	if expires := s.Meta.Expiry(cmd.Key); expires == 0 || expires > cmd.Now {
+		return
+	}
+	if s.dropKey(cmd.Key) {
+		s.Meta.Expired(cmd.Key)
+	} else {
+		s.Meta.Remove(cmd.Key)
+	}
+}
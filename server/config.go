@@ -0,0 +1,604 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imjching/keev/audit"
+	"github.com/imjching/keev/conflict"
+	"github.com/imjching/keev/encrypt"
+	"github.com/imjching/keev/evict"
+	"github.com/imjching/keev/snapshot"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fsync policies for snapshot writes.
+const (
+	FsyncAlways = "always" // fsync every snapshot before it replaces the previous one
+	FsyncNever  = "never"  // leave flushing to the operating system
+)
+
+// Duration is a time.Duration written as a string such as "5m" in the
+// config file.
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// TLSConfig holds the server certificate and client certificate settings.
+type TLSConfig struct {
+	Cert              string `yaml:"cert"`
+	Key               string `yaml:"key"`
+	ClientCA          string `yaml:"client_ca"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+}
+
+// ClusterConfig places the server in a Raft group, see package raft.
+type ClusterConfig struct {
+	ID     string `yaml:"id"`     // empty to run standalone
+	Peers  string `yaml:"peers"`  // id=host:port of every node, comma separated
+	Join   bool   `yaml:"join"`   // wait to be added to an existing cluster instead of forming one with peers
+	Secret string `yaml:"secret"` // shared by the nodes to authenticate each other
+	CA     string `yaml:"ca"`     // CA certificate(s) verifying the other nodes
+	// ReadConsistency is the consistency of reads that do not choose one,
+	// see readConsistency
+	ReadConsistency string   `yaml:"read_consistency"`
+	MaxStaleness    Duration `yaml:"max_staleness"` // of bounded reads that do not choose one
+}
+
+// ReplicationConfig makes a standalone server a primary that read-only
+// replicas follow, or a replica of one, see replication.go.
+type ReplicationConfig struct {
+	Primary string `yaml:"primary"` // host:port of the primary, makes the server a replica
+	Secret  string `yaml:"secret"`  // shared by the primary and its replicas, empty to disable replication
+	CA      string `yaml:"ca"`      // CA certificate(s) verifying the primary
+	Backlog int64  `yaml:"backlog"` // changes the primary, or a site, keeps for replicas and sites that reconnect
+}
+
+// ShardingConfig makes the server one of the shards the keys are spread
+// over, see sharding.go.
+type ShardingConfig struct {
+	ID     string `yaml:"id"`     // empty to hold every key
+	Nodes  string `yaml:"nodes"`  // id=host:port of every shard, comma separated, the first shard map
+	Secret string `yaml:"secret"` // shared by the shards to authenticate each other
+	CA     string `yaml:"ca"`     // CA certificate(s) verifying the other shards
+}
+
+// SitesConfig makes the server a site accepting writes on its own and
+// exchanging them with other sites, see sites.go.
+type SitesConfig struct {
+	ID           string   `yaml:"id"`            // empty to disable
+	Peers        string   `yaml:"peers"`         // id=host:port of every other site, comma separated
+	Secret       string   `yaml:"secret"`        // shared by the sites to authenticate each other
+	CA           string   `yaml:"ca"`            // CA certificate(s) verifying the other sites
+	Conflicts    string   `yaml:"conflicts"`     // lww or siblings, see package conflict
+	TombstoneTTL Duration `yaml:"tombstone_ttl"` // how long deleted keys are remembered
+}
+
+// Config is the server configuration. It is read from the file given with
+// --config, then overridden by KEEV_* environment variables and finally by
+// command-line flags, except for the secrets. Empty file paths default to
+// files inside DataDir.
+type Config struct {
+	Listen              string            `yaml:"listen"`
+	TLS                 TLSConfig         `yaml:"tls"`
+	Cluster             ClusterConfig     `yaml:"cluster"`
+	Replication         ReplicationConfig `yaml:"replication"`
+	Sharding            ShardingConfig    `yaml:"sharding"`
+	Sites               SitesConfig       `yaml:"sites"`
+	DataDir             string            `yaml:"data_dir"`
+	Users               string            `yaml:"users"`
+	JWTKeys             string            `yaml:"jwt_keys"`
+	APIKeys             string            `yaml:"api_keys"`
+	AuditDir            string            `yaml:"audit_dir"` // "off" disables auditing
+	AuditMaxSize        int64             `yaml:"audit_max_size"`
+	AuditKey            string            `yaml:"audit_key"` // signs the audit log, kept outside AuditDir
+	SnapshotInterval    Duration          `yaml:"snapshot_interval"`
+	Fsync               string            `yaml:"fsync"`
+	SnapshotCompression string            `yaml:"snapshot_compression"`
+	EncryptionKeys      string            `yaml:"encryption_keys"` // key file, see package encrypt
+	WALDir              string            `yaml:"wal_dir"`         // "off" disables the write log
+	WALSyncInterval     Duration          `yaml:"wal_sync_interval"`
+	ArchiveInterval     Duration          `yaml:"archive_interval"`
+	RecoveryWindow      Duration          `yaml:"recovery_window"`
+	MaxMemory           int64             `yaml:"max_memory"`
+	EvictionPolicy      string            `yaml:"eviction_policy"`
+	MaxMessageSize      int64             `yaml:"max_message_size"`
+	LogLevel            string            `yaml:"log_level"`
+	LogFormat           string            `yaml:"log_format"`
+	SlowRequest         Duration          `yaml:"slow_request"` // 0 disables slow request logging
+	MetricsListen       string            `yaml:"metrics_listen"`
+	ShutdownTimeout     Duration          `yaml:"shutdown_timeout"`
+}
+
+// DefaultConfig returns the configuration used when nothing is overridden.
+func DefaultConfig() *Config {
+	return &Config{
+		Listen:              ":1234",
+		TLS:                 TLSConfig{Cert: "keys/cert.pem", Key: "keys/key.pem"},
+		Cluster:             ClusterConfig{ReadConsistency: ConsistencyLocal, MaxStaleness: Duration(5 * time.Second)},
+		Replication:         ReplicationConfig{Backlog: 10000},
+		Sites:               SitesConfig{Conflicts: conflict.LastWriterWins, TombstoneTTL: Duration(24 * time.Hour)},
+		DataDir:             "data",
+		AuditMaxSize:        audit.DefaultMaxSize,
+		SnapshotInterval:    Duration(5 * time.Minute),
+		Fsync:               FsyncAlways,
+		SnapshotCompression: "none",
+		WALSyncInterval:     Duration(time.Second),
+		ArchiveInterval:     Duration(time.Hour),
+		RecoveryWindow:      Duration(24 * time.Hour),
+		EvictionPolicy:      evict.NoEviction,
+		MaxMessageSize:      4 << 20,
+		LogLevel:            "info",
+		LogFormat:           "logfmt",
+		SlowRequest:         Duration(500 * time.Millisecond),
+		ShutdownTimeout:     Duration(30 * time.Second),
+	}
+}
+
+// option is a setting that can be overridden with a flag and with the
+// environment variable KEEV_<NAME>, where NAME is the flag name in upper
+// case with dashes replaced by underscores.
+type option struct {
+	name  string
+	usage string
+	field func(c *Config) interface{} // pointer to the field it sets
+}
+
+var options = []option{
+	{"listen", "address to listen on", func(c *Config) interface{} { return &c.Listen }},
+	{"tls-cert", "server certificate", func(c *Config) interface{} { return &c.TLS.Cert }},
+	{"tls-key", "server private key", func(c *Config) interface{} { return &c.TLS.Key }},
+	{"client-ca", "CA certificate(s) used to verify client certificates, enables mutual TLS", func(c *Config) interface{} { return &c.TLS.ClientCA }},
+	{"require-client-cert", "reject clients that do not present a valid certificate (requires --client-ca)", func(c *Config) interface{} { return &c.TLS.RequireClientCert }},
+	{"cluster-id", "ID of this node in --cluster-peers, empty to run standalone", func(c *Config) interface{} { return &c.Cluster.ID }},
+	{"cluster-peers", "every node of the Raft group, including this one, as id=host:port,...", func(c *Config) interface{} { return &c.Cluster.Peers }},
+	{"cluster-join", "wait to be added to an existing cluster, with \"cluster add\", instead of forming one with --cluster-peers", func(c *Config) interface{} { return &c.Cluster.Join }},
+	{"cluster-ca", "CA certificate(s) used to verify the other nodes, or their own certificate", func(c *Config) interface{} { return &c.Cluster.CA }},
+	{"read-consistency", "consistency of reads that do not choose one: linearizable, lease, bounded or local", func(c *Config) interface{} { return &c.Cluster.ReadConsistency }},
+	{"max-staleness", "how far behind the leader bounded reads may be, unless they choose", func(c *Config) interface{} { return &c.Cluster.MaxStaleness }},
+	{"replication-primary", "address of the primary to follow as a read-only replica, empty to accept writes", func(c *Config) interface{} { return &c.Replication.Primary }},
+	{"replication-ca", "CA certificate(s) used to verify the primary, or its own certificate", func(c *Config) interface{} { return &c.Replication.CA }},
+	{"replication-backlog", "changes a primary or a site keeps in memory for replicas and sites that reconnect, older ones are sent a snapshot", func(c *Config) interface{} { return &c.Replication.Backlog }},
+	{"shard-id", "ID of this server in the shard map, empty to hold every key", func(c *Config) interface{} { return &c.Sharding.ID }},
+	{"shard-nodes", "every shard, including this one, as id=host:port,..., to start a shard map; empty to wait to be added with \"shard add\"", func(c *Config) interface{} { return &c.Sharding.Nodes }},
+	{"shard-ca", "CA certificate(s) used to verify the other shards, or their own certificate", func(c *Config) interface{} { return &c.Sharding.CA }},
+	{"site-id", "ID of this site, empty unless writes are exchanged with other sites", func(c *Config) interface{} { return &c.Sites.ID }},
+	{"site-peers", "every other site, as id=host:port,...", func(c *Config) interface{} { return &c.Sites.Peers }},
+	{"site-ca", "CA certificate(s) used to verify the other sites, or their own certificate", func(c *Config) interface{} { return &c.Sites.CA }},
+	{"site-conflicts", "how concurrent writes of different sites are resolved: lww (last writer wins) or siblings (Get returns them all)", func(c *Config) interface{} { return &c.Sites.Conflicts }},
+	{"site-tombstone-ttl", "how long deleted keys are remembered, so deletions reach sites that were away", func(c *Config) interface{} { return &c.Sites.TombstoneTTL }},
+	{"data-dir", "directory holding the data and, by default, every other file", func(c *Config) interface{} { return &c.DataDir }},
+	{"users", "user store (default <data-dir>/users.json)", func(c *Config) interface{} { return &c.Users }},
+	{"jwt-keys", "JWT key file (default <data-dir>/jwt_keys.json)", func(c *Config) interface{} { return &c.JWTKeys }},
+	{"api-keys", "API key store (default <data-dir>/api_keys.json)", func(c *Config) interface{} { return &c.APIKeys }},
+	{"audit-dir", "directory of the audit log (default <data-dir>/audit), \"off\" to disable auditing", func(c *Config) interface{} { return &c.AuditDir }},
+	{"audit-max-size", "size in bytes after which the audit log is rotated", func(c *Config) interface{} { return &c.AuditMaxSize }},
+	{"audit-key", "file holding the key the audit log is signed with, created if missing, outside --audit-dir (default <data-dir>/audit.key)", func(c *Config) interface{} { return &c.AuditKey }},
+	{"snapshot-interval", "how often the data is saved to disk", func(c *Config) interface{} { return &c.SnapshotInterval }},
+	{"fsync", "fsync policy for snapshots: always or never", func(c *Config) interface{} { return &c.Fsync }},
+	{"snapshot-compression", "compression of snapshots: none or gzip", func(c *Config) interface{} { return &c.SnapshotCompression }},
+	{"encryption-keys", "key file used to encrypt the data at rest, empty to use $" + encrypt.KeyEnv + " or to disable encryption", func(c *Config) interface{} { return &c.EncryptionKeys }},
+	{"wal-dir", "directory of the write log (default <data-dir>/wal), \"off\" to disable it and point-in-time recovery", func(c *Config) interface{} { return &c.WALDir }},
+	{"wal-sync-interval", "how often the write log is flushed to disk, 0 to flush every write", func(c *Config) interface{} { return &c.WALSyncInterval }},
+	{"archive-interval", "how often a snapshot is kept for point-in-time recovery", func(c *Config) interface{} { return &c.ArchiveInterval }},
+	{"recovery-window", "how far back the store can be recovered, older snapshots and log segments are removed", func(c *Config) interface{} { return &c.RecoveryWindow }},
+	{"max-memory", "maximum bytes of keys and values stored, 0 for unlimited", func(c *Config) interface{} { return &c.MaxMemory }},
+	{"eviction-policy", "what to do when --max-memory is reached: noeviction, allkeys-lru, allkeys-lfu or volatile-ttl", func(c *Config) interface{} { return &c.EvictionPolicy }},
+	{"max-message-size", "maximum size in bytes of a request", func(c *Config) interface{} { return &c.MaxMessageSize }},
+	{"log-level", "minimum level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"log-format", "log format: logfmt or json", func(c *Config) interface{} { return &c.LogFormat }},
+	{"metrics-listen", "address of the HTTP listener serving Prometheus metrics at /metrics, empty to disable", func(c *Config) interface{} { return &c.MetricsListen }},
+	{"shutdown-timeout", "how long shutdown waits for in-flight requests before closing connections", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"slow-request", "requests taking longer than this are logged as warnings, 0 to disable", func(c *Config) interface{} { return &c.SlowRequest }},
+}
+
+// secretOptions are the settings only read from the config file and the
+// environment, never from flags: a flag would show them to anyone listing
+// the processes.
+var secretOptions = []option{
+	{"cluster-secret", "secret the nodes of the cluster authenticate each other with", func(c *Config) interface{} { return &c.Cluster.Secret }},
+	{"replication-secret", "secret replicas authenticate to the primary with, empty to disable replication", func(c *Config) interface{} { return &c.Replication.Secret }},
+	{"shard-secret", "secret the shards authenticate each other with", func(c *Config) interface{} { return &c.Sharding.Secret }},
+	{"site-secret", "secret the sites authenticate each other with", func(c *Config) interface{} { return &c.Sites.Secret }},
+}
+
+func (o *option) env() string {
+	return "KEEV_" + strings.ToUpper(strings.Replace(o.name, "-", "_", -1))
+}
+
+// get formats the field of c the option points to.
+func (o *option) get(c *Config) string {
+	switch p := o.field(c).(type) {
+	case *string:
+		return *p
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *int64:
+		return strconv.FormatInt(*p, 10)
+	case *Duration:
+		return time.Duration(*p).String()
+	}
+	return ""
+}
+
+// set parses s into the field of c the option points to.
+func (o *option) set(c *Config, s string) error {
+	switch p := o.field(c).(type) {
+	case *string:
+		*p = s
+	case *bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *int64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *Duration:
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*p = Duration(v)
+	}
+	return nil
+}
+
+// flagValue records the flags set on the command line, which are applied
+// after the config file and the environment.
+type flagValue struct {
+	opt    *option
+	isBool bool
+	value  *string
+}
+
+func (f *flagValue) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := f.opt.set(DefaultConfig(), s); err != nil {
+		return err
+	}
+	f.value = &s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+var configFile = flag.String("config", "", "YAML config file")
+var printConfig = flag.Bool("print-config", false, "print the effective configuration and exit")
+
+var flagValues = registerFlags()
+
+func registerFlags() []*flagValue {
+	defaults := DefaultConfig()
+	values := make([]*flagValue, len(options))
+	for i := range options {
+		opt := &options[i]
+		_, isBool := opt.field(defaults).(*bool)
+		values[i] = &flagValue{opt: opt, isBool: isBool}
+		usage := opt.usage + " ($" + opt.env() + ")"
+		if def := opt.get(defaults); def != "" && !isBool {
+			usage += " (default " + def + ")"
+		}
+		flag.Var(values[i], opt.name, usage)
+	}
+	return values
+}
+
+// loadConfig builds the configuration from the defaults, the config file,
+// the environment and the flags, in that order, and validates it.
+func loadConfig() (*Config, error) {
+	c := DefaultConfig()
+	if *configFile != "" {
+		b, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, fmt.Errorf("%s: %s", *configFile, err.Error())
+		}
+	}
+	for _, opts := range [][]option{options, secretOptions} {
+		for i := range opts {
+			opt := &opts[i]
+			if s, ok := os.LookupEnv(opt.env()); ok {
+				if err := opt.set(c, s); err != nil {
+					return nil, fmt.Errorf("$%s: %s", opt.env(), err.Error())
+				}
+			}
+		}
+	}
+	for _, f := range flagValues {
+		if f.value != nil {
+			f.opt.set(c, *f.value) // already checked by Set
+		}
+	}
+	c.resolvePaths()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// redacted returns a copy of c whose secrets are hidden, to be printed.
+func (c *Config) redacted() *Config {
+	r := *c
+	for i := range secretOptions {
+		if opt := &secretOptions[i]; opt.get(&r) != "" {
+			opt.set(&r, "[REDACTED]")
+		}
+	}
+	return &r
+}
+
+// resolvePaths places files that were not given explicitly inside DataDir.
+func (c *Config) resolvePaths() {
+	defaults := []struct {
+		path *string
+		name string
+	}{
+		{&c.Users, "users.json"},
+		{&c.JWTKeys, "jwt_keys.json"},
+		{&c.APIKeys, "api_keys.json"},
+		{&c.AuditDir, "audit"},
+		{&c.AuditKey, "audit.key"},
+		{&c.WALDir, "wal"},
+	}
+	for _, d := range defaults {
+		if *d.path == "" {
+			*d.path = filepath.Join(c.DataDir, d.name)
+		}
+	}
+}
+
+// DataFile is the path of the snapshot of the data.
+func (c *Config) DataFile() string {
+	return filepath.Join(c.DataDir, "data.snap")
+}
+
+// LegacyDataFile is the path of the JSON snapshot written by earlier
+// versions, which is migrated on startup.
+func (c *Config) LegacyDataFile() string {
+	return filepath.Join(c.DataDir, "data.json")
+}
+
+// ArchiveDir is the directory of the snapshots kept for point-in-time
+// recovery, named after their revision.
+func (c *Config) ArchiveDir() string {
+	return filepath.Join(c.DataDir, "snapshots")
+}
+
+// WALEnabled returns false if the write log was turned off. A cluster
+// replaces it with the Raft log, a replica has the changes of its primary.
+func (c *Config) WALEnabled() bool {
+	return c.WALDir != "off" && !c.ClusterEnabled() && !c.IsReplica()
+}
+
+// ClusterEnabled returns true if the server is a node of a Raft group.
+func (c *Config) ClusterEnabled() bool {
+	return c.Cluster.ID != ""
+}
+
+// ClusterPeers parses Cluster.Peers into the address of every node by ID.
+func (c *Config) ClusterPeers() (map[string]string, error) {
+	return parsePeers(c.Cluster.Peers)
+}
+
+// parsePeers parses a list of id=host:port into the address of every server
+// by ID.
+func parsePeers(s string) (map[string]string, error) {
+	peers := make(map[string]string)
+	for _, peer := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(peer), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected id=host:port, got %q", peer)
+		}
+		if _, _, err := net.SplitHostPort(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid address %q", parts[1])
+		}
+		if _, ok := peers[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicate node %q", parts[0])
+		}
+		peers[parts[0]] = parts[1]
+	}
+	return peers, nil
+}
+
+// ReplicationEnabled returns true if the server is a primary or a replica.
+func (c *Config) ReplicationEnabled() bool {
+	return c.Replication.Secret != ""
+}
+
+// IsReplica returns true if the server follows a primary.
+func (c *Config) IsReplica() bool {
+	return c.Replication.Primary != ""
+}
+
+// ShardingEnabled returns true if the server holds a shard of the keys.
+func (c *Config) ShardingEnabled() bool {
+	return c.Sharding.ID != ""
+}
+
+// ShardNodes parses Sharding.Nodes into the address of every shard by ID.
+func (c *Config) ShardNodes() (map[string]string, error) {
+	return parsePeers(c.Sharding.Nodes)
+}
+
+// ShardFile is the path of the shard map of a shard.
+func (c *Config) ShardFile() string {
+	return filepath.Join(c.DataDir, "shards.pb")
+}
+
+// SitesEnabled returns true if the server is a site.
+func (c *Config) SitesEnabled() bool {
+	return c.Sites.ID != ""
+}
+
+// SitePeers parses Sites.Peers into the address of every other site by ID.
+func (c *Config) SitePeers() (map[string]string, error) {
+	if c.Sites.Peers == "" {
+		return map[string]string{}, nil
+	}
+	return parsePeers(c.Sites.Peers)
+}
+
+// RaftDir is the directory of the Raft log and snapshot of a cluster node.
+func (c *Config) RaftDir() string {
+	return filepath.Join(c.DataDir, "raft")
+}
+
+// EncryptionEnabled returns true if the data is encrypted at rest, with the
+// keys in EncryptionKeys or the key in KEEV_ENCRYPTION_KEY.
+func (c *Config) EncryptionEnabled() bool {
+	return c.EncryptionKeys != "" || os.Getenv(encrypt.KeyEnv) != ""
+}
+
+// AuditEnabled returns false if auditing was turned off.
+func (c *Config) AuditEnabled() bool {
+	return c.AuditDir != "off"
+}
+
+// AuditHead is the path of the file holding the last record of the audit
+// log, kept outside AuditDir.
+func (c *Config) AuditHead() string {
+	return filepath.Join(c.DataDir, "audit.head")
+}
+
+// within returns true if path is inside dir.
+func within(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Validate returns an error listing every invalid setting.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	_, _, err := net.SplitHostPort(c.Listen)
+	check(err == nil, "listen: invalid address %q", c.Listen)
+	check(c.TLS.Cert != "" && c.TLS.Key != "", "tls: cert and key are required")
+	check(!c.TLS.RequireClientCert || c.TLS.ClientCA != "", "tls: require_client_cert needs client_ca")
+	check(c.DataDir != "", "data_dir: must not be empty")
+	if c.ClusterEnabled() && !c.Cluster.Join {
+		peers, err := c.ClusterPeers()
+		check(err == nil, "cluster: peers: %v", err)
+		_, ok := peers[c.Cluster.ID]
+		check(err != nil || ok, "cluster: id %q is not one of the peers", c.Cluster.ID)
+	}
+	if c.ClusterEnabled() {
+		check(c.Cluster.Secret != "", "cluster: secret is required")
+		check(c.Cluster.CA != "", "cluster: ca is required")
+		// which key is evicted depends on the reads each node served
+		check(c.MaxMemory == 0 || c.EvictionPolicy == evict.NoEviction, "eviction_policy: only %s is supported in a cluster", evict.NoEviction)
+	}
+	check(isConsistency(c.Cluster.ReadConsistency), "cluster: read_consistency: expected linearizable, lease, bounded or local, got %q", c.Cluster.ReadConsistency)
+	check(c.Cluster.MaxStaleness > 0, "cluster: max_staleness: must be positive")
+	if c.ReplicationEnabled() || c.IsReplica() {
+		check(!c.ClusterEnabled(), "replication: a cluster node cannot be a primary or a replica")
+	}
+	if c.IsReplica() {
+		_, _, err := net.SplitHostPort(c.Replication.Primary)
+		check(err == nil, "replication: primary: invalid address %q", c.Replication.Primary)
+		check(c.ReplicationEnabled(), "replication: secret is required")
+		check(c.Replication.CA != "", "replication: ca is required")
+	}
+	if c.ShardingEnabled() {
+		check(c.Sharding.Secret != "", "sharding: secret is required")
+		check(c.Sharding.CA != "", "sharding: ca is required")
+		check(!c.ClusterEnabled() && !c.ReplicationEnabled() && !c.IsReplica(), "sharding: a shard cannot be a cluster node, a primary or a replica")
+		if c.Sharding.Nodes != "" {
+			nodes, err := c.ShardNodes()
+			check(err == nil, "sharding: nodes: %v", err)
+			_, ok := nodes[c.Sharding.ID]
+			check(err != nil || ok, "sharding: id %q is not one of the nodes", c.Sharding.ID)
+		}
+	}
+	if c.SitesEnabled() {
+		check(c.Sites.Secret != "", "sites: secret is required")
+		check(c.Sites.CA != "", "sites: ca is required")
+		check(!c.ClusterEnabled() && !c.ShardingEnabled() && !c.IsReplica(), "sites: a site cannot be a cluster node, a shard or a replica")
+		peers, err := c.SitePeers()
+		check(err == nil, "sites: peers: %v", err)
+		_, ok := peers[c.Sites.ID]
+		check(!ok, "sites: peers: must not include the site itself")
+	}
+	check(c.Sites.Conflicts == conflict.LastWriterWins || c.Sites.Conflicts == conflict.KeepSiblings, "sites: conflicts: expected %s or %s, got %q", conflict.LastWriterWins, conflict.KeepSiblings, c.Sites.Conflicts)
+	check(c.Sites.TombstoneTTL > 0, "sites: tombstone_ttl: must be positive")
+	check(c.Replication.Backlog > 0, "replication: backlog: must be positive")
+	check(c.AuditMaxSize >= 0, "audit_max_size: must not be negative")
+	if c.AuditEnabled() && c.AuditDir != "" {
+		// whoever can rewrite the log must not be able to sign it
+		check(c.AuditKey == "" || !within(c.AuditDir, c.AuditKey), "audit_key: must not be inside audit_dir")
+		check(!within(c.AuditDir, c.AuditHead()), "audit_dir: must not hold data_dir, where the head of the audit log is kept")
+	}
+	check(c.SnapshotInterval > 0, "snapshot_interval: must be positive")
+	check(c.Fsync == FsyncAlways || c.Fsync == FsyncNever, "fsync: expected %s or %s, got %q", FsyncAlways, FsyncNever, c.Fsync)
+	_, err = snapshot.ParseCompression(c.SnapshotCompression)
+	check(err == nil, "snapshot_compression: %v", err)
+	check(c.WALSyncInterval >= 0, "wal_sync_interval: must not be negative")
+	check(c.ArchiveInterval > 0, "archive_interval: must be positive")
+	check(c.RecoveryWindow >= 0, "recovery_window: must not be negative")
+	check(c.MaxMemory >= 0, "max_memory: must not be negative")
+	_, err = evict.Lookup(c.EvictionPolicy)
+	check(err == nil, "eviction_policy: %v", err)
+	check(c.MaxMessageSize > 0, "max_message_size: must be positive")
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log_level: expected debug, info, warn or error, got %q", c.LogLevel)
+	}
+	check(c.LogFormat == "logfmt" || c.LogFormat == "json", "log_format: expected logfmt or json, got %q", c.LogFormat)
+	check(c.SlowRequest >= 0, "slow_request: must not be negative")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout: must be positive")
+	if c.MetricsListen != "" {
+		_, _, err = net.SplitHostPort(c.MetricsListen)
+		check(err == nil, "metrics_listen: invalid address %q", c.MetricsListen)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
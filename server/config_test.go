@@ -0,0 +1,184 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ConfigPrecedence(t *testing.T) {
+	file, _ := ioutil.TempFile("", "keev-config")
+	defer os.Remove(file.Name())
+	file.WriteString("listen: \":9000\"\ndata_dir: /var/lib/keev\nmax_memory: 100\nsnapshot_interval: 30s\n")
+	file.Close()
+
+	*configFile = file.Name()
+	defer func() { *configFile = "" }()
+	os.Setenv("KEEV_MAX_MEMORY", "200")
+	defer os.Unsetenv("KEEV_MAX_MEMORY")
+	os.Setenv("KEEV_FSYNC", "never")
+	defer os.Unsetenv("KEEV_FSYNC")
+	for _, f := range flagValues {
+		if f.opt.name == "fsync" {
+			f.Set(FsyncAlways)
+			defer func(f *flagValue) { f.value = nil }(f)
+		}
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err.Error())
+	}
+	if c.Listen != ":9000" || c.SnapshotInterval != Duration(30*time.Second) {
+		t.Fatalf("config file not applied: %+v", c)
+	}
+	if c.MaxMemory != 200 {
+		t.Fatalf("environment did not override config file: %d", c.MaxMemory)
+	}
+	if c.Fsync != FsyncAlways {
+		t.Fatalf("flag did not override environment: %s", c.Fsync)
+	}
+	if c.Users != "/var/lib/keev/users.json" || c.DataFile() != "/var/lib/keev/data.snap" || c.AuditKey != "/var/lib/keev/audit.key" {
+		t.Fatalf("paths not resolved against data_dir: %s, %s", c.Users, c.DataFile())
+	}
+}
+
+func Test_ConfigSecrets(t *testing.T) {
+	for _, f := range flagValues {
+		if strings.HasSuffix(f.opt.name, "-secret") {
+			t.Fatalf("secret given as a flag: --%s", f.opt.name)
+		}
+	}
+	os.Setenv("KEEV_SITE_SECRET", "s3cret")
+	defer os.Unsetenv("KEEV_SITE_SECRET")
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err.Error())
+	}
+	if c.Sites.Secret != "s3cret" {
+		t.Fatalf("secret not read from the environment: %q", c.Sites.Secret)
+	}
+	r := c.redacted()
+	if r.Sites.Secret != "[REDACTED]" || r.Cluster.Secret != "" || c.Sites.Secret != "s3cret" {
+		t.Fatalf("expected only the set secret of the copy redacted, got %+v", r.Sites)
+	}
+}
+
+func Test_ConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %s", err.Error())
+	}
+
+	c := DefaultConfig()
+	c.Listen = "1234"
+	c.Fsync = "sometimes"
+	c.EvictionPolicy = "random"
+	c.TLS.RequireClientCert = true
+	// the audit log would be signed, and its head kept, inside it
+	c.AuditDir, c.AuditKey = "data", "data/audit.key"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("invalid config accepted")
+	}
+	for _, field := range []string{"listen", "fsync", "eviction_policy", "require_client_cert", "audit_key", "audit_dir"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("error does not mention %s: %s", field, err.Error())
+		}
+	}
+}
+
+func Test_ConfigCluster(t *testing.T) {
+	c := DefaultConfig()
+	c.Cluster.ID, c.Cluster.Peers, c.Cluster.Secret, c.Cluster.CA = "a", "a=10.0.0.1:1234, b=10.0.0.2:1234,c=10.0.0.3:1234", "s3cret", "ca.pem"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid cluster rejected: %s", err.Error())
+	}
+	if peers, _ := c.ClusterPeers(); len(peers) != 3 || peers["b"] != "10.0.0.2:1234" {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+	if c.WALEnabled() {
+		t.Fatalf("expected the Raft log to replace the write log")
+	}
+
+	c.Cluster = ClusterConfig{ID: "d", Peers: "a=10.0.0.1:1234,b=nowhere", ReadConsistency: "eventual"}
+	c.MaxMemory, c.EvictionPolicy = 100, "allkeys-lru"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("invalid cluster accepted")
+	}
+	for _, problem := range []string{"nowhere", "secret", "ca is required", "eviction_policy", "read_consistency", "max_staleness"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("error does not mention %s: %s", problem, err.Error())
+		}
+	}
+}
+
+func Test_ConfigReplication(t *testing.T) {
+	c := DefaultConfig()
+	c.Replication.Primary, c.Replication.Secret, c.Replication.CA = "10.0.0.1:1234", "s3cret", "ca.pem"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid replica rejected: %s", err.Error())
+	}
+	if c.WALEnabled() {
+		t.Fatalf("expected a replica to run without a write log")
+	}
+
+	c.Replication = ReplicationConfig{Primary: "nowhere"}
+	c.Cluster.ID, c.Cluster.Peers, c.Cluster.Secret = "a", "a=10.0.0.1:1234", "s3cret"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("invalid replica accepted")
+	}
+	for _, problem := range []string{"cluster node", "nowhere", "secret is required", "ca is required", "backlog"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("error does not mention %s: %s", problem, err.Error())
+		}
+	}
+}
+
+func Test_ConfigSharding(t *testing.T) {
+	c := DefaultConfig()
+	c.Sharding = ShardingConfig{ID: "a", Nodes: "a=10.0.0.1:1234,b=10.0.0.2:1234", Secret: "s3cret", CA: "ca.pem"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid shard rejected: %s", err.Error())
+	}
+	// a shard added later starts without nodes
+	c.Sharding.Nodes = ""
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid shard rejected: %s", err.Error())
+	}
+
+	c.Sharding = ShardingConfig{ID: "c", Nodes: "a=10.0.0.1:1234"}
+	c.Replication.Secret = "s3cret"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("invalid shard accepted")
+	}
+	for _, problem := range []string{"secret is required", "ca is required", "cannot be a cluster node", "not one of the nodes"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("error does not mention %s: %s", problem, err.Error())
+		}
+	}
+}
+
+func Test_ConfigSites(t *testing.T) {
+	c := DefaultConfig()
+	c.Sites = SitesConfig{ID: "eu", Peers: "us=10.0.0.2:1234", Secret: "s3cret", CA: "ca.pem", Conflicts: "siblings", TombstoneTTL: Duration(time.Hour)}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid site rejected: %s", err.Error())
+	}
+
+	c.Sites = SitesConfig{ID: "eu", Peers: "eu=10.0.0.1:1234", Conflicts: "first"}
+	c.Replication.Primary, c.Replication.Secret = "10.0.0.1:1234", "s3cret"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("invalid site accepted")
+	}
+	for _, problem := range []string{"secret is required", "ca is required", "cannot be a cluster node, a shard or a replica", "site itself", "first", "tombstone_ttl"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("error does not mention %s: %s", problem, err.Error())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/imjching/keev/raft"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Read consistencies, chosen per request with the keev-consistency header.
+const (
+	// ConsistencyLinearizable reads from the leader once it has confirmed
+	// it still leads with a round of heartbeats (read-index).
+	ConsistencyLinearizable = "linearizable"
+	// ConsistencyLease reads from the leader while its lease, renewed by
+	// the heartbeats, holds; it relies on clocks running at the same rate.
+	ConsistencyLease = "lease"
+	// ConsistencyBounded reads from any node at most the max staleness
+	// behind the leader.
+	ConsistencyBounded = "bounded"
+	// ConsistencyLocal reads whatever the node has applied.
+	ConsistencyLocal = "local"
+)
+
+const (
+	consistencyHeader  = "keev-consistency"
+	maxStalenessHeader = "keev-max-staleness"
+	// revisionHeader is the header carrying the revision a read was served
+	// at: the data reflects every change up to it, and maybe later ones.
+	revisionHeader = "keev-revision"
+)
+
+func isConsistency(s string) bool {
+	switch s {
+	case ConsistencyLinearizable, ConsistencyLease, ConsistencyBounded, ConsistencyLocal:
+		return true
+	}
+	return false
+}
+
+// readConsistency returns the consistency and max staleness the caller
+// chose, defaulting to the configured ones.
+func readConsistency(ctx context.Context) (string, time.Duration, error) {
+	consistency, maxStaleness := cfg.Cluster.ReadConsistency, time.Duration(cfg.Cluster.MaxStaleness)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md[consistencyHeader]) > 0 {
+		consistency = md[consistencyHeader][0]
+		if !isConsistency(consistency) {
+			return "", 0, status.Error(codes.InvalidArgument, InvalidConsistencyErr.Error())
+		}
+	}
+	if len(md[maxStalenessHeader]) > 0 {
+		d, err := time.ParseDuration(md[maxStalenessHeader][0])
+		if err != nil || d <= 0 {
+			return "", 0, status.Error(codes.InvalidArgument, InvalidStalenessErr.Error())
+		}
+		maxStaleness = d
+	}
+	return consistency, maxStaleness, nil
+}
+
+// read waits until the data is as fresh as the caller asked for and sets the
+// revision it is served at in the header. A replica redirects linearizable
+// and lease reads to the primary. A standalone server has the only copy of
+// the data, every read is linearizable.
+func (s *Server) read(ctx context.Context) error {
+	consistency, maxStaleness, err := readConsistency(ctx)
+	if err != nil {
+		return err
+	}
+	if s.replica != nil {
+		switch consistency {
+		case ConsistencyLinearizable, ConsistencyLease:
+			return s.replica.redirect(ctx)
+		case ConsistencyBounded:
+			if s.replica.staleness() > maxStaleness {
+				return status.Error(codes.Unavailable, StaleReadErr.Error())
+			}
+		}
+	}
+	if s.raft != nil {
+		switch consistency {
+		case ConsistencyLinearizable, ConsistencyLease:
+			_, err = s.raft.ReadIndex(ctx, consistency == ConsistencyLease)
+		case ConsistencyBounded:
+			_, err = s.raft.ReadStale(ctx, maxStaleness)
+		}
+		if err == raft.ErrStale {
+			return status.Error(codes.Unavailable, StaleReadErr.Error())
+		}
+		if err != nil {
+			return s.raftError(ctx, err)
+		}
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(revisionHeader, strconv.FormatUint(s.revision(), 10)))
+	return nil
+}
@@ -3,12 +3,70 @@ package main
 import "errors"
 
 var (
-	KVPExistsErr        = errors.New("key already exists")
-	KVPMissingErr       = errors.New("key does not exist")
-	MissingTokenErr     = errors.New("missing token for namespace, use Use() to set a namespace")
-	InvalidTokenErr     = errors.New("invalid token for namespace, use Use() to set a namespace")
-	EmptyMetadataErr    = errors.New("missing metadata, please login again")
-	TokenSigningErr     = errors.New("unable to sign token")
-	InvalidNamespaceErr = errors.New("invalid namespace, alphanumerics only")
-	AccessDeniedErr     = errors.New("access denied: invalid username or password")
+	KVPExistsErr          = errors.New("key already exists")
+	KVPMissingErr         = errors.New("key does not exist")
+	MissingTokenErr       = errors.New("missing token for namespace, use Use() to set a namespace")
+	InvalidTokenErr       = errors.New("invalid token for namespace, use Use() to set a namespace")
+	EmptyMetadataErr      = errors.New("missing metadata, please login again")
+	TokenSigningErr       = errors.New("unable to sign token")
+	InvalidNamespaceErr   = errors.New("invalid namespace, letters, digits, '_' and '-' only")
+	AccessDeniedErr       = errors.New("access denied: invalid username or password")
+	UnknownCertificateErr = errors.New("access denied: client certificate is not mapped to a user")
+	APIKeyScopeErr        = errors.New("access denied: operation not allowed for this API key")
+	AdminOnlyErr          = errors.New("access denied: admin only")
+	APIKeyMissingErr      = errors.New("API key does not exist")
+	InvalidUsernameErr    = errors.New("invalid username")
+	AuditDisabledErr      = errors.New("audit log is disabled")
+	NotServingErr         = errors.New("server is not serving, it is starting up or shutting down")
+	OutOfMemoryErr        = errors.New("out of memory: --max-memory reached and no key can be evicted")
+	EncryptionDisabledErr = errors.New("encryption at rest is disabled")
+	EncryptedDataErr      = errors.New("data is encrypted but no encryption key is configured")
+	InvalidScopeErr       = errors.New("invalid scope: give no username for the whole store, a username, or a username and a namespace")
+	EmptyBackupErr        = errors.New("no backup received")
+	KeyOutOfScopeErr      = errors.New("backup holds a key outside the scope of the restore")
+	WALDisabledErr        = errors.New("write log is disabled")
+
+	InvalidRecoveryTargetErr    = errors.New("invalid recovery target, expected a revision or an RFC 3339 time")
+	RecoverIntoErr              = errors.New("--recover-into is required, recovery writes a new data directory")
+	RecoverIntoExistsErr        = errors.New("recovery would overwrite existing data")
+	RecoveryTargetTooOldErr     = errors.New("recovery target is older than the snapshots and write log kept, see --recovery-window")
+	RecoveryTargetNotReachedErr = errors.New("recovery target is past the last change")
+
+	NotLeaderErr          = errors.New("not the leader of the cluster, send writes and linearizable reads to the leader")
+	NoLeaderErr           = errors.New("the cluster has no leader, try again later")
+	CommandTooLargeErr    = errors.New("request is too large to replicate, see --max-message-size")
+	ClusterSecretErr      = errors.New("access denied: invalid cluster secret")
+	InvalidConsistencyErr = errors.New("invalid read consistency, expected linearizable, lease, bounded or local")
+	InvalidStalenessErr   = errors.New("invalid max staleness, expected a positive duration such as \"2s\"")
+	StaleReadErr          = errors.New("node is further behind the leader, or primary, than the read allows")
+	ClusterDisabledErr    = errors.New("server is not a node of a cluster")
+	MemberExistsErr       = errors.New("node is already a member of the cluster")
+	UnknownMemberErr      = errors.New("node is not a member of the cluster")
+	NotLearnerErr         = errors.New("node is not a learner")
+	NotVoterErr           = errors.New("node is not a voter")
+	LastVoterErr          = errors.New("cannot remove the last voter of the cluster")
+	ChangePendingErr      = errors.New("another membership change is in progress, try again later")
+	InvalidMemberErr      = errors.New("invalid member, expected an ID and, to add it, a host:port address")
+
+	ReadOnlyReplicaErr     = errors.New("server is a read-only replica, send writes and linearizable reads to the primary")
+	NotPrimaryErr          = errors.New("server is not a replication primary")
+	ReplicationDisabledErr = errors.New("server is neither a replication primary nor a replica")
+	ReplicationSecretErr   = errors.New("access denied: invalid replication secret")
+	ReplicaBehindErr       = errors.New("replica fell behind the changes kept by the primary, see --replication-backlog")
+	ReplicationStreamErr   = errors.New("invalid replication stream")
+
+	WrongShardErr       = errors.New("key is held by another shard, send it to the owner the shard map names")
+	NoShardMapErr       = errors.New("shard has no shard map yet, add it with \"shard add\"")
+	ShardingDisabledErr = errors.New("server is not a shard")
+	ShardSecretErr      = errors.New("access denied: invalid shard secret")
+	ShardExistsErr      = errors.New("shard is already in the shard map")
+	UnknownShardErr     = errors.New("shard is not in the shard map")
+	LastShardErr        = errors.New("cannot remove the last shard")
+	InvalidShardErr     = errors.New("invalid shard, expected an ID and, to add it, a host:port address")
+	RebalancingErr      = errors.New("keys are moving between shards, try again later")
+	ShardMapChangedErr  = errors.New("shard map changed in the meantime, try again")
+
+	SitesDisabledErr = errors.New("server is not a site")
+	SiteSecretErr    = errors.New("access denied: invalid site secret")
+	MissingSiteErr   = errors.New("site following the server did not send its ID")
 )
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// kvsService is the name the KVS service is reported under by health checks.
+const kvsService = "protobuf.KVS"
+
+// publicServices are called without credentials and skip the interceptors.
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+func isPublicMethod(method string) bool {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var healthServer = health.NewServer()
+
+// serving is 1 while the KVS service accepts requests: after the data has
+// loaded and until shutdown starts.
+var serving int32
+
+// registerHealth registers the health and reflection services, starting out
+// as NOT_SERVING.
+func registerHealth(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+	setServing(false)
+}
+
+// setServing reports the server, and the KVS service, as (not) serving.
+func setServing(ok bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	var v int32
+	if ok {
+		st, v = healthpb.HealthCheckResponse_SERVING, 1
+	}
+	atomic.StoreInt32(&serving, v)
+	healthServer.SetServingStatus("", st)
+	healthServer.SetServingStatus(kvsService, st)
+}
+
+// checkServing rejects requests while the data is loading or the server is
+// shutting down.
+func checkServing() error {
+	if atomic.LoadInt32(&serving) == 0 {
+		return status.Error(codes.Unavailable, NotServingErr.Error())
+	}
+	return nil
+}
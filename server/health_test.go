@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+func Test_HealthAndReflection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	s := grpc.NewServer(
+		grpc.StreamInterceptor(streamInterceptor),
+		grpc.UnaryInterceptor(unaryInterceptor),
+	)
+	protobuf.RegisterKVSServer(s, NewServer())
+	registerHealth(s)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err.Error())
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	hc := healthpb.NewHealthClient(conn)
+
+	// no credentials are needed for health checks
+	resp, err := hc.Check(ctx, &healthpb.HealthCheckRequest{Service: kvsService})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING before data is loaded, got %v, %v", resp, err)
+	}
+	_, err = protobuf.NewKVSClient(conn).Count(ctx, &google_protobuf.Empty{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected KVS to be unavailable before data is loaded, got %v", err)
+	}
+
+	setServing(true)
+	defer setServing(false)
+	resp, err = hc.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING once data is loaded, got %v, %v", resp, err)
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to open reflection stream: %s", err.Error())
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatalf("failed to send reflection request: %s", err.Error())
+	}
+	reply, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("reflection request failed: %s", err.Error())
+	}
+	found := false
+	for _, svc := range reply.GetListServicesResponse().GetService() {
+		found = found || svc.Name == kvsService
+	}
+	if !found {
+		t.Fatalf("%s not listed by reflection: %v", kvsService, reply)
+	}
+
+	// grpcurl needs the file descriptors to describe and call methods
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: kvsService},
+	})
+	if err != nil {
+		t.Fatalf("failed to send reflection request: %s", err.Error())
+	}
+	reply, err = stream.Recv()
+	if err != nil || len(reply.GetFileDescriptorResponse().GetFileDescriptorProto()) == 0 {
+		t.Fatalf("descriptor of %s not served: %v, %v", kvsService, reply, err)
+	}
+}
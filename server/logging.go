@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader is the metadata key carrying the request ID, both ways.
+const requestIDHeader = "x-request-id"
+
+// sensitiveMetadata lists metadata keys whose values are never logged.
+var sensitiveMetadata = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"api-key":       true,
+	"authorization": true,
+}
+
+// validRequestID restricts the request IDs accepted from clients, so they
+// cannot inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+var logger = logrus.New()
+
+// setupLogging configures the logger from the level and format in c.
+func setupLogging(c *Config) {
+	logger.Out = os.Stderr
+	level, err := logrus.ParseLevel(c.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.Level = level
+	if c.LogFormat == "json" {
+		logger.Formatter = &logrus.JSONFormatter{}
+	} else {
+		logger.Formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+	}
+}
+
+// request is the state of an RPC kept for its access log.
+type request struct {
+	ID     string
+	Method string
+	start  time.Time
+	caller *caller
+}
+
+type requestKey struct{}
+
+// startRequest returns a context carrying a new request, whose ID is taken
+// from the client's metadata if it sent a valid one.
+func startRequest(ctx context.Context, method string) (context.Context, *request) {
+	r := &request{Method: method, start: time.Now()}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[requestIDHeader]) > 0 && validRequestID.MatchString(md[requestIDHeader][0]) {
+		r.ID = md[requestIDHeader][0]
+	} else {
+		r.ID = newRequestID()
+	}
+	return context.WithValue(ctx, requestKey{}, r), r
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestFromContext returns the request set by the interceptors.
+func requestFromContext(ctx context.Context) (*request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*request)
+	return r, ok
+}
+
+// authenticated records the caller of the request once it is known.
+func (r *request) authenticated(ctx context.Context) {
+	r.caller, _ = callerFromContext(ctx)
+}
+
+// fields returns the log fields identifying the request and its caller.
+func (r *request) fields() logrus.Fields {
+	fields := logrus.Fields{"request_id": r.ID, "method": r.Method}
+	if r.caller != nil {
+		fields["user"] = r.caller.Username
+		if r.caller.APIKey != nil {
+			fields["api_key"] = r.caller.APIKey.ID
+		}
+		if r.caller.Namespace != "" {
+			fields["namespace"] = r.caller.Namespace
+		}
+	}
+	return fields
+}
+
+// finish writes the access log of the request, as a warning if it was slow.
+func (r *request) finish(ctx context.Context, err error) {
+	elapsed := time.Since(r.start)
+	entry := logger.WithFields(r.fields()).WithFields(logrus.Fields{
+		"code":        status.Code(err).String(),
+		"duration_ms": float64(elapsed) / float64(time.Millisecond),
+	})
+	if p, ok := peer.FromContext(ctx); ok {
+		entry = entry.WithField("peer", p.Addr.String())
+	}
+	if err != nil {
+		entry = entry.WithField("error", err.Error())
+	}
+	if logger.IsLevelEnabled(logrus.DebugLevel) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			entry = entry.WithField("metadata", redactMetadata(md))
+		}
+	}
+	if cfg != nil && cfg.SlowRequest > 0 && elapsed >= time.Duration(cfg.SlowRequest) {
+		entry.Warn("slow request")
+		return
+	}
+	entry.Info("request")
+}
+
+// requestLogger returns a logger for messages about the request in ctx.
+func requestLogger(ctx context.Context) *logrus.Entry {
+	if r, ok := requestFromContext(ctx); ok {
+		return logger.WithFields(r.fields())
+	}
+	return logrus.NewEntry(logger)
+}
+
+// redactMetadata returns md with the values of credentials replaced.
+func redactMetadata(md metadata.MD) map[string][]string {
+	redacted := make(map[string][]string, len(md))
+	for k, v := range md {
+		if sensitiveMetadata[k] {
+			v = []string{"[REDACTED]"}
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
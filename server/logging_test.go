@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func Test_LoggingRedactsCredentials(t *testing.T) {
+	md := metadata.Pairs("username", "user", "password", "secret", "token", "jwt", "api-key", "keev_a_b")
+	redacted := redactMetadata(md)
+	if redacted["username"][0] != "user" {
+		t.Fatalf("username redacted: %v", redacted)
+	}
+	for _, k := range []string{"password", "token", "api-key"} {
+		if redacted[k][0] != "[REDACTED]" {
+			t.Fatalf("%s not redacted: %v", k, redacted)
+		}
+	}
+}
+
+func Test_LoggingRequestID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestIDHeader, "abc-123"))
+	ctx, r := startRequest(ctx, "/protobuf.KVS/Get")
+	if r.ID != "abc-123" {
+		t.Fatalf("request ID from the client not used: %s", r.ID)
+	}
+	if got, ok := requestFromContext(ctx); !ok || got != r {
+		t.Fatalf("request not stored in context")
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestIDHeader, "bad id\nlevel=error"))
+	if _, r := startRequest(ctx, "/protobuf.KVS/Get"); r.ID == "bad id\nlevel=error" || r.ID == "" {
+		t.Fatalf("invalid request ID accepted: %q", r.ID)
+	}
+}
@@ -1,140 +1,525 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/imjching/keev/audit"
 	"github.com/imjching/keev/auth"
+	"github.com/imjching/keev/common"
+	"github.com/imjching/keev/encrypt"
+	"github.com/imjching/keev/evict"
 	"github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/raft"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v2"
 )
 
-const (
-	port = ":1234"
-)
+var verifyAudit = flag.Bool("verify-audit", false, "verify the audit log in --audit-dir and exit")
 
+var cfg *Config
 var users *auth.CredentialsStore
+var apiKeys *auth.APIKeyStore
+var keyRing *common.KeyRing
+var auditLog *audit.Log
+var dataKeys *encrypt.KeyRing // nil if encryption at rest is disabled
 
 // middleware
-func streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	if err := authorize(stream.Context()); err != nil {
+func streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	if isPublicMethod(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	if isClusterMethod(info.FullMethod) {
+		if err := checkClusterSecret(stream.Context()); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+	if isReplicationMethod(info.FullMethod) {
+		if err := checkReplicationSecret(stream.Context()); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+	if isSiteMethod(info.FullMethod) {
+		if err := checkSiteSecret(stream.Context()); err != nil {
+			return err
+		}
+		// the feed is not there before the data is loaded
+		if err := checkServing(); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+	reqCtx, r := startRequest(stream.Context(), info.FullMethod)
+	stream.SetHeader(metadata.Pairs(requestIDHeader, r.ID))
+	activeStreams.Inc()
+	defer func() {
+		activeStreams.Dec()
+		r.finish(reqCtx, err)
+		observeRequest(info.FullMethod, r.start, err)
+	}()
+	if err := checkServing(); err != nil {
 		return err
 	}
-	return handler(srv, stream)
+	ctx, err := authorize(reqCtx, info.FullMethod)
+	if err == nil {
+		r.authenticated(ctx)
+		err = checkRateLimit(ctx, nil)
+	}
+	if err != nil {
+		auditRequest(reqCtx, info.FullMethod, nil, err)
+		return err
+	}
+	ctx, cancel := streamContext(ctx)
+	defer cancel()
+	err = handler(srv, chargedStream{&authorizedStream{stream, ctx}})
+	auditRequest(ctx, info.FullMethod, nil, err)
+	return err
 }
 
-func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	if err := authorize(ctx); err != nil {
+func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+	if isPublicMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if isClusterMethod(info.FullMethod) {
+		if err := checkClusterSecret(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	if isShardMethod(info.FullMethod) {
+		if err := checkShardSecret(ctx); err != nil {
+			return nil, err
+		}
+		// keys must not arrive before the data is loaded
+		if err := checkServing(); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	ctx, r := startRequest(ctx, info.FullMethod)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, r.ID))
+	defer func() {
+		r.finish(ctx, err)
+		observeRequest(info.FullMethod, r.start, err)
+	}()
+	if err := checkServing(); err != nil {
 		return nil, err
 	}
-	return handler(ctx, req)
+	authCtx, err := authorize(ctx, info.FullMethod)
+	if err != nil {
+		auditRequest(ctx, info.FullMethod, req, err)
+		return nil, err
+	}
+	r.authenticated(authCtx)
+	if err := checkRateLimit(authCtx, req); err != nil {
+		auditRequest(authCtx, info.FullMethod, req, err)
+		return nil, err
+	}
+	resp, err := handler(authCtx, req)
+	chargeResponse(authCtx, resp)
+	auditRequest(authCtx, info.FullMethod, req, err)
+	return resp, err
 }
 
-func authorize(ctx context.Context) error {
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		if len(md["username"]) == 0 || len(md["password"]) == 0 || !users.Check(md["username"][0], md["password"][0]) {
-			return AccessDeniedErr // should close client's socket instead...
+// authorize authenticates the caller with an API key, the username and
+// password in the metadata or, failing those, with a verified client
+// certificate. It returns a context carrying the authenticated caller.
+func authorize(ctx context.Context, method string) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok && len(md["api-key"]) > 0 {
+		key, err := apiKeys.Check(md["api-key"][0])
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAPIKeyMethod(key, method); err != nil {
+			return nil, err
+		}
+		return withCaller(ctx, &caller{Username: key.Username, APIKey: key}), nil
+	}
+	if ok && len(md["username"]) > 0 {
+		if len(md["password"]) == 0 || !users.Check(md["username"][0], md["password"][0]) {
+			return nil, AccessDeniedErr // should close client's socket instead...
 		}
-		return nil
+		return withCaller(ctx, &caller{Username: md["username"][0]}), nil
+	}
+	if cert := clientCertificate(ctx); cert != nil {
+		username, ok := users.CheckCertificate(cert)
+		if !ok {
+			return nil, UnknownCertificateErr
+		}
+		return withCaller(ctx, &caller{Username: username}), nil
+	}
+	if !ok {
+		return nil, EmptyMetadataErr
 	}
-	return EmptyMetadataErr
+	return nil, AccessDeniedErr
 }
 
-// for graceful shutdown
-func saveToDisk(server *Server, forced bool) {
-	b, err := json.Marshal(server)
-	err = ioutil.WriteFile("./data/data.json", b, 0644)
+// saveAPIKeysMu keeps the admin RPCs and the periodic save from racing over
+// the temporary file.
+var saveAPIKeysMu sync.Mutex
+
+// saveAPIKeys writes the API key store, including last-used times, to disk.
+func saveAPIKeys() {
+	saveAPIKeysMu.Lock()
+	defer saveAPIKeysMu.Unlock()
+	if err := writeFile(cfg.APIKeys, 0600, apiKeys.Save); err != nil {
+		logger.WithError(err).Error("failed to save API keys")
+	}
+}
+
+// loadTLSConfig builds the server TLS configuration, verifying client
+// certificates against the client CA when it is set.
+func loadTLSConfig(c TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.ClientCA == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(c.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", c.ClientCA)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// writeFile replaces the file at path with the output of write through a
+// temporary file, so a crash never leaves a partially written file behind.
+// The data is synced before the rename unless the fsync policy is never.
+func writeFile(path string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
-		if forced {
-			fmt.Println("Data loss...")
-		} else {
-			fmt.Println("Failed to write to file...Trying again...")
-			saveToDisk(server, true)
+		return err
+	}
+	err = write(f)
+	if err == nil && cfg.Fsync == FsyncAlways {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if cfg.Fsync == FsyncAlways {
+		// persist the rename itself
+		if dir, err := os.Open(filepath.Dir(path)); err == nil {
+			dir.Sync()
+			dir.Close()
 		}
 	}
-	log.Println("Saved to disk")
+	return nil
 }
 
 func main() {
-	listener, err := net.Listen("tcp", port)
+	flag.Parse()
+
+	var err error
+	cfg, err = loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		logger.Fatal(err)
+	}
+	setupLogging(cfg)
+	if *printConfig {
+		b, _ := yaml.Marshal(cfg.redacted())
+		fmt.Print(string(b))
+		return
+	}
+
+	if *verifyAudit {
+		key, err := audit.LoadKey(cfg.AuditKey, false)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load the audit key")
+		}
+		n, err := audit.Verify(cfg.AuditDir, key, cfg.AuditHead())
+		if err != nil {
+			logger.WithError(err).WithField("records", n).Fatal("audit log verification failed")
+		}
+		logger.WithField("records", n).Info("audit log verified")
+		return
+	}
+
+	if *recoverTo != "" {
+		report, err := recoverData(*recoverTo, *recoverInto)
+		if err != nil {
+			logger.WithError(err).Fatal("point-in-time recovery failed")
+		}
+		fmt.Print(report)
+		return
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to listen")
 	}
 
 	// Load our TLS key pair to use for authentication
-	cert, err := credentials.NewServerTLSFromFile("keys/cert.pem", "keys/key.pem")
+	tlsConfig, err := loadTLSConfig(cfg.TLS)
 	if err != nil {
-		log.Fatalln("Unable to load cert", err)
+		logger.WithError(err).Fatal("unable to load cert")
 	}
 
-	// load and print users
-	file, err := os.Open("data/users.json")
+	// load users
+	file, err := os.Open(cfg.Users)
 	if err != nil {
-		log.Fatalln("Unable to load users", err)
+		logger.WithError(err).Fatal("unable to load users")
 	}
 	users = auth.NewCredentialsStore()
 	if err := users.Load(file); err != nil {
-		log.Fatalf("failed to load credentials: %s", err.Error())
+		logger.WithError(err).Fatal("failed to load credentials")
+	}
+	logger.WithField("users", users.Count()).Info("loaded users")
+
+	// load API keys
+	apiKeys = auth.NewAPIKeyStore()
+	if file, err := os.Open(cfg.APIKeys); err == nil {
+		err = apiKeys.Load(file)
+		file.Close()
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load API keys")
+		}
+	} else if !os.IsNotExist(err) {
+		logger.WithError(err).Fatal("failed to load API keys")
+	}
+
+	// open the audit log
+	if cfg.AuditEnabled() {
+		key, err := audit.LoadKey(cfg.AuditKey, true)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load the audit key")
+		}
+		auditLog, err = audit.Open(cfg.AuditDir, key, cfg.AuditHead())
+		if err != nil {
+			logger.WithError(err).Fatal("failed to open audit log")
+		}
+		auditLog.MaxSize = cfg.AuditMaxSize
+	}
+
+	// load JWT signing keys
+	keyRing, err = common.LoadKeyRing(cfg.JWTKeys)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load JWT keys")
+	}
+
+	// load the keys encrypting the data at rest
+	if cfg.EncryptionEnabled() {
+		dataKeys, err = encrypt.LoadKeyRing(cfg.EncryptionKeys)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load encryption keys")
+		}
+		logger.WithField("key", dataKeys.Active()).Info("encrypting data at rest")
 	}
-	fmt.Println("[USERS]:", users)
 
 	// register grpc server
 	s := grpc.NewServer(
-		grpc.Creds(cert),
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.MaxRecvMsgSize(int(cfg.MaxMessageSize)),
 		grpc.StreamInterceptor(streamInterceptor),
 		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StatsHandler(connStats{}),
 	)
 	server := NewServer()
 	protobuf.RegisterKVSServer(s, server)
+	registerHealth(s)
+	var nodeService *raft.Service
+	if cfg.ClusterEnabled() {
+		nodeService = raft.NewService()
+		protobuf.RegisterRaftServer(s, nodeService)
+	}
+	if cfg.ReplicationEnabled() {
+		protobuf.RegisterReplicationServer(s, server)
+	}
+	if cfg.SitesEnabled() {
+		server.sites = newSites(server, cfg.Sites.ID, cfg.Sites.Conflicts)
+		protobuf.RegisterSitesServer(s, server.sites)
+	}
+	if cfg.ShardingEnabled() {
+		if server.shards, err = loadSharding(server); err != nil {
+			logger.WithError(err).Fatal("failed to load the shard map")
+		}
+		protobuf.RegisterShardingServer(s, server.shards)
+	}
+	policy, _ := evict.Lookup(cfg.EvictionPolicy) // checked by Validate
+	server.Meta.SetPolicy(policy)
 
-	// load data
-	data, err := ioutil.ReadFile("./data/data.json")
-	if err != nil {
-		fmt.Println("No previous data found. Creating a new one...")
+	// shut down on SIGINT and SIGTERM, from here on
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	// serve health checks while the data loads, other RPCs are rejected until
+	// the server reports SERVING
+	logger.WithField("address", cfg.Listen).Info("listening")
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(listener)
+	}()
+
+	// load data, a cluster node from its Raft snapshot and log
+	var transport *raft.GRPCTransport
+	if cfg.ClusterEnabled() {
+		if _, err := os.Stat(cfg.DataFile()); err == nil {
+			logger.WithField("path", cfg.DataFile()).Warn("ignoring the data of the standalone server, restore a backup to move it into the cluster")
+		}
+		if transport, err = startCluster(server, nodeService); err != nil {
+			logger.WithError(err).Fatal("failed to join cluster")
+		}
+	} else {
+		if err := loadFromDisk(server); os.IsNotExist(err) {
+			logger.Warn("no previous data found, creating a new one")
+		} else if err != nil {
+			// starting empty would overwrite the data with the next snapshot
+			logger.WithError(err).Fatal("failed to load data")
+		}
+		if cfg.WALEnabled() {
+			if err := server.openLog(); err != nil {
+				logger.WithError(err).Fatal("failed to open write log")
+			}
+		}
+		server.rebuildUsage()
+		server.trackKeys()
+		if cfg.IsReplica() {
+			if err := startReplica(server); err != nil {
+				logger.WithError(err).Fatal("failed to follow the primary")
+			}
+		} else if cfg.ReplicationEnabled() || cfg.SitesEnabled() {
+			server.feed = newFeed(server.revision(), int(cfg.Replication.Backlog))
+			logger.WithField("revision", server.revision()).Info("accepting replicas")
+		}
+		if server.sites != nil {
+			if err := startSites(server); err != nil {
+				logger.WithError(err).Fatal("failed to follow the other sites")
+			}
+		}
+		if server.shards != nil {
+			if err := server.shards.start(); err != nil {
+				logger.WithError(err).Fatal("failed to save the shard map")
+			}
+		}
 	}
-	if x := json.Unmarshal(data, server); x != nil {
-		fmt.Println("No previous data found. Creating a new one...")
+	setServing(true)
+
+	if cfg.MetricsListen != "" {
+		go serveMetrics(cfg.MetricsListen, server)
 	}
 
-	// save to disk every 5 minutes
-	ticker := time.NewTicker(5 * time.Minute)
+	// save to disk periodically, remove expired keys and idle rate limits
+	// every second and flush the write log to disk
+	ticker := time.NewTicker(time.Duration(cfg.SnapshotInterval))
+	expiry := time.NewTicker(time.Second)
+	var syncLog <-chan time.Time
+	if server.log != nil && cfg.WALSyncInterval > 0 {
+		walSync := time.NewTicker(time.Duration(cfg.WALSyncInterval))
+		defer walSync.Stop()
+		syncLog = walSync.C
+	}
 	quit := make(chan struct{})
+	stopped := make(chan struct{})
 	go func(s *Server) {
+		defer close(stopped)
 		for {
 			select {
 			case <-ticker.C:
 				saveToDisk(s, false)
+				saveAPIKeys()
+			case <-expiry.C:
+				s.expireKeys()
+				limiter.Forget(rateLimitIdle)
+			case <-syncLog:
+				s.syncLog()
 			case <-quit:
 				ticker.Stop()
+				expiry.Stop()
 				return
 			}
 		}
 	}(server)
 
-	// graceful shutdown
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	// reload JWT keys on SIGHUP, so keys can be rotated without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := keyRing.Reload(cfg.JWTKeys); err != nil {
+				logger.WithError(err).Error("failed to reload JWT keys")
+				continue
+			}
+			logger.Info("reloaded JWT keys")
+		}
+	}()
 
-	go func(q chan struct{}, s *Server) {
-		<-c
-		fmt.Println()
-		close(q)
-		saveToDisk(s, false)
-		os.Exit(1)
-	}(quit, server)
+	select {
+	case err := <-served:
+		logger.WithError(err).Fatal("failed to serve")
+	case sig := <-c:
+		logger.WithField("signal", sig.String()).Info("shutting down")
+	}
 
-	// listen
-	log.Printf("Listening RPC Server on port localhost%s", port)
-	s.Serve(listener)
+	// graceful shutdown: once in-flight RPCs are drained and the background
+	// work has stopped nothing writes to the data, so the final snapshot is
+	// consistent
+	drain(s, time.Duration(cfg.ShutdownTimeout))
+	close(quit)
+	<-stopped
+	if server.replica != nil {
+		server.replica.stop()
+	}
+	if server.sites != nil {
+		server.sites.stop()
+	}
+	if server.shards != nil {
+		server.shards.stopMoving()
+	}
+	err = saveToDisk(server, false)
+	saveAPIKeys()
+	if server.log != nil {
+		if lerr := server.log.Close(); lerr != nil {
+			logger.WithError(lerr).Error("failed to close write log")
+		}
+	}
+	if server.raft != nil {
+		if rerr := server.raft.Stop(); rerr != nil {
+			logger.WithError(rerr).Error("failed to stop raft node")
+		}
+		transport.Close()
+	}
+	if auditLog != nil {
+		auditLog.Close()
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	logger.Info("shut down")
 }
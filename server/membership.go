@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/raft"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// membershipErrs maps the errors of membership changes to those of the API.
+var membershipErrs = map[error]error{
+	raft.ErrMemberExists:  MemberExistsErr,
+	raft.ErrUnknownMember: UnknownMemberErr,
+	raft.ErrNotLearner:    NotLearnerErr,
+	raft.ErrNotVoter:      NotVoterErr,
+	raft.ErrLastVoter:     LastVoterErr,
+	raft.ErrChangePending: ChangePendingErr,
+}
+
+// membershipError returns the error a membership change of id the Raft node
+// failed is answered with.
+func (s *Server) membershipError(ctx context.Context, id string, err error) error {
+	if e, ok := membershipErrs[err]; ok {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: %q", e, id))
+	}
+	return s.raftError(ctx, err)
+}
+
+// checkMembership returns an error if the caller may not change the members
+// of the cluster, or in must name a node.
+func (s *Server) checkMembership(ctx context.Context, in *pb.MemberRequest) error {
+	if !isAdmin(ctx) {
+		return AdminOnlyErr
+	}
+	if s.raft == nil {
+		return status.Error(codes.FailedPrecondition, ClusterDisabledErr.Error())
+	}
+	if in.Id == "" {
+		return status.Error(codes.InvalidArgument, InvalidMemberErr.Error())
+	}
+	return nil
+}
+
+// Returns the state of the cluster as the node sees it, with the replication progress of every node when asked to the leader
+// NOTE: Admin only, no token needed
+func (s *Server) ClusterStatus(ctx context.Context, in *google_protobuf.Empty) (*pb.ClusterStatusResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if s.raft == nil {
+		return nil, status.Error(codes.FailedPrecondition, ClusterDisabledErr.Error())
+	}
+	st := s.raft.Status()
+	_, leaderAddr := s.raft.Leader()
+	resp := &pb.ClusterStatusResponse{
+		Id:            st.ID,
+		State:         st.State.String(),
+		Term:          st.Term,
+		Leader:        st.Leader,
+		LeaderAddr:    leaderAddr,
+		LastIndex:     st.LastIndex,
+		CommitIndex:   st.CommitIndex,
+		AppliedIndex:  st.AppliedIndex,
+		SnapshotIndex: st.SnapshotIndex,
+	}
+	for _, p := range st.Members {
+		m := &pb.ClusterMember{Id: p.ID, Addr: p.Addr, Learner: p.Learner, MatchIndex: p.Match, LastAckMs: -1}
+		if st.State == raft.Leader && p.Match < st.LastIndex {
+			m.Lag = st.LastIndex - p.Match
+		}
+		if !p.LastAck.IsZero() {
+			m.LastAckMs = int64(time.Since(p.LastAck) / time.Millisecond)
+		}
+		resp.Members = append(resp.Members, m)
+	}
+	return resp, nil
+}
+
+// Adds a node to the cluster, as a learner or as a voter once it has caught up with the leader
+// NOTE: Admin only, no token needed
+func (s *Server) AddMember(ctx context.Context, in *pb.MemberRequest) (*pb.Response, error) {
+	if err := s.checkMembership(ctx, in); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(in.Addr); err != nil {
+		return nil, status.Error(codes.InvalidArgument, InvalidMemberErr.Error())
+	}
+	var err error
+	if in.Learner {
+		err = s.raft.AddLearner(ctx, in.Id, in.Addr)
+	} else {
+		err = s.raft.AddVoter(ctx, in.Id, in.Addr)
+	}
+	if err != nil {
+		return nil, s.membershipError(ctx, in.Id, err)
+	}
+	requestLogger(ctx).WithFields(logrus.Fields{"node": in.Id, "addr": in.Addr, "learner": in.Learner}).Info("added cluster member")
+	if in.Learner {
+		return &pb.Response{Success: true, Value: "(learner " + in.Id + " added)"}, nil
+	}
+	return &pb.Response{Success: true, Value: "(voter " + in.Id + " added)"}, nil
+}
+
+// Makes a learner a voter once it has caught up with the leader
+// NOTE: Admin only, no token needed
+func (s *Server) PromoteMember(ctx context.Context, in *pb.MemberRequest) (*pb.Response, error) {
+	if err := s.checkMembership(ctx, in); err != nil {
+		return nil, err
+	}
+	if err := s.raft.Promote(ctx, in.Id); err != nil {
+		return nil, s.membershipError(ctx, in.Id, err)
+	}
+	requestLogger(ctx).WithField("node", in.Id).Info("promoted cluster member")
+	return &pb.Response{Success: true, Value: "(" + in.Id + " promoted to voter)"}, nil
+}
+
+// Removes a node from the cluster
+// NOTE: Admin only, no token needed
+func (s *Server) RemoveMember(ctx context.Context, in *pb.MemberRequest) (*pb.Response, error) {
+	if err := s.checkMembership(ctx, in); err != nil {
+		return nil, err
+	}
+	if err := s.raft.RemoveMember(ctx, in.Id); err != nil {
+		return nil, s.membershipError(ctx, in.Id, err)
+	}
+	requestLogger(ctx).WithField("node", in.Id).Info("removed cluster member")
+	return &pb.Response{Success: true, Value: "(" + in.Id + " removed)"}, nil
+}
+
+// Hands leadership over to a voter once it has caught up with the leader
+// NOTE: Admin only, no token needed
+func (s *Server) TransferLeadership(ctx context.Context, in *pb.MemberRequest) (*pb.Response, error) {
+	if err := s.checkMembership(ctx, in); err != nil {
+		return nil, err
+	}
+	if err := s.raft.TransferLeadership(ctx, in.Id); err != nil {
+		return nil, s.membershipError(ctx, in.Id, err)
+	}
+	requestLogger(ctx).WithField("node", in.Id).Info("transferred leadership")
+	return &pb.Response{Success: true, Value: "(leadership transferred to " + in.Id + ")"}, nil
+}
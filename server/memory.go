@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// expiresAt converts a TTL in seconds to an expiry for the tracker.
+func expiresAt(ttl int64) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Unix() + ttl
+}
+
+// ttlLeft returns the seconds until key expires, 0 if it does not expire.
+func (s *Server) ttlLeft(key string) int64 {
+	expires := s.Meta.Expiry(key)
+	if expires == 0 {
+		return 0
+	}
+	if left := expires - time.Now().Unix(); left > 0 {
+		return left
+	}
+	return 1
+}
+
+// makeRoom evicts keys other than key until n more bytes fit under
+// --max-memory, and fails with ResourceExhausted if none can be evicted.
+func (s *Server) makeRoom(key string, n int64) error {
+	if cfg.MaxMemory <= 0 || n <= 0 {
+		return nil
+	}
+	for s.Data.Bytes()+n > cfg.MaxMemory {
+		victim, ok := s.Meta.Victim(key)
+		if !ok {
+			return status.Error(codes.ResourceExhausted, OutOfMemoryErr.Error())
+		}
+		if s.dropKey(victim) {
+			s.Meta.Evicted(victim)
+		} else {
+			s.Meta.Remove(victim)
+		}
+	}
+	return nil
+}
+
+// dropKey removes a key the server evicts or expires on its own and gives
+// back its quota. It forgets the versions of the key.
+func (s *Server) dropKey(key string) bool {
+	value, ok := s.Data.Pop(key)
+	if !ok {
+		return false
+	}
+	s.versions.forget(key)
+	if parts := strings.SplitN(key, ".", 3); len(parts) == 3 {
+		s.usage.Add(parts[0], parts[1], -1, -entrySize(parts[2], value.(string)))
+	}
+	return true
+}
+
+// putKey stores a key written elsewhere, by the primary or another shard,
+// and takes its quota. It forgets the versions of the key.
+func (s *Server) putKey(key, value string) {
+	username, namespace, name := splitKey(key)
+	keys, bytes := int64(1), entrySize(name, value)
+	if old, ok := s.Data.Get(key); ok {
+		keys, bytes = 0, bytes-entrySize(name, old.(string))
+	}
+	s.Data.Set(key, value)
+	s.Meta.Touch(key)
+	s.versions.forget(key)
+	s.usage.Add(username, namespace, keys, bytes)
+}
+
+// expire removes key if its expiry has passed, so it is never served after
+// expiring even if expireKeys has not caught up yet. In a cluster the key is
+// only removed through the Raft log, by expireKeys on the leader, and on a
+// replica by the primary. It returns true if the key expired.
+func (s *Server) expire(key string) bool {
+	if !s.Meta.IsExpired(key) {
+		return false
+	}
+	if s.raft == nil && s.replica == nil && s.dropKey(key) {
+		s.Meta.Expired(key)
+	}
+	return true
+}
+
+// expireAt removes key if it expired at unix time now, the time a change was
+// made at, so every node of a cluster applying the change agrees.
+func (s *Server) expireAt(key string, now int64) {
+	if expires := s.Meta.Expiry(key); expires != 0 && expires <= now && s.dropKey(key) {
+		s.Meta.Expired(key)
+	}
+}
+
+// expireKeys removes every key whose expiry has passed. In a cluster the
+// leader replicates the removals and the other nodes do nothing, as do
+// replicas. A site also forgets the keys deleted longer than tombstone_ttl
+// ago.
+func (s *Server) expireKeys() {
+	if s.replica != nil {
+		return
+	}
+	if s.raft != nil {
+		if !s.raft.IsLeader() {
+			return
+		}
+		for _, key := range s.Meta.ExpiredKeys() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_, err := s.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_EXPIRE, Key: key})
+			cancel()
+			if err != nil {
+				logger.WithError(err).WithField("key", key).Warn("failed to expire key")
+				return
+			}
+		}
+		return
+	}
+	for _, key := range s.Meta.ExpiredKeys() {
+		if s.dropKey(key) {
+			s.Meta.Expired(key)
+		} else {
+			s.Meta.Remove(key)
+		}
+	}
+	if s.sites != nil {
+		s.sites.forgetTombstones(time.Duration(cfg.Sites.TombstoneTTL))
+	}
+}
+
+// trackKeys starts tracking the access metadata of every key, only needed
+// after the data is loaded from disk.
+func (s *Server) trackKeys() {
+	s.Data.IterCb(func(key string, v interface{}) {
+		s.Meta.Touch(key)
+	})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/imjching/keev/raft"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "keev_requests_total",
+		Help: "RPCs handled, by method and status code.",
+	}, []string{"method", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "keev_request_duration_seconds",
+		Help:    "Time taken to handle RPCs, by method.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 100µs to 26s
+	}, []string{"method"})
+	activeStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "keev_active_streams",
+		Help: "Streaming RPCs in progress.",
+	})
+	connectedClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "keev_connected_clients",
+		Help: "Open client connections.",
+	})
+	snapshotDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "keev_snapshot_duration_seconds",
+		Help: "Time taken by the last snapshot.",
+	})
+	snapshotSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "keev_snapshot_size_bytes",
+		Help: "Size of the last snapshot.",
+	})
+	snapshotTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "keev_snapshot_timestamp_seconds",
+		Help: "Unix time of the last successful snapshot, 0 if there was none.",
+	})
+	snapshotFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "keev_snapshot_failures_total",
+		Help: "Snapshots that could not be written.",
+	})
+	walFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "keev_wal_failures_total",
+		Help: "Changes that could not be written to the write log, and failed syncs.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, activeStreams, connectedClients,
+		snapshotDuration, snapshotSize, snapshotTimestamp, snapshotFailures, walFailures)
+}
+
+// observeRequest records the outcome and latency of an RPC.
+func observeRequest(method string, start time.Time, err error) {
+	requestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+	requestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// observeSnapshot records a snapshot attempt.
+func observeSnapshot(start time.Time, size int64, err error) {
+	if err != nil {
+		snapshotFailures.Inc()
+		return
+	}
+	snapshotDuration.Set(time.Since(start).Seconds())
+	snapshotSize.Set(float64(size))
+	now := time.Now()
+	snapshotTimestamp.Set(float64(now.Unix()))
+	atomic.StoreInt64(&lastSnapshot, now.UnixNano())
+}
+
+// connStats is a gRPC stats handler counting open connections.
+type connStats struct{}
+
+func (connStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (connStats) HandleRPC(context.Context, stats.RPCStats)                         {}
+func (connStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+
+func (connStats) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		connectedClients.Inc()
+	case *stats.ConnEnd:
+		connectedClients.Dec()
+	}
+}
+
+// storeCollector exports the keys, bytes and memory of the store when
+// scraped, read from the usage and eviction trackers rather than by scanning
+// the data.
+type storeCollector struct {
+	server *Server
+}
+
+var (
+	namespaceKeysDesc = prometheus.NewDesc("keev_namespace_keys",
+		"Keys stored per namespace.", []string{"user", "namespace"}, nil)
+	namespaceBytesDesc = prometheus.NewDesc("keev_namespace_bytes",
+		"Bytes of keys and values stored per namespace.", []string{"user", "namespace"}, nil)
+	memoryBytesDesc = prometheus.NewDesc("keev_memory_bytes",
+		"Bytes of keys and values held in memory.", nil, nil)
+	evictedDesc = prometheus.NewDesc("keev_evicted_keys_total",
+		"Keys evicted to stay under the memory limit.", nil, nil)
+	expiredDesc = prometheus.NewDesc("keev_expired_keys_total",
+		"Keys removed after their TTL passed.", nil, nil)
+	walSizeDesc = prometheus.NewDesc("keev_wal_size_bytes",
+		"Size of the write log segments kept.", nil, nil)
+	walRevisionDesc = prometheus.NewDesc("keev_wal_revision",
+		"Revision of the last change written to the write log.", nil, nil)
+	raftTermDesc = prometheus.NewDesc("keev_raft_term",
+		"Current Raft term of the node.", nil, nil)
+	raftLeaderDesc = prometheus.NewDesc("keev_raft_leader",
+		"1 if the node is the leader of the cluster, 0 otherwise.", nil, nil)
+	raftCommitDesc = prometheus.NewDesc("keev_raft_commit_index",
+		"Index of the last Raft entry known to be committed.", nil, nil)
+	raftAppliedDesc = prometheus.NewDesc("keev_raft_applied_index",
+		"Index of the last Raft entry applied to the data.", nil, nil)
+	replicasDesc = prometheus.NewDesc("keev_replication_replicas",
+		"Replicas connected to the primary.", nil, nil)
+	replicationLagDesc = prometheus.NewDesc("keev_replication_lag",
+		"Changes of the primary the replica has not applied yet.", nil, nil)
+	replicationStalenessDesc = prometheus.NewDesc("keev_replication_staleness_seconds",
+		"Seconds since the replica last had every change of the primary, +Inf if never.", nil, nil)
+	shardMapVersionDesc = prometheus.NewDesc("keev_shard_map_version",
+		"Version of the shard map of the shard, 0 if it has none yet.", nil, nil)
+	shardRebalancingDesc = prometheus.NewDesc("keev_shard_rebalancing",
+		"1 while keys move to or from the shard, 0 otherwise.", nil, nil)
+	shardMovedDesc = prometheus.NewDesc("keev_shard_moved_keys_total",
+		"Keys sent to other shards.", nil, nil)
+	siteLagDesc = prometheus.NewDesc("keev_site_lag",
+		"Changes of another site the site has not merged yet.", []string{"site"}, nil)
+	siteStalenessDesc = prometheus.NewDesc("keev_site_staleness_seconds",
+		"Seconds since the site last had every change of another site, +Inf if never.", []string{"site"}, nil)
+	siteConflictsDesc = prometheus.NewDesc("keev_site_conflicts_total",
+		"Writes of another site found concurrent with those of the site.", []string{"site"}, nil)
+)
+
+func (c storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- namespaceKeysDesc
+	ch <- namespaceBytesDesc
+	ch <- memoryBytesDesc
+	ch <- evictedDesc
+	ch <- expiredDesc
+	ch <- walSizeDesc
+	ch <- walRevisionDesc
+	ch <- raftTermDesc
+	ch <- raftLeaderDesc
+	ch <- raftCommitDesc
+	ch <- raftAppliedDesc
+	ch <- replicasDesc
+	ch <- replicationLagDesc
+	ch <- replicationStalenessDesc
+	ch <- shardMapVersionDesc
+	ch <- shardRebalancingDesc
+	ch <- shardMovedDesc
+	ch <- siteLagDesc
+	ch <- siteStalenessDesc
+	ch <- siteConflictsDesc
+}
+
+func (c storeCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.server
+	for _, user := range s.usage.Users() {
+		for _, ns := range s.usage.Namespaces(user) {
+			ch <- prometheus.MustNewConstMetric(namespaceKeysDesc, prometheus.GaugeValue, float64(ns.Keys), user, ns.Namespace)
+			ch <- prometheus.MustNewConstMetric(namespaceBytesDesc, prometheus.GaugeValue, float64(ns.Bytes), user, ns.Namespace)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(memoryBytesDesc, prometheus.GaugeValue, float64(s.Data.Bytes()))
+	evicted := s.Meta.Stats()
+	ch <- prometheus.MustNewConstMetric(evictedDesc, prometheus.CounterValue, float64(evicted.Evicted))
+	ch <- prometheus.MustNewConstMetric(expiredDesc, prometheus.CounterValue, float64(evicted.Expired))
+	if s.log != nil {
+		ch <- prometheus.MustNewConstMetric(walSizeDesc, prometheus.GaugeValue, float64(s.log.Size()))
+		ch <- prometheus.MustNewConstMetric(walRevisionDesc, prometheus.GaugeValue, float64(s.log.Revision()))
+	}
+	if s.raft != nil {
+		st := s.raft.Status()
+		leader := 0.0
+		if st.State == raft.Leader {
+			leader = 1
+		}
+		ch <- prometheus.MustNewConstMetric(raftTermDesc, prometheus.GaugeValue, float64(st.Term))
+		ch <- prometheus.MustNewConstMetric(raftLeaderDesc, prometheus.GaugeValue, leader)
+		ch <- prometheus.MustNewConstMetric(raftCommitDesc, prometheus.GaugeValue, float64(st.CommitIndex))
+		ch <- prometheus.MustNewConstMetric(raftAppliedDesc, prometheus.GaugeValue, float64(st.AppliedIndex))
+	}
+	if s.feed != nil {
+		ch <- prometheus.MustNewConstMetric(replicasDesc, prometheus.GaugeValue, float64(len(s.feed.status().Replicas)))
+	}
+	if s.replica != nil {
+		st := s.replica.status(s.revision())
+		staleness := math.Inf(1)
+		if st.StalenessMs >= 0 {
+			staleness = float64(st.StalenessMs) / 1000
+		}
+		ch <- prometheus.MustNewConstMetric(replicationLagDesc, prometheus.GaugeValue, float64(st.Lag))
+		ch <- prometheus.MustNewConstMetric(replicationStalenessDesc, prometheus.GaugeValue, staleness)
+	}
+	if s.shards != nil {
+		st := s.shards.status()
+		rebalancing := 0.0
+		if st.Rebalancing {
+			rebalancing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(shardMapVersionDesc, prometheus.GaugeValue, float64(st.Map.Version))
+		ch <- prometheus.MustNewConstMetric(shardRebalancingDesc, prometheus.GaugeValue, rebalancing)
+		ch <- prometheus.MustNewConstMetric(shardMovedDesc, prometheus.CounterValue, float64(st.Moved))
+	}
+	if s.sites != nil {
+		for _, p := range s.sites.status().Peers {
+			staleness := math.Inf(1)
+			if p.StalenessMs >= 0 {
+				staleness = float64(p.StalenessMs) / 1000
+			}
+			ch <- prometheus.MustNewConstMetric(siteLagDesc, prometheus.GaugeValue, float64(p.Lag), p.Id)
+			ch <- prometheus.MustNewConstMetric(siteStalenessDesc, prometheus.GaugeValue, staleness, p.Id)
+			ch <- prometheus.MustNewConstMetric(siteConflictsDesc, prometheus.CounterValue, float64(p.Conflicts), p.Id)
+		}
+	}
+}
+
+// serveMetrics exposes the metrics of server over HTTP at /metrics.
+func serveMetrics(addr string, server *Server) {
+	prometheus.MustRegister(storeCollector{server})
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "keev_snapshot_age_seconds",
+		Help: "Seconds since the last successful snapshot, or since startup if there was none.",
+	}, snapshotAge))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	logger.WithField("address", addr).Info("serving metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.WithError(err).Error("metrics listener stopped")
+	}
+}
+
+// lastSnapshot is the unix time in nanoseconds of the last successful
+// snapshot, or of startup.
+var lastSnapshot = time.Now().UnixNano()
+
+func snapshotAge() float64 {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&lastSnapshot))).Seconds()
+}
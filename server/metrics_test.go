@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_MetricsStoreCollector(t *testing.T) {
+	s := NewServer()
+	s.Data.Set("user.ns.a", "12345")
+	s.Data.Set("user.ns.b", "1")
+	s.Data.Set("admin.other.c", "")
+	s.rebuildUsage()
+
+	expected := `
+# HELP keev_namespace_keys Keys stored per namespace.
+# TYPE keev_namespace_keys gauge
+keev_namespace_keys{namespace="ns",user="user"} 2
+keev_namespace_keys{namespace="other",user="admin"} 1
+`
+	if err := testutil.CollectAndCompare(storeCollector{s}, strings.NewReader(expected), "keev_namespace_keys"); err != nil {
+		t.Fatalf("unexpected namespace metrics: %s", err.Error())
+	}
+	if n := testutil.CollectAndCount(storeCollector{s}, "keev_namespace_bytes"); n != 2 {
+		t.Fatalf("expected bytes for 2 namespaces, got %d", n)
+	}
+}
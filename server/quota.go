@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/quota"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// entrySize is the number of bytes a key-value pair counts towards quotas.
+func entrySize(key, value string) int64 {
+	return int64(len(key) + len(value))
+}
+
+func toQuotaLimit(q auth.Quota) quota.Limit {
+	return quota.Limit{Keys: q.Keys, Bytes: q.Bytes}
+}
+
+// reserve takes keys and bytes from the quotas of a user and namespace,
+// failing with ResourceExhausted if either would be exceeded.
+func (s *Server) reserve(username, namespace string, keys, bytes int64) error {
+	err := s.usage.Reserve(username, namespace, keys, bytes,
+		toQuotaLimit(users.Quota(username)),
+		toQuotaLimit(users.NamespaceQuota(username, namespace)))
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return nil
+}
+
+// release gives back keys and bytes taken by reserve, or freed by a write.
+func (s *Server) release(username, namespace string, keys, bytes int64) {
+	s.usage.Add(username, namespace, -keys, -bytes)
+}
+
+// rebuildUsage recomputes usage from scratch, only needed after the data is
+// loaded from disk.
+func (s *Server) rebuildUsage() {
+	s.usage.Reset()
+	s.Data.IterCb(func(key string, v interface{}) {
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) != 3 {
+			return
+		}
+		s.usage.Add(parts[0], parts[1], 1, entrySize(parts[2], v.(string)))
+	})
+}
+
+// Returns the keys and bytes stored by a user and each of their namespaces, along with their quotas
+// NOTE: No token needed, only admins may query other users
+func (s *Server) Usage(ctx context.Context, in *pb.UsageRequest) (*pb.UsageResponse, error) {
+	username, ok := usernameFromContext(ctx)
+	if !ok {
+		return nil, EmptyMetadataErr // should not occur
+	}
+	if in.Username != "" && in.Username != username {
+		if !isAdmin(ctx) {
+			return nil, AdminOnlyErr
+		}
+		if !users.Exists(in.Username) {
+			return nil, InvalidUsernameErr
+		}
+		username = in.Username
+	}
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
+	total := s.usage.User(username)
+	limit := users.Quota(username)
+	resp := &pb.UsageResponse{
+		Total: &pb.QuotaUsage{Keys: total.Keys, Bytes: total.Bytes, MaxKeys: limit.Keys, MaxBytes: limit.Bytes},
+	}
+	for _, ns := range s.usage.Namespaces(username) {
+		if checkNamespace(ctx, ns.Namespace) != nil {
+			continue
+		}
+		limit := users.NamespaceQuota(username, ns.Namespace)
+		resp.Namespaces = append(resp.Namespaces, &pb.QuotaUsage{
+			Namespace: ns.Namespace,
+			Keys:      ns.Keys,
+			Bytes:     ns.Bytes,
+			MaxKeys:   limit.Keys,
+			MaxBytes:  limit.Bytes,
+		})
+	}
+	return resp, nil
+}
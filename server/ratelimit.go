@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/imjching/keev/auth"
+	"github.com/imjching/keev/ratelimit"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var limiter = ratelimit.New()
+
+// rateLimitIdle is how long the buckets and counters of an identity are
+// kept after its last request.
+const rateLimitIdle = 10 * time.Minute
+
+func toLimit(l auth.RateLimit) ratelimit.Limit {
+	return ratelimit.Limit{Requests: l.Requests, Bytes: l.Bytes}
+}
+
+// rateLimitIDs returns the identities a request is charged to: the user and,
+// for API keys, the key itself.
+func rateLimitIDs(c *caller) ([]string, []ratelimit.Limit) {
+	ids := []string{"user:" + c.Username}
+	limits := []ratelimit.Limit{toLimit(users.RateLimit(c.Username))}
+	if c.APIKey != nil {
+		ids = append(ids, "key:"+c.APIKey.ID)
+		limits = append(limits, toLimit(users.APIKeyRateLimit(c.Username)))
+	}
+	return ids, limits
+}
+
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok && msg != nil {
+		return proto.Size(msg)
+	}
+	return 0
+}
+
+// checkRateLimit takes a request and its bytes from the caller's buckets. A
+// throttled request fails with ResourceExhausted and a retry-after trailer
+// holding the number of seconds to wait.
+func checkRateLimit(ctx context.Context, req interface{}) error {
+	c, ok := callerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	ids, limits := rateLimitIDs(c)
+	wait, ok := limiter.Allow(ids, limits, messageSize(req))
+	if ok {
+		return nil
+	}
+	secs := int(math.Ceil(wait.Seconds()))
+	grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(secs)))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ds", secs)
+}
+
+// chargeResponse takes the bytes of a response, or of a message of a
+// stream, from the caller's buckets.
+func chargeResponse(ctx context.Context, resp interface{}) {
+	if c, ok := callerFromContext(ctx); ok {
+		ids, _ := rateLimitIDs(c)
+		limiter.Charge(ids, messageSize(resp))
+	}
+}
+
+// chargedStream charges the caller for every message sent and received on a
+// stream, the stream itself being checked as one request.
+type chargedStream struct {
+	grpc.ServerStream
+}
+
+func (s chargedStream) SendMsg(m interface{}) error {
+	chargeResponse(s.Context(), m)
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s chargedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		chargeResponse(s.Context(), m)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sendStream is the server side of a stream that only sends.
+type sendStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s sendStream) Context() context.Context    { return s.ctx }
+func (s sendStream) SendMsg(m interface{}) error { return nil }
+
+func Test_RateLimitStreams(t *testing.T) {
+	defer func(u *auth.CredentialsStore) { users = u }(users)
+	users = auth.NewCredentialsStore()
+	users.Load(strings.NewReader(`[{"username": "streamer", "rate_limit": {"bytes": 1000}}]`))
+	ctx := withCaller(context.Background(), &caller{Username: "streamer"})
+
+	if err := checkRateLimit(ctx, nil); err != nil {
+		t.Fatalf("failed to open the stream: %s", err.Error())
+	}
+	stream := chargedStream{sendStream{ctx: ctx}}
+	for i := 0; i < 3; i++ {
+		stream.SendMsg(&pb.BackupChunk{Data: make([]byte, 600)})
+	}
+	if err := checkRateLimit(ctx, nil); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected the messages of the stream to be charged, got %v", err)
+	}
+}
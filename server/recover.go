@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/imjching/keev/encrypt"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/snapshot"
+	"github.com/imjching/keev/wal"
+
+	"github.com/sirupsen/logrus"
+)
+
+var recoverTo = flag.String("recover-to", "", "rebuild the data as of a revision or an RFC 3339 time into --recover-into and exit")
+var recoverInto = flag.String("recover-into", "", "new data directory written by --recover-to")
+
+// errTargetReached stops the replay at the first change after the target.
+var errTargetReached = errors.New("recovery target reached")
+
+// recoveryTarget is the revision, or the time, the data is recovered to.
+type recoveryTarget struct {
+	revision uint64
+	time     time.Time // zero when recovering to a revision
+}
+
+// parseRecoveryTarget parses a revision or an RFC 3339 time.
+func parseRecoveryTarget(s string) (recoveryTarget, error) {
+	if revision, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return recoveryTarget{revision: revision}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return recoveryTarget{}, fmt.Errorf("%s: %q", InvalidRecoveryTargetErr, s)
+	}
+	return recoveryTarget{time: t}, nil
+}
+
+// includes returns true if the change at revision, made at unix nanoseconds
+// at, is part of the recovered data.
+func (t recoveryTarget) includes(revision uint64, at int64) bool {
+	if t.time.IsZero() {
+		return revision <= t.revision
+	}
+	return at <= t.time.UnixNano()
+}
+
+// recoveryReport describes what point-in-time recovery did.
+type recoveryReport struct {
+	Base         string // snapshot the data was rebuilt from
+	BaseRevision uint64
+	Replayed     int // changes replayed from the write log
+	Revision     uint64
+	Keys         int
+	Into         string
+}
+
+func (r *recoveryReport) String() string {
+	return fmt.Sprintf("base snapshot: %s (revision %d)\nreplayed:      %d operation(s)\nrevision:      %d\nkeys:          %d\nwritten to:    %s\n",
+		r.Base, r.BaseRevision, r.Replayed, r.Revision, r.Keys, r.Into)
+}
+
+// readSnapshotHeader returns the header of the snapshot at path.
+func readSnapshotHeader(path string) (*pb.SnapshotHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r, err := openData(file)
+	if err != nil {
+		return nil, err
+	}
+	sr, err := snapshot.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return sr.Header(), nil
+}
+
+// recoveryBase returns the newest snapshot, archived or current, taken no
+// later than target. Without one the data cannot be rebuilt: the log does
+// not hold what was stored before it was turned on.
+func recoveryBase(target recoveryTarget) (string, error) {
+	archives, err := listArchives(cfg.ArchiveDir())
+	if err != nil {
+		return "", err
+	}
+	paths := []string{cfg.DataFile()}
+	for _, a := range archives {
+		paths = append(paths, a.path)
+	}
+	base, baseRevision := "", uint64(0)
+	for _, path := range paths {
+		h, err := readSnapshotHeader(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", path, err.Error())
+		}
+		if target.includes(h.Revision, h.Created) && (base == "" || h.Revision > baseRevision) {
+			base, baseRevision = path, h.Revision
+		}
+	}
+	if base == "" {
+		return "", RecoveryTargetTooOldErr
+	}
+	return base, nil
+}
+
+// recoverData rebuilds the data as of target from the snapshots and the
+// write log, and writes it with the users and keys into a new data
+// directory. The server's own data is only read.
+func recoverData(to, into string) (*recoveryReport, error) {
+	target, err := parseRecoveryTarget(to)
+	if err != nil {
+		return nil, err
+	}
+	if into == "" {
+		return nil, RecoverIntoErr
+	}
+	if !cfg.WALEnabled() {
+		return nil, WALDisabledErr
+	}
+	dataFile := filepath.Join(into, filepath.Base(cfg.DataFile()))
+	if _, err := os.Stat(dataFile); err == nil {
+		return nil, fmt.Errorf("%s: %q", RecoverIntoExistsErr, dataFile)
+	}
+	if cfg.EncryptionEnabled() && dataKeys == nil {
+		if dataKeys, err = encrypt.LoadKeyRing(cfg.EncryptionKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	s := NewServer()
+	report := &recoveryReport{Into: into}
+	if report.Base, err = recoveryBase(target); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(report.Base)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openData(file)
+	if err == nil {
+		_, err = s.readSnapshot(r)
+	}
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", report.Base, err.Error())
+	}
+	report.BaseRevision = s.baseRevision
+
+	err = wal.Replay(cfg.WALDir, logCipher(), s.baseRevision+1, func(e *pb.LogEntry) error {
+		if !target.includes(e.Revision, e.Time) {
+			return errTargetReached
+		}
+		s.applyLogEntry(e)
+		s.baseRevision = e.Revision
+		report.Replayed++
+		return nil
+	})
+	if err == wal.ErrTruncated {
+		return nil, RecoveryTargetTooOldErr
+	}
+	if err != nil && err != errTargetReached {
+		return nil, err
+	}
+	if target.time.IsZero() && s.baseRevision != target.revision {
+		return nil, fmt.Errorf("%s: the write log ends at revision %d", RecoveryTargetNotReachedErr, s.baseRevision)
+	}
+	report.Revision, report.Keys = s.baseRevision, s.Data.Count()
+
+	if err := os.MkdirAll(into, 0700); err != nil {
+		return nil, err
+	}
+	compression, _ := snapshot.ParseCompression(cfg.SnapshotCompression) // checked by Validate
+	err = writeFile(dataFile, 0644, func(w io.Writer) error {
+		return sealData(w, func(w io.Writer) error {
+			_, _, err := s.writeSnapshot(w, compression, "")
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the recovered store is started with the users and keys of today
+	for _, path := range []string{cfg.Users, cfg.JWTKeys, cfg.APIKeys} {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(into, filepath.Base(path)), b, 0600)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger.WithFields(logrus.Fields{"base": report.Base, "replayed": report.Replayed, "revision": report.Revision,
+		"keys": report.Keys, "path": into}).Info("recovered data")
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadDir loads the data directory dir as the server would on startup.
+func loadDir(t *testing.T, dir string) *Server {
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = dir
+	cfg.resolvePaths()
+	s := NewServer()
+	if err := loadFromDisk(s); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to load %s: %s", dir, err.Error())
+	}
+	if err := s.openLog(); err != nil {
+		t.Fatalf("failed to open write log: %s", err.Error())
+	}
+	s.log.Close()
+	return s
+}
+
+func Test_RecoverPointInTime(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-recover")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = filepath.Join(dir, "data")
+	cfg.resolvePaths()
+	os.MkdirAll(cfg.DataDir, 0700)
+	ioutil.WriteFile(cfg.Users, []byte("{}"), 0600)
+
+	s := NewServer()
+	if err := s.openLog(); err != nil {
+		t.Fatalf("failed to open write log: %s", err.Error())
+	}
+	s.Data.Set("user.ns.a", "1")
+	s.Data.Set("user.ns.b", "2")
+	s.setExpiry("user.ns.b", 4102444800)
+	if err := saveToDisk(s, true); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+	if archives, _ := listArchives(cfg.ArchiveDir()); len(archives) != 1 || archives[0].revision != 3 {
+		t.Fatalf("expected the snapshot at revision 3 to be archived, got %v", archives)
+	}
+	s.Data.Set("user.ns.c", "3")
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	// the accidental unset spree, only in the log
+	for _, key := range []string{"user.ns.a", "user.ns.b", "user.ns.c"} {
+		s.Data.Remove(key)
+		s.Meta.Remove(key)
+	}
+	s.log.Close()
+
+	// the server replays the log on top of the snapshot
+	if restarted := loadDir(t, cfg.DataDir); restarted.Data.Count() != 0 || restarted.revision() != 7 {
+		t.Fatalf("expected the log to be replayed, got %v at revision %d", restarted.Data.Items(), restarted.revision())
+	}
+
+	for _, to := range []string{"4", before.Format(time.RFC3339Nano)} {
+		into := filepath.Join(dir, "recovered-"+strings.Replace(to, ":", "", -1))
+		report, err := recoverData(to, into)
+		if err != nil {
+			t.Fatalf("failed to recover to %s: %s", to, err.Error())
+		}
+		if report.BaseRevision != 3 || report.Replayed != 1 || report.Revision != 4 || report.Keys != 3 {
+			t.Fatalf("unexpected report recovering to %s: %+v", to, report)
+		}
+		if _, err := os.Stat(filepath.Join(into, "users.json")); err != nil {
+			t.Fatalf("users not copied: %s", err.Error())
+		}
+		recovered := loadDir(t, into)
+		if v, _ := recovered.Data.Get("user.ns.c"); recovered.Data.Count() != 3 || v != "3" {
+			t.Fatalf("unexpected data recovered to %s: %v", to, recovered.Data.Items())
+		}
+		if recovered.Meta.Expiry("user.ns.b") != 4102444800 {
+			t.Fatalf("expiry not recovered")
+		}
+		if recovered.revision() != 4 {
+			t.Fatalf("expected the recovered store to continue after revision 4, got %d", recovered.revision())
+		}
+	}
+
+	if _, err := recoverData("2", filepath.Join(dir, "first")); err != RecoveryTargetTooOldErr {
+		t.Fatalf("expected a target before every snapshot to be rejected, got %v", err)
+	}
+	if _, err := recoverData("8", filepath.Join(dir, "future")); err == nil || !strings.Contains(err.Error(), RecoveryTargetNotReachedErr.Error()) {
+		t.Fatalf("expected a revision after the log to be rejected, got %v", err)
+	}
+	if _, err := recoverData("4", cfg.DataDir); err == nil || !strings.Contains(err.Error(), RecoverIntoExistsErr.Error()) {
+		t.Fatalf("expected recovering over existing data to be refused, got %v", err)
+	}
+	if _, err := recoverData("yesterday", filepath.Join(dir, "x")); err == nil {
+		t.Fatalf("expected an invalid target to be rejected")
+	}
+}
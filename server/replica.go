@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// replicaRetry is how long a replica waits before reconnecting to the
+// primary.
+const replicaRetry = time.Second
+
+// replica follows a primary: it loads the snapshot the primary sends, then
+// applies the changes of the primary as they are made and acknowledges
+// them, reconnecting whenever the stream breaks. The replica is read-only,
+// its data only changes through the primary.
+type replica struct {
+	s       *Server
+	primary string // address of the primary
+	conn    *grpc.ClientConn
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu              sync.Mutex
+	history         string // of the primary the data comes from, empty while it is incomplete
+	connected       bool
+	primaryRevision uint64    // of the last change of the primary known
+	synced          time.Time // when the replica last had every change of the primary
+}
+
+// startReplica dials the primary in cfg and starts following it.
+func startReplica(s *Server) error {
+	opts, err := peerDialOptions(cfg, cfg.Replication.CA, "--replication-ca",
+		secretCredentials{replicationSecretHeader, cfg.Replication.Secret})
+	if err != nil {
+		return err
+	}
+	opts = append(opts,
+		grpc.WithBackoffMaxDelay(replicaRetry),
+		// a change may be as large as a request
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(2*cfg.MaxMessageSize))))
+	conn, err := grpc.Dial(cfg.Replication.Primary, opts...)
+	if err != nil {
+		return err
+	}
+	s.follow(conn, cfg.Replication.Primary)
+	logger.WithFields(logrus.Fields{"primary": cfg.Replication.Primary, "revision": s.revision()}).Info("following primary")
+	return nil
+}
+
+// follow makes the server a replica of the primary at addr, reached
+// through conn.
+func (s *Server) follow(conn *grpc.ClientConn, addr string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &replica{s: s, primary: addr, conn: conn, cancel: cancel, done: make(chan struct{})}
+	atomic.StoreUint64(&s.applied, s.baseRevision)
+	s.replica = r
+	go r.run(ctx)
+}
+
+// stop stops following the primary.
+func (r *replica) stop() {
+	r.cancel()
+	<-r.done
+	r.conn.Close()
+}
+
+func (r *replica) run(ctx context.Context) {
+	defer close(r.done)
+	client := pb.NewReplicationClient(r.conn)
+	for {
+		err := r.replicate(ctx, client)
+		r.mu.Lock()
+		r.connected = false
+		r.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		logger.WithError(err).WithField("primary", r.primary).Warn("lost the primary, reconnecting")
+		select {
+		case <-time.After(replicaRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replicate follows the primary until the stream breaks.
+func (r *replica) replicate(ctx context.Context, client pb.ReplicationClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Replicate(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	history := r.history
+	r.mu.Unlock()
+	if err := stream.Send(&pb.ReplicaAck{History: history, Revision: r.s.revision()}); err != nil {
+		return err
+	}
+	var next *pb.ReplicationMessage // read past the end of a snapshot
+	for {
+		msg := next
+		if msg == nil {
+			if msg, err = stream.Recv(); err != nil {
+				return err
+			}
+		}
+		next = nil
+		if msg.Full {
+			if next, err = r.load(stream, msg.History); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(msg.Snapshot) > 0 {
+			return fmt.Errorf("%s: snapshot data without a snapshot", ReplicationStreamErr)
+		}
+		for _, e := range msg.Entries {
+			if want := r.s.revision() + 1; e.Revision != want {
+				return fmt.Errorf("%s: expected revision %d, got %d", ReplicationStreamErr, want, e.Revision)
+			}
+			r.s.applyReplicated(e)
+		}
+		revision := r.s.revision()
+		r.mu.Lock()
+		r.connected, r.primaryRevision = true, msg.Revision
+		if revision >= msg.Revision {
+			r.synced = time.Now()
+		}
+		r.mu.Unlock()
+		if err := stream.Send(&pb.ReplicaAck{Revision: revision}); err != nil {
+			return err
+		}
+	}
+}
+
+// load replaces the data with the snapshot streamed by the primary and
+// returns the message that follows it. Until it is loaded, reads see part
+// of the data, and bounded reads fail.
+func (r *replica) load(stream pb.Replication_ReplicateClient, history string) (*pb.ReplicationMessage, error) {
+	s := r.s
+	r.mu.Lock()
+	r.history, r.synced = "", time.Time{}
+	r.mu.Unlock()
+	for _, key := range s.Data.Keys() {
+		s.Data.Remove(key)
+		s.Meta.Remove(key)
+	}
+	s.versions.clear()
+	sr := &snapshotReader{stream: stream}
+	keys, err := s.readSnapshot(sr)
+	if err == nil {
+		// read up to the message after the snapshot
+		_, err = io.Copy(ioutil.Discard, sr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreUint64(&s.applied, s.baseRevision)
+	s.rebuildUsage()
+	s.trackKeys()
+	r.mu.Lock()
+	r.history = history
+	r.mu.Unlock()
+	logger.WithFields(logrus.Fields{"keys": keys, "revision": s.baseRevision}).Info("loaded snapshot from the primary")
+	return sr.next, nil
+}
+
+// messageStream is a stream of the changes of a primary, or of a site.
+type messageStream interface {
+	Recv() (*pb.ReplicationMessage, error)
+}
+
+// snapshotReader reads the snapshot sent to a replica or to a site, ending
+// at the first message that is not part of it.
+type snapshotReader struct {
+	stream messageStream
+	buf    []byte
+	next   *pb.ReplicationMessage
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next != nil {
+			return 0, io.EOF
+		}
+		msg, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(msg.Snapshot) == 0 {
+			r.next = msg
+			return 0, io.EOF
+		}
+		r.buf = msg.Snapshot
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// applyReplicated makes a change of the primary, keeping the usage up to
+// date. Changes are applied one at a time, by the replica alone.
+func (s *Server) applyReplicated(e *pb.LogEntry) {
+	switch e.Op {
+	case pb.LogOp_SET:
+		s.putKey(e.Key, e.Value)
+	case pb.LogOp_DELETE:
+		s.dropKey(e.Key)
+		s.Meta.Remove(e.Key)
+	case pb.LogOp_EXPIRE:
+		s.Meta.SetExpiry(e.Key, e.Expires)
+	case pb.LogOp_VERSIONS:
+		s.versions.set(e.Key, e.Versions)
+	}
+	atomic.StoreUint64(&s.applied, e.Revision)
+}
+
+// staleness returns how long ago the replica last had every change of the
+// primary, about the age of the oldest change it may be missing.
+func (r *replica) staleness() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.synced.IsZero() {
+		return math.MaxInt64
+	}
+	return time.Since(r.synced)
+}
+
+// redirect returns the error a replica answers writes with, setting the
+// address of the primary in the trailer as a cluster node does with the
+// leader's.
+func (r *replica) redirect(ctx context.Context) error {
+	grpc.SetTrailer(ctx, metadata.Pairs(leaderHeader, r.primary))
+	return status.Error(codes.Unavailable, fmt.Sprintf("%s: %q", ReadOnlyReplicaErr, r.primary))
+}
+
+func (r *replica) status(revision uint64) *pb.ReplicationStatusResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := &pb.ReplicationStatusResponse{
+		Role:            "replica",
+		Revision:        revision,
+		History:         r.history,
+		Primary:         r.primary,
+		Connected:       r.connected,
+		PrimaryRevision: r.primaryRevision,
+		StalenessMs:     -1,
+	}
+	if r.primaryRevision > revision {
+		resp.Lag = r.primaryRevision - revision
+	}
+	if !r.synced.IsZero() {
+		resp.StalenessMs = int64(time.Since(r.synced) / time.Millisecond)
+	}
+	return resp
+}
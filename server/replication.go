@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/snapshot"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// replicationMethods is the prefix of the methods of the Replication
+// service, called by the replicas of a primary.
+const replicationMethods = "/protobuf.Replication/"
+
+// replicationSecretHeader is the metadata key carrying the replication
+// secret.
+const replicationSecretHeader = "replication-secret"
+
+// replicationHeartbeat is how often the primary tells an idle replica its
+// revision, so the replica knows how stale it is.
+const replicationHeartbeat = 500 * time.Millisecond
+
+// maxReplicationBatch is the most changes sent to a replica in one message.
+const maxReplicationBatch = 1000
+
+func isReplicationMethod(method string) bool {
+	return strings.HasPrefix(method, replicationMethods)
+}
+
+// checkReplicationSecret authenticates a replica.
+func checkReplicationSecret(ctx context.Context) error {
+	if !cfg.ReplicationEnabled() || !hasSecret(ctx, replicationSecretHeader, cfg.Replication.Secret) {
+		return status.Error(codes.Unauthenticated, ReplicationSecretErr.Error())
+	}
+	return nil
+}
+
+// feed keeps the most recent changes of a primary for its replicas. Changes
+// are numbered like the write log, which gives the same revisions when it
+// is enabled.
+type feed struct {
+	mu       sync.Mutex
+	history  string
+	last     uint64         // revision of the last change
+	backlog  []*pb.LogEntry // the changes up to last, oldest first
+	size     int            // changes kept in the backlog
+	changed  chan struct{}  // closed by the next change
+	replicas map[*follower]bool
+	saving   bool // taking the snapshot after a write log reset
+}
+
+// follower is a replica, or a site, connected to the server.
+type follower struct {
+	addr     string
+	site     string // ID of a site, empty for a replica
+	revision uint64 // of the last change acknowledged
+	acked    time.Time
+}
+
+// newFeed returns the feed of a primary whose last change is revision. Its
+// history is new: revisions after the snapshot the primary started from
+// may be reused for different changes, replicas must not resume from them.
+func newFeed(revision uint64, size int) *feed {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &feed{
+		history:  hex.EncodeToString(b),
+		last:     revision,
+		size:     size,
+		changed:  make(chan struct{}),
+		replicas: make(map[*follower]bool),
+	}
+}
+
+// publish gives e the next revision and keeps it for the replicas, after
+// writing it to the write log if there is one. It is called with the lock
+// of the shard holding the key, so a snapshot holds every change up to the
+// revision it is taken at.
+func (s *Server) publish(e *pb.LogEntry) {
+	f := s.feed
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s.log != nil && s.appendLog(e) != nil && s.log.Revision() != f.last+1 {
+		// the change is applied and sent to the replicas all the same: the
+		// log starts over after it so both keep the same revisions, and a
+		// snapshot holding it is taken once the lock of its shard is free
+		if err := s.log.Reset(f.last + 1); err != nil {
+			walFailures.Inc()
+			logger.WithError(err).Error("failed to start a new write log")
+		}
+		if !f.saving {
+			f.saving = true
+			go func() {
+				saveToDisk(s, false)
+				f.mu.Lock()
+				f.saving = false
+				f.mu.Unlock()
+			}()
+		}
+	}
+	e.Revision = f.last + 1
+	if e.Time == 0 {
+		e.Time = time.Now().UnixNano()
+	}
+	f.last = e.Revision
+	f.backlog = append(f.backlog, e)
+	if len(f.backlog) >= 2*f.size {
+		f.backlog = append([]*pb.LogEntry(nil), f.backlog[len(f.backlog)-f.size:]...)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// revision returns the revision of the last change.
+func (f *feed) revision() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+// has returns true if a replica whose data comes from history and holds
+// the changes up to revision can resume from the backlog.
+func (f *feed) has(history string, revision uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return history == f.history && revision <= f.last && revision+uint64(len(f.backlog)) >= f.last
+}
+
+// since returns up to max changes after revision, the revision of the last
+// change and a channel closed by the next one. ok is false if the changes
+// after revision are no longer kept.
+func (f *feed) since(revision uint64, max int) (entries []*pb.LogEntry, last uint64, changed <-chan struct{}, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if revision > f.last || revision+uint64(len(f.backlog)) < f.last {
+		return nil, f.last, f.changed, false
+	}
+	entries = f.backlog[len(f.backlog)-int(f.last-revision):]
+	if len(entries) > max {
+		entries = entries[:max]
+	}
+	return entries, f.last, f.changed, true
+}
+
+func (f *feed) attach(addr, site string) *follower {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := &follower{addr: addr, site: site}
+	f.replicas[r] = true
+	return r
+}
+
+func (f *feed) detach(r *follower) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.replicas, r)
+}
+
+func (f *feed) ack(r *follower, revision uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.revision, r.acked = revision, time.Now()
+}
+
+// status returns the revision of the primary and the progress of every
+// replica.
+func (f *feed) status() *pb.ReplicationStatusResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &pb.ReplicationStatusResponse{Role: "primary", Revision: f.last, History: f.history}
+	for r := range f.replicas {
+		if r.site != "" {
+			continue
+		}
+		st := &pb.ReplicaStatus{Addr: r.addr, Revision: r.revision, LastAckMs: -1}
+		if r.revision < f.last {
+			st.Lag = f.last - r.revision
+		}
+		if !r.acked.IsZero() {
+			st.LastAckMs = int64(time.Since(r.acked) / time.Millisecond)
+		}
+		resp.Replicas = append(resp.Replicas, st)
+	}
+	return resp
+}
+
+// batch cuts entries short so they fit in a message.
+func batch(entries []*pb.LogEntry) []*pb.LogEntry {
+	size := 0
+	for i, e := range entries {
+		if size += proto.Size(e); i > 0 && size > int(cfg.MaxMessageSize/2) {
+			return entries[:i]
+		}
+	}
+	return entries
+}
+
+// feedStream is a stream the changes of the feed are sent on, to a replica
+// or to a site.
+type feedStream interface {
+	Send(*pb.ReplicationMessage) error
+	Recv() (*pb.ReplicaAck, error)
+	Context() context.Context
+}
+
+// Streams the changes of a primary to a replica, preceded by a snapshot if the replica cannot resume where it left off
+// NOTE: Replicas only, authenticated with the replication secret
+func (s *Server) Replicate(stream pb.Replication_ReplicateServer) error {
+	if s.feed == nil {
+		return status.Error(codes.FailedPrecondition, NotPrimaryErr.Error())
+	}
+	return s.serveFeed(stream, false)
+}
+
+// serveFeed streams the changes of the feed to a replica or, if site is
+// true, only the versions of the keys written to a site: the site merges
+// them into its own.
+func (s *Server) serveFeed(stream feedStream, site bool) error {
+	ctx, cancel := streamContext(stream.Context())
+	defer cancel()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if site && first.Site == "" {
+		return status.Error(codes.InvalidArgument, MissingSiteErr.Error())
+	}
+	if !site {
+		first.Site = ""
+	}
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	r := s.feed.attach(addr, first.Site)
+	defer s.feed.detach(r)
+	go func() {
+		for {
+			ack, err := stream.Recv()
+			if err != nil {
+				cancel()
+				return
+			}
+			s.feed.ack(r, ack.Revision)
+		}
+	}()
+
+	log := logger.WithField("replica", addr)
+	if site {
+		log = logger.WithFields(logrus.Fields{"site": first.Site, "addr": addr})
+	}
+	revision := first.Revision
+	if !s.feed.has(first.History, revision) {
+		if revision, err = s.sendSnapshot(stream, log); err != nil {
+			return err
+		}
+	} else {
+		log.WithField("revision", revision).Info("resumed from the backlog")
+	}
+	heartbeat := time.NewTicker(replicationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		entries, last, changed, ok := s.feed.since(revision, maxReplicationBatch)
+		if !ok {
+			// the replica reconnects and is sent a snapshot
+			log.WithField("revision", revision).Warn("fell behind the backlog")
+			return status.Error(codes.Aborted, ReplicaBehindErr.Error())
+		}
+		if len(entries) > 0 {
+			entries = batch(entries)
+			revision = entries[len(entries)-1].Revision
+			if site {
+				entries = siteEntries(entries, first.Site)
+			}
+			if err := stream.Send(&pb.ReplicationMessage{History: s.feed.history, Revision: last, Entries: entries, Through: revision}); err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			if err := stream.Send(&pb.ReplicationMessage{History: s.feed.history, Revision: last, Through: revision}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.Error(codes.Canceled, ctx.Err().Error())
+		}
+	}
+}
+
+// sendSnapshot sends a snapshot of the data to a replica, which drops its
+// own, or to a site, which merges it into its own, and returns the revision
+// of the snapshot.
+func (s *Server) sendSnapshot(stream feedStream, log *logrus.Entry) (uint64, error) {
+	err := stream.Send(&pb.ReplicationMessage{History: s.feed.history, Revision: s.feed.revision(), Full: true})
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriterSize(chunkWriter{func(p []byte) error {
+		return stream.Send(&pb.ReplicationMessage{Snapshot: p})
+	}}, backupChunkSize)
+	keys, revision, err := s.writeSnapshot(w, snapshot.Gzip, "")
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return 0, err
+	}
+	log.WithFields(logrus.Fields{"keys": keys, "revision": revision}).Info("sent snapshot")
+	return revision, nil
+}
+
+// Returns the role of the server in primary-replica replication, with the lag of a replica or of every replica following a primary
+// NOTE: Admin only, no token needed
+func (s *Server) ReplicationStatus(ctx context.Context, in *google_protobuf.Empty) (*pb.ReplicationStatusResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	switch {
+	case s.replica != nil:
+		return s.replica.status(s.revision()), nil
+	case s.feed != nil:
+		return s.feed.status(), nil
+	}
+	return nil, status.Error(codes.FailedPrecondition, ReplicationDisabledErr.Error())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// waitUntil fails the test if ok does not hold within 5 seconds.
+func waitUntil(t *testing.T, what string, ok func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func Test_ReplicationBacklog(t *testing.T) {
+	s := NewServer()
+	s.feed = newFeed(10, 2)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.Data.Set("user.ns."+key, "1")
+	}
+	if s.revision() != 15 {
+		t.Fatalf("expected revision 15, got %d", s.revision())
+	}
+	if entries, last, _, ok := s.feed.since(12, 2); !ok || last != 15 || len(entries) != 2 || entries[0].Key != "user.ns.c" {
+		t.Fatalf("unexpected changes after 12: %v %d %v", entries, last, ok)
+	}
+	for _, revision := range []uint64{11, 16} {
+		if _, _, _, ok := s.feed.since(revision, 10); ok {
+			t.Fatalf("expected the changes after %d to be unavailable", revision)
+		}
+	}
+	if !s.feed.has(s.feed.history, 15) || s.feed.has("elsewhere", 15) || s.feed.has(s.feed.history, 11) {
+		t.Fatalf("replicas resume from the wrong revisions")
+	}
+}
+
+func Test_ReplicationLogFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-replication")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = dir
+	cfg.resolvePaths()
+
+	s := NewServer()
+	if err := s.openLog(); err != nil {
+		t.Fatalf("failed to open write log: %s", err.Error())
+	}
+	s.feed = newFeed(s.revision(), 100)
+	s.Data.Set("user.ns.a", "1")
+	s.Data.Set("user.ns.b", "2")
+	// the write log fails to write the next change
+	s.log.Close()
+	s.Data.Set("user.ns.c", "3")
+	s.Data.Set("user.ns.d", "4")
+	if s.revision() != 4 || s.log.Revision() != 4 {
+		t.Fatalf("expected the feed and the write log at revision 4, got %d and %d", s.revision(), s.log.Revision())
+	}
+	waitUntil(t, "the snapshot", func() bool {
+		s.feed.mu.Lock()
+		defer s.feed.mu.Unlock()
+		return !s.feed.saving
+	})
+	s.log.Close()
+
+	if restarted := loadDir(t, dir); restarted.Data.Count() != 4 || restarted.revision() != 4 {
+		t.Fatalf("expected every change after a restart, got %v at revision %d", restarted.Data.Items(), restarted.revision())
+	}
+}
+
+func Test_Replication(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	ctx := context.Background()
+
+	primary := NewServer()
+	primary.feed = newFeed(0, 100)
+	primary.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.a", Value: "1"})
+	primary.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.b", Value: "2", Expires: expiresAt(3600)})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	g := grpc.NewServer()
+	pb.RegisterReplicationServer(g, primary)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	// the replica starts from a snapshot
+	replica := NewServer()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err.Error())
+	}
+	replica.follow(conn, lis.Addr().String())
+	defer replica.replica.stop()
+	waitUntil(t, "the snapshot", func() bool { return replica.revision() == primary.revision() })
+	if v, _ := replica.Data.Get("user.ns.b"); v != "2" || replica.Meta.Expiry("user.ns.b") == 0 {
+		t.Fatalf("snapshot not loaded: %v", replica.Data.Items())
+	}
+
+	// then follows the changes
+	primary.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UPDATE, Key: "user.ns.a", Value: "3"})
+	primary.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: "user.ns.b"})
+	waitUntil(t, "the changes", func() bool { return replica.revision() == primary.revision() })
+	if v, _ := replica.Data.Get("user.ns.a"); v != "3" || replica.Data.Has("user.ns.b") || replica.usage.User("user").Keys != 1 {
+		t.Fatalf("changes not applied: %v", replica.Data.Items())
+	}
+
+	// and sends writes to the primary
+	_, err = replica.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.c", Value: "4"})
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), lis.Addr().String()) {
+		t.Fatalf("expected a redirect to the primary, got %v", err)
+	}
+
+	// both report the lag
+	waitUntil(t, "the acknowledgement", func() bool {
+		st := primary.feed.status()
+		return len(st.Replicas) == 1 && st.Replicas[0].Lag == 0 && st.Replicas[0].LastAckMs >= 0
+	})
+	st := replica.replica.status(replica.revision())
+	if !st.Connected || st.Lag != 0 || st.PrimaryRevision != primary.revision() || st.StalenessMs < 0 {
+		t.Fatalf("unexpected replica status: %v", st)
+	}
+	if replica.replica.staleness() > time.Second {
+		t.Fatalf("expected a caught up replica to be fresh, got %s", replica.replica.staleness())
+	}
+}
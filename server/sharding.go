@@ -0,0 +1,680 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/shard"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// shardMethods is the prefix of the methods of the Sharding service, called
+// by the other shards.
+const shardMethods = "/protobuf.Sharding/"
+
+// shardSecretHeader is the metadata key carrying the shard secret.
+const shardSecretHeader = "shard-secret"
+
+// shardOwnerHeader and shardVersionHeader are the trailers carrying the
+// address of the owner of a key sent to another shard, and the version of
+// the shard map that says so.
+const (
+	shardOwnerHeader   = "keev-shard-owner"
+	shardVersionHeader = "keev-shard-version"
+)
+
+// maxMigrationBatch is the most keys sent to another shard in one request.
+const maxMigrationBatch = 1000
+
+// migrationRetry is how long a shard waits before sending keys again to a
+// shard that failed to store them.
+const migrationRetry = time.Second
+
+func isShardMethod(method string) bool {
+	return strings.HasPrefix(method, shardMethods)
+}
+
+// checkShardSecret authenticates another shard.
+func checkShardSecret(ctx context.Context) error {
+	if !cfg.ShardingEnabled() || !hasSecret(ctx, shardSecretHeader, cfg.Sharding.Secret) {
+		return status.Error(codes.Unauthenticated, ShardSecretErr.Error())
+	}
+	return nil
+}
+
+// shardErrs maps the errors of shard map changes to those of the API.
+var shardErrs = map[error]error{
+	shard.ErrNodeExists:  ShardExistsErr,
+	shard.ErrUnknownNode: UnknownShardErr,
+	shard.ErrLastNode:    LastShardErr,
+}
+
+// sharding holds the shard map of a shard, which places every key on one of
+// the shards, and moves the keys the shard no longer owns to their owner
+// when the map changes. Until every key has arrived, the shard takes those a
+// request needs from their previous owner first, so a key is only ever
+// served by one shard.
+type sharding struct {
+	s        *Server
+	id       string
+	path     string // of the saved shard map
+	dialOpts []grpc.DialOption
+
+	// routing is held for reading by the requests for a key, from checking
+	// the shard owns it until they are done, and for writing while the map
+	// changes: once the map changed, no request is still writing a key the
+	// shard gave away
+	routing sync.RWMutex
+	// arriving serializes the keys sent to the shard, by their previous
+	// owner or taken from it
+	arriving sync.Mutex
+
+	mu      sync.Mutex
+	current *shard.Map // nil until the shard is added to a map
+	prev    *shard.Map // the map before the last change, while keys move to the shard
+	pending map[string]bool
+	// settled are the keys that arrived since the last change, which their
+	// previous owner must not send again
+	settled map[string]bool
+	moving  bool   // keys are moving out
+	moved   uint64 // keys sent to other shards
+	conns   map[string]*grpc.ClientConn
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// loadSharding returns the sharding of s, with the shard map saved in the
+// data directory or the first one, made from --shard-nodes.
+func loadSharding(s *Server) (*sharding, error) {
+	opts, err := peerDialOptions(cfg, cfg.Sharding.CA, "--shard-ca",
+		secretCredentials{shardSecretHeader, cfg.Sharding.Secret})
+	if err != nil {
+		return nil, err
+	}
+	sh := newSharding(s, cfg.Sharding.ID, cfg.ShardFile(), opts)
+	state, err := loadShardState(sh.path)
+	if os.IsNotExist(err) && cfg.Sharding.Nodes != "" {
+		peers, _ := cfg.ShardNodes() // checked by Validate
+		var nodes []shard.Node
+		for id, addr := range peers {
+			nodes = append(nodes, shard.Node{ID: id, Addr: addr})
+		}
+		state, err = &pb.ShardState{Map: shard.New(1, nodes).Proto()}, nil
+	} else if os.IsNotExist(err) {
+		state, err = &pb.ShardState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sh.current, sh.prev = shard.FromProto(state.Map), shard.FromProto(state.Prev)
+	for _, id := range state.Pending {
+		sh.pending[id] = true
+	}
+	return sh, nil
+}
+
+// start resumes moving the keys the shard does not own, once the data is
+// loaded.
+func (sh *sharding) start() error {
+	sh.mu.Lock()
+	if sh.current == nil {
+		sh.mu.Unlock()
+		logger.WithField("id", sh.id).Warn("no shard map yet, waiting to be added with \"shard add\"")
+		return nil
+	}
+	logger.WithFields(logrus.Fields{"id": sh.id, "version": sh.current.Version, "shards": len(sh.current.Nodes)}).Info("loaded shard map")
+	sh.startMoving()
+	sh.mu.Unlock()
+	return sh.save()
+}
+
+func newSharding(s *Server, id, path string, dialOpts []grpc.DialOption) *sharding {
+	return &sharding{
+		s:        s,
+		id:       id,
+		path:     path,
+		dialOpts: dialOpts,
+		pending:  make(map[string]bool),
+		settled:  make(map[string]bool),
+		conns:    make(map[string]*grpc.ClientConn),
+		stop:     make(chan struct{}),
+	}
+}
+
+func loadShardState(path string) (*pb.ShardState, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &pb.ShardState{}
+	if err := proto.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return state, nil
+}
+
+// save writes the shard map to disk, it must survive a restart before keys
+// move.
+func (sh *sharding) save() error {
+	sh.mu.Lock()
+	state := &pb.ShardState{Map: sh.current.Proto()}
+	if sh.prev != nil {
+		state.Prev = sh.prev.Proto()
+	}
+	for id := range sh.pending {
+		state.Pending = append(state.Pending, id)
+	}
+	sh.mu.Unlock()
+	b, err := proto.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFile(sh.path, 0600, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// stopMoving stops sending keys to other shards and closes the connections
+// to them.
+func (sh *sharding) stopMoving() {
+	close(sh.stop)
+	sh.done.Wait()
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for _, conn := range sh.conns {
+		conn.Close()
+	}
+}
+
+// client returns a client of the shard at addr.
+func (sh *sharding) client(addr string) (pb.ShardingClient, error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	conn, ok := sh.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = grpc.Dial(addr, sh.dialOpts...); err != nil {
+			return nil, err
+		}
+		sh.conns[addr] = conn
+	}
+	return pb.NewShardingClient(conn), nil
+}
+
+// route checks that the shard owns key and, while keys move to it, takes key
+// from its previous owner if it has not arrived yet. A key owned by another
+// shard is redirected to it, setting its address in the trailer. The
+// function returned must be called once the request is done with key.
+func (s *Server) route(ctx context.Context, key string) (func(), error) {
+	if s.shards == nil {
+		return func() {}, nil
+	}
+	sh := s.shards
+	sh.routing.RLock()
+	if err := sh.check(ctx, key); err != nil {
+		sh.routing.RUnlock()
+		return nil, err
+	}
+	return sh.routing.RUnlock, nil
+}
+
+func (sh *sharding) check(ctx context.Context, key string) error {
+	sh.mu.Lock()
+	m, prev, settled := sh.current, sh.prev, sh.settled[key]
+	sh.mu.Unlock()
+	if m == nil {
+		return status.Error(codes.Unavailable, NoShardMapErr.Error())
+	}
+	if owner, _ := m.Owner(key); owner.ID != sh.id {
+		grpc.SetTrailer(ctx, metadata.Pairs(shardOwnerHeader, owner.Addr, shardVersionHeader, strconv.FormatUint(m.Version, 10)))
+		return status.Error(codes.Unavailable, fmt.Sprintf("%s: %q", WrongShardErr, owner.ID))
+	}
+	if prev == nil || settled {
+		return nil
+	}
+	if from, _ := prev.Owner(key); from.ID != sh.id && sh.isPending(from.ID) {
+		return sh.take(ctx, from, m.Version, key)
+	}
+	return nil
+}
+
+func (sh *sharding) isPending(id string) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.pending[id]
+}
+
+// take moves key from the shard that owned it before the map changed.
+func (sh *sharding) take(ctx context.Context, from shard.Node, version uint64, key string) error {
+	sh.arriving.Lock()
+	defer sh.arriving.Unlock()
+	sh.mu.Lock()
+	settled := sh.settled[key]
+	sh.mu.Unlock()
+	if settled {
+		return nil
+	}
+	client, err := sh.client(from.Addr)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Handoff(ctx, &pb.HandoffRequest{Version: version, Keys: []string{key}})
+	if err != nil {
+		// the previous owner may not have the new map yet
+		requestLogger(ctx).WithError(err).WithFields(logrus.Fields{"key": key, "from": from.ID}).Warn("failed to take key from its previous owner")
+		return status.Error(codes.Unavailable, RebalancingErr.Error())
+	}
+	sh.store(resp.Entries, true)
+	sh.mu.Lock()
+	sh.settled[key] = true
+	sh.mu.Unlock()
+	return nil
+}
+
+// store saves keys sent by another shard, unless they arrived already. Keys
+// whose previous owner is still sending them overwrite those held, any
+// other key is only stored if absent.
+func (sh *sharding) store(entries []*pb.SnapshotEntry, overwrite bool) {
+	for _, e := range entries {
+		sh.mu.Lock()
+		settled := sh.settled[e.Key]
+		if overwrite && !settled {
+			sh.settled[e.Key] = true
+		}
+		sh.mu.Unlock()
+		if settled || (!overwrite && sh.s.Data.Has(e.Key)) {
+			continue
+		}
+		sh.s.putKey(e.Key, e.Value)
+		sh.s.setExpiry(e.Key, e.Expires)
+	}
+}
+
+// checkVersion returns an error unless the shard map is at version.
+func (sh *sharding) checkVersion(version uint64) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.current == nil || sh.current.Version != version {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: version %d", ShardMapChangedErr, version))
+	}
+	return nil
+}
+
+// install replaces the shard map, made from prev, with next and starts
+// moving the keys the shard no longer owns.
+func (sh *sharding) install(prev, next *shard.Map) error {
+	sh.routing.Lock()
+	defer sh.routing.Unlock()
+	sh.mu.Lock()
+	if shard.Equal(sh.current, next) {
+		sh.mu.Unlock()
+		return nil // sent again by a change that is retried
+	}
+	if sh.current != nil && !shard.Equal(sh.current, prev) {
+		sh.mu.Unlock()
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: holding version %d", ShardMapChangedErr, sh.current.Version))
+	}
+	if sh.moving || len(sh.pending) > 0 {
+		sh.mu.Unlock()
+		return status.Error(codes.FailedPrecondition, RebalancingErr.Error())
+	}
+	sh.current, sh.prev = next, prev
+	sh.settled = make(map[string]bool)
+	for _, id := range shard.Sources(prev, next, sh.id) {
+		sh.pending[id] = true
+	}
+	if len(sh.pending) == 0 {
+		sh.prev = nil
+	}
+	sh.startMoving()
+	sh.mu.Unlock()
+	logger.WithFields(logrus.Fields{"version": next.Version, "shards": len(next.Nodes)}).Info("changed shard map")
+	return sh.save()
+}
+
+// startMoving starts sending the keys the shard does not own to their owner,
+// called with mu held.
+func (sh *sharding) startMoving() {
+	if sh.moving {
+		return
+	}
+	sh.moving = true
+	sh.done.Add(1)
+	go sh.migrate(sh.current)
+}
+
+// rebalance moves the keys the shard holds but does not own, such as those
+// of a restored backup, to their owner.
+func (sh *sharding) rebalance() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.current != nil {
+		sh.startMoving()
+	}
+}
+
+// migrate sends the keys the shard holds but does not own in m to their
+// owner, removing them once stored, then tells every other shard it is done.
+// It keeps retrying until it succeeds or the shard stops.
+func (sh *sharding) migrate(m *shard.Map) {
+	defer sh.done.Done()
+	s := sh.s
+	keys := make(map[shard.Node][]string)
+	for _, key := range s.Data.Keys() {
+		if owner, _ := m.Owner(key); owner.ID != sh.id {
+			keys[owner] = append(keys[owner], key)
+		}
+	}
+	moved := 0
+	for owner, names := range keys {
+		for len(names) > 0 {
+			req := &pb.MigrateRequest{From: sh.id, Version: m.Version}
+			size := 0
+			for len(names) > 0 && len(req.Entries) < maxMigrationBatch && size < int(cfg.MaxMessageSize/2) {
+				key := names[0]
+				names = names[1:]
+				// taken by its owner in the meantime
+				if v, ok := s.Data.Get(key); ok && !s.Meta.IsExpired(key) {
+					e := &pb.SnapshotEntry{Key: key, Value: v.(string), Expires: s.Meta.Expiry(key)}
+					req.Entries = append(req.Entries, e)
+					size += proto.Size(e)
+				}
+			}
+			if !sh.send(owner, req) {
+				return
+			}
+			for _, e := range req.Entries {
+				s.dropKey(e.Key)
+				s.Meta.Remove(e.Key)
+			}
+			moved += len(req.Entries)
+			sh.mu.Lock()
+			sh.moved += uint64(len(req.Entries))
+			sh.mu.Unlock()
+		}
+	}
+	for _, n := range m.Nodes {
+		if n.ID != sh.id && !sh.send(n, &pb.MigrateRequest{From: sh.id, Version: m.Version, Done: true}) {
+			return
+		}
+	}
+	sh.mu.Lock()
+	sh.moving = false
+	sh.mu.Unlock()
+	if moved > 0 {
+		logger.WithFields(logrus.Fields{"keys": moved, "version": m.Version}).Info("moved keys to their shard")
+	}
+}
+
+// send sends req to n until it succeeds, and returns false if the shard
+// stops first.
+func (sh *sharding) send(n shard.Node, req *pb.MigrateRequest) bool {
+	for {
+		client, err := sh.client(n.Addr)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			_, err = client.Migrate(ctx, req)
+			cancel()
+		}
+		if err == nil {
+			return true
+		}
+		logger.WithError(err).WithField("shard", n.ID).Warn("failed to move keys, retrying")
+		select {
+		case <-time.After(migrationRetry):
+		case <-sh.stop:
+			return false
+		}
+	}
+}
+
+// finish records that from sent every key it gave to the shard.
+func (sh *sharding) finish(from string) error {
+	sh.mu.Lock()
+	if !sh.pending[from] {
+		sh.mu.Unlock()
+		return nil
+	}
+	delete(sh.pending, from)
+	done := len(sh.pending) == 0
+	if done {
+		sh.prev, sh.settled = nil, make(map[string]bool)
+	}
+	sh.mu.Unlock()
+	if done {
+		logger.WithField("from", from).Info("received every key the shard now owns")
+	} else {
+		logger.WithField("from", from).Info("received every key of a shard")
+	}
+	return sh.save()
+}
+
+// status returns the shard map of the shard and the keys it is moving.
+func (sh *sharding) status() *pb.ShardStatusResponse {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	resp := &pb.ShardStatusResponse{
+		Id:          sh.id,
+		Map:         sh.current.Proto(),
+		Rebalancing: sh.moving || len(sh.pending) > 0,
+		Moved:       sh.moved,
+	}
+	for id := range sh.pending {
+		resp.Pending = append(resp.Pending, id)
+	}
+	return resp
+}
+
+// change makes the next shard map and sends it to every shard of both maps,
+// this one last, once none of them is still moving keys. Shards that
+// already hold the next map are skipped, so a change that failed part way
+// can be made again.
+func (sh *sharding) change(ctx context.Context, next func(m *shard.Map) (*shard.Map, error)) (*shard.Map, error) {
+	sh.mu.Lock()
+	prev := sh.current
+	sh.mu.Unlock()
+	if prev == nil {
+		return nil, status.Error(codes.FailedPrecondition, NoShardMapErr.Error())
+	}
+	m, err := next(prev)
+	if e, ok := shardErrs[err]; ok {
+		return nil, status.Error(codes.FailedPrecondition, e.Error())
+	} else if err != nil {
+		return nil, err
+	}
+	var nodes []shard.Node
+	for _, n := range prev.Nodes {
+		if n.ID != sh.id {
+			nodes = append(nodes, n)
+		}
+	}
+	for _, n := range m.Nodes {
+		if _, ok := prev.Node(n.ID); !ok {
+			nodes = append(nodes, n)
+		}
+	}
+	for _, n := range append(nodes, shard.Node{ID: sh.id}) {
+		var st *pb.ShardStatusResponse
+		if n.ID == sh.id {
+			st = sh.status()
+		} else if client, err := sh.client(n.Addr); err != nil {
+			return nil, err
+		} else if st, err = client.Status(ctx, &google_protobuf.Empty{}); err != nil {
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("shard %q: %s", n.ID, err.Error()))
+		}
+		held := shard.FromProto(st.Map)
+		switch {
+		case shard.Equal(held, m):
+		case held != nil && !shard.Equal(held, prev):
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: shard %q holds version %d", ShardMapChangedErr, n.ID, held.Version))
+		case st.Rebalancing:
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: shard %q", RebalancingErr, n.ID))
+		}
+	}
+	req := &pb.UpdateShardMapRequest{Prev: prev.Proto(), Next: m.Proto()}
+	for _, n := range nodes {
+		client, err := sh.client(n.Addr)
+		if err == nil {
+			_, err = client.UpdateMap(ctx, req)
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("shard %q: %s", n.ID, err.Error()))
+		}
+	}
+	return m, sh.install(prev, m)
+}
+
+// checkShardChange returns an error if the caller may not change the shard
+// map, or in must name a shard.
+func (s *Server) checkShardChange(ctx context.Context, in *pb.ShardNode) error {
+	if !isAdmin(ctx) {
+		return AdminOnlyErr
+	}
+	if s.shards == nil {
+		return status.Error(codes.FailedPrecondition, ShardingDisabledErr.Error())
+	}
+	if in.Id == "" {
+		return status.Error(codes.InvalidArgument, InvalidShardErr.Error())
+	}
+	return nil
+}
+
+// Returns the shard map, which says the server holding each key
+// NOTE: No token needed
+func (s *Server) ShardMap(ctx context.Context, in *google_protobuf.Empty) (*pb.ShardMap, error) {
+	if s.shards == nil {
+		return nil, status.Error(codes.FailedPrecondition, ShardingDisabledErr.Error())
+	}
+	s.shards.mu.Lock()
+	defer s.shards.mu.Unlock()
+	if s.shards.current == nil {
+		return nil, status.Error(codes.Unavailable, NoShardMapErr.Error())
+	}
+	return s.shards.current.Proto(), nil
+}
+
+// Returns the shard map of the server and the keys it is moving
+// NOTE: Admin only, no token needed
+func (s *Server) ShardStatus(ctx context.Context, in *google_protobuf.Empty) (*pb.ShardStatusResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if s.shards == nil {
+		return nil, status.Error(codes.FailedPrecondition, ShardingDisabledErr.Error())
+	}
+	return s.shards.status(), nil
+}
+
+// Adds a server to the shard map, the keys it now holds move to it
+// NOTE: Admin only, no token needed
+func (s *Server) AddShard(ctx context.Context, in *pb.ShardNode) (*pb.Response, error) {
+	if err := s.checkShardChange(ctx, in); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(in.Addr); err != nil {
+		return nil, status.Error(codes.InvalidArgument, InvalidShardErr.Error())
+	}
+	m, err := s.shards.change(ctx, func(m *shard.Map) (*shard.Map, error) {
+		return m.Add(shard.Node{ID: in.Id, Addr: in.Addr})
+	})
+	if err != nil {
+		return nil, err
+	}
+	requestLogger(ctx).WithFields(logrus.Fields{"shard": in.Id, "addr": in.Addr, "version": m.Version}).Info("added shard")
+	return &pb.Response{Success: true, Value: "(shard " + in.Id + " added, keys are moving)"}, nil
+}
+
+// Removes a server from the shard map, its keys move to the others
+// NOTE: Admin only, no token needed
+func (s *Server) RemoveShard(ctx context.Context, in *pb.ShardNode) (*pb.Response, error) {
+	if err := s.checkShardChange(ctx, in); err != nil {
+		return nil, err
+	}
+	m, err := s.shards.change(ctx, func(m *shard.Map) (*shard.Map, error) {
+		return m.Remove(in.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	requestLogger(ctx).WithFields(logrus.Fields{"shard": in.Id, "version": m.Version}).Info("removed shard")
+	return &pb.Response{Success: true, Value: "(shard " + in.Id + " removed, keys are moving)"}, nil
+}
+
+// UpdateMap replaces the shard map, whose version must follow that of the
+// map the shard holds, and starts moving the keys it no longer owns.
+func (sh *sharding) UpdateMap(ctx context.Context, in *pb.UpdateShardMapRequest) (*google_protobuf.Empty, error) {
+	next := shard.FromProto(in.Next)
+	if next == nil {
+		return nil, status.Error(codes.InvalidArgument, NoShardMapErr.Error())
+	}
+	if err := sh.install(shard.FromProto(in.Prev), next); err != nil {
+		return nil, err
+	}
+	return &google_protobuf.Empty{}, nil
+}
+
+// Status returns the shard map of the shard and the keys it is moving.
+func (sh *sharding) Status(ctx context.Context, in *google_protobuf.Empty) (*pb.ShardStatusResponse, error) {
+	return sh.status(), nil
+}
+
+// Migrate stores keys the sender no longer owns.
+func (sh *sharding) Migrate(ctx context.Context, in *pb.MigrateRequest) (*google_protobuf.Empty, error) {
+	if err := sh.checkVersion(in.Version); err != nil {
+		return nil, err
+	}
+	sh.arriving.Lock()
+	defer sh.arriving.Unlock()
+	sh.store(in.Entries, sh.isPending(in.From))
+	if in.Done {
+		if err := sh.finish(in.From); err != nil {
+			return nil, err
+		}
+	}
+	return &google_protobuf.Empty{}, nil
+}
+
+// Handoff removes keys the caller now owns and returns them.
+func (sh *sharding) Handoff(ctx context.Context, in *pb.HandoffRequest) (*pb.HandoffResponse, error) {
+	if err := sh.checkVersion(in.Version); err != nil {
+		return nil, err
+	}
+	sh.mu.Lock()
+	m := sh.current
+	sh.mu.Unlock()
+	s := sh.s
+	resp := &pb.HandoffResponse{}
+	for _, key := range in.Keys {
+		if owner, _ := m.Owner(key); owner.ID == sh.id {
+			continue
+		}
+		expires, expired := s.Meta.Expiry(key), s.Meta.IsExpired(key)
+		v, ok := s.Data.Get(key)
+		if !ok || !s.dropKey(key) {
+			continue
+		}
+		s.Meta.Remove(key)
+		if !expired {
+			resp.Entries = append(resp.Entries, &pb.SnapshotEntry{Key: key, Value: v.(string), Expires: expires})
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imjching/keev/auth"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/shard"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startTestShard runs a server as the shard id on loopback, serving only the
+// Sharding service, without TLS.
+func startTestShard(t *testing.T, dir, id string) (*Server, shard.Node) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	s := NewServer()
+	s.shards = newSharding(s, id, filepath.Join(dir, id+".pb"), []grpc.DialOption{grpc.WithInsecure()})
+	g := grpc.NewServer()
+	pb.RegisterShardingServer(g, s.shards)
+	go g.Serve(lis)
+	return s, shard.Node{ID: id, Addr: lis.Addr().String()}
+}
+
+// shardKeys returns the keys of every shard, failing the test if one holds a
+// key it does not own.
+func shardKeys(t *testing.T, shards map[string]*Server) map[string]string {
+	keys := make(map[string]string)
+	for id, s := range shards {
+		for key, v := range s.Data.Items() {
+			if owner, _ := s.shards.current.Owner(key); owner.ID != id {
+				t.Fatalf("%s holds %q, owned by %s", id, key, owner.ID)
+			}
+			if _, ok := keys[key]; ok {
+				t.Fatalf("%q is held twice", key)
+			}
+			keys[key] = v.(string)
+		}
+	}
+	return keys
+}
+
+func Test_Sharding(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	ctx := context.Background()
+	dir, _ := ioutil.TempDir("", "keev-sharding")
+	defer os.RemoveAll(dir)
+
+	a, na := startTestShard(t, dir, "a")
+	b, nb := startTestShard(t, dir, "b")
+	defer a.shards.stopMoving()
+	defer b.shards.stopMoving()
+	a.shards.current = shard.New(1, []shard.Node{na})
+	for i := 0; i < 300; i++ {
+		a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: fmt.Sprintf("user.ns.key%d", i), Value: "v", Expires: expiresAt(3600)})
+	}
+
+	// b takes about half of the keys of a
+	m, err := a.shards.change(ctx, func(m *shard.Map) (*shard.Map, error) { return m.Add(nb) })
+	if err != nil {
+		t.Fatalf("failed to add b: %s", err.Error())
+	}
+	if _, err := a.shards.change(ctx, func(m *shard.Map) (*shard.Map, error) { return m.Add(nb) }); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected b to be in the map already, got %v", err)
+	}
+	shards := map[string]*Server{"a": a, "b": b}
+	waitUntil(t, "the keys to move", func() bool { return !a.shards.status().Rebalancing && !b.shards.status().Rebalancing })
+	if keys := shardKeys(t, shards); len(keys) != 300 || b.Data.Count() < 50 || b.Data.Count() > 250 {
+		t.Fatalf("expected the keys spread over both shards, a has %d and b %d", a.Data.Count(), b.Data.Count())
+	}
+	if b.usage.User("user").Keys != int64(b.Data.Count()) || a.usage.User("user").Keys != int64(a.Data.Count()) {
+		t.Fatalf("usage not moved with the keys")
+	}
+	var key string
+	for k := range b.Data.Items() {
+		key = k
+		break
+	}
+	if b.Meta.Expiry(key) == 0 {
+		t.Fatalf("expiry not moved with %q", key)
+	}
+	if _, err := a.route(ctx, key); status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), WrongShardErr.Error()) {
+		t.Fatalf("expected a to redirect %q, got %v", key, err)
+	}
+
+	// while keys move, c takes those a request needs from their previous
+	// owner, which only gives them once it has the new map too
+	c, nc := startTestShard(t, dir, "c")
+	defer c.shards.stopMoving()
+	shards["c"] = c
+	next, _ := m.Add(nc)
+	if err := c.shards.install(m, next); err != nil {
+		t.Fatalf("failed to install the map on c: %s", err.Error())
+	}
+	var taken []string
+	for k := range shardKeys(t, map[string]*Server{"a": a, "b": b}) {
+		if owner, _ := next.Owner(k); owner.ID == "c" {
+			taken = append(taken, k)
+		}
+	}
+	if _, err := c.route(ctx, taken[0]); status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), RebalancingErr.Error()) {
+		t.Fatalf("expected c to wait for the previous owner, got %v", err)
+	}
+	for _, s := range []*Server{a, b} {
+		if err := s.shards.install(m, next); err != nil {
+			t.Fatalf("failed to install the map: %s", err.Error())
+		}
+	}
+	for _, k := range taken[:2] {
+		done, err := c.route(ctx, k)
+		if err != nil {
+			t.Fatalf("failed to take %q: %s", k, err.Error())
+		}
+		c.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: k})
+		done()
+	}
+	waitUntil(t, "the keys to move", func() bool {
+		return !a.shards.status().Rebalancing && !b.shards.status().Rebalancing && !c.shards.status().Rebalancing
+	})
+	keys := shardKeys(t, shards)
+	if len(keys) != 298 || c.Data.Count() != len(taken)-2 {
+		t.Fatalf("expected c to hold %d keys, and the 2 removed to stay removed, got %d of %d", len(taken)-2, c.Data.Count(), len(keys))
+	}
+
+	// the map survives a restart
+	state, err := loadShardState(filepath.Join(dir, "c.pb"))
+	if err != nil || !shard.Equal(shard.FromProto(state.Map), next) || len(state.Pending) != 0 {
+		t.Fatalf("unexpected saved state: %v %v", state, err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// shuttingDown is closed when shutdown starts, ending long-lived streams.
+var shuttingDown = make(chan struct{})
+
+// streamContext returns a context for a streaming RPC that is canceled when
+// shutdown starts, so stream handlers return instead of holding up the
+// drain.
+func streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-shuttingDown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// drain stops accepting connections, ends streams and waits up to timeout
+// for in-flight RPCs to finish before closing the remaining connections.
+func drain(s *grpc.Server, timeout time.Duration) {
+	setServing(false)
+	close(shuttingDown)
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Info("drained in-flight requests")
+	case <-time.After(timeout):
+		logger.WithField("timeout", timeout.String()).Warn("in-flight requests did not finish in time, closing connections")
+		s.Stop()
+		<-done
+	}
+}
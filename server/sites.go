@@ -0,0 +1,442 @@
+package main
+
+import (
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/imjching/keev/conflict"
+	"github.com/imjching/keev/hlc"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/snapshot"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// siteMethods is the prefix of the methods of the Sites service, called by
+// the other sites.
+const siteMethods = "/protobuf.Sites/"
+
+// siteSecretHeader is the metadata key carrying the site secret.
+const siteSecretHeader = "site-secret"
+
+// siteRetry is how long a site waits before reconnecting to another.
+const siteRetry = time.Second
+
+// siteLocks is the number of locks the writes of a site are serialized
+// with, by key.
+const siteLocks = 256
+
+func isSiteMethod(method string) bool {
+	return strings.HasPrefix(method, siteMethods)
+}
+
+// checkSiteSecret authenticates another site.
+func checkSiteSecret(ctx context.Context) error {
+	if !cfg.SitesEnabled() || !hasSecret(ctx, siteSecretHeader, cfg.Sites.Secret) {
+		return status.Error(codes.Unauthenticated, SiteSecretErr.Error())
+	}
+	return nil
+}
+
+// sites stamps every write made on a site with a version, and merges the
+// versions written at the other sites, see package conflict. Each site
+// follows the others like a replica follows its primary: a site streams
+// the versions of the keys written on it from its feed, preceded by a
+// snapshot to merge if the other cannot resume where it left off. Sites
+// keep accepting writes while the others are away and catch up once they
+// are back.
+type sites struct {
+	s          *Server
+	id         string
+	resolution string // conflict.LastWriterWins or conflict.KeepSiblings
+	clock      *hlc.Clock
+	// locks keep a key from changing between reading its versions and
+	// replacing them
+	locks [siteLocks]sync.Mutex
+	links []*siteLink
+}
+
+func newSites(s *Server, id, resolution string) *sites {
+	return &sites{s: s, id: id, resolution: resolution, clock: hlc.NewClock(nil)}
+}
+
+// startSites dials the other sites in cfg and starts following them, once
+// the data is loaded.
+func startSites(s *Server) error {
+	peers, _ := cfg.SitePeers() // checked by Validate
+	opts, err := peerDialOptions(cfg, cfg.Sites.CA, "--site-ca",
+		secretCredentials{siteSecretHeader, cfg.Sites.Secret})
+	if err != nil {
+		return err
+	}
+	opts = append(opts,
+		grpc.WithBackoffMaxDelay(siteRetry),
+		// a change may be as large as a request
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(2*cfg.MaxMessageSize))))
+	ids := make([]string, 0, len(peers))
+	for id := range peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		conn, err := grpc.Dial(peers[id], opts...)
+		if err != nil {
+			s.sites.stop()
+			return err
+		}
+		s.sites.follow(id, peers[id], conn)
+	}
+	logger.WithFields(logrus.Fields{"site": s.sites.id, "peers": strings.Join(ids, ","), "conflicts": s.sites.resolution}).Info("exchanging writes with sites")
+	return nil
+}
+
+// follow starts merging the versions written at the site id, reached
+// through conn.
+func (sh *sites) follow(id, addr string, conn *grpc.ClientConn) {
+	// versions loaded from disk may come from a clock ahead of this one
+	sh.clock.Update(hlc.Timestamp(sh.s.versions.latest()))
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &siteLink{sites: sh, id: id, addr: addr, conn: conn, cancel: cancel, done: make(chan struct{})}
+	sh.links = append(sh.links, l)
+	go l.run(ctx)
+}
+
+// stop stops following the other sites.
+func (sh *sites) stop() {
+	for _, l := range sh.links {
+		l.cancel()
+		<-l.done
+		l.conn.Close()
+	}
+}
+
+// lock locks key against other writes of the site and returns the function
+// unlocking it.
+func (sh *sites) lock(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &sh.locks[h.Sum32()%siteLocks]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// apply makes a change of a client, then stamps the key with a version
+// following every version it had, which the other sites merge.
+func (sh *sites) apply(cmd *pb.Command) (interface{}, error) {
+	if cmd.Op == pb.CommandOp_CMD_RESTORE {
+		return sh.restore(cmd)
+	}
+	unlock := sh.lock(cmd.Key)
+	defer unlock()
+	current := sh.s.versions.get(cmd.Key) // forgotten by the change
+	resp, err := sh.s.apply(cmd)
+	if err != nil {
+		return nil, err
+	}
+	switch cmd.Op {
+	case pb.CommandOp_CMD_SET, pb.CommandOp_CMD_UPDATE:
+		sh.stamp(cmd.Key, current, cmd.Value, cmd.Expires, false)
+	case pb.CommandOp_CMD_UNSET:
+		sh.stamp(cmd.Key, current, "", 0, true)
+	}
+	return resp, nil
+}
+
+// restore restores a backup, then stamps every key it wrote or removed, so
+// the other sites restore it too.
+func (sh *sites) restore(cmd *pb.Command) (interface{}, error) {
+	s := sh.s
+	current := make(map[string][]*pb.Version, len(cmd.Removed)+len(cmd.Entries))
+	for _, key := range cmd.Removed {
+		current[key] = s.versions.get(key)
+	}
+	for _, e := range cmd.Entries {
+		current[e.Key] = s.versions.get(e.Key)
+	}
+	resp, err := s.apply(cmd)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range cmd.Removed {
+		sh.stamp(key, current[key], "", 0, true)
+	}
+	for _, e := range cmd.Entries {
+		sh.stamp(e.Key, current[e.Key], e.Value, e.Expires, false)
+	}
+	return resp, nil
+}
+
+// stamp replaces the versions of key with the one written now.
+func (sh *sites) stamp(key string, current []*pb.Version, value string, expires int64, deleted bool) {
+	v := conflict.Write(current, sh.id, uint64(sh.clock.Now()), value, expires, deleted)
+	sh.s.setVersions(key, []*pb.Version{v})
+}
+
+// merge merges the versions of key written at another site into those of
+// the key, and changes its value if the latest version changed. It returns
+// true if the versions conflicted.
+func (sh *sites) merge(key string, remote []*pb.Version) bool {
+	for _, v := range remote {
+		sh.clock.Update(hlc.Timestamp(v.Hlc))
+	}
+	unlock := sh.lock(key)
+	defer unlock()
+	s := sh.s
+	local := s.versions.get(key)
+	if local == nil {
+		if value, ok := s.Data.Get(key); ok {
+			local = unversioned(sh.id, value.(string), s.Meta.Expiry(key))
+		}
+	}
+	merged, changed, conflicted := conflict.Merge(local, remote, sh.resolution)
+	if !changed {
+		return false
+	}
+	if conflict.Deleted(merged) {
+		s.dropKey(key)
+		s.Meta.Remove(key)
+	} else {
+		latest := merged[0]
+		if value, ok := s.Data.Get(key); !ok || value.(string) != latest.Value {
+			// quotas and --max-memory do not apply, the write was accepted
+			// by the other site
+			s.putKey(key, latest.Value)
+		}
+		s.setExpiry(key, latest.Expires)
+	}
+	s.setVersions(key, merged)
+	return conflicted
+}
+
+// unversioned returns the version of a key written before its site
+// exchanged writes with others: it conflicts with every other such version
+// of the key.
+func unversioned(site, value string, expires int64) []*pb.Version {
+	return []*pb.Version{{Value: value, Expires: expires, Site: site}}
+}
+
+// siteEntries returns the versions in entries that site does not have
+// already, leaving out the other changes.
+func siteEntries(entries []*pb.LogEntry, site string) []*pb.LogEntry {
+	var out []*pb.LogEntry
+	for _, e := range entries {
+		if e.Op != pb.LogOp_VERSIONS {
+			continue
+		}
+		for _, v := range e.Versions {
+			if v.Site != site {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// forgetTombstones forgets the keys deleted longer than ttl ago. A site
+// away for longer may bring them back.
+func (sh *sites) forgetTombstones(ttl time.Duration) {
+	before := time.Now().Add(-ttl)
+	for _, key := range sh.s.versions.deletedBefore(before) {
+		unlock := sh.lock(key)
+		if vs := sh.s.versions.get(key); conflict.Deleted(vs) && hlc.Timestamp(vs[0].Hlc).Time().Before(before) {
+			sh.s.setVersions(key, nil)
+		}
+		unlock()
+	}
+}
+
+func (sh *sites) status() *pb.SiteStatusResponse {
+	resp := &pb.SiteStatusResponse{
+		Id:        sh.id,
+		Conflicts: sh.resolution,
+		Hlc:       uint64(sh.clock.Last()),
+		Revision:  sh.s.revision(),
+	}
+	for _, l := range sh.links {
+		resp.Peers = append(resp.Peers, l.status())
+	}
+	return resp
+}
+
+// siteLink follows another site, merging the versions written at it and
+// reconnecting whenever the stream breaks. Where it left off is only kept in
+// memory: after a restart, it starts again from a snapshot of the site.
+type siteLink struct {
+	sites  *sites
+	id     string
+	addr   string
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu           sync.Mutex
+	history      string // of the feed of the site, empty until a snapshot of it is merged
+	revision     uint64 // of the last change of the site merged
+	connected    bool
+	siteRevision uint64    // of the last change of the site known
+	synced       time.Time // when the site last had every change of the other
+	conflicts    uint64
+}
+
+func (l *siteLink) run(ctx context.Context) {
+	defer close(l.done)
+	client := pb.NewSitesClient(l.conn)
+	for {
+		err := l.follow(ctx, client)
+		l.mu.Lock()
+		l.connected = false
+		l.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		logger.WithError(err).WithField("site", l.id).Warn("lost the site, reconnecting")
+		select {
+		case <-time.After(siteRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// follow merges the versions written at the site until the stream breaks.
+func (l *siteLink) follow(ctx context.Context, client pb.SitesClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Follow(ctx)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	first := &pb.ReplicaAck{History: l.history, Revision: l.revision, Site: l.sites.id}
+	l.mu.Unlock()
+	if err := stream.Send(first); err != nil {
+		return err
+	}
+	var next *pb.ReplicationMessage // read past the end of a snapshot
+	for {
+		msg := next
+		if msg == nil {
+			if msg, err = stream.Recv(); err != nil {
+				return err
+			}
+		}
+		next = nil
+		if msg.Full {
+			if next, err = l.load(stream, msg.History); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(msg.Snapshot) > 0 {
+			return status.Error(codes.DataLoss, ReplicationStreamErr.Error()+": snapshot data without a snapshot")
+		}
+		for _, e := range msg.Entries {
+			l.merge(e.Key, e.Versions)
+		}
+		l.mu.Lock()
+		if msg.Through > l.revision {
+			l.revision = msg.Through
+		}
+		l.connected, l.siteRevision = true, msg.Revision
+		if l.revision >= msg.Revision {
+			l.synced = time.Now()
+		}
+		revision := l.revision
+		l.mu.Unlock()
+		if err := stream.Send(&pb.ReplicaAck{Revision: revision}); err != nil {
+			return err
+		}
+	}
+}
+
+// load merges the snapshot streamed by the site and returns the message
+// that follows it.
+func (l *siteLink) load(stream pb.Sites_FollowClient, history string) (*pb.ReplicationMessage, error) {
+	sr := &snapshotReader{stream: stream}
+	r, err := snapshot.NewReader(sr)
+	if err != nil {
+		return nil, err
+	}
+	keys := 0
+	for ; ; keys++ {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		vs := e.Versions
+		if len(vs) == 0 {
+			vs = unversioned(l.id, e.Value, e.Expires)
+		}
+		l.merge(e.Key, vs)
+	}
+	// read up to the message after the snapshot
+	if _, err := io.Copy(ioutil.Discard, sr); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.history, l.revision = history, r.Header().Revision
+	l.mu.Unlock()
+	logger.WithFields(logrus.Fields{"site": l.id, "keys": keys, "revision": r.Header().Revision}).Info("merged snapshot of the site")
+	return sr.next, nil
+}
+
+func (l *siteLink) merge(key string, vs []*pb.Version) {
+	if l.sites.merge(key, vs) {
+		l.mu.Lock()
+		l.conflicts++
+		l.mu.Unlock()
+	}
+}
+
+func (l *siteLink) status() *pb.SitePeer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := &pb.SitePeer{
+		Id:           l.id,
+		Addr:         l.addr,
+		Connected:    l.connected,
+		Revision:     l.revision,
+		SiteRevision: l.siteRevision,
+		StalenessMs:  -1,
+		Conflicts:    l.conflicts,
+	}
+	if l.siteRevision > l.revision {
+		p.Lag = l.siteRevision - l.revision
+	}
+	if !l.synced.IsZero() {
+		p.StalenessMs = int64(time.Since(l.synced) / time.Millisecond)
+	}
+	return p
+}
+
+// Streams the versions of the keys written on the server to another site, preceded by a snapshot to merge if the site cannot resume where it left off
+// NOTE: Sites only, authenticated with the site secret
+func (sh *sites) Follow(stream pb.Sites_FollowServer) error {
+	return sh.s.serveFeed(stream, true)
+}
+
+// Returns the sites the server exchanges writes with, and how far behind each of them it is
+// NOTE: Admin only, no token needed
+func (s *Server) SiteStatus(ctx context.Context, in *google_protobuf.Empty) (*pb.SiteStatusResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, AdminOnlyErr
+	}
+	if s.sites == nil {
+		return nil, status.Error(codes.FailedPrecondition, SitesDisabledErr.Error())
+	}
+	return s.sites.status(), nil
+}
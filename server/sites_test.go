@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/imjching/keev/auth"
+	"github.com/imjching/keev/conflict"
+	pb "github.com/imjching/keev/protobuf"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// startTestSite runs a server as the site id on loopback, serving only the
+// Sites service, without TLS. It follows no site until linkSites.
+func startTestSite(t *testing.T, id, resolution string) (*Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	s := NewServer()
+	s.feed = newFeed(0, 100)
+	s.sites = newSites(s, id, resolution)
+	g := grpc.NewServer()
+	pb.RegisterSitesServer(g, s.sites)
+	go g.Serve(lis)
+	return s, lis.Addr().String()
+}
+
+// linkSites makes s follow the site id at addr.
+func linkSites(t *testing.T, s *Server, id, addr string) {
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err.Error())
+	}
+	s.sites.follow(id, addr, conn)
+}
+
+// siteValue returns the value of key on s, empty if it has none.
+func siteValue(s *Server, key string) string {
+	v, _ := s.Data.Get(key)
+	str, _ := v.(string)
+	return str
+}
+
+func Test_SitesLastWriterWins(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	ctx := context.Background()
+
+	a, addrA := startTestSite(t, "a", conflict.LastWriterWins)
+	b, addrB := startTestSite(t, "b", conflict.LastWriterWins)
+	// data written before a became a site
+	a.Data.Set("user.ns.old", "0")
+	// written at both sites while apart, b last
+	a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.k", Value: "a"})
+	a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.gone", Value: "1"})
+	b.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.k", Value: "b"})
+
+	// each merges a snapshot of the other
+	linkSites(t, a, "b", addrB)
+	linkSites(t, b, "a", addrA)
+	defer a.sites.stop()
+	defer b.sites.stop()
+	waitUntil(t, "the snapshots", func() bool {
+		return siteValue(a, "user.ns.k") == "b" && siteValue(b, "user.ns.k") == "b" && siteValue(b, "user.ns.old") == "0" && b.Data.Has("user.ns.gone")
+	})
+	if len(a.siblings("user.ns.k")) != 0 {
+		t.Fatalf("expected no siblings with lww, got %v", a.siblings("user.ns.k"))
+	}
+
+	// then the writes made at either
+	a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UPDATE, Key: "user.ns.k", Value: "c"})
+	a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UNSET, Key: "user.ns.gone"})
+	b.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.new", Value: "2", Expires: expiresAt(3600)})
+	waitUntil(t, "the writes", func() bool {
+		return siteValue(b, "user.ns.k") == "c" && !b.Data.Has("user.ns.gone") && siteValue(a, "user.ns.new") == "2"
+	})
+	if a.Meta.Expiry("user.ns.new") == 0 {
+		t.Fatalf("expiry not merged")
+	}
+	if b.usage.User("user").Keys != int64(b.Data.Count()) {
+		t.Fatalf("usage not kept up to date: %d keys, %d counted", b.Data.Count(), b.usage.User("user").Keys)
+	}
+	if !conflict.Deleted(b.versions.get("user.ns.gone")) {
+		t.Fatalf("expected a tombstone, got %v", b.versions.get("user.ns.gone"))
+	}
+
+	// tombstones are forgotten after the ttl
+	b.sites.forgetTombstones(0)
+	if b.versions.get("user.ns.gone") != nil {
+		t.Fatalf("tombstone not forgotten")
+	}
+
+	waitUntil(t, "the status", func() bool {
+		st := a.sites.status()
+		return len(st.Peers) == 1 && st.Peers[0].Connected && st.Peers[0].Lag == 0 && st.Peers[0].StalenessMs >= 0
+	})
+	if st := b.sites.status(); st.Id != "b" || st.Peers[0].Id != "a" || st.Peers[0].Conflicts == 0 {
+		t.Fatalf("unexpected site status: %v", st)
+	}
+}
+
+func Test_SitesSiblings(t *testing.T) {
+	defer func(c *Config, u *auth.CredentialsStore) { cfg, users = c, u }(cfg, users)
+	cfg = DefaultConfig()
+	users = auth.NewCredentialsStore()
+	ctx := context.Background()
+
+	a, addrA := startTestSite(t, "a", conflict.KeepSiblings)
+	b, addrB := startTestSite(t, "b", conflict.KeepSiblings)
+	// the same key written at both sites before either sees the other
+	a.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.k", Value: "a"})
+	b.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_SET, Key: "user.ns.k", Value: "b"})
+	linkSites(t, a, "b", addrB)
+	linkSites(t, b, "a", addrA)
+	defer a.sites.stop()
+	defer b.sites.stop()
+	waitUntil(t, "the siblings", func() bool {
+		return len(a.versions.get("user.ns.k")) == 2 && len(b.versions.get("user.ns.k")) == 2
+	})
+	if siteValue(a, "user.ns.k") != siteValue(b, "user.ns.k") {
+		t.Fatalf("sites disagree on the value: %q and %q", siteValue(a, "user.ns.k"), siteValue(b, "user.ns.k"))
+	}
+	siblings := a.siblings("user.ns.k")
+	if len(siblings) != 1 || siblings[0].Value == siteValue(a, "user.ns.k") {
+		t.Fatalf("expected the other value as a sibling, got %v", siblings)
+	}
+
+	// a write that saw both resolves the conflict
+	b.mutate(ctx, &pb.Command{Op: pb.CommandOp_CMD_UPDATE, Key: "user.ns.k", Value: "c"})
+	waitUntil(t, "the resolution", func() bool {
+		return siteValue(a, "user.ns.k") == "c" && len(a.versions.get("user.ns.k")) == 1
+	})
+	if len(a.siblings("user.ns.k")) != 0 {
+		t.Fatalf("expected no siblings, got %v", a.siblings("user.ns.k"))
+	}
+}
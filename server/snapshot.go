@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imjching/keev/cmap"
+	"github.com/imjching/keev/conflict"
+	"github.com/imjching/keev/encrypt"
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/snapshot"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeSnapshot streams a point-in-time snapshot of the keys starting with
+// prefix to w, returning the number of keys written and the revision of the
+// snapshot.
+func (s *Server) writeSnapshot(w io.Writer, c snapshot.Compression, prefix string) (uint64, uint64, error) {
+	h := &pb.SnapshotHeader{}
+	snap := s.Data.SnapshotFunc(func() {
+		h.Revision, h.Created = s.revision(), time.Now().UnixNano()
+	})
+	defer snap.Close()
+	// expiries and versions are read as each key is written, a key whose
+	// ttl changes meanwhile is saved with its new ttl
+	keys, err := writeSnapshotOf(w, c, snap, h, prefix, func(e *pb.SnapshotEntry) {
+		e.Expires, e.Versions = s.Meta.Expiry(e.Key), s.versions.get(e.Key)
+	}, s.versions.tombstones())
+	return keys, h.Revision, err
+}
+
+// writeSnapshotOf writes the keys of snap starting with prefix, each
+// completed by fill, then the tombstones of deleted keys starting with
+// prefix, and returns the number of entries written.
+func writeSnapshotOf(w io.Writer, c snapshot.Compression, snap *cmap.Snapshot, h *pb.SnapshotHeader, prefix string, fill func(e *pb.SnapshotEntry), deleted []*pb.SnapshotEntry) (uint64, error) {
+	sw, err := snapshot.NewWriter(w, c, h)
+	if err != nil {
+		return 0, err
+	}
+	snap.IterCb(func(key string, v interface{}) {
+		if err == nil && strings.HasPrefix(key, prefix) {
+			e := &pb.SnapshotEntry{Key: key, Value: v.(string)}
+			fill(e)
+			err = sw.Write(e)
+		}
+	})
+	for _, e := range deleted {
+		if err == nil && strings.HasPrefix(e.Key, prefix) {
+			err = sw.Write(e)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return sw.Count(), sw.Close()
+}
+
+// readSnapshot loads the keys of the snapshot in r into the data as they are
+// read, and its revision. If it fails part of the snapshot may have been
+// loaded.
+func (s *Server) readSnapshot(r io.Reader) (int, error) {
+	sr, err := snapshot.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	s.baseRevision = sr.Header().Revision
+	for keys := 0; ; keys++ {
+		e, err := sr.Next()
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return keys, err
+		}
+		if len(e.Versions) > 0 {
+			s.versions.set(e.Key, e.Versions)
+		}
+		if conflict.Deleted(e.Versions) {
+			continue // a tombstone
+		}
+		s.Data.Set(e.Key, e.Value)
+		if e.Expires != 0 {
+			s.Meta.SetExpiry(e.Key, e.Expires)
+		}
+	}
+}
+
+// sealData calls write with a writer encrypting to w if encryption at rest
+// is enabled, or with w itself otherwise.
+func sealData(w io.Writer, write func(w io.Writer) error) error {
+	if dataKeys == nil {
+		return write(w)
+	}
+	ew, err := dataKeys.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := write(ew); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// openData returns a reader decrypting r if it is encrypted. Data written
+// before encryption was enabled is read as is, and encrypted by the next
+// write.
+func openData(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(encrypt.MagicLen)
+	if !encrypt.IsEncrypted(header) {
+		return br, nil
+	}
+	if dataKeys == nil {
+		return nil, EncryptedDataErr
+	}
+	return dataKeys.NewReader(br)
+}
+
+// saveMu keeps snapshots written on demand, e.g. by Reencrypt, from racing
+// with the periodic ones over the temporary file.
+var saveMu sync.Mutex
+
+// saveToDisk writes a snapshot of the data, retrying once if it fails.
+func saveToDisk(server *Server, forced bool) error {
+	saveMu.Lock()
+	err := writeSnapshotFile(server)
+	saveMu.Unlock()
+	if err != nil {
+		if forced {
+			logger.WithError(err).Error("failed to save to disk, data loss")
+			return err
+		}
+		logger.WithError(err).Warn("failed to save to disk, trying again")
+		return saveToDisk(server, true)
+	}
+	return nil
+}
+
+func writeSnapshotFile(server *Server) error {
+	if server.raft != nil {
+		return snapshotRaft(server)
+	}
+	start := time.Now()
+	compression, _ := snapshot.ParseCompression(cfg.SnapshotCompression) // checked by Validate
+	var keys, revision uint64
+	err := writeFile(cfg.DataFile(), 0644, func(w io.Writer) error {
+		return sealData(w, func(w io.Writer) (err error) {
+			keys, revision, err = server.writeSnapshot(w, compression, "")
+			return err
+		})
+	})
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(cfg.DataFile()); err == nil {
+			size = info.Size()
+		}
+	}
+	observeSnapshot(start, size, err)
+	if err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{"path": cfg.DataFile(), "keys": keys, "bytes": size, "revision": revision}).Info("saved to disk")
+	if server.log != nil {
+		// a failure here loses no data, the next snapshot tries again
+		if err := archiveSnapshot(server, revision); err != nil {
+			logger.WithError(err).Warn("failed to archive snapshot for point-in-time recovery")
+		}
+	}
+	return nil
+}
+
+// loadFromDisk restores the data from the last snapshot. A data.json written
+// by earlier versions is loaded instead if there is no snapshot yet, then
+// saved as a snapshot and renamed to data.json.migrated. It returns an error
+// satisfying os.IsNotExist if there is no data at all.
+func loadFromDisk(server *Server) error {
+	file, err := os.Open(cfg.DataFile())
+	if err == nil {
+		defer file.Close()
+		r, err := openData(file)
+		if err != nil {
+			return err
+		}
+		keys, err := server.readSnapshot(r)
+		if err == nil {
+			logger.WithFields(logrus.Fields{"path": cfg.DataFile(), "keys": keys}).Info("loaded data")
+		}
+		return err
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	legacy := cfg.LegacyDataFile()
+	b, err := ioutil.ReadFile(legacy)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, server); err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{"path": legacy, "keys": server.Data.Count()}).Info("migrating legacy data to a snapshot")
+	if err := saveToDisk(server, false); err != nil {
+		return err
+	}
+	return os.Rename(legacy, legacy+".migrated")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imjching/keev/encrypt"
+)
+
+func Test_SnapshotSaveLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-snapshot")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = dir
+	cfg.SnapshotCompression = "gzip"
+
+	s := NewServer()
+	s.Data.Set("user.ns.a", "1")
+	s.Data.Set("user.ns.b", "2")
+	s.Meta.SetExpiry("user.ns.b", 4102444800)
+	if err := saveToDisk(s, true); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+
+	loaded := NewServer()
+	if err := loadFromDisk(loaded); err != nil {
+		t.Fatalf("failed to load: %s", err.Error())
+	}
+	if v, _ := loaded.Data.Get("user.ns.a"); loaded.Data.Count() != 2 || v != "1" {
+		t.Fatalf("unexpected data loaded: %v", loaded.Data.Items())
+	}
+	if loaded.Meta.Expiry("user.ns.b") != 4102444800 || loaded.Meta.Expiry("user.ns.a") != 0 {
+		t.Fatalf("expiries not restored")
+	}
+
+	// a damaged snapshot must not load as empty data
+	ioutil.WriteFile(cfg.DataFile(), []byte("KEEVSNAP\x01\x00\x05"), 0644)
+	if err := loadFromDisk(NewServer()); err == nil || os.IsNotExist(err) {
+		t.Fatalf("expected damaged snapshot to fail to load, got %v", err)
+	}
+}
+
+func Test_SnapshotMigrateLegacy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-snapshot")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = dir
+
+	if err := loadFromDisk(NewServer()); !os.IsNotExist(err) {
+		t.Fatalf("expected no data in an empty directory, got %v", err)
+	}
+
+	legacy := NewServer()
+	legacy.Data.Set("user.ns.a", "1")
+	legacy.Meta.SetExpiry("user.ns.a", 4102444800)
+	b, _ := json.Marshal(legacy)
+	ioutil.WriteFile(filepath.Join(dir, "data.json"), b, 0644)
+
+	s := NewServer()
+	if err := loadFromDisk(s); err != nil {
+		t.Fatalf("failed to migrate: %s", err.Error())
+	}
+	if v, _ := s.Data.Get("user.ns.a"); v != "1" || s.Meta.Expiry("user.ns.a") != 4102444800 {
+		t.Fatalf("legacy data not loaded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data.json.migrated")); err != nil {
+		t.Fatalf("legacy data not renamed: %s", err.Error())
+	}
+
+	// the next start loads the snapshot
+	s = NewServer()
+	if err := loadFromDisk(s); err != nil || !s.Data.Has("user.ns.a") {
+		t.Fatalf("failed to load migrated snapshot: %v", err)
+	}
+}
+
+func Test_SnapshotEncrypted(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-snapshot")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = dir
+	defer func(k *encrypt.KeyRing) { dataKeys = k }(dataKeys)
+	dataKeys = nil
+
+	// data saved before encryption was enabled is still loaded
+	s := NewServer()
+	s.Data.Set("user.ns.a", "plaintext-value")
+	if err := saveToDisk(s, true); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+
+	keyFile := filepath.Join(dir, "keys.json")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	ioutil.WriteFile(keyFile, []byte(`{"active":"k1","keys":[{"id":"k1","key":"`+key+`"}]}`), 0600)
+	var err error
+	if dataKeys, err = encrypt.LoadKeyRing(keyFile); err != nil {
+		t.Fatalf("failed to load keys: %s", err.Error())
+	}
+	s = NewServer()
+	if err := loadFromDisk(s); err != nil || !s.Data.Has("user.ns.a") {
+		t.Fatalf("failed to load unencrypted data: %v", err)
+	}
+	if err := saveToDisk(s, true); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+	b, _ := ioutil.ReadFile(cfg.DataFile())
+	if !encrypt.IsEncrypted(b) || bytes.Contains(b, []byte("plaintext-value")) {
+		t.Fatalf("snapshot not encrypted")
+	}
+	if id, _ := encrypt.KeyID(bytes.NewReader(b)); id != "k1" {
+		t.Fatalf("expected snapshot encrypted with k1, got %q", id)
+	}
+	s = NewServer()
+	if err := loadFromDisk(s); err != nil || !s.Data.Has("user.ns.a") {
+		t.Fatalf("failed to load encrypted data: %v", err)
+	}
+
+	dataKeys = nil
+	if err := loadFromDisk(NewServer()); err != EncryptedDataErr {
+		t.Fatalf("expected encrypted data to need a key, got %v", err)
+	}
+}
+
+func Test_SnapshotReencrypt(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keev-snapshot")
+	defer os.RemoveAll(dir)
+	defer func(c *Config) { cfg = c }(cfg)
+	cfg = DefaultConfig()
+	cfg.DataDir = filepath.Join(dir, "data")
+	cfg.resolvePaths()
+	os.MkdirAll(cfg.DataDir, 0700)
+	ioutil.WriteFile(cfg.Users, []byte("{}"), 0600)
+	defer func(k *encrypt.KeyRing) { dataKeys = k }(dataKeys)
+
+	keyFile := filepath.Join(dir, "keys.json")
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	ioutil.WriteFile(keyFile, []byte(`{"active":"k1","keys":[{"id":"k1","key":"`+k1+`"}]}`), 0600)
+	var err error
+	if dataKeys, err = encrypt.LoadKeyRing(keyFile); err != nil {
+		t.Fatalf("failed to load keys: %s", err.Error())
+	}
+
+	s := NewServer()
+	if err := s.openLog(); err != nil {
+		t.Fatalf("failed to open write log: %s", err.Error())
+	}
+	s.Data.Set("user.ns.a", "1")
+	if err := saveToDisk(s, true); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+	s.Data.Set("user.ns.b", "2")
+
+	// rotate to k2, then retire k1
+	ioutil.WriteFile(keyFile, []byte(`{"active":"k2","keys":[{"id":"k1","key":"`+k1+`"},{"id":"k2","key":"`+k2+`"}]}`), 0600)
+	dataKeys.Reload(keyFile)
+	if err := reencrypt(s); err != nil {
+		t.Fatalf("failed to re-encrypt: %s", err.Error())
+	}
+	s.Data.Set("user.ns.c", "3")
+	s.log.Close()
+	ioutil.WriteFile(keyFile, []byte(`{"active":"k2","keys":[{"id":"k2","key":"`+k2+`"}]}`), 0600)
+	dataKeys.Reload(keyFile)
+
+	if restarted := loadDir(t, cfg.DataDir); restarted.Data.Count() != 3 {
+		t.Fatalf("expected the data back after a restart, got %v", restarted.Data.Items())
+	}
+	if _, err := recoverData("2", filepath.Join(dir, "recovered")); err != nil {
+		t.Fatalf("failed to recover: %s", err.Error())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imjching/keev/conflict"
+	"github.com/imjching/keev/hlc"
+	pb "github.com/imjching/keev/protobuf"
+)
+
+// versionStore holds the versions of the keys written at sites, see package
+// conflict. Keys written elsewhere have none, and any other change of a key
+// forgets its versions: a site records the new ones right after it.
+type versionStore struct {
+	mu   sync.RWMutex
+	keys map[string][]*pb.Version
+	// deleted is when each tombstone was written, so it can be forgotten
+	// after tombstone_ttl
+	deleted map[string]time.Time
+}
+
+func newVersionStore() *versionStore {
+	return &versionStore{keys: make(map[string][]*pb.Version), deleted: make(map[string]time.Time)}
+}
+
+func (v *versionStore) get(key string) []*pb.Version {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.keys[key]
+}
+
+// set replaces the versions of key, none to forget them.
+func (v *versionStore) set(key string, vs []*pb.Version) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(vs) == 0 {
+		delete(v.keys, key)
+		delete(v.deleted, key)
+		return
+	}
+	v.keys[key] = vs
+	if conflict.Deleted(vs) {
+		v.deleted[key] = hlc.Timestamp(vs[0].Hlc).Time()
+	} else {
+		delete(v.deleted, key)
+	}
+}
+
+// forget forgets the versions of key, if it has any.
+func (v *versionStore) forget(key string) {
+	v.mu.RLock()
+	_, ok := v.keys[key]
+	v.mu.RUnlock()
+	if ok {
+		v.set(key, nil)
+	}
+}
+
+// clear forgets every version.
+func (v *versionStore) clear() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys = make(map[string][]*pb.Version)
+	v.deleted = make(map[string]time.Time)
+}
+
+// tombstones returns every tombstone, as snapshot entries.
+func (v *versionStore) tombstones() []*pb.SnapshotEntry {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	entries := make([]*pb.SnapshotEntry, 0, len(v.deleted))
+	for key := range v.deleted {
+		entries = append(entries, &pb.SnapshotEntry{Key: key, Versions: v.keys[key]})
+	}
+	return entries
+}
+
+// deletedBefore returns the keys of the tombstones written before t.
+func (v *versionStore) deletedBefore(t time.Time) []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var keys []string
+	for key, at := range v.deleted {
+		if at.Before(t) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// latest returns the latest hybrid logical clock timestamp of a version.
+func (v *versionStore) latest() uint64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var latest uint64
+	for _, vs := range v.keys {
+		for _, version := range vs {
+			if version.Hlc > latest {
+				latest = version.Hlc
+			}
+		}
+	}
+	return latest
+}
+
+// setVersions replaces the versions of key and logs them, after the change
+// of the data they go with.
+func (s *Server) setVersions(key string, vs []*pb.Version) {
+	s.versions.set(key, vs)
+	s.record(&pb.LogEntry{Op: pb.LogOp_VERSIONS, Key: key, Versions: vs})
+}
+
+// siblings returns the values of key kept besides the one served, written
+// concurrently at other sites.
+func (s *Server) siblings(key string) []*pb.Sibling {
+	var siblings []*pb.Sibling
+	for _, v := range conflict.Siblings(s.versions.get(key)) {
+		siblings = append(siblings, &pb.Sibling{Value: v.Value, Site: v.Site, Hlc: v.Hlc})
+	}
+	return siblings
+}
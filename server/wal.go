@@ -0,0 +1,286 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/imjching/keev/protobuf"
+	"github.com/imjching/keev/wal"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logCipher returns the cipher of the write log, and of the Raft log, nil if
+// encryption at rest is disabled.
+func logCipher() wal.Cipher {
+	if dataKeys == nil {
+		return nil // not a nil *KeyRing, the log would try to use it
+	}
+	return dataKeys
+}
+
+// logChange is the hook of the data, writing every change to the write log
+// once it is open, and sending it to the replicas of a primary.
+func (s *Server) logChange(key string, value interface{}, deleted bool) {
+	if s.log == nil && s.feed == nil {
+		return
+	}
+	e := &pb.LogEntry{Op: pb.LogOp_SET, Key: key}
+	if deleted {
+		e.Op = pb.LogOp_DELETE
+	} else {
+		e.Value = value.(string)
+	}
+	s.record(e)
+}
+
+// record writes a change to the write log, through the feed of a primary.
+func (s *Server) record(e *pb.LogEntry) {
+	if s.feed != nil {
+		s.publish(e)
+	} else if s.log != nil {
+		s.appendLog(e)
+	}
+}
+
+// appendLog writes e to the write log, and returns the error it logs. A
+// change that cannot be logged is still applied, it is only missing from
+// point-in-time recovery until the next snapshot.
+func (s *Server) appendLog(e *pb.LogEntry) error {
+	_, err := s.log.Append(e)
+	if err == nil && cfg.WALSyncInterval == 0 {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		walFailures.Inc()
+		logger.WithError(err).WithField("key", e.Key).Error("failed to write to the write log")
+	}
+	return err
+}
+
+// setExpiry sets the expiry of key, logging it if it changed. The expiry is
+// applied before it is logged, so a snapshot holds every expiry logged up to
+// its revision.
+func (s *Server) setExpiry(key string, expires int64) {
+	if s.Meta.Expiry(key) == expires {
+		return
+	}
+	s.Meta.SetExpiry(key, expires)
+	s.record(&pb.LogEntry{Op: pb.LogOp_EXPIRE, Key: key, Expires: expires})
+}
+
+// revision returns the revision of the last change to the data, in a
+// cluster the index of the last Raft entry applied and on a replica the
+// revision of the last change of the primary applied.
+func (s *Server) revision() uint64 {
+	if s.raft != nil || s.replica != nil {
+		return atomic.LoadUint64(&s.applied)
+	}
+	if s.feed != nil {
+		return s.feed.revision()
+	}
+	if s.log != nil {
+		return s.log.Revision()
+	}
+	return s.baseRevision
+}
+
+// applyLogEntry replays a change from the write log.
+func (s *Server) applyLogEntry(e *pb.LogEntry) {
+	switch e.Op {
+	case pb.LogOp_SET:
+		s.Data.Set(e.Key, e.Value)
+		s.versions.forget(e.Key)
+	case pb.LogOp_DELETE:
+		s.Data.Remove(e.Key)
+		s.Meta.Remove(e.Key)
+		s.versions.forget(e.Key)
+	case pb.LogOp_EXPIRE:
+		s.Meta.SetExpiry(e.Key, e.Expires)
+	case pb.LogOp_VERSIONS:
+		s.versions.set(e.Key, e.Versions)
+	}
+}
+
+// openLog opens the write log and replays the changes made after the
+// snapshot that was loaded, from then on every change is logged.
+func (s *Server) openLog() error {
+	l, err := wal.Open(cfg.WALDir, logCipher())
+	if err != nil {
+		return err
+	}
+	fields := logrus.Fields{"path": cfg.WALDir, "snapshot": s.baseRevision, "log": l.Revision()}
+	replayed := 0
+	if l.Revision() < s.baseRevision {
+		// the log was removed or lost the changes the snapshot holds
+		logger.WithFields(fields).Warn("write log is behind the snapshot, starting a new one")
+		err = l.Reset(s.baseRevision)
+	} else {
+		err = wal.Replay(cfg.WALDir, logCipher(), s.baseRevision+1, func(e *pb.LogEntry) error {
+			s.applyLogEntry(e)
+			replayed++
+			return nil
+		})
+	}
+	if err != nil {
+		l.Close()
+		return err
+	}
+	if replayed > 0 {
+		fields["replayed"] = replayed
+		logger.WithFields(fields).Info("replayed write log")
+	}
+	s.log = l
+	return nil
+}
+
+// syncLog flushes the write log to disk, called every --wal-sync-interval.
+func (s *Server) syncLog() {
+	if err := s.log.Sync(); err != nil {
+		walFailures.Inc()
+		logger.WithError(err).Error("failed to sync the write log")
+	}
+}
+
+// archive is a snapshot kept for point-in-time recovery.
+type archive struct {
+	path     string
+	revision uint64
+	saved    time.Time
+}
+
+// listArchives returns the snapshots kept in dir, oldest first.
+func listArchives(dir string) ([]archive, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if err != nil {
+		return nil, err
+	}
+	var archives []archive
+	for _, file := range files {
+		revision, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), ".snap"), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, archive{file, revision, info.ModTime()})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].revision < archives[j].revision })
+	return archives, nil
+}
+
+// linkOrCopy makes dst a hard link to src, or a copy where links are not
+// supported. data.snap is replaced rather than rewritten, so the link keeps
+// the snapshot as it is now.
+func linkOrCopy(src, dst string) error {
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, 0600, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// archiveSnapshot keeps the snapshot just saved at revision if the last one
+// kept is older than --archive-interval. It then removes the snapshots older
+// than --recovery-window, except the newest of them which recovery to the
+// start of the window begins from, and the log segments they alone needed.
+func archiveSnapshot(server *Server, revision uint64) error {
+	dir := cfg.ArchiveDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	archives, err := listArchives(dir)
+	if err != nil {
+		return err
+	}
+	n := len(archives)
+	if n == 0 || (archives[n-1].revision != revision && time.Since(archives[n-1].saved) >= time.Duration(cfg.ArchiveInterval)) {
+		path := filepath.Join(dir, strconv.FormatUint(revision, 10)+".snap")
+		if err := linkOrCopy(cfg.DataFile(), path); err != nil {
+			return err
+		}
+		archives = append(archives, archive{path, revision, time.Now()})
+		logger.WithFields(logrus.Fields{"path": path, "revision": revision}).Info("archived snapshot")
+	}
+
+	cutoff := time.Now().Add(-time.Duration(cfg.RecoveryWindow))
+	keep := 0
+	for i, a := range archives {
+		if a.saved.Before(cutoff) {
+			keep = i
+		}
+	}
+	for _, a := range archives[:keep] {
+		if err := os.Remove(a.path); err != nil {
+			return err
+		}
+	}
+	pruned, err := server.log.Prune(archives[keep].revision + 1)
+	if pruned > 0 || keep > 0 {
+		logger.WithFields(logrus.Fields{"snapshots": keep, "segments": pruned}).Info("removed data older than the recovery window")
+	}
+	return err
+}
+
+// reencrypt rewrites the data on disk with the active key: a snapshot, which
+// also compacts the Raft log of a cluster, then the write log and the
+// snapshots kept for point-in-time recovery. The keys they were encrypted
+// with can then be removed.
+func reencrypt(server *Server) error {
+	if err := saveToDisk(server, false); err != nil {
+		return err
+	}
+	if server.log == nil {
+		return nil
+	}
+	if err := server.log.Reseal(); err != nil {
+		return err
+	}
+	// keeps the snapshots from being archived or removed meanwhile
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	archives, err := listArchives(cfg.ArchiveDir())
+	if err != nil {
+		return err
+	}
+	for _, a := range archives {
+		if err := resealSnapshot(a.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resealSnapshot rewrites the snapshot at path with the active key.
+func resealSnapshot(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := openData(in)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, 0600, func(w io.Writer) error {
+		return sealData(w, func(w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		})
+	})
+}
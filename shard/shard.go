@@ -0,0 +1,189 @@
+// Package shard spreads the keys of the store over several servers with
+// consistent hashing.
+//
+// Every server is placed on a ring at Points positions hashed from its ID,
+// and owns the keys whose hash falls in the range ending at each of them.
+// Adding or removing a server only moves the keys of the ranges it takes or
+// gives back, about 1/n of the keys, and only between it and the others.
+package shard
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	pb "github.com/imjching/keev/protobuf"
+)
+
+// Points is the number of positions of every server on the ring, which
+// evens out the share of the keys each of them owns.
+const Points = 128
+
+var (
+	ErrNodeExists  = errors.New("shard: node already in the map")
+	ErrUnknownNode = errors.New("shard: node not in the map")
+	ErrLastNode    = errors.New("shard: cannot remove the last node")
+)
+
+// Node is a server holding a shard of the keys.
+type Node struct {
+	ID   string
+	Addr string
+}
+
+// Map places every key on a node. It is immutable, a change returns the next
+// version of the map.
+type Map struct {
+	Version uint64
+	Nodes   []Node // sorted by ID
+	ring    []point
+}
+
+// point is a position of a node on the ring.
+type point struct {
+	hash uint32
+	node int // index in Nodes
+}
+
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
+
+// New returns the map placing the keys on nodes.
+func New(version uint64, nodes []Node) *Map {
+	m := &Map{Version: version, Nodes: append([]Node(nil), nodes...)}
+	sort.Slice(m.Nodes, func(i, j int) bool { return m.Nodes[i].ID < m.Nodes[j].ID })
+	m.ring = make([]point, 0, len(m.Nodes)*Points)
+	for i, n := range m.Nodes {
+		for j := 0; j < Points; j++ {
+			m.ring = append(m.ring, point{hash(strconv.Itoa(j) + "-" + n.ID), i})
+		}
+	}
+	// nodes sharing a position are ordered by ID, so every map agrees
+	sort.Slice(m.ring, func(i, j int) bool {
+		a, b := m.ring[i], m.ring[j]
+		return a.hash < b.hash || (a.hash == b.hash && a.node < b.node)
+	})
+	return m
+}
+
+// owner returns the index of the node owning hash h.
+func (m *Map) owner(h uint32) int {
+	i := sort.Search(len(m.ring), func(i int) bool { return m.ring[i].hash >= h })
+	if i == len(m.ring) {
+		i = 0 // past the last position, the ring wraps around
+	}
+	return m.ring[i].node
+}
+
+// Owner returns the node holding key, false if the map has no nodes.
+func (m *Map) Owner(key string) (Node, bool) {
+	if len(m.ring) == 0 {
+		return Node{}, false
+	}
+	return m.Nodes[m.owner(hash(key))], true
+}
+
+// Node returns the node with the given ID.
+func (m *Map) Node(id string) (Node, bool) {
+	for _, n := range m.Nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// Add returns the next version of the map, with n.
+func (m *Map) Add(n Node) (*Map, error) {
+	if _, ok := m.Node(n.ID); ok {
+		return nil, ErrNodeExists
+	}
+	return New(m.Version+1, append(append([]Node(nil), m.Nodes...), n)), nil
+}
+
+// Remove returns the next version of the map, without the node with the
+// given ID.
+func (m *Map) Remove(id string) (*Map, error) {
+	var nodes []Node
+	for _, n := range m.Nodes {
+		if n.ID != id {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == len(m.Nodes) {
+		return nil, ErrUnknownNode
+	}
+	if len(nodes) == 0 {
+		return nil, ErrLastNode
+	}
+	return New(m.Version+1, nodes), nil
+}
+
+// Equal returns true if a and b are the same version with the same nodes.
+func Equal(a, b *Map) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Version != b.Version || len(a.Nodes) != len(b.Nodes) {
+		return false
+	}
+	for i := range a.Nodes {
+		if a.Nodes[i] != b.Nodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Sources returns the IDs of the nodes that own keys in from which to gives
+// to the node with the given ID, sorted.
+func Sources(from, to *Map, id string) []string {
+	if from == nil || len(from.ring) == 0 || len(to.ring) == 0 {
+		return nil
+	}
+	// between two positions of either map, the keys have the same owner in
+	// both, that of the keys at the second position
+	sources := make(map[string]bool)
+	for _, m := range []*Map{from, to} {
+		for _, p := range m.ring {
+			if to.Nodes[to.owner(p.hash)].ID != id {
+				continue
+			}
+			if n := from.Nodes[from.owner(p.hash)]; n.ID != id {
+				sources[n.ID] = true
+			}
+		}
+	}
+	ids := make([]string, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// FromProto returns the map m describes, nil if it has no version.
+func FromProto(m *pb.ShardMap) *Map {
+	if m == nil || m.Version == 0 {
+		return nil
+	}
+	nodes := make([]Node, len(m.Nodes))
+	for i, n := range m.Nodes {
+		nodes[i] = Node{ID: n.Id, Addr: n.Addr}
+	}
+	return New(m.Version, nodes)
+}
+
+// Proto returns the message describing m, an empty one if m is nil.
+func (m *Map) Proto() *pb.ShardMap {
+	if m == nil {
+		return &pb.ShardMap{}
+	}
+	resp := &pb.ShardMap{Version: m.Version}
+	for _, n := range m.Nodes {
+		resp.Nodes = append(resp.Nodes, &pb.ShardNode{Id: n.ID, Addr: n.Addr})
+	}
+	return resp
+}
@@ -0,0 +1,97 @@
+package shard
+
+import (
+	"strconv"
+	"testing"
+)
+
+func keys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "user.ns.key" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func Test_ShardOwner(t *testing.T) {
+	m := New(1, []Node{{"c", "c:1"}, {"a", "a:1"}, {"b", "b:1"}})
+	if m.Nodes[0].ID != "a" {
+		t.Fatalf("expected the nodes sorted by ID, got %v", m.Nodes)
+	}
+	// the same nodes give the same owners, whatever their order
+	other := New(1, []Node{{"b", "b:1"}, {"c", "c:1"}, {"a", "a:1"}})
+	counts := make(map[string]int)
+	for _, key := range keys(30000) {
+		n, ok := m.Owner(key)
+		if o, _ := other.Owner(key); !ok || n != o {
+			t.Fatalf("owners of %q differ: %v and %v", key, n, o)
+		}
+		counts[n.ID]++
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if counts[id] < 7000 || counts[id] > 13000 {
+			t.Fatalf("keys spread unevenly: %v", counts)
+		}
+	}
+	if _, ok := New(1, nil).Owner("user.ns.key"); ok {
+		t.Fatalf("expected no owner in an empty map")
+	}
+}
+
+func Test_ShardChanges(t *testing.T) {
+	m := New(1, []Node{{"a", "a:1"}, {"b", "b:1"}, {"c", "c:1"}})
+	if _, err := m.Add(Node{"a", "x:1"}); err != ErrNodeExists {
+		t.Fatalf("expected ErrNodeExists, got %v", err)
+	}
+	added, err := m.Add(Node{"d", "d:1"})
+	if err != nil || added.Version != 2 {
+		t.Fatalf("failed to add a node: %v", err)
+	}
+	// only the keys the new node takes move
+	moved := 0
+	for _, key := range keys(20000) {
+		before, _ := m.Owner(key)
+		after, _ := added.Owner(key)
+		if before != after {
+			if after.ID != "d" {
+				t.Fatalf("%q moved from %s to %s", key, before.ID, after.ID)
+			}
+			moved++
+		}
+	}
+	if moved < 3000 || moved > 7000 {
+		t.Fatalf("expected about a quarter of the keys to move, %d did", moved)
+	}
+	if s := Sources(m, added, "d"); len(s) != 3 {
+		t.Fatalf("expected every node to give keys to d, got %v", s)
+	}
+	if s := Sources(m, added, "a"); len(s) != 0 {
+		t.Fatalf("expected a to take no keys, got %v", s)
+	}
+
+	removed, err := added.Remove("b")
+	if err != nil || removed.Version != 3 {
+		t.Fatalf("failed to remove a node: %v", err)
+	}
+	for _, id := range []string{"a", "c", "d"} {
+		if s := Sources(added, removed, id); len(s) != 1 || s[0] != "b" {
+			t.Fatalf("expected %s to take keys from b only, got %v", id, s)
+		}
+	}
+	if _, err := removed.Remove("b"); err != ErrUnknownNode {
+		t.Fatalf("expected ErrUnknownNode, got %v", err)
+	}
+	if _, err := New(1, []Node{{"a", "a:1"}}).Remove("a"); err != ErrLastNode {
+		t.Fatalf("expected ErrLastNode, got %v", err)
+	}
+}
+
+func Test_ShardProto(t *testing.T) {
+	m := New(4, []Node{{"a", "a:1"}, {"b", "b:1"}})
+	if !Equal(FromProto(m.Proto()), m) || Equal(m, New(4, []Node{{"a", "a:2"}, {"b", "b:1"}})) {
+		t.Fatalf("map changed through its message")
+	}
+	if FromProto((*Map)(nil).Proto()) != nil {
+		t.Fatalf("expected no map")
+	}
+}
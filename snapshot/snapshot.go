@@ -0,0 +1,284 @@
+// Package snapshot reads and writes the binary snapshot format of the store.
+//
+// A snapshot starts with an 8 byte magic, a version byte, a compression byte
+// and a SnapshotHeader record, which version 1 snapshots do not have. The
+// rest of the file, compressed if requested, is a sequence of records, each a
+// uvarint length followed by a protobuf SnapshotEntry. The records end with a
+// zero length, the number of records and a CRC-32 of the header and every
+// record, so a truncated or damaged snapshot is detected instead of loading
+// partially. Entries are written and read one at a time,
+// neither side holds the whole snapshot in memory.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/imjching/keev/protobuf"
+)
+
+const (
+	magic   = "KEEVSNAP"
+	version = 2
+	// maxRecord guards against allocating a huge buffer for a damaged length.
+	maxRecord = 1 << 30
+)
+
+// Compression is the algorithm the records of a snapshot are compressed with.
+type Compression byte
+
+const (
+	None Compression = iota
+	Gzip
+)
+
+var compressionNames = map[Compression]string{None: "none", Gzip: "gzip"}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("compression(%d)", byte(c))
+}
+
+// ParseCompression returns the compression called name: none or gzip.
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return None, fmt.Errorf("unknown compression %q, expected none or gzip", name)
+}
+
+var (
+	// ErrFormat is returned when a file is not a snapshot.
+	ErrFormat = errors.New("snapshot: not a snapshot file")
+	// ErrCorrupt is returned when a snapshot is truncated or damaged.
+	ErrCorrupt = errors.New("snapshot: corrupt snapshot")
+)
+
+// Writer writes entries to a snapshot.
+type Writer struct {
+	buf   *bufio.Writer
+	gz    *gzip.Writer // nil if not compressed
+	crc   hash.Hash32
+	count uint64
+	len   [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes the snapshot header to w and returns a Writer for its
+// entries. The snapshot is only complete once Close returns.
+func NewWriter(w io.Writer, c Compression, h *pb.SnapshotHeader) (*Writer, error) {
+	if _, ok := compressionNames[c]; !ok {
+		return nil, fmt.Errorf("snapshot: unknown %s", c)
+	}
+	b, err := proto.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(magic), version, byte(c))
+	header = append(header, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(header[len(magic)+2:], uint64(len(b)))
+	header = append(header[:len(magic)+2+n], b...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	sw := &Writer{crc: crc32.NewIEEE()}
+	sw.crc.Write(header[len(magic)+2:])
+	if c == Gzip {
+		sw.gz, _ = gzip.NewWriterLevel(w, gzip.BestSpeed) // the level is valid
+		w = sw.gz
+	}
+	sw.buf = bufio.NewWriter(w)
+	return sw, nil
+}
+
+// Write appends an entry to the snapshot.
+func (w *Writer) Write(e *pb.SnapshotEntry) error {
+	if e.Key == "" {
+		return errors.New("snapshot: entry without a key")
+	}
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	n := binary.PutUvarint(w.len[:], uint64(len(b)))
+	w.crc.Write(w.len[:n])
+	w.crc.Write(b)
+	if _, err := w.buf.Write(w.len[:n]); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(b); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Count returns the number of entries written so far.
+func (w *Writer) Count() uint64 {
+	return w.count
+}
+
+// Close ends the snapshot and flushes it, it does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	var trailer [13]byte // end of records, count and checksum
+	binary.BigEndian.PutUint64(trailer[1:9], w.count)
+	binary.BigEndian.PutUint32(trailer[9:], w.crc.Sum32())
+	if _, err := w.buf.Write(trailer[:]); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// Reader reads the entries of a snapshot.
+type Reader struct {
+	buf         *bufio.Reader
+	crc         hash.Hash32
+	count       uint64
+	compression Compression
+	header      *pb.SnapshotHeader
+	done        bool
+}
+
+// NewReader reads the snapshot header from r and returns a Reader for its
+// entries. It returns ErrFormat if r is not a snapshot.
+func NewReader(r io.Reader) (*Reader, error) {
+	var header [len(magic) + 2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	v := header[len(magic)]
+	if v != 1 && v != version {
+		return nil, fmt.Errorf("snapshot: unsupported version %d", v)
+	}
+	sr := &Reader{
+		crc:         crc32.NewIEEE(),
+		compression: Compression(header[len(magic)+1]),
+		header:      &pb.SnapshotHeader{},
+	}
+	if v >= 2 {
+		br := bufio.NewReader(r)
+		b, err := sr.record(br)
+		if err != nil {
+			return nil, err
+		}
+		if err := proto.Unmarshal(b, sr.header); err != nil {
+			return nil, ErrCorrupt
+		}
+		r = br
+	}
+	switch sr.compression {
+	case None:
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		r = gz
+	default:
+		return nil, fmt.Errorf("snapshot: unknown %s", sr.compression)
+	}
+	sr.buf = bufio.NewReader(r)
+	return sr, nil
+}
+
+// Header returns the header of the snapshot, which is empty for version 1
+// snapshots.
+func (r *Reader) Header() *pb.SnapshotHeader {
+	return r.header
+}
+
+// record reads a length-prefixed record, adding it to the checksum.
+func (r *Reader) record(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, corrupt(err)
+	}
+	if n > maxRecord {
+		return nil, ErrCorrupt
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, corrupt(err)
+	}
+	var length [binary.MaxVarintLen64]byte
+	r.crc.Write(length[:binary.PutUvarint(length[:], n)])
+	r.crc.Write(b)
+	return b, nil
+}
+
+// Compression returns the compression of the snapshot.
+func (r *Reader) Compression() Compression {
+	return r.compression
+}
+
+// Next returns the next entry, or io.EOF once every entry has been read and
+// the snapshot was found to be complete.
+func (r *Reader) Next() (*pb.SnapshotEntry, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	if b, err := r.buf.Peek(1); err == nil && b[0] == 0 {
+		r.buf.ReadByte()
+		return nil, r.end()
+	}
+	b, err := r.record(r.buf)
+	if err != nil {
+		return nil, err
+	}
+	e := &pb.SnapshotEntry{}
+	if err := proto.Unmarshal(b, e); err != nil || e.Key == "" {
+		return nil, ErrCorrupt
+	}
+	r.count++
+	return e, nil
+}
+
+// end checks the trailer against the records read.
+func (r *Reader) end() error {
+	var trailer [12]byte
+	if _, err := io.ReadFull(r.buf, trailer[:]); err != nil {
+		return corrupt(err)
+	}
+	if binary.BigEndian.Uint64(trailer[:8]) != r.count || binary.BigEndian.Uint32(trailer[8:]) != r.crc.Sum32() {
+		return ErrCorrupt
+	}
+	// nothing may follow, reading to the end also checks the gzip footer
+	if _, err := r.buf.ReadByte(); err == nil {
+		return ErrCorrupt
+	} else if err != io.EOF {
+		return corrupt(err)
+	}
+	r.done = true
+	return io.EOF
+}
+
+// corrupt reports running out of data as a corrupt snapshot.
+func corrupt(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	pb "github.com/imjching/keev/protobuf"
+)
+
+func writeSnapshot(t *testing.T, c Compression, n int) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, c, &pb.SnapshotHeader{Revision: uint64(n), Created: 1e18})
+	if err != nil {
+		t.Fatalf("failed to create writer: %s", err.Error())
+	}
+	for i := 0; i < n; i++ {
+		e := &pb.SnapshotEntry{Key: fmt.Sprintf("user.ns.key%d", i), Value: fmt.Sprint(i), Expires: int64(i % 2)}
+		if err := w.Write(e); err != nil {
+			t.Fatalf("failed to write entry: %s", err.Error())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func readSnapshot(b []byte) ([]*pb.SnapshotEntry, error) {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if h := r.Header(); h.Created != 1e18 {
+		return nil, fmt.Errorf("unexpected header %v", h)
+	}
+	var entries []*pb.SnapshotEntry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func Test_SnapshotRoundTrip(t *testing.T) {
+	for _, c := range []Compression{None, Gzip} {
+		for _, n := range []int{0, 1, 1000} {
+			entries, err := readSnapshot(writeSnapshot(t, c, n))
+			if err != nil {
+				t.Fatalf("%s, %d entries: failed to read: %s", c, n, err.Error())
+			}
+			if len(entries) != n {
+				t.Fatalf("%s: expected %d entries, got %d", c, n, len(entries))
+			}
+			for i, e := range entries {
+				if e.Key != fmt.Sprintf("user.ns.key%d", i) || e.Value != fmt.Sprint(i) || e.Expires != int64(i%2) {
+					t.Fatalf("%s: unexpected entry %d: %v", c, i, e)
+				}
+			}
+		}
+	}
+}
+
+func Test_SnapshotVersion1(t *testing.T) {
+	// an empty snapshot written before snapshots had a header
+	b := append([]byte(magic+"\x01\x00\x00"), make([]byte, 12)...)
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to read version 1 snapshot: %s", err.Error())
+	}
+	if _, err := r.Next(); err != io.EOF || r.Header().Revision != 0 {
+		t.Fatalf("expected an empty version 1 snapshot, got %v", err)
+	}
+}
+
+func Test_SnapshotCompression(t *testing.T) {
+	plain, compressed := writeSnapshot(t, None, 1000), writeSnapshot(t, Gzip, 1000)
+	if len(compressed) >= len(plain) {
+		t.Fatalf("expected gzip to shrink the snapshot, got %d bytes from %d", len(compressed), len(plain))
+	}
+	if c, err := ParseCompression("gzip"); err != nil || c != Gzip {
+		t.Fatalf("failed to parse gzip: %v", err)
+	}
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Fatalf("expected unknown compression to be rejected")
+	}
+}
+
+func Test_SnapshotCorrupt(t *testing.T) {
+	if _, err := readSnapshot([]byte(`{"data":{}}`)); err != ErrFormat {
+		t.Fatalf("expected JSON to be rejected with ErrFormat, got %v", err)
+	}
+	for _, c := range []Compression{None, Gzip} {
+		b := writeSnapshot(t, c, 100)
+		// every truncation must be detected, not load part of the data
+		for _, n := range []int{len(b) - 1, len(b) - 13, len(b) / 2, len(magic) + 2} {
+			if _, err := readSnapshot(b[:n]); err == nil {
+				t.Fatalf("%s: snapshot truncated to %d of %d bytes was accepted", c, n, len(b))
+			}
+		}
+	}
+	b := writeSnapshot(t, None, 100)
+	b[len(b)/2] ^= 0xff
+	if _, err := readSnapshot(b); err == nil {
+		t.Fatalf("damaged snapshot was accepted")
+	}
+}
@@ -0,0 +1,491 @@
+// Package wal is the write log of the store: every change to the data, in
+// the order it was made, numbered by a revision.
+//
+// The log is split into segment files named after the revision of their
+// first entry, with 20 digits so that they sort in order. Each record is a
+// uvarint length, a flag byte telling whether it is encrypted, a protobuf
+// LogEntry, encrypted if the log has a Cipher, and a CRC-32 of the bytes
+// before it. A log written before encryption was turned on stays readable.
+// A record cut short by a crash is dropped when the log is opened. Segments
+// are removed with Prune once the snapshots that need them are gone.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/imjching/keev/protobuf"
+)
+
+// DefaultSegmentSize is the size after which a new segment is started.
+const DefaultSegmentSize = 64 << 20
+
+// Record flags.
+const (
+	plain  = 0
+	sealed = 1
+)
+
+// maxRecord guards against allocating a huge buffer for a damaged length.
+const maxRecord = 1 << 30
+
+var (
+	// ErrCorrupt is returned when a segment other than the last one is
+	// damaged, or revisions are missing between segments.
+	ErrCorrupt = errors.New("wal: corrupt write log")
+	// ErrTruncated is returned by Replay when the log no longer holds the
+	// first revision asked for.
+	ErrTruncated = errors.New("wal: revisions were pruned from the write log")
+	// ErrEncrypted is returned when an encrypted record is read without a
+	// Cipher.
+	ErrEncrypted = errors.New("wal: write log is encrypted")
+	// errTorn marks the end of the valid records of a segment.
+	errTorn = errors.New("wal: torn record")
+)
+
+// Cipher encrypts records, see encrypt.KeyRing.
+type Cipher interface {
+	Seal(plain []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+type segment struct {
+	first uint64 // revision of its first entry
+	size  int64
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%020d.log", first)
+}
+
+// segments lists the segments in dir, oldest first.
+func segments(dir string) ([]segment, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	var segs []segment
+	for _, file := range files {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, segment{first, info.Size()})
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].first < segs[j].first })
+	return segs, nil
+}
+
+// readSegment calls fn for every record of a segment. It returns the offset
+// after the last valid record and errTorn if invalid data follows it.
+func readSegment(path string, c Cipher, fn func(e *pb.LogEntry) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		length, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil || length > maxRecord {
+			return offset, errTorn
+		}
+		var prefix [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(prefix[:], length)
+		record := make([]byte, int(length)+4)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return offset, errTorn
+		}
+		b := record[:length]
+		crc := crc32.NewIEEE()
+		crc.Write(prefix[:n])
+		crc.Write(b)
+		if length == 0 || crc.Sum32() != binary.BigEndian.Uint32(record[length:]) {
+			return offset, errTorn
+		}
+		switch b, err = b[1:], nil; record[0] {
+		case plain:
+		case sealed:
+			if c == nil {
+				return offset, ErrEncrypted
+			}
+			b, err = c.Open(b)
+		default:
+			err = ErrCorrupt
+		}
+		if err != nil {
+			return offset, err
+		}
+		e := &pb.LogEntry{}
+		if err := proto.Unmarshal(b, e); err != nil {
+			return offset, ErrCorrupt
+		}
+		if err := fn(e); err != nil {
+			return offset, err
+		}
+		offset += int64(n) + int64(len(record))
+	}
+}
+
+// Log appends entries to the segments in a directory. It is safe for
+// concurrent use.
+type Log struct {
+	// SegmentSize is the size in bytes after which a new segment is started.
+	SegmentSize int64
+
+	mu       sync.Mutex
+	dir      string
+	cipher   Cipher
+	file     *os.File
+	buf      *bufio.Writer
+	closed   []segment // every segment but the current one
+	current  segment
+	last     uint64 // revision of the last entry
+	unsynced bool
+}
+
+// Open opens the log in dir, creating it if needed, and continues after the
+// last entry written. Records cut short by a crash are removed. c may be nil
+// to write records in plaintext.
+func Open(dir string, c Cipher) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{SegmentSize: DefaultSegmentSize, dir: dir, cipher: c}
+	if len(segs) == 0 {
+		return l, l.create(1)
+	}
+	l.closed, l.current = segs[:len(segs)-1], segs[len(segs)-1]
+	l.last = l.current.first - 1
+	path := filepath.Join(dir, segmentName(l.current.first))
+	size, err := readSegment(path, c, func(e *pb.LogEntry) error {
+		if e.Revision != l.last+1 {
+			return ErrCorrupt
+		}
+		l.last = e.Revision
+		return nil
+	})
+	if err != nil && err != errTorn {
+		return nil, err
+	}
+	l.file, err = os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if size != l.current.size {
+		// drop the torn record, it was never acknowledged
+		if err := l.file.Truncate(size); err != nil {
+			l.file.Close()
+			return nil, err
+		}
+		l.current.size = size
+	}
+	if _, err := l.file.Seek(size, io.SeekStart); err != nil {
+		l.file.Close()
+		return nil, err
+	}
+	l.buf = bufio.NewWriter(l.file)
+	return l, nil
+}
+
+// create starts a new segment whose first entry will be revision first.
+func (l *Log) create(first uint64) error {
+	file, err := os.OpenFile(filepath.Join(l.dir, segmentName(first)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if dir, err := os.Open(l.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	l.file, l.buf = file, bufio.NewWriter(file)
+	l.current = segment{first: first}
+	return nil
+}
+
+// rotate closes the current segment and starts the next one.
+func (l *Log) rotate() error {
+	if err := l.closeFile(); err != nil {
+		return err
+	}
+	l.closed = append(l.closed, l.current)
+	return l.create(l.last + 1)
+}
+
+func (l *Log) closeFile() error {
+	err := l.buf.Flush()
+	if serr := l.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.unsynced = false
+	return err
+}
+
+// Append gives e the next revision, stamps it with the current time unless
+// it has one and writes it to the operating system, which keeps it if the
+// process crashes. Call Sync to keep it if the machine crashes.
+func (l *Log) Append(e *pb.LogEntry) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Revision = l.last + 1
+	if e.Time == 0 {
+		e.Time = time.Now().UnixNano()
+	}
+	record, err := l.encode(e)
+	if err != nil {
+		return 0, err
+	}
+	if l.current.size > 0 && l.current.size+int64(len(record)) > l.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := l.buf.Write(record); err != nil {
+		return 0, err
+	}
+	if err := l.buf.Flush(); err != nil {
+		return 0, err
+	}
+	l.current.size += int64(len(record))
+	l.last = e.Revision
+	l.unsynced = true
+	return e.Revision, nil
+}
+
+// encode returns the record of e, sealed if the log has a Cipher.
+func (l *Log) encode(e *pb.LogEntry) ([]byte, error) {
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	flag := byte(plain)
+	if l.cipher != nil {
+		if b, err = l.cipher.Seal(b); err != nil {
+			return nil, err
+		}
+		flag = sealed
+	}
+	record := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+1+len(b)+4)
+	record = append(record[:binary.PutUvarint(record, uint64(1+len(b)))], flag)
+	record = append(record, b...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(record))
+	return append(record, crc[:]...), nil
+}
+
+// Reseal rewrites every segment with the Cipher of the log, so that records
+// sealed with a key it no longer uses can be read once that key is retired.
+// Appends wait until it is done.
+func (l *Log) Reseal() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.buf.Flush(); err != nil {
+		return err
+	}
+	for i := range l.closed {
+		size, err := l.reseal(l.closed[i].first)
+		if err != nil {
+			return err
+		}
+		l.closed[i].size = size
+	}
+	size, err := l.reseal(l.current.first)
+	if err != nil {
+		return err
+	}
+	// the segment appended to was replaced
+	l.file.Close()
+	l.file, err = os.OpenFile(filepath.Join(l.dir, segmentName(l.current.first)), os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = l.file.Seek(size, io.SeekStart)
+	}
+	l.buf = bufio.NewWriter(l.file)
+	l.current.size, l.unsynced = size, false
+	return err
+}
+
+// reseal rewrites the segment starting at first through a temporary file and
+// returns its new size.
+func (l *Log) reseal(first uint64) (int64, error) {
+	path := filepath.Join(l.dir, segmentName(first))
+	tmp, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(tmp)
+	var size int64
+	_, err = readSegment(path, l.cipher, func(e *pb.LogEntry) error {
+		record, err := l.encode(e)
+		if err != nil {
+			return err
+		}
+		size += int64(len(record))
+		_, err = w.Write(record)
+		return err
+	})
+	if err == errTorn {
+		err = ErrCorrupt // the log was checked when opened
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+// Sync flushes the entries appended since the last Sync to disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.unsynced {
+		return nil
+	}
+	l.unsynced = false
+	return l.file.Sync()
+}
+
+// Revision returns the revision of the last entry, 0 if there is none.
+func (l *Log) Revision() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Size returns the size in bytes of every segment.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := l.current.size
+	for _, s := range l.closed {
+		size += s.size
+	}
+	return size
+}
+
+// Reset removes every segment and continues after revision. It is used when
+// the data was loaded from a snapshot newer than the log, or to recover from
+// a failed Append.
+func (l *Log) Reset(revision uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the segment is removed, whether or not it could be flushed
+	l.closeFile()
+	for _, s := range append(l.closed, l.current) {
+		if err := os.Remove(filepath.Join(l.dir, segmentName(s.first))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	l.closed, l.last = nil, revision
+	return l.create(revision + 1)
+}
+
+// Prune removes the segments holding only revisions before revision, and
+// returns how many were removed. The current segment is never removed.
+func (l *Log) Prune(revision uint64) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for len(l.closed) > 0 {
+		next := l.current.first
+		if len(l.closed) > 1 {
+			next = l.closed[1].first
+		}
+		if next > revision {
+			break
+		}
+		if err := os.Remove(filepath.Join(l.dir, segmentName(l.closed[0].first))); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		l.closed = l.closed[1:]
+		removed++
+	}
+	return removed, nil
+}
+
+// Close flushes the log to disk and closes it.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closeFile()
+}
+
+// Replay calls fn for every entry in dir from revision from on, in order. It
+// returns ErrTruncated if the log starts after from, and stops quietly at a
+// torn record at the end of the last segment. The log may be open.
+func Replay(dir string, c Cipher, from uint64, fn func(e *pb.LogEntry) error) error {
+	segs, err := segments(dir)
+	if err != nil {
+		return err
+	}
+	if len(segs) == 0 {
+		return nil
+	}
+	if segs[0].first > from {
+		return ErrTruncated
+	}
+	next := from
+	for i, s := range segs {
+		if i+1 < len(segs) && segs[i+1].first <= from {
+			continue // only holds earlier revisions
+		}
+		if s.first > next {
+			return ErrCorrupt // revisions missing between segments
+		}
+		_, err := readSegment(filepath.Join(dir, segmentName(s.first)), c, func(e *pb.LogEntry) error {
+			if e.Revision < next {
+				return nil
+			}
+			if e.Revision != next {
+				return ErrCorrupt
+			}
+			next++
+			return fn(e)
+		})
+		if err == errTorn && i < len(segs)-1 {
+			return ErrCorrupt
+		}
+		if err != nil && err != errTorn {
+			return err
+		}
+	}
+	return nil
+}
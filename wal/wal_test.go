@@ -0,0 +1,215 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/imjching/keev/protobuf"
+)
+
+func openLog(t *testing.T, dir string) *Log {
+	l, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to open log: %s", err.Error())
+	}
+	return l
+}
+
+func appendN(t *testing.T, l *Log, n int) {
+	for i := 0; i < n; i++ {
+		if _, err := l.Append(&pb.LogEntry{Op: pb.LogOp_SET, Key: fmt.Sprintf("user.ns.key%d", i), Value: "v"}); err != nil {
+			t.Fatalf("failed to append: %s", err.Error())
+		}
+	}
+}
+
+func replay(dir string, from uint64) ([]uint64, error) {
+	var revisions []uint64
+	err := Replay(dir, nil, from, func(e *pb.LogEntry) error {
+		revisions = append(revisions, e.Revision)
+		return nil
+	})
+	return revisions, err
+}
+
+func Test_LogAppendReplay(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, dir)
+	l.SegmentSize = 200 // a few entries per segment
+	appendN(t, l, 50)
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close log: %s", err.Error())
+	}
+	if segs, _ := segments(dir); len(segs) < 5 {
+		t.Fatalf("expected the log to be split into segments, got %d", len(segs))
+	}
+
+	l = openLog(t, dir)
+	defer l.Close()
+	if l.Revision() != 50 {
+		t.Fatalf("expected revision 50 after reopening, got %d", l.Revision())
+	}
+	if rev, _ := l.Append(&pb.LogEntry{Op: pb.LogOp_DELETE, Key: "user.ns.key0"}); rev != 51 {
+		t.Fatalf("expected revision 51, got %d", rev)
+	}
+	for _, from := range []uint64{1, 23, 51, 52} {
+		revisions, err := replay(dir, from)
+		if err != nil {
+			t.Fatalf("failed to replay from %d: %s", from, err.Error())
+		}
+		if len(revisions) != int(52-from) || (len(revisions) > 0 && revisions[0] != from) {
+			t.Fatalf("replay from %d: unexpected revisions %v", from, revisions)
+		}
+	}
+}
+
+func Test_LogTornTail(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, dir)
+	appendN(t, l, 10)
+	l.Close()
+	path := filepath.Join(dir, segmentName(1))
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-3)
+
+	if revisions, err := replay(dir, 1); err != nil || len(revisions) != 9 {
+		t.Fatalf("expected the torn entry to be skipped, got %v, %v", revisions, err)
+	}
+	l = openLog(t, dir)
+	defer l.Close()
+	if l.Revision() != 9 {
+		t.Fatalf("expected the torn entry to be dropped, got revision %d", l.Revision())
+	}
+	appendN(t, l, 1)
+	if revisions, err := replay(dir, 1); err != nil || len(revisions) != 10 {
+		t.Fatalf("expected writes after the torn entry to be readable, got %v, %v", revisions, err)
+	}
+}
+
+func Test_LogPrune(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, dir)
+	defer l.Close()
+	l.SegmentSize = 200
+	appendN(t, l, 50)
+	size := l.Size()
+	if n, err := l.Prune(30); err != nil || n == 0 {
+		t.Fatalf("expected segments to be pruned, got %d, %v", n, err)
+	}
+	if l.Size() >= size {
+		t.Fatalf("expected the log to shrink")
+	}
+	if revisions, err := replay(dir, 30); err != nil || len(revisions) != 21 {
+		t.Fatalf("expected revision 30 to be kept, got %v, %v", revisions, err)
+	}
+	if _, err := replay(dir, 1); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+
+	// a snapshot newer than the log
+	if err := l.Reset(100); err != nil {
+		t.Fatalf("failed to reset: %s", err.Error())
+	}
+	if rev, _ := l.Append(&pb.LogEntry{Op: pb.LogOp_SET, Key: "user.ns.key"}); rev != 101 {
+		t.Fatalf("expected revision 101 after reset, got %d", rev)
+	}
+	if revisions, err := replay(dir, 101); err != nil || len(revisions) != 1 {
+		t.Fatalf("unexpected replay after reset: %v, %v", revisions, err)
+	}
+}
+
+// xor is a stand-in for encrypt.KeyRing.
+type xor struct{}
+
+func (xor) Seal(b []byte) ([]byte, error) { return xor{}.flip(b), nil }
+func (xor) Open(b []byte) ([]byte, error) { return xor{}.flip(b), nil }
+
+func (xor) flip(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out
+}
+
+func Test_LogCipher(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+
+	// written before encryption was turned on
+	l := openLog(t, dir)
+	appendN(t, l, 5)
+	l.Close()
+
+	l, err := Open(dir, xor{})
+	if err != nil {
+		t.Fatalf("failed to open plaintext log with a cipher: %s", err.Error())
+	}
+	appendN(t, l, 5)
+	l.Close()
+	b, _ := ioutil.ReadFile(filepath.Join(dir, segmentName(1)))
+	if n := bytes.Count(b, []byte("user.ns.key")); n != 5 {
+		t.Fatalf("expected only the first 5 entries in plaintext, found %d", n)
+	}
+
+	var keys []string
+	err = Replay(dir, xor{}, 1, func(e *pb.LogEntry) error {
+		keys = append(keys, e.Key)
+		return nil
+	})
+	if err != nil || len(keys) != 10 || keys[9] != "user.ns.key4" {
+		t.Fatalf("failed to replay mixed log: %v, %v", keys, err)
+	}
+	if _, err := replay(dir, 1); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted without a cipher, got %v", err)
+	}
+}
+
+func Test_LogReseal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, dir)
+	l.SegmentSize = 200
+	appendN(t, l, 10)
+	l.Close()
+
+	l, _ = Open(dir, xor{})
+	l.SegmentSize = 200
+	if err := l.Reseal(); err != nil {
+		t.Fatalf("failed to reseal: %s", err.Error())
+	}
+	appendN(t, l, 1)
+	l.Close()
+	segs, _ := segments(dir)
+	if len(segs) < 2 {
+		t.Fatalf("expected several segments, found %d", len(segs))
+	}
+	for _, s := range segs {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, segmentName(s.first)))
+		if bytes.Contains(b, []byte("user.ns.key")) {
+			t.Fatalf("segment %d not sealed", s.first)
+		}
+	}
+	if _, err := replay(dir, 1); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted without a cipher, got %v", err)
+	}
+	var revisions []uint64
+	err := Replay(dir, xor{}, 1, func(e *pb.LogEntry) error {
+		revisions = append(revisions, e.Revision)
+		return nil
+	})
+	if err != nil || len(revisions) != 11 || revisions[10] != 11 {
+		t.Fatalf("failed to replay resealed log: %v, %v", revisions, err)
+	}
+}